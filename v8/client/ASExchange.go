@@ -1,6 +1,8 @@
 package client
 
 import (
+	"context"
+
 	"github.com/jcmturner/gokrb5/v8/crypto"
 	"github.com/jcmturner/gokrb5/v8/crypto/etype"
 	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
@@ -13,9 +15,29 @@ import (
 
 // ASExchange performs an AS exchange for the client to retrieve a TGT.
 func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (messages.ASRep, error) {
+	return cl.ASExchangeContext(context.Background(), realm, ASReq, referral)
+}
+
+// ASExchangeContext performs an AS exchange for the client to retrieve a TGT.
+// If the context is done before the exchange completes the context's error is returned.
+func (cl *Client) ASExchangeContext(ctx context.Context, realm string, ASReq messages.ASReq, referral int) (messages.ASRep, error) {
+	ASRep, err := cl.asExchange(ctx, realm, ASReq, referral)
+	return ASRep, ctxErr(ctx, err)
+}
+
+func (cl *Client) asExchange(ctx context.Context, realm string, ASReq messages.ASReq, referral int) (messages.ASRep, error) {
 	if ok, err := cl.IsConfigured(); !ok {
 		return messages.ASRep{}, krberror.Errorf(err, krberror.ConfigError, "AS Exchange cannot be performed")
 	}
+	if (cl.settings.FASTArmor() != nil || cl.settings.RequireFAST()) && !cl.settings.DisablePAFXFAST() {
+		return cl.fastASExchange(ctx, realm, ASReq, referral)
+	}
+	if cl.settings.RequireFAST() {
+		return messages.ASRep{}, krberror.NewErrorf(krberror.ConfigError, "AS Exchange cannot be performed: FAST is required but PA_FX_FAST is disabled")
+	}
+	if cl.Credentials.HasCertificate() || cl.Credentials.Anonymous() {
+		return cl.pkinitASExchange(ctx, realm, ASReq, referral)
+	}
 
 	// Set PAData if required
 	err := setPAData(cl, nil, &ASReq)
@@ -29,7 +51,7 @@ func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (
 	}
 	var ASRep messages.ASRep
 
-	rb, err := cl.sendToKDC(b, realm)
+	rb, err := cl.sendToKDC(ctx, b, realm)
 	if err != nil {
 		if e, ok := err.(messages.KRBError); ok {
 			switch e.ErrorCode {
@@ -44,7 +66,7 @@ func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (
 				if err != nil {
 					return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ with PAData")
 				}
-				rb, err = cl.sendToKDC(b, realm)
+				rb, err = cl.sendToKDC(ctx, b, realm)
 				if err != nil {
 					if _, ok := err.(messages.KRBError); ok {
 						return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
@@ -57,7 +79,7 @@ func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (
 					return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "maximum number of client referrals exceeded")
 				}
 				referral++
-				return cl.ASExchange(e.CRealm, ASReq, referral)
+				return cl.asExchange(ctx, e.CRealm, ASReq, referral)
 			default:
 				return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
 			}
@@ -82,37 +104,9 @@ func setPAData(cl *Client, krberr *messages.KRBError, ASReq *messages.ASReq) err
 		ASReq.PAData = append(ASReq.PAData, pa)
 	}
 	if cl.settings.AssumePreAuthentication() {
-		// Identify the etype to use to encrypt the PA Data
-		var et etype.EType
-		var err error
-		var key types.EncryptionKey
-		var kvno int
-		if krberr == nil {
-			// This is not in response to an error from the KDC. It is preemptive or renewal
-			// There is no KRB Error that tells us the etype to use
-			etn := cl.settings.preAuthEType // Use the etype that may have previously been negotiated
-			if etn == 0 {
-				etn = int32(cl.Config.LibDefaults.PreferredPreauthTypes[0]) // Resort to config
-			}
-			et, err = crypto.GetEtype(etn)
-			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
-			}
-			key, kvno, err = cl.Key(et, 0, nil)
-			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
-			}
-		} else {
-			// Get the etype to use from the PA data in the KRBError e-data
-			et, err = preAuthEType(krberr)
-			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
-			}
-			cl.settings.preAuthEType = et.GetETypeID() // Set the etype that has been defined for potential future use
-			key, kvno, err = cl.Key(et, 0, krberr)
-			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
-			}
+		key, kvno, err := cl.preAuthKey(krberr)
+		if err != nil {
+			return err
 		}
 		// Generate the PA data
 		paTSb, err := types.GetPAEncTSEncAsnMarshalled()
@@ -143,6 +137,44 @@ func setPAData(cl *Client, krberr *messages.KRBError, ASReq *messages.ASReq) err
 	return nil
 }
 
+// preAuthKey returns the client's key, and its kvno, to use for pre-authentication.
+// The KRBError from the KDC requiring pre-authentication should be provided if available, otherwise pass nil.
+func (cl *Client) preAuthKey(krberr *messages.KRBError) (types.EncryptionKey, int, error) {
+	// Identify the etype to use to encrypt the PA Data
+	var et etype.EType
+	var err error
+	var key types.EncryptionKey
+	var kvno int
+	if krberr == nil {
+		// This is not in response to an error from the KDC. It is preemptive or renewal
+		// There is no KRB Error that tells us the etype to use
+		etn := cl.settings.preAuthEType // Use the etype that may have previously been negotiated
+		if etn == 0 {
+			etn = int32(cl.Config.LibDefaults.PreferredPreauthTypes[0]) // Resort to config
+		}
+		et, err = crypto.GetEtype(etn)
+		if err != nil {
+			return key, kvno, krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
+		}
+		key, kvno, err = cl.Key(et, 0, nil)
+		if err != nil {
+			return key, kvno, krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
+		}
+	} else {
+		// Get the etype to use from the PA data in the KRBError e-data
+		et, err = preAuthEType(krberr)
+		if err != nil {
+			return key, kvno, krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
+		}
+		cl.settings.preAuthEType = et.GetETypeID() // Set the etype that has been defined for potential future use
+		key, kvno, err = cl.Key(et, 0, krberr)
+		if err != nil {
+			return key, kvno, krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
+		}
+	}
+	return key, kvno, nil
+}
+
 // preAuthEType establishes what encryption type to use for pre-authentication from the KRBError returned from the KDC.
 func preAuthEType(krberr *messages.KRBError) (etype etype.EType, err error) {
 	//RFC 4120 5.2.7.5 covers the preference order of ETYPE-INFO2 and ETYPE-INFO.
@@ -1,6 +1,8 @@
 package client
 
 import (
+	"context"
+
 	"github.com/jcmturner/gokrb5/v8/iana/flags"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/krberror"
@@ -10,23 +12,48 @@ import (
 
 // TGSREQGenerateAndExchange generates the TGS_REQ and performs a TGS exchange to retrieve a ticket to the specified SPN.
 func (cl *Client) TGSREQGenerateAndExchange(spn types.PrincipalName, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, renewal bool) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
+	return cl.TGSREQGenerateAndExchangeContext(context.Background(), spn, kdcRealm, tgt, sessionKey, renewal)
+}
+
+// TGSREQGenerateAndExchangeContext generates the TGS_REQ and performs a TGS exchange to retrieve a ticket to the specified SPN.
+// If the context is done before the exchange completes the context's error is returned.
+func (cl *Client) TGSREQGenerateAndExchangeContext(ctx context.Context, spn types.PrincipalName, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, renewal bool) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
+	tgsReq, tgsRep, err = cl.tgsReqGenerateAndExchange(ctx, spn, kdcRealm, tgt, sessionKey, renewal)
+	return tgsReq, tgsRep, ctxErr(ctx, err)
+}
+
+func (cl *Client) tgsReqGenerateAndExchange(ctx context.Context, spn types.PrincipalName, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, renewal bool) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
+	if cl.fastTGS(kdcRealm) {
+		return cl.fastTGSExchange(ctx, spn, kdcRealm, tgt, sessionKey, renewal, 0)
+	}
 	tgsReq, err = messages.NewTGSReq(cl.Credentials.CName(), kdcRealm, cl.Config, tgt, sessionKey, spn, renewal)
 	if err != nil {
 		return tgsReq, tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new TGS_REQ")
 	}
-	return cl.TGSExchange(tgsReq, kdcRealm, tgsRep.Ticket, sessionKey, 0)
+	return cl.tgsExchange(ctx, tgsReq, kdcRealm, tgsRep.Ticket, sessionKey, 0)
 }
 
 // TGSExchange exchanges the provided TGS_REQ with the KDC to retrieve a TGS_REP.
 // Referrals are automatically handled.
 // The client's cache is updated with the ticket received.
 func (cl *Client) TGSExchange(tgsReq messages.TGSReq, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, referral int) (messages.TGSReq, messages.TGSRep, error) {
+	return cl.TGSExchangeContext(context.Background(), tgsReq, kdcRealm, tgt, sessionKey, referral)
+}
+
+// TGSExchangeContext exchanges the provided TGS_REQ with the KDC to retrieve a TGS_REP.
+// If the context is done before the exchange completes the context's error is returned.
+func (cl *Client) TGSExchangeContext(ctx context.Context, tgsReq messages.TGSReq, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, referral int) (messages.TGSReq, messages.TGSRep, error) {
+	tgsReq, tgsRep, err := cl.tgsExchange(ctx, tgsReq, kdcRealm, tgt, sessionKey, referral)
+	return tgsReq, tgsRep, ctxErr(ctx, err)
+}
+
+func (cl *Client) tgsExchange(ctx context.Context, tgsReq messages.TGSReq, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, referral int) (messages.TGSReq, messages.TGSRep, error) {
 	var tgsRep messages.TGSRep
 	b, err := tgsReq.Marshal()
 	if err != nil {
 		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to marshal TGS_REQ")
 	}
-	r, err := cl.sendToKDC(b, kdcRealm)
+	r, err := cl.sendToKDC(ctx, b, kdcRealm)
 	if err != nil {
 		if _, ok := err.(messages.KRBError); ok {
 			return tgsReq, tgsRep, krberror.Errorf(err, krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC when requesting for %s", tgsReq.ReqBody.SName.PrincipalNameString())
@@ -60,34 +87,123 @@ func (cl *Client) TGSExchange(tgsReq messages.TGSReq, kdcRealm string, tgt messa
 				return tgsReq, tgsRep, err
 			}
 		}
+		if cl.fastTGS(realm) {
+			return cl.fastTGSExchange(ctx, tgsReq.ReqBody.SName, realm, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, tgsReq.Renewal, referral)
+		}
 		tgsReq, err = messages.NewTGSReq(cl.Credentials.CName(), realm, cl.Config, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, tgsReq.ReqBody.SName, tgsReq.Renewal)
 		if err != nil {
 			return tgsReq, tgsRep, err
 		}
-		return cl.TGSExchange(tgsReq, realm, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, referral)
+		return cl.tgsExchange(ctx, tgsReq, realm, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, referral)
+	}
+	cl.cacheServiceTicket(tgsRep)
+	return tgsReq, tgsRep, err
+}
+
+// uncachedTGSExchange exchanges the TGS_REQ with the KDC for a ticket that is not added to the client's cache, such
+// as an S4U ticket or a forwarded TGT. The request is FAST armored as other TGS_REQs to the realm are, with a
+// sub-session key added to its authenticator. The reply key, which is the sub-session key or the TGT session key, is
+// returned with the TGS_REP. Referrals are not followed. The client name in the reply is not verified as for S4U it is
+// that of the user rather than the client.
+func (cl *Client) uncachedTGSExchange(ctx context.Context, tgsReq messages.TGSReq, realm string, tgt messages.Ticket, sessionKey types.EncryptionKey) (messages.TGSRep, types.EncryptionKey, error) {
+	tgsRep, replyKey, err := cl.sendUncachedTGSReq(ctx, tgsReq, realm, tgt, sessionKey)
+	if err != nil {
+		return tgsRep, replyKey, err
+	}
+	req := tgsReq
+	req.ReqBody.CName = tgsRep.CName
+	if ok, err := tgsRep.Verify(cl.Config, req); !ok {
+		return tgsRep, replyKey, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: TGS_REP is not valid")
+	}
+	if tgsRep.Ticket.SName.NameString[0] == "krbtgt" && !tgsRep.Ticket.SName.Equal(tgsReq.ReqBody.SName) {
+		return tgsRep, replyKey, krberror.NewErrorf(krberror.KRBMsgError, "TGS Exchange Error: KDC returned a referral to %s which is not supported for this request", tgsRep.Ticket.SName.PrincipalNameString())
+	}
+	cl.Log("ticket obtained for %s to %s (EndTime: %v)", tgsRep.CName.PrincipalNameString(), tgsRep.Ticket.SName.PrincipalNameString(), tgsRep.DecryptedEncPart.EndTime)
+	return tgsRep, replyKey, nil
+}
+
+// sendUncachedTGSReq sends the TGS_REQ for uncachedTGSExchange, armoring it if FAST is used for the realm, and returns
+// the decrypted TGS_REP with its reply key.
+func (cl *Client) sendUncachedTGSReq(ctx context.Context, tgsReq messages.TGSReq, realm string, tgt messages.Ticket, sessionKey types.EncryptionKey) (messages.TGSRep, types.EncryptionKey, error) {
+	var tgsRep messages.TGSRep
+	if cl.fastTGS(realm) {
+		subKey, err := newSubKey(sessionKey)
+		if err != nil {
+			return tgsRep, subKey, err
+		}
+		err = tgsReq.SetSubKey(tgt, sessionKey, subKey)
+		if err != nil {
+			return tgsRep, subKey, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to add a sub-session key to the TGS_REQ")
+		}
+		tgsRep, err = cl.armoredTGSExchange(ctx, &tgsReq, realm, sessionKey, subKey)
+		return tgsRep, subKey, err
 	}
+	b, err := tgsReq.Marshal()
+	if err != nil {
+		return tgsRep, sessionKey, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to marshal TGS_REQ")
+	}
+	r, err := cl.sendToKDC(ctx, b, realm)
+	if err != nil {
+		if _, ok := err.(messages.KRBError); ok {
+			return tgsRep, sessionKey, krberror.Errorf(err, krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC when requesting for %s", tgsReq.ReqBody.SName.PrincipalNameString())
+		}
+		return tgsRep, sessionKey, krberror.Errorf(err, krberror.NetworkingError, "TGS Exchange Error: issue sending TGS_REQ to KDC")
+	}
+	err = tgsRep.Unmarshal(r)
+	if err != nil {
+		return tgsRep, sessionKey, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
+	}
+	err = tgsRep.DecryptEncPart(sessionKey)
+	if err != nil {
+		return tgsRep, sessionKey, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
+	}
+	return tgsRep, sessionKey, nil
+}
+
+// cacheServiceTicket adds the ticket from the TGS_REP to the client's cache.
+func (cl *Client) cacheServiceTicket(tgsRep messages.TGSRep) {
 	cl.cache.addEntry(
 		tgsRep.Ticket,
 		tgsRep.DecryptedEncPart.AuthTime,
 		tgsRep.DecryptedEncPart.StartTime,
 		tgsRep.DecryptedEncPart.EndTime,
 		tgsRep.DecryptedEncPart.RenewTill,
+		tgsRep.DecryptedEncPart.Flags,
 		tgsRep.DecryptedEncPart.Key,
 	)
 	cl.Log("ticket added to cache for %s (EndTime: %v)", tgsRep.Ticket.SName.PrincipalNameString(), tgsRep.DecryptedEncPart.EndTime)
-	return tgsReq, tgsRep, err
+	cl.saveCCache()
 }
 
 // GetServiceTicket makes a request to get a service ticket for the SPN specified
 // SPN format: <SERVICE>/<FQDN> Eg. HTTP/www.example.com
 // The ticket will be added to the client's ticket cache
 func (cl *Client) GetServiceTicket(spn string) (messages.Ticket, types.EncryptionKey, error) {
+	return cl.GetServiceTicketContext(context.Background(), spn)
+}
+
+// GetServiceTicketContext makes a request to get a service ticket for the SPN specified.
+// If the context is done before the ticket is obtained the context's error is returned.
+func (cl *Client) GetServiceTicketContext(ctx context.Context, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	tkt, skey, err := cl.getServiceTicket(ctx, spn)
+	return tkt, skey, ctxErr(ctx, err)
+}
+
+func (cl *Client) getServiceTicket(ctx context.Context, spn string) (messages.Ticket, types.EncryptionKey, error) {
 	var tkt messages.Ticket
 	var skey types.EncryptionKey
-	if tkt, skey, ok := cl.GetCachedTicket(spn); ok {
+	if tkt, skey, ok := cl.getCachedTicket(ctx, spn); ok {
 		// Already a valid ticket in the cache
 		return tkt, skey, nil
 	}
+	if cl.impersonation != nil {
+		tgsRep, err := cl.impersonation.serviceTicket(ctx, spn)
+		if err != nil {
+			return tkt, skey, err
+		}
+		cl.cacheServiceTicket(tgsRep)
+		return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+	}
 	princ := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)
 	realm := cl.spnRealm(princ)
 
@@ -96,11 +212,11 @@ func (cl *Client) GetServiceTicket(spn string) (messages.Ticket, types.Encryptio
 		realm = cl.Credentials.Realm()
 	}
 
-	tgt, skey, err := cl.sessionTGT(realm)
+	tgt, skey, err := cl.sessionTGT(ctx, realm)
 	if err != nil {
 		return tkt, skey, err
 	}
-	_, tgsRep, err := cl.TGSREQGenerateAndExchange(princ, realm, tgt, skey, false)
+	_, tgsRep, err := cl.tgsReqGenerateAndExchange(ctx, princ, realm, tgt, skey, false)
 	if err != nil {
 		return tkt, skey, err
 	}
@@ -1,31 +1,106 @@
 package client
 
 import (
+	"container/list"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"sort"
 	"sync"
 	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/jcmturner/gokrb5/v8/messages"
 	"github.com/jcmturner/gokrb5/v8/types"
 )
 
 // Cache for service tickets held by the client.
+//
+// The number of entries can be limited with the CacheMaxEntries setting, in which case the least recently used entries
+// are evicted to keep within the limit. Expired entries are removed when they are next looked up, or periodically if
+// the CacheSweepInterval setting is configured.
 type Cache struct {
-	Entries map[string]CacheEntry
-	mux     sync.RWMutex
+	Entries       map[string]CacheEntry
+	mux           sync.RWMutex
+	maxEntries    int
+	sweepInterval time.Duration
+	observer      func(CacheEvent)
+	lru           *list.List // SPNs of the entries, most recently used first
+	elems         map[string]*list.Element
+	stop          chan struct{}
+	statsMux      sync.Mutex
+	stats         CacheStats
 }
 
 // CacheEntry holds details for a cache entry.
 type CacheEntry struct {
-	SPN        string
-	Ticket     messages.Ticket `json:"-"`
-	AuthTime   time.Time
-	StartTime  time.Time
-	EndTime    time.Time
-	RenewTill  time.Time
-	SessionKey types.EncryptionKey `json:"-"`
+	SPN         string
+	Ticket      messages.Ticket `json:"-"`
+	AuthTime    time.Time
+	StartTime   time.Time
+	EndTime     time.Time
+	RenewTill   time.Time
+	TicketFlags asn1.BitString      `json:"-"`
+	SessionKey  types.EncryptionKey `json:"-"`
+}
+
+// CacheEventType is the type of a cache event.
+type CacheEventType int
+
+// Cache event types.
+const (
+	// CacheHit is a valid ticket for the SPN being found in the cache.
+	CacheHit CacheEventType = iota
+	// CacheMiss is a valid ticket for the SPN not being found in the cache.
+	CacheMiss
+	// CacheRenewal is the cached ticket for the SPN being renewed.
+	CacheRenewal
+	// CacheRenewalFailure is the renewal of the cached ticket for the SPN failing.
+	CacheRenewalFailure
+	// CacheEviction is the entry for the SPN being evicted to keep the cache within its maximum number of entries.
+	CacheEviction
+	// CacheExpiry is the expired entry for the SPN being removed from the cache.
+	CacheExpiry
+)
+
+// String returns the name of the cache event type.
+func (t CacheEventType) String() string {
+	switch t {
+	case CacheHit:
+		return "hit"
+	case CacheMiss:
+		return "miss"
+	case CacheRenewal:
+		return "renewal"
+	case CacheRenewalFailure:
+		return "renewal failure"
+	case CacheEviction:
+		return "eviction"
+	case CacheExpiry:
+		return "expiry"
+	}
+	return fmt.Sprintf("unknown (%d)", int(t))
+}
+
+// CacheEvent describes an event on the client's service ticket cache. It is passed to the observer configured with the
+// CacheObserver setting.
+type CacheEvent struct {
+	Type CacheEventType
+	SPN  string
+	// Err is the error of a renewal failure.
+	Err error
+}
+
+// CacheStats holds counts of the events on the client's service ticket cache.
+type CacheStats struct {
+	Entries         int
+	Hits            uint64
+	Misses          uint64
+	Renewals        uint64
+	RenewalFailures uint64
+	Evictions       uint64
+	Expiries        uint64
 }
 
 // NewCache creates a new client ticket cache instance.
@@ -35,11 +110,28 @@ func NewCache() *Cache {
 	}
 }
 
-// getEntry returns a cache entry that matches the SPN.
+// newCache creates a new client ticket cache instance configured by the client settings.
+func newCache(s *Settings) *Cache {
+	c := NewCache()
+	c.maxEntries = s.CacheMaxEntries()
+	c.sweepInterval = s.CacheSweepInterval()
+	c.observer = s.CacheObserver()
+	return c
+}
+
+// expired indicates if the entry's ticket can no longer be used or renewed.
+func (e CacheEntry) expired(now time.Time) bool {
+	return !now.Before(e.EndTime) && !now.Before(e.RenewTill)
+}
+
+// getEntry returns a cache entry that matches the SPN, marking it as the most recently used.
 func (c *Cache) getEntry(spn string) (CacheEntry, bool) {
-	c.mux.RLock()
-	defer c.mux.RUnlock()
+	c.mux.Lock()
+	defer c.mux.Unlock()
 	e, ok := (*c).Entries[spn]
+	if ok {
+		c.touch(spn)
+	}
 	return e, ok
 }
 
@@ -63,55 +155,199 @@ func (c *Cache) JSON() (string, error) {
 	return string(b), nil
 }
 
-// addEntry adds a ticket to the cache.
-func (c *Cache) addEntry(tkt messages.Ticket, authTime, startTime, endTime, renewTill time.Time, sessionKey types.EncryptionKey) CacheEntry {
+// addEntry adds a ticket to the cache, evicting the least recently used entries if the cache is then over its maximum
+// number of entries.
+func (c *Cache) addEntry(tkt messages.Ticket, authTime, startTime, endTime, renewTill time.Time, flags asn1.BitString, sessionKey types.EncryptionKey) CacheEntry {
 	spn := tkt.SName.PrincipalNameString()
 	c.mux.Lock()
-	defer c.mux.Unlock()
-	(*c).Entries[spn] = CacheEntry{
-		SPN:        spn,
-		Ticket:     tkt,
-		AuthTime:   authTime,
-		StartTime:  startTime,
-		EndTime:    endTime,
-		RenewTill:  renewTill,
-		SessionKey: sessionKey,
+	e := CacheEntry{
+		SPN:         spn,
+		Ticket:      tkt,
+		AuthTime:    authTime,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		RenewTill:   renewTill,
+		TicketFlags: flags,
+		SessionKey:  sessionKey,
+	}
+	(*c).Entries[spn] = e
+	c.touch(spn)
+	var evicted []string
+	for c.maxEntries > 0 && len(c.Entries) > c.maxEntries && c.lru.Len() > 1 {
+		old := c.lru.Remove(c.lru.Back()).(string)
+		delete(c.elems, old)
+		delete(c.Entries, old)
+		evicted = append(evicted, old)
+	}
+	if c.sweepInterval > 0 && c.stop == nil {
+		c.stop = make(chan struct{})
+		go c.sweep(c.sweepInterval, c.stop)
+	}
+	c.mux.Unlock()
+	for _, old := range evicted {
+		c.notify(CacheEvent{Type: CacheEviction, SPN: old})
 	}
-	return c.Entries[spn]
+	return e
 }
 
-// clear deletes all the cache entries
+// touch marks the entry for the SPN as the most recently used. The caller must hold the lock.
+func (c *Cache) touch(spn string) {
+	if c.lru == nil {
+		c.lru = list.New()
+		c.elems = make(map[string]*list.Element)
+	}
+	if el, ok := c.elems[spn]; ok {
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.elems[spn] = c.lru.PushFront(spn)
+}
+
+// remove deletes the entry for the SPN. The caller must hold the lock.
+func (c *Cache) remove(spn string) {
+	delete(c.Entries, spn)
+	if el, ok := c.elems[spn]; ok {
+		c.lru.Remove(el)
+		delete(c.elems, spn)
+	}
+}
+
+// clear deletes all the cache entries and stops the sweeping of expired entries.
 func (c *Cache) clear() {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 	for k := range c.Entries {
 		delete(c.Entries, k)
 	}
+	c.lru = nil
+	c.elems = nil
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
 }
 
 // RemoveEntry removes the cache entry for the defined SPN.
 func (c *Cache) RemoveEntry(spn string) {
 	c.mux.Lock()
 	defer c.mux.Unlock()
-	delete(c.Entries, spn)
+	c.remove(spn)
+}
+
+// removeExpired removes the expired entry for the SPN, if it has not been replaced since it was looked up.
+func (c *Cache) removeExpired(spn string) {
+	c.mux.Lock()
+	e, ok := c.Entries[spn]
+	ok = ok && e.expired(time.Now().UTC())
+	if ok {
+		c.remove(spn)
+	}
+	c.mux.Unlock()
+	if ok {
+		c.notify(CacheEvent{Type: CacheExpiry, SPN: spn})
+	}
+}
+
+// sweep removes expired entries at each interval until stopped.
+func (c *Cache) sweep(interval time.Duration, stop chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			c.removeAllExpired()
+		}
+	}
+}
+
+// removeAllExpired removes the entries that have expired.
+func (c *Cache) removeAllExpired() {
+	now := time.Now().UTC()
+	var expired []string
+	c.mux.Lock()
+	for spn, e := range c.Entries {
+		if e.expired(now) {
+			c.remove(spn)
+			expired = append(expired, spn)
+		}
+	}
+	c.mux.Unlock()
+	for _, spn := range expired {
+		c.notify(CacheEvent{Type: CacheExpiry, SPN: spn})
+	}
+}
+
+// notify counts the event in the cache statistics and passes it to the observer if one is configured.
+func (c *Cache) notify(ev CacheEvent) {
+	c.statsMux.Lock()
+	switch ev.Type {
+	case CacheHit:
+		c.stats.Hits++
+	case CacheMiss:
+		c.stats.Misses++
+	case CacheRenewal:
+		c.stats.Renewals++
+	case CacheRenewalFailure:
+		c.stats.RenewalFailures++
+	case CacheEviction:
+		c.stats.Evictions++
+	case CacheExpiry:
+		c.stats.Expiries++
+	}
+	c.statsMux.Unlock()
+	if c.observer != nil {
+		c.observer(ev)
+	}
+}
+
+// Stats returns the counts of events on the cache and its current number of entries.
+func (c *Cache) Stats() CacheStats {
+	c.mux.RLock()
+	n := len(c.Entries)
+	c.mux.RUnlock()
+	c.statsMux.Lock()
+	defer c.statsMux.Unlock()
+	s := c.stats
+	s.Entries = n
+	return s
+}
+
+// CacheStats returns the counts of events on the client's service ticket cache, such as hits and misses, and its
+// current number of entries.
+func (cl *Client) CacheStats() CacheStats {
+	return cl.cache.Stats()
 }
 
 // GetCachedTicket returns a ticket from the cache for the SPN.
 // Only a ticket that is currently valid will be returned.
 func (cl *Client) GetCachedTicket(spn string) (messages.Ticket, types.EncryptionKey, bool) {
+	return cl.getCachedTicket(context.Background(), spn)
+}
+
+func (cl *Client) getCachedTicket(ctx context.Context, spn string) (messages.Ticket, types.EncryptionKey, bool) {
 	if e, ok := cl.cache.getEntry(spn); ok {
+		now := time.Now().UTC()
 		//If within time window of ticket return it
-		if time.Now().UTC().After(e.StartTime) && time.Now().UTC().Before(e.EndTime) {
+		if now.After(e.StartTime) && now.Before(e.EndTime) {
 			cl.Log("ticket received from cache for %s", spn)
+			cl.cache.notify(CacheEvent{Type: CacheHit, SPN: spn})
 			return e.Ticket, e.SessionKey, true
-		} else if time.Now().UTC().Before(e.RenewTill) {
-			e, err := cl.renewTicket(e)
+		} else if now.Before(e.RenewTill) {
+			e, err := cl.renewTicket(ctx, e)
 			if err != nil {
+				cl.cache.notify(CacheEvent{Type: CacheRenewalFailure, SPN: spn, Err: err})
+				cl.cache.notify(CacheEvent{Type: CacheMiss, SPN: spn})
 				return e.Ticket, e.SessionKey, false
 			}
+			cl.cache.notify(CacheEvent{Type: CacheRenewal, SPN: spn})
 			return e.Ticket, e.SessionKey, true
+		} else if e.expired(now) {
+			cl.cache.removeExpired(spn)
 		}
 	}
+	cl.cache.notify(CacheEvent{Type: CacheMiss, SPN: spn})
 	var tkt messages.Ticket
 	var key types.EncryptionKey
 	return tkt, key, false
@@ -119,9 +355,9 @@ func (cl *Client) GetCachedTicket(spn string) (messages.Ticket, types.Encryption
 
 // renewTicket renews a cache entry ticket.
 // To renew from outside the client package use GetCachedTicket
-func (cl *Client) renewTicket(e CacheEntry) (CacheEntry, error) {
+func (cl *Client) renewTicket(ctx context.Context, e CacheEntry) (CacheEntry, error) {
 	spn := e.Ticket.SName
-	_, _, err := cl.TGSREQGenerateAndExchange(spn, e.Ticket.Realm, e.Ticket, e.SessionKey, true)
+	_, _, err := cl.tgsReqGenerateAndExchange(ctx, spn, e.Ticket.Realm, e.Ticket, e.SessionKey, true)
 	if err != nil {
 		return e, err
 	}
@@ -29,7 +29,7 @@ func TestCache_addEntry_getEntry_remove_clear(t *testing.T) {
 			KeyValue: []byte{byte(i)},
 		}
 		go func(i int) {
-			e := c.addEntry(tkt, time.Unix(int64(0+i), 0).UTC(), time.Unix(int64(10+i), 0).UTC(), time.Unix(int64(20+i), 0).UTC(), time.Unix(int64(30+i), 0).UTC(), key)
+			e := c.addEntry(tkt, time.Unix(int64(0+i), 0).UTC(), time.Unix(int64(10+i), 0).UTC(), time.Unix(int64(20+i), 0).UTC(), time.Unix(int64(30+i), 0).UTC(), types.NewKrbFlags(), key)
 			assert.Equal(t, fmt.Sprintf("%d/test.cache", i), e.SPN, "SPN cache key not as expected")
 			wg.Done()
 		}(i)
@@ -112,7 +112,7 @@ func TestCache_JSON(t *testing.T) {
 			KeyType:  1,
 			KeyValue: []byte{byte(i)},
 		}
-		e := c.addEntry(tkt, time.Unix(int64(0+i), 0).UTC(), time.Unix(int64(10+i), 0).UTC(), time.Unix(int64(20+i), 0).UTC(), time.Unix(int64(30+i), 0).UTC(), key)
+		e := c.addEntry(tkt, time.Unix(int64(0+i), 0).UTC(), time.Unix(int64(10+i), 0).UTC(), time.Unix(int64(20+i), 0).UTC(), time.Unix(int64(30+i), 0).UTC(), types.NewKrbFlags(), key)
 		assert.Equal(t, fmt.Sprintf("%d/test.cache", i), e.SPN, "SPN cache key not as expected")
 	}
 	expected := `[
@@ -144,3 +144,103 @@ func TestCache_JSON(t *testing.T) {
 	}
 	assert.Equal(t, expected, j, "json output not as expected")
 }
+
+func TestCache_MaxEntries(t *testing.T) {
+	t.Parallel()
+	var mux sync.Mutex
+	var evicted []string
+	c := newCache(NewSettings(CacheMaxEntries(3), CacheObserver(func(ev CacheEvent) {
+		if ev.Type == CacheEviction {
+			mux.Lock()
+			evicted = append(evicted, ev.SPN)
+			mux.Unlock()
+		}
+	})))
+	now := time.Now().UTC()
+	add := func(i int) {
+		tkt := messages.Ticket{
+			SName: types.PrincipalName{
+				NameType:   1,
+				NameString: []string{fmt.Sprintf("%d", i), "test.cache"},
+			},
+		}
+		c.addEntry(tkt, now, now, now.Add(time.Hour), now.Add(time.Hour), types.NewKrbFlags(), types.EncryptionKey{})
+	}
+	for i := 0; i < 3; i++ {
+		add(i)
+	}
+	// Use the oldest entry so that the second is the least recently used.
+	_, ok := c.getEntry("0/test.cache")
+	assert.True(t, ok, "cache entry 0 was not found")
+	add(3)
+	add(4)
+	assert.Equal(t, []string{"1/test.cache", "2/test.cache"}, evicted, "least recently used entries should be evicted")
+	for _, i := range []int{0, 3, 4} {
+		_, ok := c.getEntry(fmt.Sprintf("%d/test.cache", i))
+		assert.True(t, ok, "cache entry %d was not found", i)
+	}
+	// Replacing an entry does not evict another.
+	add(4)
+	stats := c.Stats()
+	assert.Equal(t, 3, stats.Entries, "number of entries not as expected")
+	assert.Equal(t, uint64(2), stats.Evictions, "number of evictions not as expected")
+}
+
+func TestCache_Sweep(t *testing.T) {
+	t.Parallel()
+	c := newCache(NewSettings(CacheSweepInterval(10 * time.Millisecond)))
+	now := time.Now().UTC()
+	var tkts []messages.Ticket
+	for i := 0; i < 3; i++ {
+		tkts = append(tkts, messages.Ticket{
+			SName: types.PrincipalName{
+				NameType:   1,
+				NameString: []string{fmt.Sprintf("%d", i), "test.cache"},
+			},
+		})
+	}
+	c.addEntry(tkts[0], now, now, now.Add(time.Hour), time.Time{}, types.NewKrbFlags(), types.EncryptionKey{})
+	// Expired but can still be renewed.
+	c.addEntry(tkts[1], now, now, now.Add(-time.Minute), now.Add(time.Hour), types.NewKrbFlags(), types.EncryptionKey{})
+	c.addEntry(tkts[2], now, now, now.Add(-time.Minute), now.Add(-time.Minute), types.NewKrbFlags(), types.EncryptionKey{})
+	time.Sleep(50 * time.Millisecond)
+	_, ok := c.getEntry("0/test.cache")
+	assert.True(t, ok, "valid cache entry should not be removed")
+	_, ok = c.getEntry("1/test.cache")
+	assert.True(t, ok, "renewable cache entry should not be removed")
+	_, ok = c.getEntry("2/test.cache")
+	assert.False(t, ok, "expired cache entry should be removed")
+	assert.Equal(t, uint64(1), c.Stats().Expiries, "number of expiries not as expected")
+
+	c.clear()
+	c.mux.Lock()
+	assert.Nil(t, c.stop, "sweeping should be stopped when the cache is cleared")
+	c.mux.Unlock()
+}
+
+func TestClient_CacheStats(t *testing.T) {
+	t.Parallel()
+	var mux sync.Mutex
+	events := make(map[CacheEventType]int)
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", nil, CacheObserver(func(ev CacheEvent) {
+		mux.Lock()
+		events[ev.Type]++
+		mux.Unlock()
+	}))
+	now := time.Now().UTC()
+	valid := messages.Ticket{SName: types.PrincipalName{NameType: 2, NameString: []string{"HTTP", "valid.test.gokrb5"}}}
+	expired := messages.Ticket{SName: types.PrincipalName{NameType: 2, NameString: []string{"HTTP", "expired.test.gokrb5"}}}
+	cl.cache.addEntry(valid, now, now.Add(-time.Minute), now.Add(time.Hour), time.Time{}, types.NewKrbFlags(), types.EncryptionKey{})
+	cl.cache.addEntry(expired, now, now.Add(-time.Hour), now.Add(-time.Minute), time.Time{}, types.NewKrbFlags(), types.EncryptionKey{})
+
+	_, _, ok := cl.GetCachedTicket("HTTP/valid.test.gokrb5")
+	assert.True(t, ok, "valid ticket should be returned from the cache")
+	_, _, ok = cl.GetCachedTicket("HTTP/expired.test.gokrb5")
+	assert.False(t, ok, "expired ticket should not be returned from the cache")
+	_, _, ok = cl.GetCachedTicket("HTTP/other.test.gokrb5")
+	assert.False(t, ok, "ticket not in the cache should not be returned")
+
+	stats := cl.CacheStats()
+	assert.Equal(t, CacheStats{Entries: 1, Hits: 1, Misses: 2, Expiries: 1}, stats, "cache stats not as expected")
+	assert.Equal(t, map[CacheEventType]int{CacheHit: 1, CacheMiss: 2, CacheExpiry: 1}, events, "cache events not as expected")
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/credentials"
+)
+
+// saveCCache writes the client's TGT sessions and cached service tickets to the credential cache, if the client is
+// configured with a credential cache path.
+func (cl *Client) saveCCache() {
+	cpath := cl.settings.CCachePath()
+	if cpath == "" {
+		return
+	}
+	cl.ccacheMux.Lock()
+	defer cl.ccacheMux.Unlock()
+	c, err := cl.ccache()
+	if err != nil {
+		cl.Log("error creating credential cache: %v", err)
+		return
+	}
+	err = c.SaveNamed(cpath)
+	if err != nil {
+		cl.Log("error saving credential cache to %s: %v", cpath, err)
+		return
+	}
+	cl.Log("credential cache saved to %s", cpath)
+}
+
+// removeCCache destroys the credential cache, if the client is configured with a credential cache path.
+func (cl *Client) removeCCache() {
+	cpath := cl.settings.CCachePath()
+	if cpath == "" {
+		return
+	}
+	cl.ccacheMux.Lock()
+	defer cl.ccacheMux.Unlock()
+	err := credentials.DestroyNamedCCache(cpath)
+	if err != nil {
+		cl.Log("error removing credential cache %s: %v", cpath, err)
+	}
+}
+
+// CCache returns a credential cache holding the client's TGTs, the TGT for the client's realm first, followed by its
+// cached service tickets. It can be saved for use by other processes, such as with its SaveNamed method.
+func (cl *Client) CCache() (*credentials.CCache, error) {
+	cl.ccacheMux.Lock()
+	defer cl.ccacheMux.Unlock()
+	return cl.ccache()
+}
+
+// ccache creates a credential cache holding the client's TGTs followed by its cached service tickets.
+func (cl *Client) ccache() (*credentials.CCache, error) {
+	cname := cl.Credentials.CName()
+	crealm := cl.Credentials.Domain()
+	c := credentials.NewCCache(cname, crealm)
+
+	cl.sessions.mux.RLock()
+	realms := make([]string, 0, len(cl.sessions.Entries))
+	for r := range cl.sessions.Entries {
+		realms = append(realms, r)
+	}
+	sort.Slice(realms, func(i, j int) bool {
+		// The TGT for the client's realm comes first
+		if realms[i] == crealm || realms[j] == crealm {
+			return realms[i] == crealm
+		}
+		return realms[i] < realms[j]
+	})
+	ss := make([]*session, len(realms))
+	for i, r := range realms {
+		ss[i] = cl.sessions.Entries[r]
+	}
+	cl.sessions.mux.RUnlock()
+	for _, s := range ss {
+		s.mux.RLock()
+		cred := credentials.NewCredential(cname, crealm, s.tgt.SName, s.tgt.Realm)
+		cred.Key = s.sessionKey
+		cred.AuthTime = s.authTime
+		cred.StartTime = s.authTime
+		cred.EndTime = s.endTime
+		cred.RenewTill = s.renewTill
+		if len(s.flags.Bytes) > 0 {
+			cred.TicketFlags = s.flags
+		}
+		tgt := s.tgt
+		s.mux.RUnlock()
+		b, err := tgt.Marshal()
+		if err != nil {
+			return c, err
+		}
+		cred.Ticket = b
+		c.AddCredential(cred)
+	}
+
+	cl.cache.mux.RLock()
+	defer cl.cache.mux.RUnlock()
+	spns := make([]string, 0, len(cl.cache.Entries))
+	for spn := range cl.cache.Entries {
+		spns = append(spns, spn)
+	}
+	sort.Strings(spns)
+	for _, spn := range spns {
+		e := cl.cache.Entries[spn]
+		if len(e.Ticket.SName.NameString) > 0 && strings.ToLower(e.Ticket.SName.NameString[0]) == "krbtgt" {
+			// TGTs are written from the sessions
+			continue
+		}
+		cred := credentials.NewCredential(cname, crealm, e.Ticket.SName, e.Ticket.Realm)
+		cred.Key = e.SessionKey
+		cred.AuthTime = e.AuthTime
+		cred.StartTime = e.StartTime
+		cred.EndTime = e.EndTime
+		cred.RenewTill = e.RenewTill
+		if len(e.TicketFlags.Bytes) > 0 {
+			cred.TicketFlags = e.TicketFlags
+		}
+		b, err := e.Ticket.Marshal()
+		if err != nil {
+			return c, err
+		}
+		cred.Ticket = b
+		c.AddCredential(cred)
+	}
+	return c, nil
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_CCachePath(t *testing.T) {
+	t.Parallel()
+	dir, err := os.MkdirTemp("", "ccache")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cpath := filepath.Join(dir, "krb5cc_test")
+
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c, CCachePath(cpath))
+
+	b, err := hex.DecodeString(testdata.MarshaledKRB5ticket)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	var tgt messages.Ticket
+	err = tgt.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	tgt.Realm = "TEST.GOKRB5"
+	tgt.SName = types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5")
+	now := time.Now().UTC().Truncate(time.Second)
+	tf := types.NewKrbFlags()
+	types.SetFlag(&tf, flags.Renewable)
+	cl.sessions.update(&session{
+		realm:      "TEST.GOKRB5",
+		authTime:   now,
+		endTime:    now.Add(time.Hour),
+		renewTill:  now.Add(time.Hour * 24),
+		tgt:        tgt,
+		sessionKey: types.EncryptionKey{KeyType: 18, KeyValue: make([]byte, 32)},
+		flags:      tf,
+	})
+	var tkt messages.Ticket
+	tkt.Unmarshal(b)
+	tkt.Realm = "TEST.GOKRB5"
+	tkt.SName = types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	var tgsRep messages.TGSRep
+	tgsRep.Ticket = tkt
+	tgsRep.DecryptedEncPart = messages.EncKDCRepPart{
+		Key:       types.EncryptionKey{KeyType: 18, KeyValue: make([]byte, 32)},
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		Flags:     types.NewKrbFlags(),
+	}
+	types.SetFlag(&tgsRep.DecryptedEncPart.Flags, flags.Forwardable)
+	cl.cacheServiceTicket(tgsRep)
+
+	cc, err := credentials.LoadCCache(cpath)
+	if err != nil {
+		t.Fatalf("error loading saved ccache: %v", err)
+	}
+	assert.Equal(t, "testuser1", cc.GetClientPrincipalName().PrincipalNameString(), "ccache principal not as expected")
+	assert.Equal(t, 2, len(cc.GetEntries()), "number of ccache entries not as expected")
+	assert.Equal(t, tgt.SName, cc.Credentials[0].Server.PrincipalName, "first ccache entry should be the TGT")
+	assert.True(t, types.IsFlagSet(&cc.Credentials[0].TicketFlags, flags.Renewable), "TGT flags not as expected")
+	assert.True(t, types.IsFlagSet(&cc.Credentials[1].TicketFlags, flags.Forwardable), "service ticket flags not as expected")
+
+	cl2, err := NewFromCCache(cc, c, CCachePath(cpath))
+	if err != nil {
+		t.Fatalf("error creating client from saved ccache: %v", err)
+	}
+	_, endTime, _, _, err := cl2.sessionTimes("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("session not loaded from saved ccache: %v", err)
+	}
+	assert.True(t, now.Add(time.Hour).Equal(endTime), "TGT end time not as expected")
+	_, _, ok := cl2.GetCachedTicket("HTTP/host.test.gokrb5")
+	assert.True(t, ok, "service ticket not loaded from saved ccache")
+	e, _ := cl2.cache.getEntry("HTTP/host.test.gokrb5")
+	assert.True(t, types.IsFlagSet(&e.TicketFlags, flags.Forwardable), "service ticket flags not loaded from saved ccache")
+
+	// A cached ticket without a service name does not prevent the ccache being created.
+	cl2.cache.addEntry(messages.Ticket{Realm: "TEST.GOKRB5"}, now, now, now.Add(time.Hour), time.Time{}, types.NewKrbFlags(), types.EncryptionKey{})
+	_, err = cl2.CCache()
+	assert.NoError(t, err, "error creating ccache with a ticket without a service name")
+
+	cl2.Destroy()
+	_, err = os.Stat(cpath)
+	assert.True(t, os.IsNotExist(err), "ccache file should be removed when the client is destroyed")
+}
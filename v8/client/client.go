@@ -2,11 +2,15 @@
 package client
 
 import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jcmturner/gokrb5/v8/config"
@@ -23,39 +27,79 @@ import (
 
 // Client side configuration and state.
 type Client struct {
-	Credentials *credentials.Credentials
-	Config      *config.Config
-	settings    *Settings
-	sessions    *sessions
-	cache       *Cache
+	Credentials   *credentials.Credentials
+	Config        *config.Config
+	settings      *Settings
+	sessions      *sessions
+	cache         *Cache
+	ccacheMux     sync.Mutex
+	impersonation *impersonation
+	servers       serverStatus
+	anonArmor     *Client
+	anonArmorMux  sync.Mutex
 }
 
 // NewWithPassword creates a new client from a password credential.
 // Set the realm to empty string to use the default realm from config.
 func NewWithPassword(username, realm, password string, krb5conf *config.Config, settings ...func(*Settings)) *Client {
 	creds := credentials.New(username, realm)
+	s := NewSettings(settings...)
 	return &Client{
 		Credentials: creds.WithPassword(password),
 		Config:      krb5conf,
-		settings:    NewSettings(settings...),
+		settings:    s,
 		sessions: &sessions{
 			Entries: make(map[string]*session),
 		},
-		cache: NewCache(),
+		cache: newCache(s),
 	}
 }
 
 // NewWithKeytab creates a new client from a keytab credential.
 func NewWithKeytab(username, realm string, kt *keytab.Keytab, krb5conf *config.Config, settings ...func(*Settings)) *Client {
 	creds := credentials.New(username, realm)
+	s := NewSettings(settings...)
 	return &Client{
 		Credentials: creds.WithKeytab(kt),
 		Config:      krb5conf,
-		settings:    NewSettings(settings...),
+		settings:    s,
 		sessions: &sessions{
 			Entries: make(map[string]*session),
 		},
-		cache: NewCache(),
+		cache: newCache(s),
+	}
+}
+
+// NewWithCertificate creates a new client from a certificate credential that authenticates to the KDC with PKINIT.
+// The first certificate must be the user's and any others are intermediates needed to chain it to a root trusted by the
+// KDC. The signer is the private key of the user's certificate.
+func NewWithCertificate(username, realm string, certs []*x509.Certificate, signer stdcrypto.Signer, krb5conf *config.Config, settings ...func(*Settings)) *Client {
+	creds := credentials.New(username, realm)
+	s := NewSettings(settings...)
+	return &Client{
+		Credentials: creds.WithCertificate(certs, signer),
+		Config:      krb5conf,
+		settings:    s,
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		cache: newCache(s),
+	}
+}
+
+// NewAnonymous creates a new client that obtains anonymous tickets from the KDC of the realm using anonymous PKINIT, as
+// defined in RFC 8062. The KDC's certificate must chain to a root in the client's PKINIT trust pool.
+// An anonymous client can, for example, be used as the FAST armor of another client.
+func NewAnonymous(realm string, krb5conf *config.Config, settings ...func(*Settings)) *Client {
+	s := NewSettings(settings...)
+	return &Client{
+		Credentials: credentials.NewAnonymous(realm),
+		Config:      krb5conf,
+		settings:    s,
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		cache: newCache(s),
 	}
 }
 
@@ -63,14 +107,15 @@ func NewWithKeytab(username, realm string, kt *keytab.Keytab, krb5conf *config.C
 //
 // WARNING: A client created from CCache does not automatically renew TGTs and a failure will occur after the TGT expires.
 func NewFromCCache(c *credentials.CCache, krb5conf *config.Config, settings ...func(*Settings)) (*Client, error) {
+	s := NewSettings(settings...)
 	cl := &Client{
 		Credentials: c.GetClientCredentials(),
 		Config:      krb5conf,
-		settings:    NewSettings(settings...),
+		settings:    s,
 		sessions: &sessions{
 			Entries: make(map[string]*session),
 		},
-		cache: NewCache(),
+		cache: newCache(s),
 	}
 	spn := types.PrincipalName{
 		NameType:   nametype.KRB_NT_SRV_INST,
@@ -92,6 +137,7 @@ func NewFromCCache(c *credentials.CCache, krb5conf *config.Config, settings ...f
 		renewTill:  cred.RenewTill,
 		tgt:        tgt,
 		sessionKey: cred.Key,
+		flags:      cred.TicketFlags,
 	}
 	for _, cred := range c.GetEntries() {
 		var tkt messages.Ticket
@@ -105,12 +151,62 @@ func NewFromCCache(c *credentials.CCache, krb5conf *config.Config, settings ...f
 			cred.StartTime,
 			cred.EndTime,
 			cred.RenewTill,
+			cred.TicketFlags,
 			cred.Key,
 		)
 	}
 	return cl, nil
 }
 
+// NewFromKRBCred creates a client from the tickets within a KRB_CRED, such as the TGT delegated to a service.
+// The encrypted part of the KRB_CRED must already be decrypted. A TGT within the KRB_CRED establishes a session for its
+// realm and any other tickets are added to the client's cache.
+//
+// WARNING: As with a client created from a CCache, the client does not automatically renew TGTs and a failure will occur
+// after the TGT expires.
+func NewFromKRBCred(cred *messages.KRBCred, krb5conf *config.Config, settings ...func(*Settings)) (*Client, error) {
+	info := cred.DecryptedEncPart.TicketInfo
+	if len(info) < 1 || len(info) != len(cred.Tickets) {
+		return nil, errors.New("KRB_CRED does not hold ticket information for each ticket, ensure its encrypted part is decrypted")
+	}
+	s := NewSettings(settings...)
+	cl := &Client{
+		Credentials: credentials.NewFromPrincipalName(info[0].PName, info[0].PRealm),
+		Config:      krb5conf,
+		settings:    s,
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		cache: newCache(s),
+	}
+	var tgt bool
+	for i, tkt := range cred.Tickets {
+		ci := info[i]
+		if len(tkt.SName.NameString) < 1 {
+			return nil, fmt.Errorf("ticket %d of the KRB_CRED does not have a service name", i)
+		}
+		if len(tkt.SName.NameString) > 1 && strings.ToLower(tkt.SName.NameString[0]) == "krbtgt" {
+			realm := tkt.SName.NameString[len(tkt.SName.NameString)-1]
+			cl.sessions.Entries[realm] = &session{
+				realm:      realm,
+				authTime:   ci.AuthTime,
+				endTime:    ci.EndTime,
+				renewTill:  ci.RenewTill,
+				tgt:        tkt,
+				sessionKey: ci.Key,
+				flags:      ci.Flags,
+			}
+			tgt = true
+			continue
+		}
+		cl.cache.addEntry(tkt, ci.AuthTime, ci.StartTime, ci.EndTime, ci.RenewTill, ci.Flags, ci.Key)
+	}
+	if !tgt {
+		return cl, errors.New("TGT not found in KRB_CRED")
+	}
+	return cl, nil
+}
+
 // Key returns the client's encryption key for the specified encryption type and its kvno (kvno of zero will find latest).
 // The key can be retrieved either from the keytab or generated from the client's password.
 // If the client has both a keytab and a password defined the keytab is favoured as the source for the key
@@ -143,11 +239,11 @@ func (cl *Client) IsConfigured() (bool, error) {
 	if cl.Credentials.Domain() == "" {
 		return false, errors.New("client does not have a define realm")
 	}
-	// Client needs to have either a password, keytab or a session already (later when loading from CCache)
-	if !cl.Credentials.HasPassword() && !cl.Credentials.HasKeytab() {
+	// Client needs to have either a password, keytab, certificate, be anonymous or a session already (later when loading from CCache)
+	if !cl.Credentials.HasPassword() && !cl.Credentials.HasKeytab() && !cl.Credentials.HasCertificate() && !cl.Credentials.Anonymous() {
 		authTime, _, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
 		if err != nil || authTime.IsZero() {
-			return false, errors.New("client has neither a keytab nor a password set and no session")
+			return false, errors.New("client has neither a keytab, a password nor a certificate set and no session")
 		}
 	}
 	if !cl.Config.LibDefaults.DNSLookupKDC {
@@ -165,10 +261,25 @@ func (cl *Client) IsConfigured() (bool, error) {
 
 // Login the client with the KDC via an AS exchange.
 func (cl *Client) Login() error {
+	return cl.LoginContext(context.Background())
+}
+
+// LoginContext logs the client in with the KDC via an AS exchange.
+// If the context is done before the login completes the context's error is returned.
+func (cl *Client) LoginContext(ctx context.Context) error {
+	return ctxErr(ctx, cl.login(ctx))
+}
+
+func (cl *Client) login(ctx context.Context) error {
+	if cl.impersonation != nil {
+		// A client impersonating a user via S4U only needs a valid S4U2Self ticket
+		_, err := cl.impersonation.evidenceTicket(ctx)
+		return err
+	}
 	if ok, err := cl.IsConfigured(); !ok {
 		return err
 	}
-	if !cl.Credentials.HasPassword() && !cl.Credentials.HasKeytab() {
+	if !cl.Credentials.HasPassword() && !cl.Credentials.HasKeytab() && !cl.Credentials.HasCertificate() && !cl.Credentials.Anonymous() {
 		_, endTime, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
 		if err != nil {
 			return krberror.Errorf(err, krberror.KRBMsgError, "no user credentials available and error getting any existing session")
@@ -179,11 +290,17 @@ func (cl *Client) Login() error {
 		// no credentials but there is a session with tgt already
 		return nil
 	}
-	ASReq, err := messages.NewASReqForTGT(cl.Credentials.Domain(), cl.Config, cl.Credentials.CName())
+	var ASReq messages.ASReq
+	var err error
+	if cl.Credentials.Anonymous() {
+		ASReq, err = messages.NewASReqForAnonymousTGT(cl.Credentials.Domain(), cl.Config)
+	} else {
+		ASReq, err = messages.NewASReqForTGT(cl.Credentials.Domain(), cl.Config, cl.Credentials.CName())
+	}
 	if err != nil {
 		return krberror.Errorf(err, krberror.KRBMsgError, "error generating new AS_REQ")
 	}
-	ASRep, err := cl.ASExchange(cl.Credentials.Domain(), ASReq, 0)
+	ASRep, err := cl.asExchange(ctx, cl.Credentials.Domain(), ASReq, 0)
 	if err != nil {
 		return err
 	}
@@ -193,10 +310,19 @@ func (cl *Client) Login() error {
 
 // AffirmLogin will only perform an AS exchange with the KDC if the client does not already have a TGT.
 func (cl *Client) AffirmLogin() error {
+	return cl.AffirmLoginContext(context.Background())
+}
+
+// AffirmLoginContext will only perform an AS exchange with the KDC if the client does not already have a TGT.
+// If the context is done before the login completes the context's error is returned.
+func (cl *Client) AffirmLoginContext(ctx context.Context) error {
 	_, endTime, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
 	if err != nil || time.Now().UTC().After(endTime) {
-		err := cl.Login()
+		err := cl.login(ctx)
 		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			return fmt.Errorf("could not get valid TGT for client's realm: %v", err)
 		}
 	}
@@ -204,18 +330,18 @@ func (cl *Client) AffirmLogin() error {
 }
 
 // realmLogin obtains or renews a TGT and establishes a session for the realm specified.
-func (cl *Client) realmLogin(realm string) error {
+func (cl *Client) realmLogin(ctx context.Context, realm string) error {
 	if realm == cl.Credentials.Domain() {
-		return cl.Login()
+		return cl.login(ctx)
 	}
 	_, endTime, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
 	if err != nil || time.Now().UTC().After(endTime) {
-		err := cl.Login()
+		err := cl.login(ctx)
 		if err != nil {
 			return fmt.Errorf("could not get valid TGT for client's realm: %v", err)
 		}
 	}
-	tgt, skey, err := cl.sessionTGT(cl.Credentials.Domain())
+	tgt, skey, err := cl.sessionTGT(ctx, cl.Credentials.Domain())
 	if err != nil {
 		return err
 	}
@@ -225,7 +351,7 @@ func (cl *Client) realmLogin(realm string) error {
 		NameString: []string{"krbtgt", realm},
 	}
 
-	_, tgsRep, err := cl.TGSREQGenerateAndExchange(spn, cl.Credentials.Domain(), tgt, skey, false)
+	_, tgsRep, err := cl.tgsReqGenerateAndExchange(ctx, spn, cl.Credentials.Domain(), tgt, skey, false)
 	if err != nil {
 		return err
 	}
@@ -235,11 +361,19 @@ func (cl *Client) realmLogin(realm string) error {
 }
 
 // Destroy stops the auto-renewal of all sessions and removes the sessions and cache entries from the client.
+// If the client is configured to keep a credential cache file in sync the file is removed.
 func (cl *Client) Destroy() {
 	creds := credentials.New("", "")
 	cl.sessions.destroy()
 	cl.cache.clear()
+	cl.anonArmorMux.Lock()
+	if cl.anonArmor != nil {
+		cl.anonArmor.Destroy()
+		cl.anonArmor = nil
+	}
+	cl.anonArmorMux.Unlock()
 	cl.Credentials = creds
+	cl.removeCCache()
 	cl.Log("client destroyed")
 }
 
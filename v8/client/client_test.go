@@ -1,10 +1,23 @@
 package client
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4556"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestAssumePreauthentication(t *testing.T) {
@@ -18,3 +31,56 @@ func TestAssumePreauthentication(t *testing.T) {
 		t.Fatal("AssumePreAuthentication() should be true")
 	}
 }
+
+func TestNewWithCertificate(t *testing.T) {
+	t.Parallel()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "testuser1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(b)
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	pool := x509.NewCertPool()
+	cl := NewWithCertificate("testuser1", "TEST.GOKRB5", []*x509.Certificate{cert}, key, c, PKINITTrustPool(pool), PKINITKeyAgreement(rfc4556.P256))
+	assert.True(t, cl.Credentials.HasCertificate(), "credentials should have a certificate")
+	assert.False(t, cl.Credentials.HasPassword(), "credentials should not have a password")
+	ok, err := cl.IsConfigured()
+	assert.True(t, ok, "client with a certificate should be configured: %v", err)
+	assert.Equal(t, pool, cl.settings.PKINITTrustPool(), "PKINIT trust pool not as configured")
+	assert.True(t, cl.settings.PKINITRequireKDCPrincipal(), "KDC principal should be required by default")
+	assert.Equal(t, rfc4556.P256, cl.settings.PKINITKeyAgreement(), "PKINIT key agreement not as configured")
+}
+
+func TestNewAnonymous(t *testing.T) {
+	t.Parallel()
+
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	cl := NewAnonymous("TEST.GOKRB5", c)
+	assert.True(t, cl.Credentials.Anonymous(), "credentials should be anonymous")
+	assert.Equal(t, "WELLKNOWN/ANONYMOUS", cl.Credentials.CName().PrincipalNameString(), "client name not as expected")
+	ok, err := cl.IsConfigured()
+	assert.True(t, ok, "anonymous client should be configured: %v", err)
+}
+
+func TestNewFromKRBCred_NoSName(t *testing.T) {
+	t.Parallel()
+
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	pn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	cred := &messages.KRBCred{
+		Tickets: []messages.Ticket{{Realm: "TEST.GOKRB5"}},
+		DecryptedEncPart: messages.EncKrbCredPart{
+			TicketInfo: []messages.KrbCredInfo{{PRealm: "TEST.GOKRB5", PName: pn}},
+		},
+	}
+	_, err := NewFromKRBCred(cred, c)
+	assert.Error(t, err, "KRB_CRED with a ticket that does not have a service name should be rejected")
+}
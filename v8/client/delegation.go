@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// GetForwardedTGT requests a forwarded TGT for the client's realm that can be delegated to a service, for example
+// within a KRB_CRED in the GSS-API checksum of a KRB5 token. The client's TGT must be forwardable, which requires
+// forwardable = true in the [libdefaults] of the krb5.conf. The forwarded TGT is not added to the client's sessions.
+func (cl *Client) GetForwardedTGT() (messages.Ticket, messages.EncKDCRepPart, error) {
+	return cl.GetForwardedTGTContext(context.Background())
+}
+
+// GetForwardedTGTContext requests a forwarded TGT for the client's realm. See GetForwardedTGT.
+// If the context is done before the ticket is obtained the context's error is returned.
+func (cl *Client) GetForwardedTGTContext(ctx context.Context) (messages.Ticket, messages.EncKDCRepPart, error) {
+	tkt, dep, err := cl.getForwardedTGT(ctx)
+	return tkt, dep, ctxErr(ctx, err)
+}
+
+func (cl *Client) getForwardedTGT(ctx context.Context) (messages.Ticket, messages.EncKDCRepPart, error) {
+	realm := cl.Credentials.Domain()
+	tgt, skey, err := cl.sessionTGT(ctx, realm)
+	if err != nil {
+		return messages.Ticket{}, messages.EncKDCRepPart{}, err
+	}
+	s, ok := cl.sessions.get(realm)
+	if !ok || !s.forwardable() {
+		return messages.Ticket{}, messages.EncKDCRepPart{}, krberror.NewErrorf(krberror.KRBMsgError, "TGT for %s is not forwardable", realm)
+	}
+	tgsReq, err := messages.NewForwardedTGTReq(cl.Credentials.CName(), realm, cl.Config, tgt, skey)
+	if err != nil {
+		return messages.Ticket{}, messages.EncKDCRepPart{}, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new TGS_REQ")
+	}
+	tgsRep, _, err := cl.uncachedTGSExchange(ctx, tgsReq, realm, tgt, skey)
+	if err != nil {
+		return messages.Ticket{}, messages.EncKDCRepPart{}, err
+	}
+	if !types.IsFlagSet(&tgsRep.DecryptedEncPart.Flags, flags.Forwarded) {
+		return messages.Ticket{}, messages.EncKDCRepPart{}, krberror.NewErrorf(krberror.KRBMsgError, "KDC did not issue a forwarded TGT for %s", realm)
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart, nil
+}
@@ -0,0 +1,490 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4556"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Reference: https://tools.ietf.org/html/rfc6113
+
+// maxFASTASAttempts limits the number of AS_REQs sent while negotiating pre-authentication within FAST.
+const maxFASTASAttempts = 4
+
+// fastASExchange performs an AS exchange protected by FAST armor derived from the TGT of the armor client.
+func (cl *Client) fastASExchange(ctx context.Context, realm string, ASReq messages.ASReq, referral int) (messages.ASRep, error) {
+	var krberr *messages.KRBError
+	var cookie []types.PAData
+	preAuth := cl.settings.AssumePreAuthentication()
+	for i := 0; i < maxFASTASAttempts; i++ {
+		armor, armorKey, err := cl.fastArmor(ctx, realm)
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: could not create FAST armor")
+		}
+
+		// The pre-authentication data is carried within the encrypted FAST request
+		pas := types.PADataSequence{types.PAData{PADataType: patype.PA_REQ_ENC_PA_REP}}
+		pas = append(pas, cookie...)
+		var longTermKey types.EncryptionKey
+		var ka rfc4556.KeyAgreement
+		if cl.Credentials.HasCertificate() || cl.Credentials.Anonymous() {
+			var pa types.PAData
+			pa, ka, err = cl.pkinitPAData(ASReq.ReqBody)
+			if err != nil {
+				return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed setting PKINIT PAData")
+			}
+			pas = append(pas, pa)
+		} else if preAuth {
+			var pa types.PAData
+			pa, longTermKey, err = cl.encryptedChallenge(armorKey, krberr)
+			if err != nil {
+				return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed setting FAST encrypted challenge")
+			}
+			pas = append(pas, pa)
+		}
+		bb, err := ASReq.ReqBody.Marshal()
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ body")
+		}
+		fastReq := messages.KrbFastReq{
+			FastOptions: types.NewKrbFlags(),
+			PAData:      pas,
+			ReqBody:     ASReq.ReqBody,
+		}
+		armoredReq, err := messages.NewKrbFastArmoredReq(&armor, armorKey, fastReq, bb)
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed creating FAST armored request")
+		}
+		fastPA, err := armoredReq.PAData()
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling FAST armored request")
+		}
+		// The KDC only considers the PA-FX-FAST outer PAData. PA_REQ_ENC_PA_REP is also included in the outer PAData so
+		// the FAST negotiation checksum can be verified against the AS_REQ as sent.
+		ASReq.PAData = types.PADataSequence{types.PAData{PADataType: patype.PA_REQ_ENC_PA_REP}, fastPA}
+
+		b, err := ASReq.Marshal()
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ")
+		}
+		rb, err := cl.sendToKDC(ctx, b, realm)
+		if err != nil {
+			e, ok := err.(messages.KRBError)
+			if !ok {
+				return messages.ASRep{}, krberror.Errorf(err, krberror.NetworkingError, "AS Exchange Error: failed sending AS_REQ to KDC")
+			}
+			fe, fpas, err := fastKRBError(e, armorKey)
+			if err != nil {
+				return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed processing FAST error from KDC")
+			}
+			cookie = cookie[:0]
+			for _, pa := range fpas {
+				if pa.PADataType == patype.PA_FX_COOKIE {
+					cookie = append(cookie, pa)
+				}
+			}
+			switch fe.ErrorCode {
+			case errorcode.KDC_ERR_PREAUTH_REQUIRED, errorcode.KDC_ERR_PREAUTH_FAILED:
+				if preAuth && krberr != nil {
+					// Pre-authentication already provided in response to the KDC's requirements has failed
+					return messages.ASRep{}, krberror.Errorf(fe, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
+				}
+				// From now on assume this client will need to do this pre-auth and set the PAData
+				cl.settings.assumePreAuthentication = true
+				preAuth = true
+				krberr = &fe
+				continue
+			case errorcode.KDC_ERR_MORE_PREAUTH_DATA_REQUIRED:
+				krberr = &fe
+				continue
+			case errorcode.KDC_ERR_WRONG_REALM:
+				// Client referral https://tools.ietf.org/html/rfc6806.html#section-7
+				if referral > 5 {
+					return messages.ASRep{}, krberror.Errorf(fe, krberror.KRBMsgError, "maximum number of client referrals exceeded")
+				}
+				referral++
+				return cl.asExchange(ctx, fe.CRealm, ASReq, referral)
+			default:
+				return messages.ASRep{}, krberror.Errorf(fe, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
+			}
+		}
+
+		var ASRep messages.ASRep
+		err = ASRep.Unmarshal(rb)
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed to process the AS_REP")
+		}
+		fastRep, err := fastResponse(types.PADataSequence(ASRep.PAData), armorKey, ASReq.ReqBody.Nonce, ASRep.Ticket)
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: FAST response from KDC is not valid")
+		}
+		// The client name and realm within the FAST finished are authoritative
+		ASRep.CName = fastRep.Finished.CName
+		ASRep.CRealm = fastRep.Finished.CRealm
+		// The encrypted challenge FAST factor replaces the reply key with the armor key (RFC 6113 section 5.4.6), so the
+		// KDC's challenge is its only proof of knowing the client's long term key.
+		var replyKey types.EncryptionKey
+		switch {
+		case ka != nil:
+			replyKey, err = cl.pkinitReplyKey(ka, ASReq.ReqBody.Nonce, ASRep.EncPart.EType, realm, append(fastRep.PAData, ASRep.PAData...))
+			if err != nil {
+				return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: PKINIT reply from KDC is not valid")
+			}
+		case preAuth:
+			err = verifyKDCEncryptedChallenge(fastRep.PAData, armorKey, longTermKey, cl.Config.LibDefaults.Clockskew)
+			if err != nil {
+				return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: KDC's encrypted challenge is not valid")
+			}
+			replyKey = armorKey
+		default:
+			replyKey, err = cl.longTermKey(ASRep.EncPart.EType, ASRep.EncPart.KVNO, append(fastRep.PAData, ASRep.PAData...))
+			if err != nil {
+				return messages.ASRep{}, krberror.Errorf(err, krberror.DecryptingError, "AS Exchange Error: could not get key to decrypt AS_REP")
+			}
+		}
+		replyKey, err = fastRep.StrengthenReplyKey(replyKey)
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.EncryptingError, "AS Exchange Error: failed to strengthen the reply key")
+		}
+		if ok, err := ASRep.VerifyWithKey(cl.Config, replyKey, ASReq); !ok {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: AS_REP is not valid or client password/keytab incorrect")
+		}
+		if ka != nil {
+			err = verifyPKINITKX(append(fastRep.PAData, ASRep.PAData...), replyKey, ASRep.DecryptedEncPart.Key)
+			if err != nil {
+				return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: PKINIT reply from KDC is not valid")
+			}
+		}
+		return ASRep, nil
+	}
+	return messages.ASRep{}, krberror.NewErrorf(krberror.KRBMsgError, "AS Exchange Error: pre-authentication with the KDC within FAST did not complete after %d attempts", maxFASTASAttempts)
+}
+
+// fastArmor creates FAST armor for an AS exchange with the realm's KDC from the TGT of the armor client.
+func (cl *Client) fastArmor(ctx context.Context, realm string) (messages.KrbFastArmor, types.EncryptionKey, error) {
+	acl := cl.armorClient()
+	tgt, skey, err := acl.sessionTGT(ctx, realm)
+	if err != nil {
+		return messages.KrbFastArmor{}, types.EncryptionKey{}, err
+	}
+	return messages.NewFASTArmorAPReq(tgt, skey, acl.Credentials.CName(), acl.Credentials.Domain())
+}
+
+// armorClient returns the client whose TGT is used to armor AS exchanges. If no FASTArmor client is configured an
+// anonymous client, which obtains its TGT with anonymous PKINIT using the client's settings, is created on first use.
+func (cl *Client) armorClient() *Client {
+	if acl := cl.settings.FASTArmor(); acl != nil {
+		return acl
+	}
+	cl.anonArmorMux.Lock()
+	defer cl.anonArmorMux.Unlock()
+	if cl.anonArmor == nil {
+		s := *cl.settings
+		s.requireFAST = false
+		s.assumePreAuthentication = false
+		s.preAuthEType = 0
+		s.ccachePath = ""
+		s.cacheObserver = nil
+		cl.anonArmor = &Client{
+			Credentials: credentials.NewAnonymous(cl.Credentials.Domain()),
+			Config:      cl.Config,
+			settings:    &s,
+			sessions: &sessions{
+				Entries: make(map[string]*session),
+			},
+			cache: newCache(&s),
+		}
+	}
+	return cl.anonArmor
+}
+
+// encryptedChallenge generates the PA-ENCRYPTED-CHALLENGE pre-authentication data.
+// The client's long term key used to derive the challenge key is also returned.
+func (cl *Client) encryptedChallenge(armorKey types.EncryptionKey, krberr *messages.KRBError) (types.PAData, types.EncryptionKey, error) {
+	key, _, err := cl.preAuthKey(krberr)
+	if err != nil {
+		return types.PAData{}, key, err
+	}
+	challengeKey, err := crypto.KRBFXCF2(armorKey, key, "clientchallengearmor", "challengelongterm")
+	if err != nil {
+		return types.PAData{}, key, krberror.Errorf(err, krberror.EncryptingError, "error generating client challenge key")
+	}
+	paTSb, err := types.GetPAEncTSEncAsnMarshalled()
+	if err != nil {
+		return types.PAData{}, key, krberror.Errorf(err, krberror.KRBMsgError, "error creating PAEncTSEnc for encrypted challenge")
+	}
+	ed, err := crypto.GetEncryptedData(paTSb, challengeKey, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT, 0)
+	if err != nil {
+		return types.PAData{}, key, krberror.Errorf(err, krberror.EncryptingError, "error encrypting challenge timestamp")
+	}
+	pb, err := ed.Marshal()
+	if err != nil {
+		return types.PAData{}, key, krberror.Errorf(err, krberror.EncodingError, "error marshaling the encrypted challenge")
+	}
+	return types.PAData{
+		PADataType:  patype.PA_ENCRYPTED_CHALLENGE,
+		PADataValue: pb,
+	}, key, nil
+}
+
+// verifyKDCEncryptedChallenge checks the KDC's PA-ENCRYPTED-CHALLENGE to authenticate the KDC. An error is returned if
+// the KDC did not include one.
+func verifyKDCEncryptedChallenge(pas types.PADataSequence, armorKey, longTermKey types.EncryptionKey, skew time.Duration) error {
+	for _, pa := range pas {
+		if pa.PADataType != patype.PA_ENCRYPTED_CHALLENGE {
+			continue
+		}
+		var ed types.EncryptedData
+		err := ed.Unmarshal(pa.PADataValue)
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC encrypted challenge")
+		}
+		challengeKey, err := crypto.KRBFXCF2(armorKey, longTermKey, "kdcchallengearmor", "challengelongterm")
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncryptingError, "error generating KDC challenge key")
+		}
+		b, err := crypto.DecryptEncPart(ed, challengeKey, keyusage.KEY_USAGE_ENC_CHALLENGE_KDC)
+		if err != nil {
+			return krberror.Errorf(err, krberror.DecryptingError, "error decrypting KDC encrypted challenge")
+		}
+		var ts types.PAEncTSEnc
+		err = ts.Unmarshal(b)
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC encrypted challenge timestamp")
+		}
+		t := time.Now().UTC()
+		if t.Sub(ts.PATimestamp) > skew || ts.PATimestamp.Sub(t) > skew {
+			return krberror.NewErrorf(krberror.KRBMsgError, "clock skew with KDC too large. Greater than %v seconds", skew.Seconds())
+		}
+		return nil
+	}
+	return krberror.NewErrorf(krberror.KRBMsgError, "KDC did not return an encrypted challenge")
+}
+
+// longTermKey returns the client's long term key for the etype, using any salt information within the PAData provided.
+func (cl *Client) longTermKey(etypeID int32, kvno int, pas types.PADataSequence) (types.EncryptionKey, error) {
+	if cl.Credentials.HasKeytab() {
+		key, _, err := cl.Credentials.Keytab().GetEncryptionKey(cl.Credentials.CName(), cl.Credentials.Domain(), kvno, etypeID)
+		return key, err
+	}
+	if cl.Credentials.HasPassword() {
+		key, _, err := crypto.GetKeyFromPassword(cl.Credentials.Password(), cl.Credentials.CName(), cl.Credentials.Domain(), etypeID, pas)
+		return key, err
+	}
+	return types.EncryptionKey{}, krberror.NewErrorf(krberror.DecryptingError, "credential has neither keytab or password to generate key")
+}
+
+// newSubKey generates a sub-session key of the encryption type of the session key.
+func newSubKey(sessionKey types.EncryptionKey) (types.EncryptionKey, error) {
+	et, err := crypto.GetEtype(sessionKey.KeyType)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "TGS Exchange Error: failed to get etype for sub-session key")
+	}
+	subKey, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		return subKey, krberror.Errorf(err, krberror.EncryptingError, "TGS Exchange Error: failed to generate sub-session key")
+	}
+	return subKey, nil
+}
+
+// armoredTGSExchange armors the TGS_REQ, whose authenticator must carry the sub-session key provided, with FAST and
+// exchanges it with the KDC. The TGS_REP returned is decrypted but not verified against the request. The PAData of the
+// FAST response, such as the KDC's PA-S4U-X509-USER, precede any of the TGS_REP itself.
+func (cl *Client) armoredTGSExchange(ctx context.Context, tgsReq *messages.TGSReq, kdcRealm string, sessionKey, subKey types.EncryptionKey) (messages.TGSRep, error) {
+	var tgsRep messages.TGSRep
+	armorKey, err := crypto.KRBFXCF2(subKey, sessionKey, "subkeyarmor", "ticketarmor")
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncryptingError, "TGS Exchange Error: failed to generate FAST armor key")
+	}
+	// The FAST request checksum is over the AP_REQ within the PA-TGS-REQ
+	var apb []byte
+	for _, pa := range tgsReq.PAData {
+		if pa.PADataType == patype.PA_TGS_REQ {
+			apb = pa.PADataValue
+		}
+	}
+	fastReq := messages.KrbFastReq{
+		FastOptions: types.NewKrbFlags(),
+		PAData:      types.PADataSequence{},
+		ReqBody:     tgsReq.ReqBody,
+	}
+	armoredReq, err := messages.NewKrbFastArmoredReq(nil, armorKey, fastReq, apb)
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed creating FAST armored request")
+	}
+	fastPA, err := armoredReq.PAData()
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed marshaling FAST armored request")
+	}
+	tgsReq.PAData = append(tgsReq.PAData, fastPA)
+
+	b, err := tgsReq.Marshal()
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to marshal TGS_REQ")
+	}
+	r, err := cl.sendToKDC(ctx, b, kdcRealm)
+	if err != nil {
+		if e, ok := err.(messages.KRBError); ok {
+			fe, _, ferr := fastKRBError(e, armorKey)
+			if ferr == nil {
+				err = fe
+			}
+			return tgsRep, krberror.Errorf(err, krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC when requesting for %s", tgsReq.ReqBody.SName.PrincipalNameString())
+		}
+		return tgsRep, krberror.Errorf(err, krberror.NetworkingError, "TGS Exchange Error: issue sending TGS_REQ to KDC")
+	}
+	err = tgsRep.Unmarshal(r)
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
+	}
+	replyKey := subKey
+	if _, armored, _ := messages.GetFASTArmoredRep(types.PADataSequence(tgsRep.PAData)); armored || cl.settings.RequireFAST() {
+		fastRep, err := fastResponse(types.PADataSequence(tgsRep.PAData), armorKey, tgsReq.ReqBody.Nonce, tgsRep.Ticket)
+		if err != nil {
+			return tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: FAST response from KDC is not valid")
+		}
+		tgsRep.CName = fastRep.Finished.CName
+		tgsRep.CRealm = fastRep.Finished.CRealm
+		tgsRep.PAData = append(fastRep.PAData, tgsRep.PAData...)
+		replyKey, err = fastRep.StrengthenReplyKey(subKey)
+		if err != nil {
+			return tgsRep, krberror.Errorf(err, krberror.EncryptingError, "TGS Exchange Error: failed to strengthen the reply key")
+		}
+	}
+	err = tgsRep.DecryptEncPartWithSubKey(replyKey)
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
+	}
+	return tgsRep, nil
+}
+
+// fastKRBError extracts the KRBError carried in the PA-FX-ERROR of the FAST response within the e-data of the KRBError
+// returned by the KDC. The PAData of the FAST response is also returned and is set as the e-data of the KRBError returned.
+// If the KDC's KRBError is not FAST armored it is returned as is.
+func fastKRBError(e messages.KRBError, armorKey types.EncryptionKey) (messages.KRBError, types.PADataSequence, error) {
+	var pas types.PADataSequence
+	if len(e.EData) < 1 {
+		return e, pas, nil
+	}
+	err := pas.Unmarshal(e.EData)
+	if err != nil {
+		// e-data is not PAData so this is not an armored error
+		return e, types.PADataSequence{}, nil
+	}
+	fastRep, ok, err := messages.GetFASTArmoredRep(pas)
+	if err != nil {
+		return e, pas, err
+	}
+	if !ok {
+		return e, pas, nil
+	}
+	err = fastRep.DecryptEncPart(armorKey)
+	if err != nil {
+		return e, pas, err
+	}
+	fpas := fastRep.DecryptedEncPart.PAData
+	fe := e
+	for _, pa := range fpas {
+		if pa.PADataType == patype.PA_FX_ERROR {
+			err = fe.Unmarshal(pa.PADataValue)
+			if err != nil {
+				return e, fpas, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-FX-ERROR")
+			}
+			break
+		}
+	}
+	fe.EData, err = asn1.Marshal(fpas)
+	if err != nil {
+		return e, fpas, krberror.Errorf(err, krberror.EncodingError, "error marshaling FAST error PAData")
+	}
+	return fe, fpas, nil
+}
+
+// fastResponse decrypts and validates the KrbFastResponse within the PA-FX-FAST PAData of a KDC reply.
+func fastResponse(pas types.PADataSequence, armorKey types.EncryptionKey, nonce int, tkt messages.Ticket) (messages.KrbFastResponse, error) {
+	fastRep, ok, err := messages.GetFASTArmoredRep(pas)
+	if err != nil {
+		return messages.KrbFastResponse{}, err
+	}
+	if !ok {
+		return messages.KrbFastResponse{}, krberror.NewErrorf(krberror.KRBMsgError, "KDC reply to a FAST armored request is not armored")
+	}
+	err = fastRep.DecryptEncPart(armorKey)
+	if err != nil {
+		return messages.KrbFastResponse{}, err
+	}
+	r := fastRep.DecryptedEncPart
+	if r.Nonce != nonce {
+		return r, krberror.NewErrorf(krberror.KRBMsgError, "possible replay attack, nonce in FAST response does not match that in request")
+	}
+	err = r.VerifyFinished(armorKey, tkt)
+	if err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// fastTGS indicates if TGS exchanges with the realm's KDC should be protected with FAST armor. They are if FAST is
+// required or, when a FASTArmor client is configured, if the KDC advertised FAST support when issuing the realm's TGT.
+func (cl *Client) fastTGS(realm string) bool {
+	if cl.settings.DisablePAFXFAST() {
+		return false
+	}
+	if cl.settings.RequireFAST() {
+		return true
+	}
+	if cl.settings.FASTArmor() == nil {
+		return false
+	}
+	s, ok := cl.sessions.get(realm)
+	return ok && s.fastAvailable()
+}
+
+// fastTGSExchange performs a TGS exchange protected by FAST using the implicit armor of the TGS_REQ authenticator's subkey.
+func (cl *Client) fastTGSExchange(ctx context.Context, spn types.PrincipalName, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, renewal bool, referral int) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
+	subKey, err := newSubKey(sessionKey)
+	if err != nil {
+		return tgsReq, tgsRep, err
+	}
+	tgsReq, err = messages.NewTGSReqWithSubKey(cl.Credentials.CName(), kdcRealm, cl.Config, tgt, sessionKey, subKey, spn, renewal)
+	if err != nil {
+		return tgsReq, tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new TGS_REQ")
+	}
+	tgsRep, err = cl.armoredTGSExchange(ctx, &tgsReq, kdcRealm, sessionKey, subKey)
+	if err != nil {
+		return tgsReq, tgsRep, err
+	}
+	if ok, err := tgsRep.Verify(cl.Config, tgsReq); !ok {
+		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: TGS_REP is not valid")
+	}
+
+	if tgsRep.Ticket.SName.NameString[0] == "krbtgt" && !tgsRep.Ticket.SName.Equal(tgsReq.ReqBody.SName) {
+		if referral > 5 {
+			return tgsReq, tgsRep, krberror.NewErrorf(krberror.KRBMsgError, "TGS Exchange Error: maximum number of referrals exceeded")
+		}
+		// Server referral https://tools.ietf.org/html/rfc6806.html#section-8
+		cl.addSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
+		realm := tgsRep.Ticket.SName.NameString[len(tgsRep.Ticket.SName.NameString)-1]
+		referral++
+		if cl.fastTGS(realm) {
+			return cl.fastTGSExchange(ctx, spn, realm, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, renewal, referral)
+		}
+		tgsReq, err = messages.NewTGSReq(cl.Credentials.CName(), realm, cl.Config, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, spn, renewal)
+		if err != nil {
+			return tgsReq, tgsRep, err
+		}
+		return cl.tgsExchange(ctx, tgsReq, realm, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, referral)
+	}
+	cl.cacheServiceTicket(tgsRep)
+	return tgsReq, tgsRep, nil
+}
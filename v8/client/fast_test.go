@@ -0,0 +1,400 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	stdasn1 "encoding/asn1"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4556"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/test/kdc"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fastRecorder is a transport to a KDC that records the AS_REQs and TGS_REQs sent to it and the errors returned.
+type fastRecorder struct {
+	k    *kdc.KDC
+	mux  sync.Mutex
+	as   []messages.ASReq
+	tgs  []messages.TGSReq
+	errs []messages.KRBError
+}
+
+func (r *fastRecorder) Exchange(ctx context.Context, network, address string, b []byte) ([]byte, error) {
+	var as messages.ASReq
+	var tgs messages.TGSReq
+	var kerr messages.KRBError
+	rb := r.k.Handle(b)
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if as.Unmarshal(b) == nil {
+		r.as = append(r.as, as)
+	} else if tgs.Unmarshal(b) == nil {
+		r.tgs = append(r.tgs, tgs)
+	}
+	if kerr.Unmarshal(rb) == nil {
+		r.errs = append(r.errs, kerr)
+	}
+	return rb, nil
+}
+
+// asReqs returns the AS_REQs recorded for the client, and how many of them were FAST armored.
+func (r *fastRecorder) asReqs(cname string) (n, armored int) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, as := range r.as {
+		if as.ReqBody.CName.PrincipalNameString() != cname {
+			continue
+		}
+		n++
+		if as.PAData.Contains(patype.PA_FX_FAST) {
+			armored++
+		}
+	}
+	return
+}
+
+// tgsReqs returns the number of TGS_REQs recorded, and how many of them were FAST armored.
+func (r *fastRecorder) tgsReqs() (n, armored int) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, tgs := range r.tgs {
+		n++
+		if tgs.PAData.Contains(patype.PA_FX_FAST) {
+			armored++
+		}
+	}
+	return
+}
+
+func TestFASTASExchange(t *testing.T) {
+	t.Parallel()
+	k, cfg := transportTestKDC(t, kdc.RequirePreAuth(true), kdc.FAST(true))
+	err := k.AddPrincipal("host/armor.test.gokrb5", "armorpassword")
+	if err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	r := &fastRecorder{k: k}
+	acl := NewWithPassword("host/armor.test.gokrb5", "TEST.GOKRB5", "armorpassword", cfg, KDCTransport(r))
+	defer acl.Destroy()
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, FASTArmor(acl), KDCTransport(r))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in with FAST: %v", err)
+	}
+	defer cl.Destroy()
+
+	// The first armored AS_REQ has no pre-authentication so the KDC returns its error within the FAST response with
+	// its cookie, which the client must return with its encrypted challenge.
+	n, armored := r.asReqs("testuser1")
+	assert.Equal(t, 2, n, "number of AS_REQs not as expected")
+	assert.Equal(t, 2, armored, "all AS_REQs should be armored")
+	if assert.NotEmpty(t, r.errs, "KDC should have returned an error requiring pre-authentication") {
+		var pas types.PADataSequence
+		err = pas.Unmarshal(r.errs[0].EData)
+		if err != nil {
+			t.Fatalf("error unmarshaling KRBError e-data: %v", err)
+		}
+		assert.True(t, pas.Contains(patype.PA_FX_FAST), "KDC error should carry the FAST armored error")
+	}
+	s, ok := cl.sessions.get("TEST.GOKRB5")
+	if !ok {
+		t.Fatal("client has no TGT session")
+	}
+	assert.True(t, s.fastAvailable(), "KDC should have advertised FAST support")
+	_, tkt, _ := s.tgtDetails()
+	assert.Equal(t, "krbtgt/TEST.GOKRB5", tkt.SName.PrincipalNameString(), "TGT service not as expected")
+
+	tgsTkt, _, err := cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket with FAST: %v", err)
+	}
+	n, armored = r.tgsReqs()
+	assert.Equal(t, 1, n, "number of TGS_REQs not as expected")
+	assert.Equal(t, 1, armored, "TGS_REQ should be armored as the KDC advertised FAST")
+	skt, err := k.Keytab("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	err = tgsTkt.DecryptEncPart(skt, &tgsTkt.SName)
+	if err != nil {
+		t.Fatalf("service could not decrypt ticket: %v", err)
+	}
+	assert.Equal(t, "testuser1", tgsTkt.DecryptedEncPart.CName.PrincipalNameString(), "ticket client not as expected")
+	assert.True(t, types.IsFlagSet(&tgsTkt.DecryptedEncPart.Flags, flags.PreAuthent), "pre-authent flag should be set")
+}
+
+func TestFASTASExchange_WrongPassword(t *testing.T) {
+	t.Parallel()
+	k, cfg := transportTestKDC(t, kdc.RequirePreAuth(true), kdc.FAST(true))
+	r := &fastRecorder{k: k}
+	acl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, KDCTransport(r))
+	defer acl.Destroy()
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "wrongpassword", cfg, FASTArmor(acl), KDCTransport(r))
+	err := cl.Login()
+	if assert.Error(t, err, "login with the wrong password should fail") {
+		assert.Contains(t, err.Error(), "KDC_ERR_PREAUTH_FAILED", "error should be the KDC's error from within the FAST response")
+	}
+}
+
+func TestFASTTGSExchange_NotConfigured(t *testing.T) {
+	t.Parallel()
+	k, cfg := transportTestKDC(t, kdc.FAST(true))
+	r := &fastRecorder{k: k}
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, KDCTransport(r))
+	err := cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	defer cl.Destroy()
+	s, _ := cl.sessions.get("TEST.GOKRB5")
+	assert.True(t, s.fastAvailable(), "KDC should have advertised FAST support")
+	_, _, err = cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	n, armored := r.tgsReqs()
+	assert.Equal(t, 1, n, "number of TGS_REQs not as expected")
+	assert.Equal(t, 0, armored, "TGS_REQ should not be armored without a FAST armor client or FAST being required")
+}
+
+func TestRequireFAST_ForwardedTGT(t *testing.T) {
+	t.Parallel()
+	k, cfg := transportTestKDC(t, kdc.FAST(true))
+	cfg.LibDefaults.Forwardable = true
+	err := k.AddPrincipal("host/armor.test.gokrb5", "armorpassword")
+	if err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	r := &fastRecorder{k: k}
+	acl := NewWithPassword("host/armor.test.gokrb5", "TEST.GOKRB5", "armorpassword", cfg, KDCTransport(r))
+	defer acl.Destroy()
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, FASTArmor(acl), RequireFAST(true), KDCTransport(r))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	defer cl.Destroy()
+	tkt, dep, err := cl.GetForwardedTGT()
+	if err != nil {
+		t.Fatalf("error getting forwarded TGT with FAST required: %v", err)
+	}
+	assert.Equal(t, "krbtgt/TEST.GOKRB5", tkt.SName.PrincipalNameString(), "forwarded TGT service not as expected")
+	assert.True(t, types.IsFlagSet(&dep.Flags, flags.Forwarded), "TGT should be forwarded")
+	n, armored := r.tgsReqs()
+	assert.Equal(t, 1, n, "number of TGS_REQs not as expected")
+	assert.Equal(t, 1, armored, "forwarded TGT request should be FAST armored")
+}
+
+func TestRequireFAST_AnonymousArmor(t *testing.T) {
+	t.Parallel()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	san, err := rfc4556.PrincipalNameExtension(rfc4556.KRB5PrincipalName{
+		Realm:         "TEST.GOKRB5",
+		PrincipalName: types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+	})
+	if err != nil {
+		t.Fatalf("error creating id-pkinit-san extension: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:       big.NewInt(1),
+		Subject:            pkix.Name{CommonName: "kdc"},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(time.Hour),
+		KeyUsage:           x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		UnknownExtKeyUsage: []stdasn1.ObjectIdentifier{stdasn1.ObjectIdentifier(rfc4556.OIDPKINITKPKdc)},
+		ExtraExtensions:    []pkix.Extension{san},
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(b)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	k, cfg := transportTestKDC(t, kdc.RequirePreAuth(true), kdc.FAST(true),
+		kdc.PKINIT([]*x509.Certificate{cert}, key, nil), kdc.Anonymous(true))
+	r := &fastRecorder{k: k}
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, RequireFAST(true), PKINITTrustPool(roots), KDCTransport(r))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in with anonymous FAST armor: %v", err)
+	}
+	n, armored := r.asReqs("WELLKNOWN/ANONYMOUS")
+	assert.Equal(t, 1, n, "the anonymous armor TGT should be obtained with one AS_REQ")
+	assert.Equal(t, 0, armored, "the anonymous AS_REQ should not be armored")
+	n, armored = r.asReqs("testuser1")
+	assert.True(t, n > 0, "client should have sent AS_REQs")
+	assert.Equal(t, n, armored, "all of the client's AS_REQs should be armored")
+	_, _, err = cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket with FAST required: %v", err)
+	}
+	n, armored = r.tgsReqs()
+	assert.Equal(t, 1, n, "number of TGS_REQs not as expected")
+	assert.Equal(t, 1, armored, "TGS_REQ should be armored when FAST is required")
+
+	acl := cl.anonArmor
+	if !assert.NotNil(t, acl, "client should have an anonymous armor client") {
+		return
+	}
+	assert.True(t, acl.Credentials.Anonymous(), "armor client should be anonymous")
+	cl.Destroy()
+	assert.Nil(t, cl.anonArmor, "anonymous armor client should be removed when the client is destroyed")
+	_, ok := acl.sessions.get("TEST.GOKRB5")
+	assert.False(t, ok, "anonymous armor client's TGT should be destroyed")
+}
+
+func TestVerifyKDCEncryptedChallenge(t *testing.T) {
+	t.Parallel()
+	armorKey, longTermKey := fastTestKey(t), fastTestKey(t)
+	challenge := func(pepper string, usage uint32) types.PADataSequence {
+		key, err := crypto.KRBFXCF2(armorKey, longTermKey, pepper, "challengelongterm")
+		if err != nil {
+			t.Fatalf("error generating challenge key: %v", err)
+		}
+		ts, _ := types.GetPAEncTSEncAsnMarshalled()
+		ed, err := crypto.GetEncryptedData(ts, key, usage, 0)
+		if err != nil {
+			t.Fatalf("error encrypting challenge: %v", err)
+		}
+		b, _ := ed.Marshal()
+		return types.PADataSequence{{PADataType: patype.PA_ENCRYPTED_CHALLENGE, PADataValue: b}}
+	}
+	skew := 5 * time.Minute
+	assert.NoError(t, verifyKDCEncryptedChallenge(challenge("kdcchallengearmor", keyusage.KEY_USAGE_ENC_CHALLENGE_KDC), armorKey, longTermKey, skew),
+		"KDC encrypted challenge should be valid")
+	assert.Error(t, verifyKDCEncryptedChallenge(challenge("kdcchallengearmor", keyusage.KEY_USAGE_ENC_CHALLENGE_KDC), armorKey, fastTestKey(t), skew),
+		"KDC encrypted challenge with another long term key should not be valid")
+	assert.Error(t, verifyKDCEncryptedChallenge(challenge("clientchallengearmor", keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT), armorKey, longTermKey, skew),
+		"the client's encrypted challenge should not be accepted as the KDC's")
+	assert.Error(t, verifyKDCEncryptedChallenge(types.PADataSequence{}, armorKey, longTermKey, skew),
+		"a missing KDC encrypted challenge should not be accepted")
+}
+
+func TestFastResponse(t *testing.T) {
+	t.Parallel()
+	armorKey := fastTestKey(t)
+	tkt := messages.Ticket{
+		TktVNO: 5,
+		Realm:  "TEST.GOKRB5",
+		SName:  types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+		EncPart: types.EncryptedData{
+			EType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+			Cipher: []byte("ticket"),
+		},
+	}
+	other := tkt
+	other.Realm = "OTHER.GOKRB5"
+	rep := func(key types.EncryptionKey, nonce int, tkt messages.Ticket) types.PADataSequence {
+		et, _ := crypto.GetEtype(armorKey.KeyType)
+		b, _ := tkt.Marshal()
+		cb, err := et.GetChecksumHash(armorKey.KeyValue, b, keyusage.KEY_USAGE_FAST_FINISHED)
+		if err != nil {
+			t.Fatalf("error generating finished checksum: %v", err)
+		}
+		a, err := messages.NewKrbFastArmoredRep(key, messages.KrbFastResponse{
+			PAData: types.PADataSequence{},
+			Finished: messages.KrbFastFinished{
+				Timestamp:      time.Now().UTC().Truncate(time.Second),
+				CRealm:         "TEST.GOKRB5",
+				CName:          types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"),
+				TicketChecksum: types.Checksum{CksumType: et.GetHashID(), Checksum: cb},
+			},
+			Nonce: nonce,
+		})
+		if err != nil {
+			t.Fatalf("error generating FAST response: %v", err)
+		}
+		pa, err := a.PAData()
+		if err != nil {
+			t.Fatalf("error marshaling FAST response: %v", err)
+		}
+		return types.PADataSequence{pa}
+	}
+
+	r, err := fastResponse(rep(armorKey, 1, tkt), armorKey, 1, tkt)
+	if assert.NoError(t, err, "FAST response should be valid") {
+		assert.Equal(t, "testuser1", r.Finished.CName.PrincipalNameString(), "finished client name not as expected")
+	}
+	_, err = fastResponse(rep(armorKey, 2, tkt), armorKey, 1, tkt)
+	assert.Error(t, err, "FAST response with another nonce should not be valid")
+	_, err = fastResponse(rep(armorKey, 1, other), armorKey, 1, tkt)
+	assert.Error(t, err, "FAST response with the finished checksum of another ticket should not be valid")
+	_, err = fastResponse(rep(fastTestKey(t), 1, tkt), armorKey, 1, tkt)
+	assert.Error(t, err, "FAST response encrypted with another key should not be valid")
+	_, err = fastResponse(types.PADataSequence{}, armorKey, 1, tkt)
+	assert.Error(t, err, "reply without a FAST response should not be valid")
+}
+
+func TestFastKRBError(t *testing.T) {
+	t.Parallel()
+	armorKey := fastTestKey(t)
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5")
+	inner := messages.NewKRBError(sname, "TEST.GOKRB5", errorcode.KDC_ERR_PREAUTH_REQUIRED, "pre-authentication required")
+	ib, _ := inner.Marshal()
+	cookie := types.PAData{PADataType: patype.PA_FX_COOKIE, PADataValue: []byte("cookie")}
+	a, err := messages.NewKrbFastArmoredRep(armorKey, messages.KrbFastResponse{
+		PAData: types.PADataSequence{
+			{PADataType: patype.PA_ENCRYPTED_CHALLENGE},
+			cookie,
+			{PADataType: patype.PA_FX_ERROR, PADataValue: ib},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error generating FAST response: %v", err)
+	}
+	pa, _ := a.PAData()
+	outer := messages.NewKRBError(sname, "TEST.GOKRB5", errorcode.KDC_ERR_PREAUTH_REQUIRED, "")
+	outer.EData, _ = asn1.Marshal(types.PADataSequence{pa})
+
+	fe, pas, err := fastKRBError(outer, armorKey)
+	if err != nil {
+		t.Fatalf("error processing FAST error: %v", err)
+	}
+	assert.Equal(t, errorcode.KDC_ERR_PREAUTH_REQUIRED, fe.ErrorCode, "error code not as expected")
+	assert.Equal(t, "pre-authentication required", fe.EText, "error text should be that of the PA-FX-ERROR")
+	assert.Contains(t, pas, cookie, "FAST response PAData should contain the cookie")
+	var epas types.PADataSequence
+	err = epas.Unmarshal(fe.EData)
+	if err != nil {
+		t.Fatalf("error unmarshaling e-data: %v", err)
+	}
+	assert.True(t, epas.Contains(patype.PA_ENCRYPTED_CHALLENGE), "e-data should be the FAST response PAData")
+
+	_, _, err = fastKRBError(outer, fastTestKey(t))
+	assert.Error(t, err, "FAST error encrypted with another key should not be valid")
+	plain := messages.NewKRBError(sname, "TEST.GOKRB5", errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN, "unknown")
+	fe, _, err = fastKRBError(plain, armorKey)
+	assert.NoError(t, err, "KRBError that is not armored should be returned as is")
+	assert.Equal(t, plain.ErrorCode, fe.ErrorCode, "error code not as expected")
+}
+
+func fastTestKey(t *testing.T) types.EncryptionKey {
+	et, err := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting etype: %v", err)
+	}
+	key, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	return key
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// serverHealthExpiry is how long the result of an exchange with a KDC or kpasswd server is remembered for.
+const serverHealthExpiry = 5 * time.Minute
+
+// Ranks of servers by health, in the order they are tried in.
+const (
+	rankHealthy = iota
+	rankUnknown
+	rankFailed
+	rankDown
+)
+
+// serverStatus tracks the success and failure of exchanges with KDCs and kpasswd servers so that servers that have
+// recently responded are preferred, and those that have failed to respond are tried after the others.
+type serverStatus struct {
+	mux    sync.Mutex
+	health map[string]serverHealth
+}
+
+// serverHealth is the result of the last exchange with a server.
+type serverHealth struct {
+	ok        bool
+	at        time.Time
+	downUntil time.Time
+}
+
+// markDown records that the server at the address failed to respond, marking it down until the time provided.
+// A zero time records the failure without marking the server down.
+func (s *serverStatus) markDown(address string, until time.Time) {
+	s.set(address, serverHealth{at: time.Now(), downUntil: until})
+}
+
+// markUp records that the server at the address responded, clearing any mark of it being down.
+func (s *serverStatus) markUp(address string) {
+	s.set(address, serverHealth{ok: true, at: time.Now()})
+}
+
+func (s *serverStatus) set(address string, h serverHealth) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.health == nil {
+		s.health = make(map[string]serverHealth)
+	}
+	s.health[address] = h
+}
+
+// rank returns the rank of the server at the address, forgetting the result of its last exchange if it has expired.
+// The caller must hold the lock.
+func (s *serverStatus) rank(address string, now time.Time) int {
+	h, ok := s.health[address]
+	if !ok {
+		return rankUnknown
+	}
+	if now.Before(h.downUntil) {
+		return rankDown
+	}
+	if now.Sub(h.at) >= serverHealthExpiry {
+		delete(s.health, address)
+		return rankUnknown
+	}
+	if h.ok {
+		return rankHealthy
+	}
+	return rankFailed
+}
+
+// order returns the servers, keyed on preference order, with those that last responded first, followed by those
+// without a recent result, then those that last failed and lastly those that are marked down, so that they are only
+// tried if none of the others respond. The preference order is kept between servers of the same health.
+func (s *serverStatus) order(servers map[int]string) map[int]string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if len(s.health) < 1 {
+		return servers
+	}
+	now := time.Now()
+	addrs := make([]string, len(servers))
+	ranks := make(map[string]int, len(servers))
+	for i := 1; i <= len(servers); i++ {
+		addrs[i-1] = servers[i]
+		ranks[servers[i]] = s.rank(servers[i], now)
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return ranks[addrs[i]] < ranks[addrs[j]]
+	})
+	ordered := make(map[int]string, len(servers))
+	for i, a := range addrs {
+		ordered[i+1] = a
+	}
+	return ordered
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/messages"
+)
+
+// Reference: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-kkdcp
+
+const (
+	// kdcProxyTimeout is the maximum time for an exchange with a KDC proxy when an HTTP client is not configured.
+	kdcProxyTimeout = 15 * time.Second
+	// kdcProxyContentType is the content type of the KDC proxy request and reply.
+	kdcProxyContentType = "application/kerberos"
+	// kdcProxyMaxReply is the maximum size of a KDC proxy reply that will be read.
+	kdcProxyMaxReply = 1 << 20
+)
+
+var defaultKDCProxyClient = &http.Client{Timeout: kdcProxyTimeout}
+
+// isKDCProxy indicates if the KDC or kpasswd server address from the configuration is the URL of a KDC proxy, as in
+// kdc = https://proxy.example.com/KdcProxy
+func isKDCProxy(address string) bool {
+	return strings.HasPrefix(strings.ToLower(address), "https://")
+}
+
+// withoutKDCProxies returns the servers, keyed on preference order, that are not KDC proxy URLs.
+func withoutKDCProxies(servers map[int]string) map[int]string {
+	m := make(map[int]string)
+	for i := 1; i <= len(servers); i++ {
+		if !isKDCProxy(servers[i]) {
+			m[len(m)+1] = servers[i]
+		}
+	}
+	return m
+}
+
+// kdcProxyExchange sends the message for the realm to the KDC proxy at the URL in a KDC-PROXY-MESSAGE and returns the
+// reply it carries.
+func (cl *Client) kdcProxyExchange(ctx context.Context, url, realm string, b []byte) ([]byte, error) {
+	m := messages.NewKDCProxyMessage(b, realm)
+	mb, err := m.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling KDC-PROXY-MESSAGE: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(mb))
+	if err != nil {
+		return nil, fmt.Errorf("error creating KDC proxy request: %v", err)
+	}
+	req.Header.Set("Content-Type", kdcProxyContentType)
+	req.Header.Set("Cache-Control", "no-cache")
+	resp, err := cl.settings.KDCProxyHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, kdcProxyMaxReply))
+		return nil, fmt.Errorf("KDC proxy returned HTTP status %s", resp.Status)
+	}
+	rb, err := ioutil.ReadAll(io.LimitReader(resp.Body, kdcProxyMaxReply))
+	if err != nil {
+		return nil, fmt.Errorf("error reading KDC proxy reply: %v", err)
+	}
+	var rm messages.KDCProxyMessage
+	err = rm.Unmarshal(rb)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling KDC proxy reply: %v", err)
+	}
+	return rm.Message()
+}
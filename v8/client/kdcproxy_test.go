@@ -0,0 +1,108 @@
+package client
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_KDCProxy(t *testing.T) {
+	t.Parallel()
+	k, _ := transportTestKDC(t)
+	var mux sync.Mutex
+	targets := make(map[string]int)
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != kdcProxyContentType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		var m messages.KDCProxyMessage
+		if err := m.Unmarshal(b); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		km, err := m.Message()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mux.Lock()
+		targets[r.URL.Path+" "+m.TargetDomain]++
+		mux.Unlock()
+		var rb []byte
+		if strings.HasSuffix(r.URL.Path, "/kpasswd") {
+			rb = k.HandleKPasswd(km)
+		} else {
+			rb = k.Handle(km)
+		}
+		rm := messages.NewKDCProxyMessage(rb, "")
+		mb, _ := rm.Marshal()
+		w.Header().Set("Content-Type", kdcProxyContentType)
+		w.Write(mb)
+	}))
+	s.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	s.StartTLS()
+	defer s.Close()
+
+	cfg, err := config.NewFromString("[libdefaults]\n  default_realm = TEST.GOKRB5\n\n[realms]\n  TEST.GOKRB5 = {\n    kdc = " + s.URL + "/KdcProxy\n    kpasswd_server = " + s.URL + "/KdcProxy/kpasswd\n  }\n")
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, DisablePAFXFAST(true), KDCProxyHTTPClient(s.Client()))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in through KDC proxy: %v", err)
+	}
+	defer cl.Destroy()
+	_, _, err = cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	assert.NoError(t, err, "error getting service ticket through KDC proxy")
+	ok, err := cl.ChangePasswd("newpasswordvalue")
+	assert.True(t, ok, "password should be changed through KDC proxy: %v", err)
+	assert.Equal(t, 1, targets["/KdcProxy/kpasswd TEST.GOKRB5"], "kpasswd request should be sent to the KDC proxy for the client's realm")
+	assert.Equal(t, 3, targets["/KdcProxy TEST.GOKRB5"], "KDC requests should be sent to the KDC proxy for the client's realm")
+
+	cl = NewWithPassword("testuser1", "TEST.GOKRB5", "newpasswordvalue", cfg, DisablePAFXFAST(true))
+	err = cl.Login()
+	assert.Error(t, err, "login through a KDC proxy with an untrusted certificate should fail")
+}
+
+func TestClient_KDCProxy_TCPOnly(t *testing.T) {
+	t.Parallel()
+	var mux sync.Mutex
+	var n int
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		n++
+		mux.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	s.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	s.StartTLS()
+	defer s.Close()
+
+	cfg, err := config.NewFromString("[libdefaults]\n  default_realm = TEST.GOKRB5\n\n[realms]\n  TEST.GOKRB5 = {\n    kdc = " + s.URL + "/KdcProxy\n  }\n")
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	for _, limit := range []int{1, 1465, 65535} {
+		mux.Lock()
+		n = 0
+		mux.Unlock()
+		cfg.LibDefaults.UDPPreferenceLimit = limit
+		cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, DisablePAFXFAST(true), KDCProxyHTTPClient(s.Client()))
+		err = cl.Login()
+		assert.Error(t, err, "login through a KDC proxy that is unavailable should fail")
+		mux.Lock()
+		assert.Equal(t, 1, n, "KDC proxy should only be sent the AS_REQ once with a UDP preference limit of %d", limit)
+		mux.Unlock()
+	}
+}
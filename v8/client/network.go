@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -12,13 +13,68 @@ import (
 	"github.com/jcmturner/gokrb5/v8/messages"
 )
 
-// SendToKDC performs network actions to send data to the KDC.
-func (cl *Client) sendToKDC(b []byte, realm string) ([]byte, error) {
+const (
+	// dialTimeout is the maximum time to establish a connection to, and exchange a message with, a KDC or kpasswd server.
+	dialTimeout = 5 * time.Second
+	// maxTCPReply is the maximum size of a reply read from a KDC or kpasswd server over TCP.
+	maxTCPReply = 1 << 20
+)
+
+// SendToKDC sends the marshaled message to the realm's KDCs and returns the reply. The message is sent over UDP or TCP,
+// or to KDC proxies, as configured for the realm using the client's network settings. A KRB_ERROR reply from the KDC is
+// returned as a messages.KRBError error.
+func (cl *Client) SendToKDC(b []byte, realm string) ([]byte, error) {
+	return cl.SendToKDCContext(context.Background(), b, realm)
+}
+
+// SendToKDCContext sends the marshaled message to the realm's KDCs and returns the reply.
+// If the context is done before the exchange completes the context's error is returned.
+func (cl *Client) SendToKDCContext(ctx context.Context, b []byte, realm string) ([]byte, error) {
+	rb, err := cl.sendToKDC(ctx, b, realm)
+	return rb, ctxErr(ctx, err)
+}
+
+// sendToKDC performs network actions to send data to the KDC.
+//
+// A KDC replying with an error that may be due to a password change not having replicated to it yet, such as
+// KDC_ERR_PREAUTH_FAILED, is not authoritative. In this case the message is resent to the realm's primary KDCs, if
+// there are any, as they hold the current keys. The original error is returned if the primary KDCs cannot be reached.
+func (cl *Client) sendToKDC(ctx context.Context, b []byte, realm string) ([]byte, error) {
+	rb, err := cl.sendToKDCs(ctx, b, realm, false)
+	if e, ok := err.(messages.KRBError); ok && retryPrimaryKDC(e.ErrorCode) {
+		if n, _, perr := cl.Config.GetPrimaryKDCs(realm, false); perr == nil && n > 0 {
+			cl.Log("resending to the primary KDC of realm %s after error from KDC: %v", realm, e)
+			prb, perr := cl.sendToKDCs(ctx, b, realm, true)
+			if _, ok := perr.(messages.KRBError); ok || perr == nil {
+				return prb, perr
+			}
+			if ctx.Err() != nil {
+				return prb, ctx.Err()
+			}
+		}
+	}
+	return rb, err
+}
+
+// retryPrimaryKDC indicates if a KDC error with the code should be retried with the primary KDC.
+func retryPrimaryKDC(code int32) bool {
+	switch code {
+	case errorcode.KDC_ERR_PREAUTH_FAILED, errorcode.KDC_ERR_KEY_EXPIRED:
+		return true
+	}
+	return false
+}
+
+// sendToKDCs sends the data to the realm's KDCs, or to its primary KDCs if primary is true.
+func (cl *Client) sendToKDCs(ctx context.Context, b []byte, realm string, primary bool) ([]byte, error) {
 	var rb []byte
 	if cl.Config.LibDefaults.UDPPreferenceLimit == 1 {
 		//1 means we should always use TCP
-		rb, errtcp := cl.sendKDCTCP(realm, b)
+		rb, errtcp := cl.sendKDCTCP(ctx, realm, b, primary)
 		if errtcp != nil {
+			if ctx.Err() != nil {
+				return rb, ctx.Err()
+			}
 			if e, ok := errtcp.(messages.KRBError); ok {
 				return rb, e
 			}
@@ -28,16 +84,22 @@ func (cl *Client) sendToKDC(b []byte, realm string) ([]byte, error) {
 	}
 	if len(b) <= cl.Config.LibDefaults.UDPPreferenceLimit {
 		//Try UDP first, TCP second
-		rb, errudp := cl.sendKDCUDP(realm, b)
+		rb, errudp := cl.sendKDCUDP(ctx, realm, b, primary)
 		if errudp != nil {
+			if ctx.Err() != nil {
+				return rb, ctx.Err()
+			}
 			if e, ok := errudp.(messages.KRBError); ok && e.ErrorCode != errorcode.KRB_ERR_RESPONSE_TOO_BIG {
 				// Got a KRBError from KDC
 				// If this is not a KRB_ERR_RESPONSE_TOO_BIG we will return immediately otherwise will try TCP.
 				return rb, e
 			}
 			// Try TCP
-			r, errtcp := cl.sendKDCTCP(realm, b)
+			r, errtcp := cl.sendKDCTCP(ctx, realm, b, primary)
 			if errtcp != nil {
+				if ctx.Err() != nil {
+					return r, ctx.Err()
+				}
 				if e, ok := errtcp.(messages.KRBError); ok {
 					// Got a KRBError
 					return r, e
@@ -49,14 +111,20 @@ func (cl *Client) sendToKDC(b []byte, realm string) ([]byte, error) {
 		return rb, nil
 	}
 	//Try TCP first, UDP second
-	rb, errtcp := cl.sendKDCTCP(realm, b)
+	rb, errtcp := cl.sendKDCTCP(ctx, realm, b, primary)
 	if errtcp != nil {
+		if ctx.Err() != nil {
+			return rb, ctx.Err()
+		}
 		if e, ok := errtcp.(messages.KRBError); ok {
 			// Got a KRBError from KDC so returning and not trying UDP.
 			return rb, e
 		}
-		rb, errudp := cl.sendKDCUDP(realm, b)
+		rb, errudp := cl.sendKDCUDP(ctx, realm, b, primary)
 		if errudp != nil {
+			if ctx.Err() != nil {
+				return rb, ctx.Err()
+			}
 			if e, ok := errudp.(messages.KRBError); ok {
 				// Got a KRBError
 				return rb, e
@@ -67,46 +135,63 @@ func (cl *Client) sendToKDC(b []byte, realm string) ([]byte, error) {
 	return rb, nil
 }
 
-// sendKDCUDP sends bytes to the KDC via UDP.
-func (cl *Client) sendKDCUDP(realm string, b []byte) ([]byte, error) {
+// sendKDCUDP sends bytes to the KDC, or to the primary KDC if primary is true, via UDP.
+func (cl *Client) sendKDCUDP(ctx context.Context, realm string, b []byte, primary bool) ([]byte, error) {
 	var r []byte
-	_, kdcs, err := cl.Config.GetKDCs(realm, false)
+	_, kdcs, err := cl.kdcs(realm, false, primary)
 	if err != nil {
 		return r, err
 	}
-	r, err = dialSendUDP(kdcs, b)
+	// KDC proxies are sent the message over HTTPS whatever the network so they are only sent it in the TCP pass.
+	kdcs = withoutKDCProxies(kdcs)
+	if len(kdcs) < 1 {
+		return r, fmt.Errorf("realm %s has no KDCs that are not KDC proxies to send to over UDP", realm)
+	}
+	r, err = cl.dialSend(ctx, "udp", realm, kdcs, b)
 	if err != nil {
 		return r, err
 	}
 	return checkForKRBError(r)
 }
 
-// dialSendUDP establishes a UDP connection to a KDC.
-func dialSendUDP(kdcs map[int]string, b []byte) ([]byte, error) {
+// dialSend sends the message for the realm to each of the servers in turn over the network, either "udp" or "tcp",
+// using the client's transport until a reply is received. Servers that are KDC proxy URLs are sent the message over
+// HTTPS whatever the network. Servers that recently responded are tried first and those that recently failed are
+// tried after the others. If a cooldown is configured servers that fail are marked down and only tried if none of the
+// others respond until the cooldown has passed.
+func (cl *Client) dialSend(ctx context.Context, network, realm string, servers map[int]string, b []byte) ([]byte, error) {
+	t := cl.settings.KDCTransport()
+	cooldown := cl.settings.KDCCooldown()
+	servers = cl.servers.order(servers)
 	var errs []string
-	for i := 1; i <= len(kdcs); i++ {
-		conn, err := net.DialTimeout("udp", kdcs[i], 5*time.Second)
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("error establishing connection to %s: %v", kdcs[i], err))
-			continue
-		}
-		if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
-			errs = append(errs, fmt.Sprintf("error setting deadline on connection to %s: %v", kdcs[i], err))
-			continue
+	for i := 1; i <= len(servers); i++ {
+		var rb []byte
+		var err error
+		if isKDCProxy(servers[i]) {
+			rb, err = cl.kdcProxyExchange(ctx, servers[i], realm, b)
+		} else {
+			rb, err = t.Exchange(ctx, network, servers[i], b)
 		}
-		// conn is guaranteed to be a UDPConn
-		rb, err := sendUDP(conn.(*net.UDPConn), b)
 		if err != nil {
-			errs = append(errs, fmt.Sprintf("error sneding to %s: %v", kdcs[i], err))
+			if ctxDone(ctx) {
+				return nil, ctx.Err()
+			}
+			var until time.Time
+			if cooldown > 0 {
+				until = time.Now().Add(cooldown)
+			}
+			cl.servers.markDown(servers[i], until)
+			errs = append(errs, fmt.Sprintf("error sending to %s: %v", servers[i], err))
 			continue
 		}
+		cl.servers.markUp(servers[i])
 		return rb, nil
 	}
 	return nil, fmt.Errorf("error sending to a KDC: %s", strings.Join(errs, "; "))
 }
 
 // sendUDP sends bytes to connection over UDP.
-func sendUDP(conn *net.UDPConn, b []byte) ([]byte, error) {
+func sendUDP(conn net.Conn, b []byte) ([]byte, error) {
 	var r []byte
 	defer conn.Close()
 	_, err := conn.Write(b)
@@ -114,7 +199,7 @@ func sendUDP(conn *net.UDPConn, b []byte) ([]byte, error) {
 		return r, fmt.Errorf("error sending to (%s): %v", conn.RemoteAddr().String(), err)
 	}
 	udpbuf := make([]byte, 4096)
-	n, _, err := conn.ReadFrom(udpbuf)
+	n, err := conn.Read(udpbuf)
 	r = udpbuf[:n]
 	if err != nil {
 		return r, fmt.Errorf("sending over UDP failed to %s: %v", conn.RemoteAddr().String(), err)
@@ -125,47 +210,36 @@ func sendUDP(conn *net.UDPConn, b []byte) ([]byte, error) {
 	return r, nil
 }
 
-// sendKDCTCP sends bytes to the KDC via TCP.
-func (cl *Client) sendKDCTCP(realm string, b []byte) ([]byte, error) {
+// sendKDCTCP sends bytes to the KDC, or to the primary KDC if primary is true, via TCP.
+func (cl *Client) sendKDCTCP(ctx context.Context, realm string, b []byte, primary bool) ([]byte, error) {
 	var r []byte
-	_, kdcs, err := cl.Config.GetKDCs(realm, true)
+	_, kdcs, err := cl.kdcs(realm, true, primary)
 	if err != nil {
 		return r, err
 	}
-	r, err = dialSendTCP(kdcs, b)
+	r, err = cl.dialSend(ctx, "tcp", realm, kdcs, b)
 	if err != nil {
 		return r, err
 	}
 	return checkForKRBError(r)
 }
 
-// dialKDCTCP establishes a TCP connection to a KDC.
-func dialSendTCP(kdcs map[int]string, b []byte) ([]byte, error) {
-	var errs []string
-	for i := 1; i <= len(kdcs); i++ {
-		conn, err := net.DialTimeout("tcp", kdcs[i], 5*time.Second)
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("error establishing connection to %s: %v", kdcs[i], err))
-			continue
-		}
-		if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
-			errs = append(errs, fmt.Sprintf("error setting deadline on connection to %s: %v", kdcs[i], err))
-			continue
-		}
-		// conn is guaranteed to be a TCPConn
-		rb, err := sendTCP(conn.(*net.TCPConn), b)
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("error sneding to %s: %v", kdcs[i], err))
-			continue
-		}
-		return rb, nil
+// kdcs returns the realm's KDCs, or its primary KDCs if primary is true, keyed on preference order.
+func (cl *Client) kdcs(realm string, tcp, primary bool) (int, map[int]string, error) {
+	if primary {
+		return cl.Config.GetPrimaryKDCs(realm, tcp)
 	}
-	return nil, fmt.Errorf("error sending to a KDC: %s", strings.Join(errs, "; "))
+	return cl.Config.GetKDCs(realm, tcp)
 }
 
 // sendTCP sends bytes to connection over TCP.
-func sendTCP(conn *net.TCPConn, b []byte) ([]byte, error) {
+func sendTCP(conn net.Conn, b []byte) ([]byte, error) {
 	defer conn.Close()
+	return exchangeTCP(conn, b)
+}
+
+// exchangeTCP sends bytes to connection over TCP and reads the reply, leaving the connection open.
+func exchangeTCP(conn net.Conn, b []byte) ([]byte, error) {
 	var r []byte
 	// RFC 4120 7.2.2 specifies the first 4 bytes indicate the length of the message in big endian order.
 	hb := make([]byte, 4, 4)
@@ -174,15 +248,23 @@ func sendTCP(conn *net.TCPConn, b []byte) ([]byte, error) {
 
 	_, err := conn.Write(b)
 	if err != nil {
-		return r, fmt.Errorf("error sending to KDC (%s): %v", conn.RemoteAddr().String(), err)
+		return r, unansweredError{fmt.Errorf("error sending to KDC (%s): %v", conn.RemoteAddr().String(), err)}
 	}
 
 	sh := make([]byte, 4, 4)
-	_, err = conn.Read(sh)
+	n, err := io.ReadFull(conn, sh)
 	if err != nil {
-		return r, fmt.Errorf("error reading response size header: %v", err)
+		e := fmt.Errorf("error reading response size header: %v", err)
+		if ne, ok := err.(net.Error); n == 0 && !(ok && ne.Timeout()) {
+			// The connection was closed without a reply.
+			return r, unansweredError{e}
+		}
+		return r, e
 	}
 	s := binary.BigEndian.Uint32(sh)
+	if s > maxTCPReply {
+		return r, fmt.Errorf("response size %d from %s exceeds the maximum of %d bytes", s, conn.RemoteAddr().String(), maxTCPReply)
+	}
 
 	rb := make([]byte, s, s)
 	_, err = io.ReadFull(conn, rb)
@@ -195,6 +277,50 @@ func sendTCP(conn *net.TCPConn, b []byte) ([]byte, error) {
 	return rb, nil
 }
 
+// unansweredError is the error of an exchange over TCP in which the message could not be sent, or the connection was
+// closed before any of the reply was read. The server has not replied to the message so it may be resent.
+type unansweredError struct {
+	error
+}
+
+// sendContext calls the send function, which exchanges a message over the connection, interrupting it by expiring the
+// connection's deadline if the context is done first.
+func sendContext(ctx context.Context, conn net.Conn, send func() ([]byte, error)) ([]byte, error) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	rb, err := send()
+	close(done)
+	// Wait so that the deadline is not expired after returning, as the connection may be reused.
+	<-stopped
+	return rb, err
+}
+
+// ctxDone indicates if the context is done. As the connection deadline may be that of the context, and so can pass
+// fractionally before the context is marked done, it waits for the context if its deadline has passed.
+func ctxDone(ctx context.Context) bool {
+	if t, ok := ctx.Deadline(); ok && !time.Now().Before(t) {
+		<-ctx.Done()
+	}
+	return ctx.Err() != nil
+}
+
+// ctxErr returns the context's error in place of the error if the context is done, so that callers can identify that
+// the operation was cancelled or timed out.
+func ctxErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
 // checkForKRBError checks if the response bytes from the KDC are a KRBError.
 func checkForKRBError(b []byte) ([]byte, error) {
 	var KRBErr messages.KRBError
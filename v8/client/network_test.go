@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// silentKDC returns the address of a listener, for both TCP and UDP, that accepts requests but never replies.
+func silentKDC(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on TCP: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				// Read until the client closes the connection.
+				io.Copy(ioutil.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	pc, err := net.ListenPacket("udp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("error listening on UDP: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return l.Addr().String()
+}
+
+func TestClient_LoginContext(t *testing.T) {
+	t.Parallel()
+	addr := silentKDC(t)
+	for _, limit := range []int{1, 1465} {
+		cfg, err := config.NewFromString(fmt.Sprintf("[libdefaults]\n  default_realm = TEST.GOKRB5\n  udp_preference_limit = %d\n\n[realms]\n  TEST.GOKRB5 = {\n    kdc = %s\n    kpasswd_server = %s\n  }\n", limit, addr, addr))
+		if err != nil {
+			t.Fatalf("error loading config: %v", err)
+		}
+		cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, DisablePAFXFAST(true))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		start := time.Now()
+		err = cl.LoginContext(ctx)
+		cancel()
+		assert.Equal(t, context.DeadlineExceeded, err, "login should return the context's error when its deadline passes")
+		assert.True(t, time.Since(start) < dialTimeout, "login should return promptly when the context's deadline passes")
+
+		ctx, cancel = context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}()
+		start = time.Now()
+		_, err = cl.ChangePasswdContext(ctx, "newpasswordvalue")
+		assert.Equal(t, context.Canceled, err, "password change should return the context's error when cancelled")
+		assert.True(t, time.Since(start) < dialTimeout, "password change should return promptly when cancelled")
+
+		_, _, err = cl.GetServiceTicketContext(ctx, "HTTP/host.test.gokrb5")
+		assert.Equal(t, context.Canceled, err, "service ticket request with a cancelled context should return its error")
+	}
+}
+
+func TestExchangeTCP(t *testing.T) {
+	t.Parallel()
+	// server reads the request and replies with the writes provided.
+	server := func(writes ...[]byte) net.Conn {
+		c, s := net.Pipe()
+		go func() {
+			defer s.Close()
+			h := make([]byte, 4)
+			if _, err := io.ReadFull(s, h); err != nil {
+				return
+			}
+			if _, err := io.ReadFull(s, make([]byte, binary.BigEndian.Uint32(h))); err != nil {
+				return
+			}
+			for _, w := range writes {
+				if _, err := s.Write(w); err != nil {
+					return
+				}
+			}
+		}()
+		return c
+	}
+
+	// The size header is split across reads.
+	conn := server([]byte{0, 0}, []byte{0, 5}, []byte("reply"))
+	rb, err := exchangeTCP(conn, []byte("request"))
+	conn.Close()
+	if err != nil {
+		t.Fatalf("error exchanging message: %v", err)
+	}
+	assert.Equal(t, []byte("reply"), rb, "reply not as expected")
+
+	conn = server([]byte{0xff, 0xff, 0xff, 0xff})
+	_, err = exchangeTCP(conn, []byte("request"))
+	conn.Close()
+	if assert.Error(t, err, "reply larger than the maximum should error") {
+		assert.Contains(t, err.Error(), "exceeds the maximum", "error not as expected")
+	}
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/jcmturner/gokrb5/v8/kadmin"
@@ -21,11 +22,22 @@ const (
 
 // ChangePasswd changes the password of the client to the value provided.
 func (cl *Client) ChangePasswd(newPasswd string) (bool, error) {
+	return cl.ChangePasswdContext(context.Background(), newPasswd)
+}
+
+// ChangePasswdContext changes the password of the client to the value provided.
+// If the context is done before the password is changed the context's error is returned.
+func (cl *Client) ChangePasswdContext(ctx context.Context, newPasswd string) (bool, error) {
+	ok, err := cl.changePasswd(ctx, newPasswd)
+	return ok, ctxErr(ctx, err)
+}
+
+func (cl *Client) changePasswd(ctx context.Context, newPasswd string) (bool, error) {
 	ASReq, err := messages.NewASReqForChgPasswd(cl.Credentials.Domain(), cl.Config, cl.Credentials.CName())
 	if err != nil {
 		return false, err
 	}
-	ASRep, err := cl.ASExchange(cl.Credentials.Domain(), ASReq, 0)
+	ASRep, err := cl.asExchange(ctx, cl.Credentials.Domain(), ASReq, 0)
 	if err != nil {
 		return false, err
 	}
@@ -34,7 +46,7 @@ func (cl *Client) ChangePasswd(newPasswd string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	r, err := cl.sendToKPasswd(msg)
+	r, err := cl.sendToKPasswd(ctx, msg)
 	if err != nil {
 		return false, err
 	}
@@ -49,7 +61,7 @@ func (cl *Client) ChangePasswd(newPasswd string) (bool, error) {
 	return true, nil
 }
 
-func (cl *Client) sendToKPasswd(msg kadmin.Request) (r kadmin.Reply, err error) {
+func (cl *Client) sendToKPasswd(ctx context.Context, msg kadmin.Request) (r kadmin.Reply, err error) {
 	_, kps, err := cl.Config.GetKpasswdServers(cl.Credentials.Domain(), true)
 	if err != nil {
 		return
@@ -60,12 +72,12 @@ func (cl *Client) sendToKPasswd(msg kadmin.Request) (r kadmin.Reply, err error)
 	}
 	var rb []byte
 	if len(b) <= cl.Config.LibDefaults.UDPPreferenceLimit {
-		rb, err = dialSendUDP(kps, b)
+		rb, err = cl.dialSend(ctx, "udp", cl.Credentials.Domain(), kps, b)
 		if err != nil {
 			return
 		}
 	} else {
-		rb, err = dialSendTCP(kps, b)
+		rb, err = cl.dialSend(ctx, "tcp", cl.Credentials.Domain(), kps, b)
 		if err != nil {
 			return
 		}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4556"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Reference: https://tools.ietf.org/html/rfc4556
+// Reference: https://tools.ietf.org/html/rfc8062
+
+// pkinitASExchange performs an AS exchange pre-authenticated with the client's certificate using PKINIT, or an
+// anonymous PKINIT exchange if the client is anonymous.
+func (cl *Client) pkinitASExchange(ctx context.Context, realm string, ASReq messages.ASReq, referral int) (messages.ASRep, error) {
+	ASReq.PAData = types.PADataSequence{}
+	if !cl.settings.DisablePAFXFAST() {
+		ASReq.PAData = append(ASReq.PAData, types.PAData{PADataType: patype.PA_REQ_ENC_PA_REP})
+	}
+	pa, ka, err := cl.pkinitPAData(ASReq.ReqBody)
+	if err != nil {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed setting PKINIT PAData on AS_REQ")
+	}
+	ASReq.PAData = append(ASReq.PAData, pa)
+
+	b, err := ASReq.Marshal()
+	if err != nil {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ")
+	}
+	rb, err := cl.sendToKDC(ctx, b, realm)
+	if err != nil {
+		if e, ok := err.(messages.KRBError); ok {
+			if e.ErrorCode == errorcode.KDC_ERR_WRONG_REALM {
+				// Client referral https://tools.ietf.org/html/rfc6806.html#section-7
+				if referral > 5 {
+					return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "maximum number of client referrals exceeded")
+				}
+				referral++
+				return cl.asExchange(ctx, e.CRealm, ASReq, referral)
+			}
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
+		}
+		return messages.ASRep{}, krberror.Errorf(err, krberror.NetworkingError, "AS Exchange Error: failed sending AS_REQ to KDC")
+	}
+	var ASRep messages.ASRep
+	err = ASRep.Unmarshal(rb)
+	if err != nil {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed to process the AS_REP")
+	}
+	key, err := cl.pkinitReplyKey(ka, ASReq.ReqBody.Nonce, ASRep.EncPart.EType, realm, types.PADataSequence(ASRep.PAData))
+	if err != nil {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: PKINIT reply from KDC is not valid")
+	}
+	if ok, err := ASRep.VerifyWithKey(cl.Config, key, ASReq); !ok {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: AS_REP is not valid")
+	}
+	err = verifyPKINITKX(types.PADataSequence(ASRep.PAData), key, ASRep.DecryptedEncPart.Key)
+	if err != nil {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: PKINIT reply from KDC is not valid")
+	}
+	return ASRep, nil
+}
+
+// pkinitPAData generates the PA-PK-AS-REQ pre-authentication data for the AS_REQ body, signed with the client's
+// certificate key or unsigned if the client is anonymous. The key agreement the reply key will be derived from is also
+// returned.
+func (cl *Client) pkinitPAData(reqBody messages.KDCReqBody) (types.PAData, rfc4556.KeyAgreement, error) {
+	ka, err := rfc4556.NewKeyAgreement(cl.settings.PKINITKeyAgreement())
+	if err != nil {
+		return types.PAData{}, nil, krberror.Errorf(err, krberror.EncryptingError, "error generating PKINIT key agreement")
+	}
+	var pa types.PAData
+	if cl.Credentials.Anonymous() {
+		pa, err = messages.NewAnonymousPAPKASReq(reqBody, ka)
+	} else {
+		pa, err = messages.NewPAPKASReq(reqBody, ka, cl.Credentials.Certificates(), cl.Credentials.Signer())
+	}
+	if err != nil {
+		return types.PAData{}, nil, err
+	}
+	return pa, ka, nil
+}
+
+// pkinitReplyKey derives the AS_REP reply key from the PA-PK-AS-REP within the reply's PAData provided. The KDC's
+// certificate must chain to the client's PKINIT trust pool and be for a KDC of the realm.
+func (cl *Client) pkinitReplyKey(ka rfc4556.KeyAgreement, nonce int, etypeID int32, realm string, pas types.PADataSequence) (types.EncryptionKey, error) {
+	pool, err := cl.pkinitTrustPool(realm)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.ConfigError, "could not load PKINIT trust pool")
+	}
+	for _, pa := range pas {
+		if pa.PADataType != patype.PA_PK_AS_REP {
+			continue
+		}
+		var rep messages.PAPKASRep
+		err = rep.Unmarshal(pa.PADataValue)
+		if err != nil {
+			return types.EncryptionKey{}, err
+		}
+		return rep.ReplyKey(ka, nonce, etypeID, realm, cl.settings.PKINITRequireKDCPrincipal(), x509.VerifyOptions{Roots: pool})
+	}
+	return types.EncryptionKey{}, krberror.NewErrorf(krberror.KRBMsgError, "KDC reply does not contain PA-PK-AS-REP")
+}
+
+// pkinitTrustPool returns the pool of root certificates trusted to issue the KDC certificates of the realm for PKINIT,
+// which is the PKINITTrustPool setting or else the pkinit_anchors of the configuration.
+func (cl *Client) pkinitTrustPool(realm string) (*x509.CertPool, error) {
+	if pool := cl.settings.PKINITTrustPool(); pool != nil {
+		return pool, nil
+	}
+	anchors := cl.Config.GetPKINITAnchors(realm)
+	if len(anchors) < 1 {
+		return nil, fmt.Errorf("no PKINIT trust pool or pkinit_anchors configured for realm %s", realm)
+	}
+	pool := x509.NewCertPool()
+	for _, a := range anchors {
+		err := addPKINITAnchors(pool, a)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pool, nil
+}
+
+// addPKINITAnchors adds the PEM encoded certificates of a pkinit_anchors value to the pool. The value is either
+// FILE:path, of a file of certificates, or DIR:path, of a directory of such files.
+func addPKINITAnchors(pool *x509.CertPool, anchor string) error {
+	switch {
+	case strings.HasPrefix(anchor, "FILE:"):
+		path := strings.TrimPrefix(anchor, "FILE:")
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read pkinit_anchors file: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return fmt.Errorf("pkinit_anchors file %s does not contain any PEM encoded certificates", path)
+		}
+	case strings.HasPrefix(anchor, "DIR:"):
+		dir := strings.TrimPrefix(anchor, "DIR:")
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("could not read pkinit_anchors directory: %v", err)
+		}
+		for _, fi := range fis {
+			if fi.IsDir() {
+				continue
+			}
+			b, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+			if err != nil {
+				return fmt.Errorf("could not read pkinit_anchors file: %v", err)
+			}
+			// Files of the directory that are not certificates, such as CRLs, are skipped.
+			pool.AppendCertsFromPEM(b)
+		}
+	default:
+		return fmt.Errorf("pkinit_anchors value %s is not supported, only FILE: and DIR: are", anchor)
+	}
+	return nil
+}
+
+// verifyPKINITKX checks any PA-PKINIT-KX within the reply's PAData provided, which a KDC includes in the reply to an
+// anonymous PKINIT request to bind the ticket's session key to the key agreement.
+func verifyPKINITKX(pas types.PADataSequence, replyKey, sessionKey types.EncryptionKey) error {
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_PKINIT_KX {
+			return messages.VerifyPAPKINITKX(pa, replyKey, sessionKey)
+		}
+	}
+	return nil
+}
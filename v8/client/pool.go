@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxIdleConnsPerServer is the default maximum number of idle TCP connections a PooledTransport keeps to
+	// each server.
+	DefaultMaxIdleConnsPerServer = 2
+	// DefaultIdleTimeout is the default time a PooledTransport keeps an idle TCP connection open for.
+	DefaultIdleTimeout = 30 * time.Second
+	// healthCheckTimeout is how long an idle connection is read from before reuse to check it has not been closed.
+	healthCheckTimeout = time.Millisecond
+)
+
+// PooledTransport is a Transport that keeps TCP connections to KDCs and kpasswd servers open after an exchange and
+// reuses them for later messages to the same server, avoiding the cost of establishing a connection for each message.
+// UDP messages are exchanged as by the default transport.
+//
+// Servers may close idle connections at any time, and some close the connection after each reply. An idle connection
+// is checked before it is reused, and an exchange over a reused connection is retried over a new one if the message
+// could not be sent or the connection was closed without a reply. Other failures are not retried, as the server may
+// have processed the message and resending it, such as a kpasswd request, would be rejected as a replay.
+//
+// The zero value is ready to use. A PooledTransport is safe for concurrent use and should be shared by clients, using
+// the KDCTransport setting, rather than created for each one.
+type PooledTransport struct {
+	// Dialer establishes the connections. If nil a net.Dialer is used.
+	Dialer Dialer
+	// MaxIdleConnsPerServer is the maximum number of idle connections kept to each server.
+	// If zero DefaultMaxIdleConnsPerServer is used.
+	MaxIdleConnsPerServer int
+	// IdleTimeout is the time an idle connection is kept open for. If zero DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+
+	once sync.Once
+	net  *netTransport
+	mux  sync.Mutex
+	idle map[string][]*idleConn
+}
+
+// idleConn is a connection held by the pool, with the timer that closes it once it has been idle for the idle timeout.
+type idleConn struct {
+	conn  net.Conn
+	timer *time.Timer
+}
+
+// Exchange sends the message to the server at the address and returns the reply. TCP messages are sent over an idle
+// connection to the server if there is one, otherwise over a new connection that is kept for reuse.
+func (t *PooledTransport) Exchange(ctx context.Context, network, address string, b []byte) ([]byte, error) {
+	t.once.Do(func() {
+		t.net = newNetTransport(t.Dialer)
+	})
+	if network != "tcp" {
+		return t.net.Exchange(ctx, network, address, b)
+	}
+	for {
+		conn := t.get(address)
+		reused := conn != nil
+		if !reused {
+			var err error
+			conn, err = t.net.dial(ctx, network, address)
+			if err != nil {
+				return nil, fmt.Errorf("error establishing connection to %s: %v", address, err)
+			}
+		} else if err := conn.SetDeadline(exchangeDeadline(ctx)); err != nil {
+			conn.Close()
+			continue
+		}
+		rb, err := sendContext(ctx, conn, func() ([]byte, error) {
+			return exchangeTCP(conn, b)
+		})
+		if err != nil {
+			conn.Close()
+			if _, ok := err.(unansweredError); ok && reused && ctx.Err() == nil {
+				// The server may have closed the connection since it was checked.
+				continue
+			}
+			return nil, err
+		}
+		t.put(address, conn)
+		return rb, nil
+	}
+}
+
+// CloseIdleConnections closes the connections that are idle in the pool. It does not interrupt connections in use.
+func (t *PooledTransport) CloseIdleConnections() {
+	t.mux.Lock()
+	idle := t.idle
+	t.idle = nil
+	t.mux.Unlock()
+	for _, conns := range idle {
+		for _, ic := range conns {
+			ic.timer.Stop()
+			ic.conn.Close()
+		}
+	}
+}
+
+// get takes a healthy idle connection to the address from the pool, returning nil if there is not one.
+func (t *PooledTransport) get(address string) net.Conn {
+	for {
+		t.mux.Lock()
+		conns := t.idle[address]
+		if len(conns) < 1 {
+			t.mux.Unlock()
+			return nil
+		}
+		// Use the most recently returned connection as it is the least likely to have been closed by the server.
+		ic := conns[len(conns)-1]
+		t.idle[address] = conns[:len(conns)-1]
+		t.mux.Unlock()
+		if !ic.timer.Stop() {
+			// The idle timeout has passed and the connection is being closed.
+			continue
+		}
+		if healthy(ic.conn) {
+			return ic.conn
+		}
+		ic.conn.Close()
+	}
+}
+
+// put returns the connection to the address to the pool, closing it if the pool for the address is full.
+func (t *PooledTransport) put(address string, conn net.Conn) {
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return
+	}
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	max := t.MaxIdleConnsPerServer
+	if max < 1 {
+		max = DefaultMaxIdleConnsPerServer
+	}
+	if len(t.idle[address]) >= max {
+		conn.Close()
+		return
+	}
+	timeout := t.IdleTimeout
+	if timeout <= 0 {
+		timeout = DefaultIdleTimeout
+	}
+	ic := &idleConn{conn: conn}
+	ic.timer = time.AfterFunc(timeout, func() {
+		t.remove(address, ic)
+		conn.Close()
+	})
+	if t.idle == nil {
+		t.idle = make(map[string][]*idleConn)
+	}
+	t.idle[address] = append(t.idle[address], ic)
+}
+
+// remove removes the idle connection to the address from the pool.
+func (t *PooledTransport) remove(address string, ic *idleConn) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	conns := t.idle[address]
+	for i, c := range conns {
+		if c == ic {
+			t.idle[address] = append(conns[:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(t.idle[address]) < 1 {
+		delete(t.idle, address)
+	}
+}
+
+// healthy indicates if the idle connection is still open. As no data is expected from the server on an idle
+// connection, a read that does not time out means it has been closed or is not in a usable state.
+func healthy(conn net.Conn) bool {
+	if err := conn.SetReadDeadline(time.Now().Add(healthCheckTimeout)); err != nil {
+		return false
+	}
+	var b [1]byte
+	_, err := conn.Read(b[:])
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		return false
+	}
+	return true
+}
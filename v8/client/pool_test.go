@@ -0,0 +1,252 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/test/kdc"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingDialer counts the connections established.
+type countingDialer struct {
+	net.Dialer
+	dials int
+	mux   sync.Mutex
+}
+
+func (d *countingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.mux.Lock()
+	d.dials++
+	d.mux.Unlock()
+	return d.Dialer.DialContext(ctx, network, address)
+}
+
+func (d *countingDialer) count() int {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.dials
+}
+
+// singleUseKDC returns the address of a TCP listener that passes a request to the KDC and closes the connection after
+// each reply.
+func singleUseKDC(t *testing.T, k *kdc.KDC) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on TCP: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				hb := make([]byte, 4)
+				if _, err := io.ReadFull(conn, hb); err != nil {
+					return
+				}
+				b := make([]byte, binary.BigEndian.Uint32(hb))
+				if _, err := io.ReadFull(conn, b); err != nil {
+					return
+				}
+				rb := k.Handle(b)
+				binary.BigEndian.PutUint32(hb, uint32(len(rb)))
+				conn.Write(append(hb, rb...))
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestPooledTransport(t *testing.T) {
+	t.Parallel()
+	k, cfg := transportTestKDC(t)
+	err := k.Start()
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	defer k.Close()
+	cfg.LibDefaults.UDPPreferenceLimit = 1
+
+	d := &countingDialer{}
+	pt := &PooledTransport{Dialer: d}
+	cfg.Realms[0].KDC = []string{k.Addr()}
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, DisablePAFXFAST(true), KDCTransport(pt))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in over pooled transport: %v", err)
+	}
+	defer cl.Destroy()
+	for i := 0; i < 3; i++ {
+		_, _, err = cl.GetServiceTicket("HTTP/host.test.gokrb5")
+		assert.NoError(t, err, "error getting service ticket over pooled transport")
+		cl.cache.clear()
+	}
+	assert.Equal(t, 1, d.count(), "connection to the KDC should be reused")
+
+	pt.CloseIdleConnections()
+	_, _, err = cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	assert.NoError(t, err, "error getting service ticket after closing idle connections")
+	assert.Equal(t, 2, d.count(), "a new connection should be established after closing idle connections")
+
+	// Connections closed by the server after each reply are not reused.
+	cfg.Realms[0].KDC = []string{singleUseKDC(t, k)}
+	for i := 0; i < 3; i++ {
+		cl.cache.clear()
+		_, _, err = cl.GetServiceTicket("HTTP/host.test.gokrb5")
+		assert.NoError(t, err, "error getting service ticket from a KDC closing connections")
+	}
+	assert.Equal(t, 5, d.count(), "a new connection should be established when the server closed the idle one")
+
+	pt.IdleTimeout = 10 * time.Millisecond
+	cfg.Realms[0].KDC = []string{k.Addr()}
+	cl.cache.clear()
+	_, _, err = cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	assert.NoError(t, err, "error getting service ticket over pooled transport")
+	time.Sleep(50 * time.Millisecond)
+	pt.mux.Lock()
+	assert.Equal(t, 0, len(pt.idle[k.Addr()]), "idle connection should be closed after the idle timeout")
+	pt.mux.Unlock()
+}
+
+func TestKDCCooldown(t *testing.T) {
+	t.Parallel()
+	k, cfg := transportTestKDC(t)
+	cfg.Realms[0].KDC = []string{"down.test.gokrb5:88", "kdc.test.gokrb5:88"}
+	var mux sync.Mutex
+	attempts := make(map[string]int)
+	tr := TransportFunc(func(ctx context.Context, network, address string, b []byte) ([]byte, error) {
+		mux.Lock()
+		attempts[address]++
+		mux.Unlock()
+		if address == "down.test.gokrb5:88" {
+			return nil, errors.New("no response")
+		}
+		return k.Handle(b), nil
+	})
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, DisablePAFXFAST(true), KDCTransport(tr), KDCCooldown(time.Minute))
+	for i := 0; i < 10; i++ {
+		err := cl.Login()
+		if err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+	}
+	assert.True(t, attempts["down.test.gokrb5:88"] <= 1, "KDC marked down should not be retried during the cooldown")
+	assert.True(t, attempts["kdc.test.gokrb5:88"] >= 10, "KDC that is up should be used")
+	cl.Destroy()
+}
+
+func TestServerStatus_Order(t *testing.T) {
+	t.Parallel()
+	var s serverStatus
+	servers := map[int]string{1: "kdc1:88", 2: "kdc2:88", 3: "kdc3:88", 4: "kdc4:88"}
+	assert.Equal(t, servers, s.order(servers), "order should not change when no servers have been used")
+	s.markDown("kdc1:88", time.Now().Add(time.Minute))
+	s.markDown("kdc2:88", time.Now().Add(-time.Second))
+	assert.Equal(t, map[int]string{1: "kdc3:88", 2: "kdc4:88", 3: "kdc2:88", 4: "kdc1:88"}, s.order(servers), "server marked down should be tried last and one that failed after those not used")
+	s.markUp("kdc4:88")
+	assert.Equal(t, map[int]string{1: "kdc4:88", 2: "kdc3:88", 3: "kdc2:88", 4: "kdc1:88"}, s.order(servers), "server that responded should be tried first")
+	s.markUp("kdc1:88")
+	assert.Equal(t, map[int]string{1: "kdc1:88", 2: "kdc4:88", 3: "kdc3:88", 4: "kdc2:88"}, s.order(servers), "servers that responded should be tried in their preference order")
+	s.mux.Lock()
+	h := s.health["kdc2:88"]
+	h.at = time.Now().Add(-serverHealthExpiry)
+	s.health["kdc2:88"] = h
+	s.mux.Unlock()
+	assert.Equal(t, map[int]string{1: "kdc1:88", 2: "kdc4:88", 3: "kdc2:88", 4: "kdc3:88"}, s.order(servers), "failure should be forgotten after it expires")
+}
+
+// scriptedServer returns the address of a TCP listener that replies to each request with the bytes the reply function
+// returns for the number of requests received, closing the connection afterwards if close is true.
+func scriptedServer(t *testing.T, reply func(n int) (b []byte, close bool)) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on TCP: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	var mux sync.Mutex
+	var n int
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					hb := make([]byte, 4)
+					if _, err := io.ReadFull(conn, hb); err != nil {
+						return
+					}
+					if _, err := io.ReadFull(conn, make([]byte, binary.BigEndian.Uint32(hb))); err != nil {
+						return
+					}
+					mux.Lock()
+					n++
+					b, close := reply(n)
+					mux.Unlock()
+					conn.Write(b)
+					if close {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestPooledTransport_Retry(t *testing.T) {
+	t.Parallel()
+	frame := func(s string) []byte {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(len(s)))
+		return append(b, s...)
+	}
+
+	// A reused connection closed without a reply is retried over a new one.
+	var reqs int
+	addr := scriptedServer(t, func(n int) ([]byte, bool) {
+		reqs = n
+		if n == 2 {
+			return nil, true
+		}
+		return frame("reply"), false
+	})
+	pt := &PooledTransport{}
+	for i := 0; i < 2; i++ {
+		rb, err := pt.Exchange(context.Background(), "tcp", addr, []byte("request"))
+		if err != nil {
+			t.Fatalf("error exchanging message: %v", err)
+		}
+		assert.Equal(t, []byte("reply"), rb, "reply not as expected")
+	}
+	assert.Equal(t, 3, reqs, "message not resent after the connection was closed without a reply")
+
+	// A reused connection closed part way through the reply is not retried as the server processed the message.
+	var partialReqs int
+	addr = scriptedServer(t, func(n int) ([]byte, bool) {
+		partialReqs = n
+		if n == 2 {
+			return frame("reply")[:6], true
+		}
+		return frame("reply"), false
+	})
+	_, err := pt.Exchange(context.Background(), "tcp", addr, []byte("request"))
+	if err != nil {
+		t.Fatalf("error exchanging message: %v", err)
+	}
+	_, err = pt.Exchange(context.Background(), "tcp", addr, []byte("request"))
+	assert.Error(t, err, "exchange with a partial reply should error")
+	assert.Equal(t, 2, partialReqs, "message resent after the server replied")
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Reference: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-sfu
+
+// S4U2Self requests a service ticket to the client's own principal on behalf of the user (S4U2self protocol
+// transition). The client is the service account and the user does not need to have authenticated with Kerberos.
+// The ticket returned can be used as the evidence ticket for S4U2Proxy. For this the service account must be trusted
+// for delegation with protocol transition or the target service must allow resource-based constrained delegation from it.
+//
+// The request is sent to the KDC of the client's realm. S4U tickets are not added to the client's cache.
+func (cl *Client) S4U2Self(user types.PrincipalName, userRealm string) (messages.Ticket, types.EncryptionKey, error) {
+	return cl.S4U2SelfContext(context.Background(), user, userRealm)
+}
+
+// S4U2SelfContext requests a service ticket to the client's own principal on behalf of the user. See S4U2Self.
+// If the context is done before the ticket is obtained the context's error is returned.
+func (cl *Client) S4U2SelfContext(ctx context.Context, user types.PrincipalName, userRealm string) (messages.Ticket, types.EncryptionKey, error) {
+	tgsRep, err := cl.s4u2Self(ctx, user, userRealm, nil)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, ctxErr(ctx, err)
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+}
+
+// S4U2SelfWithCertificate requests a service ticket to the client's own principal on behalf of the user identified by
+// the X.509 certificate provided rather than by name. See S4U2Self.
+func (cl *Client) S4U2SelfWithCertificate(cert *x509.Certificate, userRealm string) (messages.Ticket, types.EncryptionKey, error) {
+	return cl.S4U2SelfWithCertificateContext(context.Background(), cert, userRealm)
+}
+
+// S4U2SelfWithCertificateContext requests a service ticket to the client's own principal on behalf of the user
+// identified by the X.509 certificate provided. See S4U2Self.
+// If the context is done before the ticket is obtained the context's error is returned.
+func (cl *Client) S4U2SelfWithCertificateContext(ctx context.Context, cert *x509.Certificate, userRealm string) (messages.Ticket, types.EncryptionKey, error) {
+	tgsRep, err := cl.s4u2Self(ctx, types.PrincipalName{}, userRealm, cert)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, ctxErr(ctx, err)
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+}
+
+// S4U2Proxy requests a service ticket to the SPN on behalf of the user of the evidence ticket (S4U2proxy constrained
+// delegation). The evidence ticket is a service ticket to the client's own principal, either received from the user or
+// obtained with S4U2Self. Both classic and resource-based constrained delegation are supported.
+//
+// The request is sent to the KDC of the client's realm. S4U tickets are not added to the client's cache.
+// The AP_REQ sent to the target service must have an authenticator for the user rather than the client. Impersonate
+// returns a client that does this and can be used with the spnego package.
+func (cl *Client) S4U2Proxy(evidence messages.Ticket, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	return cl.S4U2ProxyContext(context.Background(), evidence, spn)
+}
+
+// S4U2ProxyContext requests a service ticket to the SPN on behalf of the user of the evidence ticket. See S4U2Proxy.
+// If the context is done before the ticket is obtained the context's error is returned.
+func (cl *Client) S4U2ProxyContext(ctx context.Context, evidence messages.Ticket, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	tgsRep, err := cl.s4u2Proxy(ctx, evidence, spn)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, ctxErr(ctx, err)
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+}
+
+// Impersonate returns a client acting as the user. The client obtains service tickets on the user's behalf with
+// S4U2Self and S4U2Proxy using the credentials of this client, which must be for the service account trusted to
+// delegate. The client returned has no credentials of its own and does not keep a credential cache.
+func (cl *Client) Impersonate(user types.PrincipalName, userRealm string) (*Client, error) {
+	imp := &impersonation{
+		client: cl,
+		user:   user,
+		realm:  userRealm,
+	}
+	if _, err := imp.evidenceTicket(context.Background()); err != nil {
+		return nil, err
+	}
+	return &Client{
+		Credentials: credentials.NewFromPrincipalName(user, userRealm),
+		Config:      cl.Config,
+		settings:    NewSettings(Logger(cl.settings.Logger())),
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		cache:         NewCache(),
+		impersonation: imp,
+	}, nil
+}
+
+func (cl *Client) s4u2Self(ctx context.Context, user types.PrincipalName, userRealm string, cert *x509.Certificate) (messages.TGSRep, error) {
+	realm := cl.Credentials.Domain()
+	tgt, skey, err := cl.sessionTGT(ctx, realm)
+	if err != nil {
+		return messages.TGSRep{}, err
+	}
+	tgsReq, err := messages.NewS4U2SelfTGSReq(cl.Credentials.CName(), realm, cl.Config, tgt, skey, user, userRealm, cert)
+	if err != nil {
+		return messages.TGSRep{}, krberror.Errorf(err, krberror.KRBMsgError, "S4U2Self Error: failed to generate a new TGS_REQ")
+	}
+	tgsRep, replyKey, err := cl.uncachedTGSExchange(ctx, tgsReq, realm, tgt, skey)
+	if err != nil {
+		return tgsRep, err
+	}
+	err = verifyS4U2SelfReply(tgsReq, tgsRep, replyKey)
+	return tgsRep, err
+}
+
+// verifyS4U2SelfReply checks the PA-S4U-X509-USER of the S4U2self reply against that of the request. KDCs that do not
+// include one in the reply are only accepted if the request named the user rather than only giving their certificate.
+// When only the certificate was given the reply must be for the user the KDC identified by it.
+func verifyS4U2SelfReply(tgsReq messages.TGSReq, tgsRep messages.TGSRep, replyKey types.EncryptionKey) error {
+	var req, rep messages.PAS4UX509User
+	for _, pa := range tgsReq.PAData {
+		if pa.PADataType == patype.PA_FOR_X509_USER {
+			if err := req.Unmarshal(pa.PADataValue); err != nil {
+				return krberror.Errorf(err, krberror.EncodingError, "S4U2Self Error: failed to unmarshal the PA-S4U-X509-USER of the TGS_REQ")
+			}
+			break
+		}
+	}
+	certOnly := len(req.UserID.CName.NameString) < 1
+	var found bool
+	for _, pa := range tgsRep.PAData {
+		if pa.PADataType == patype.PA_FOR_X509_USER {
+			if err := rep.Unmarshal(pa.PADataValue); err != nil {
+				return krberror.Errorf(err, krberror.EncodingError, "S4U2Self Error: failed to unmarshal the PA-S4U-X509-USER of the TGS_REP")
+			}
+			found = true
+			break
+		}
+	}
+	if !found {
+		if certOnly {
+			return krberror.NewErrorf(krberror.KRBMsgError, "S4U2Self Error: TGS_REP does not have a PA-S4U-X509-USER identifying the user of the certificate")
+		}
+		return nil
+	}
+	if ok, err := rep.VerifyReply(req, replyKey); !ok {
+		return krberror.Errorf(err, krberror.KRBMsgError, "S4U2Self Error: PA-S4U-X509-USER of the TGS_REP is not valid")
+	}
+	if certOnly && (!tgsRep.CName.Equal(rep.UserID.CName) || tgsRep.CRealm != rep.UserID.CRealm) {
+		return krberror.NewErrorf(krberror.KRBMsgError, "S4U2Self Error: TGS_REP is for %s@%s rather than the user the KDC identified by the certificate", tgsRep.CName.PrincipalNameString(), tgsRep.CRealm)
+	}
+	return nil
+}
+
+func (cl *Client) s4u2Proxy(ctx context.Context, evidence messages.Ticket, spn string) (messages.TGSRep, error) {
+	realm := cl.Credentials.Domain()
+	tgt, skey, err := cl.sessionTGT(ctx, realm)
+	if err != nil {
+		return messages.TGSRep{}, err
+	}
+	princ := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)
+	tgsReq, err := messages.NewS4U2ProxyTGSReq(cl.Credentials.CName(), realm, cl.Config, tgt, skey, princ, evidence)
+	if err != nil {
+		return messages.TGSRep{}, krberror.Errorf(err, krberror.KRBMsgError, "S4U2Proxy Error: failed to generate a new TGS_REQ")
+	}
+	tgsRep, _, err := cl.uncachedTGSExchange(ctx, tgsReq, realm, tgt, skey)
+	return tgsRep, err
+}
+
+// impersonation holds the state of a client acting as a user via S4U.
+type impersonation struct {
+	client   *Client
+	user     types.PrincipalName
+	realm    string
+	evidence messages.Ticket
+	endTime  time.Time
+	mux      sync.Mutex
+}
+
+// evidenceTicket returns the S4U2Self ticket for the user, requesting a new one if there is not a valid one.
+func (i *impersonation) evidenceTicket(ctx context.Context) (messages.Ticket, error) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if time.Now().UTC().Before(i.endTime) {
+		return i.evidence, nil
+	}
+	tgsRep, err := i.client.s4u2Self(ctx, i.user, i.realm, nil)
+	if err != nil {
+		return messages.Ticket{}, err
+	}
+	i.evidence = tgsRep.Ticket
+	i.endTime = tgsRep.DecryptedEncPart.EndTime
+	return i.evidence, nil
+}
+
+// serviceTicket obtains a service ticket to the SPN on behalf of the user with S4U2Proxy.
+func (i *impersonation) serviceTicket(ctx context.Context, spn string) (messages.TGSRep, error) {
+	evidence, err := i.evidenceTicket(ctx)
+	if err != nil {
+		return messages.TGSRep{}, err
+	}
+	return i.client.s4u2Proxy(ctx, evidence, spn)
+}
@@ -0,0 +1,485 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/test/kdc"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// s4uCertUser is the user the stubbed KDC identifies by the certificate of a S4U2self request.
+const s4uCertUser = "certuser"
+
+// s4uKDC is a transport to a KDC stubbed to reply to S4U2self and S4U2proxy requests, which the test KDC does not
+// support. Other requests are handled by the test KDC, whose keys are used for the S4U tickets.
+type s4uKDC struct {
+	k     *kdc.KDC
+	mux   sync.Mutex
+	self  []messages.TGSReq
+	proxy []messages.TGSReq
+	// lifetime of the tickets issued.
+	lifetime time.Duration
+	// omitPA omits the PA-S4U-X509-USER from S4U2self replies, as older KDCs do.
+	omitPA bool
+	// badChecksum corrupts the checksum of the PA-S4U-X509-USER of S4U2self replies.
+	badChecksum bool
+	// replyUser, if set, is the user S4U2self replies are for rather than the user requested.
+	replyUser types.PrincipalName
+	// armored is the number of S4U requests received that were FAST armored.
+	armored int
+}
+
+func (s *s4uKDC) Exchange(ctx context.Context, network, address string, b []byte) ([]byte, error) {
+	var req messages.TGSReq
+	if req.Unmarshal(b) != nil {
+		return s.k.Handle(b), nil
+	}
+	self := req.PAData.Contains(patype.PA_FOR_X509_USER)
+	if !self && !types.IsFlagSet(&req.ReqBody.KDCOptions, flags.CNameInAddlTkt) {
+		return s.k.Handle(b), nil
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if self {
+		s.self = append(s.self, req)
+	} else {
+		s.proxy = append(s.proxy, req)
+	}
+	return s.reply(req, self)
+}
+
+// requests returns the number of S4U2self and S4U2proxy requests received.
+func (s *s4uKDC) requests() (self, proxy int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return len(s.self), len(s.proxy)
+}
+
+// reply returns the TGS_REP to the S4U request, which is for the user of its PA-S4U-X509-USER or evidence ticket.
+func (s *s4uKDC) reply(req messages.TGSReq, self bool) ([]byte, error) {
+	var apReq messages.APReq
+	for _, pa := range req.PAData {
+		if pa.PADataType == patype.PA_TGS_REQ {
+			if err := apReq.Unmarshal(pa.PADataValue); err != nil {
+				return nil, err
+			}
+		}
+	}
+	kt, err := s.k.Keytab("krbtgt/" + s.k.Realm())
+	if err != nil {
+		return nil, err
+	}
+	err = apReq.Ticket.DecryptEncPart(kt, nil)
+	if err != nil {
+		return nil, err
+	}
+	tgtPart := apReq.Ticket.DecryptedEncPart
+	err = apReq.DecryptAuthenticator(tgtPart.Key)
+	if err != nil {
+		return nil, err
+	}
+	replyKey, usage := tgtPart.Key, uint32(keyusage.TGS_REP_ENCPART_SESSION_KEY)
+	if len(apReq.Authenticator.SubKey.KeyValue) > 0 {
+		replyKey, usage = apReq.Authenticator.SubKey, keyusage.TGS_REP_ENCPART_AUTHENTICATOR_SUB_KEY
+	}
+	var cname types.PrincipalName
+	var crealm string
+	var pas types.PADataSequence
+	if self {
+		var px messages.PAS4UX509User
+		for _, pa := range req.PAData {
+			if pa.PADataType == patype.PA_FOR_X509_USER {
+				if err := px.Unmarshal(pa.PADataValue); err != nil {
+					return nil, err
+				}
+			}
+		}
+		cname, crealm = px.UserID.CName, px.UserID.CRealm
+		if len(cname.NameString) < 1 {
+			cname = types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, s4uCertUser)
+		}
+		if len(s.replyUser.NameString) > 0 {
+			cname = s.replyUser
+		}
+		if !s.omitPA {
+			userID := px.UserID
+			userID.CName = cname
+			rpx, err := messages.NewPAS4UX509UserReply(userID, replyKey)
+			if err != nil {
+				return nil, err
+			}
+			if s.badChecksum {
+				rpx.Checksum.Checksum[0] ^= 0xff
+			}
+			b, err := rpx.Marshal()
+			if err != nil {
+				return nil, err
+			}
+			pas = append(pas, types.PAData{PADataType: patype.PA_FOR_X509_USER, PADataValue: b})
+		}
+	} else {
+		if len(req.ReqBody.AdditionalTickets) != 1 {
+			return nil, errors.New("S4U2proxy request does not have an evidence ticket")
+		}
+		evidence := req.ReqBody.AdditionalTickets[0]
+		ekt, err := s.k.Keytab(tgtPart.CName.PrincipalNameString())
+		if err != nil {
+			return nil, err
+		}
+		err = evidence.DecryptEncPart(ekt, nil)
+		if err != nil {
+			return nil, err
+		}
+		cname, crealm = evidence.DecryptedEncPart.CName, evidence.DecryptedEncPart.CRealm
+	}
+
+	skt, err := s.k.Keytab(req.ReqBody.SName.PrincipalNameString())
+	if err != nil {
+		return nil, err
+	}
+	e := skt.Entries[0]
+	now := time.Now().UTC().Truncate(time.Second)
+	endTime := now.Add(s.lifetime)
+	f := types.NewKrbFlags()
+	types.SetFlag(&f, flags.Forwardable)
+	tkt, key, err := messages.NewTicket(cname, crealm, req.ReqBody.SName, req.ReqBody.Realm, f, skt, e.Key.KeyType, int(e.KVNO), now, now, endTime, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	if req.PAData.Contains(patype.PA_FX_FAST) {
+		s.armored++
+		pas, replyKey, err = s4uFASTReply(req, apReq, pas, replyKey, tkt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	b, err := asn1.Marshal(messages.EncKDCRepPart{
+		Key:       key,
+		LastReqs:  []messages.LastReq{},
+		Nonce:     req.ReqBody.Nonce,
+		Flags:     f,
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   endTime,
+		SRealm:    req.ReqBody.Realm,
+		SName:     req.ReqBody.SName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncTGSRepPart)
+	ed, err := crypto.GetEncryptedData(b, replyKey, usage, 0)
+	if err != nil {
+		return nil, err
+	}
+	rep := messages.TGSRep{
+		KDCRepFields: messages.KDCRepFields{
+			PVNO:    iana.PVNO,
+			MsgType: msgtype.KRB_TGS_REP,
+			PAData:  pas,
+			CRealm:  crealm,
+			CName:   cname,
+			Ticket:  tkt,
+			EncPart: ed,
+		},
+	}
+	return rep.Marshal()
+}
+
+// s4uFASTReply returns the PA-FX-FAST of the reply to the FAST armored S4U request, holding the PAData provided, with
+// the strengthened reply key.
+func s4uFASTReply(req messages.TGSReq, apReq messages.APReq, pas types.PADataSequence, replyKey types.EncryptionKey, tkt messages.Ticket) (types.PADataSequence, types.EncryptionKey, error) {
+	armorKey, err := crypto.KRBFXCF2(apReq.Authenticator.SubKey, apReq.Ticket.DecryptedEncPart.Key, "subkeyarmor", "ticketarmor")
+	if err != nil {
+		return nil, replyKey, err
+	}
+	var a messages.KrbFastArmoredReq
+	for _, pa := range req.PAData {
+		if pa.PADataType == patype.PA_FX_FAST {
+			err = a.Unmarshal(pa.PADataValue)
+			if err != nil {
+				return nil, replyKey, err
+			}
+		}
+	}
+	err = a.DecryptEncPart(armorKey)
+	if err != nil {
+		return nil, replyKey, err
+	}
+	et, err := crypto.GetEtype(replyKey.KeyType)
+	if err != nil {
+		return nil, replyKey, err
+	}
+	strengthenKey, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		return nil, replyKey, err
+	}
+	replyKey, err = crypto.KRBFXCF2(strengthenKey, replyKey, "strengthenkey", "replykey")
+	if err != nil {
+		return nil, replyKey, err
+	}
+	b, err := tkt.Marshal()
+	if err != nil {
+		return nil, replyKey, err
+	}
+	cb, err := et.GetChecksumHash(armorKey.KeyValue, b, keyusage.KEY_USAGE_FAST_FINISHED)
+	if err != nil {
+		return nil, replyKey, err
+	}
+	now := time.Now().UTC()
+	rep, err := messages.NewKrbFastArmoredRep(armorKey, messages.KrbFastResponse{
+		PAData:        pas,
+		StrengthenKey: strengthenKey,
+		Finished: messages.KrbFastFinished{
+			Timestamp:      now.Truncate(time.Second),
+			Usec:           now.Nanosecond() / int(time.Microsecond),
+			CRealm:         apReq.Ticket.DecryptedEncPart.CRealm,
+			CName:          apReq.Ticket.DecryptedEncPart.CName,
+			TicketChecksum: types.Checksum{CksumType: et.GetHashID(), Checksum: cb},
+		},
+		Nonce: a.DecryptedEncPart.ReqBody.Nonce,
+	})
+	if err != nil {
+		return nil, replyKey, err
+	}
+	pa, err := rep.PAData()
+	return types.PADataSequence{pa}, replyKey, err
+}
+
+// s4uTestKDC returns a stubbed S4U KDC and the configuration of its realm.
+func s4uTestKDC(t *testing.T, settings ...func(*kdc.Settings)) (*s4uKDC, *config.Config) {
+	k, cfg := transportTestKDC(t, settings...)
+	for _, name := range []string{"testuser2", s4uCertUser, "HTTP/other.test.gokrb5"} {
+		err := k.AddPrincipal(name, "password"+name)
+		if err != nil {
+			t.Fatalf("error adding principal: %v", err)
+		}
+	}
+	return &s4uKDC{k: k, lifetime: time.Hour}, cfg
+}
+
+// s4uTestClient returns a stubbed S4U KDC and a client of the service account logged in with it.
+func s4uTestClient(t *testing.T) (*s4uKDC, *Client) {
+	s, cfg := s4uTestKDC(t)
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, DisablePAFXFAST(true), KDCTransport(s))
+	err := cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	return s, cl
+}
+
+func TestClient_S4U2Self(t *testing.T) {
+	t.Parallel()
+	s, cl := s4uTestClient(t)
+	defer cl.Destroy()
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2")
+	tkt, key, err := cl.S4U2Self(user, "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error getting S4U2Self ticket: %v", err)
+	}
+	assert.NotEmpty(t, key.KeyValue, "session key should be returned")
+	assert.Equal(t, "testuser1", tkt.SName.PrincipalNameString(), "S4U2Self ticket should be for the service itself")
+	kt, err := s.k.Keytab("testuser1")
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	err = tkt.DecryptEncPart(kt, nil)
+	if err != nil {
+		t.Fatalf("service could not decrypt ticket: %v", err)
+	}
+	assert.Equal(t, "testuser2", tkt.DecryptedEncPart.CName.PrincipalNameString(), "ticket client should be the user")
+
+	if assert.Len(t, s.self, 1, "number of S4U2Self requests not as expected") {
+		req := s.self[0]
+		assert.True(t, req.PAData.Contains(patype.PA_FOR_USER), "PA-FOR-USER should be sent when the user is named")
+		var px messages.PAS4UX509User
+		for _, pa := range req.PAData {
+			if pa.PADataType == patype.PA_FOR_X509_USER {
+				err = px.Unmarshal(pa.PADataValue)
+			}
+		}
+		assert.NoError(t, err, "error unmarshaling PA-S4U-X509-USER")
+		assert.True(t, types.IsFlagSet(&px.UserID.Options, flags.S4UOptionUseReplyKeyUsage), "KDC should be asked to use the reply key usage")
+	}
+
+	// A KDC that does not return a PA-S4U-X509-USER is accepted when the user is named.
+	s.omitPA = true
+	_, _, err = cl.S4U2Self(user, "TEST.GOKRB5")
+	assert.NoError(t, err, "S4U2Self reply without a PA-S4U-X509-USER should be accepted for a named user")
+}
+
+func TestClient_S4U2Self_ReplyNotValid(t *testing.T) {
+	t.Parallel()
+	s, cl := s4uTestClient(t)
+	defer cl.Destroy()
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2")
+
+	s.badChecksum = true
+	_, _, err := cl.S4U2Self(user, "TEST.GOKRB5")
+	assert.Error(t, err, "S4U2Self reply with a PA-S4U-X509-USER checksum that is not valid should be rejected")
+
+	s.badChecksum = false
+	s.replyUser = types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, s4uCertUser)
+	_, _, err = cl.S4U2Self(user, "TEST.GOKRB5")
+	assert.Error(t, err, "S4U2Self reply for another user should be rejected")
+}
+
+func TestClient_S4U2SelfWithCertificate(t *testing.T) {
+	t.Parallel()
+	s, cl := s4uTestClient(t)
+	defer cl.Destroy()
+	cert := &x509.Certificate{Raw: []byte("user certificate")}
+	tkt, _, err := cl.S4U2SelfWithCertificate(cert, "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error getting S4U2Self ticket: %v", err)
+	}
+	kt, err := s.k.Keytab("testuser1")
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	err = tkt.DecryptEncPart(kt, nil)
+	if err != nil {
+		t.Fatalf("service could not decrypt ticket: %v", err)
+	}
+	assert.Equal(t, s4uCertUser, tkt.DecryptedEncPart.CName.PrincipalNameString(), "ticket client should be the user of the certificate")
+	assert.False(t, s.self[0].PAData.Contains(patype.PA_FOR_USER), "PA-FOR-USER should not be sent when the user is not named")
+
+	// Without a PA-S4U-X509-USER in the reply the user of the certificate cannot be verified.
+	s.omitPA = true
+	_, _, err = cl.S4U2SelfWithCertificate(cert, "TEST.GOKRB5")
+	assert.Error(t, err, "S4U2Self reply without a PA-S4U-X509-USER should be rejected for a certificate")
+}
+
+func TestClient_S4U2Proxy(t *testing.T) {
+	t.Parallel()
+	s, cl := s4uTestClient(t)
+	defer cl.Destroy()
+	evidence, _, err := cl.S4U2Self(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2"), "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error getting S4U2Self ticket: %v", err)
+	}
+	tkt, key, err := cl.S4U2Proxy(evidence, "HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting S4U2Proxy ticket: %v", err)
+	}
+	assert.NotEmpty(t, key.KeyValue, "session key should be returned")
+	kt, err := s.k.Keytab("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	err = tkt.DecryptEncPart(kt, nil)
+	if err != nil {
+		t.Fatalf("service could not decrypt ticket: %v", err)
+	}
+	assert.Equal(t, "testuser2", tkt.DecryptedEncPart.CName.PrincipalNameString(), "ticket client should be the user of the evidence ticket")
+
+	if assert.Len(t, s.proxy, 1, "number of S4U2Proxy requests not as expected") {
+		req := s.proxy[0]
+		assert.Equal(t, "HTTP/host.test.gokrb5", req.ReqBody.SName.PrincipalNameString(), "S4U2Proxy request should be for the target service")
+		if assert.Len(t, req.ReqBody.AdditionalTickets, 1, "evidence ticket should be sent") {
+			assert.Equal(t, evidence.EncPart.Cipher, req.ReqBody.AdditionalTickets[0].EncPart.Cipher, "evidence ticket not as expected")
+		}
+		assert.True(t, req.PAData.Contains(patype.PA_PAC_OPTIONS), "PA-PAC-OPTIONS should be sent")
+	}
+}
+
+func TestClient_Impersonate(t *testing.T) {
+	t.Parallel()
+	s, cl := s4uTestClient(t)
+	defer cl.Destroy()
+	icl, err := cl.Impersonate(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2"), "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error impersonating user: %v", err)
+	}
+	self, proxy := s.requests()
+	assert.Equal(t, 1, self, "evidence ticket should be obtained when impersonating")
+	assert.Equal(t, 0, proxy, "no S4U2Proxy request should be made when impersonating")
+
+	for _, spn := range []string{"HTTP/host.test.gokrb5", "HTTP/other.test.gokrb5", "HTTP/host.test.gokrb5"} {
+		tkt, _, err := icl.GetServiceTicket(spn)
+		if err != nil {
+			t.Fatalf("error getting service ticket for %s: %v", spn, err)
+		}
+		assert.Equal(t, spn, tkt.SName.PrincipalNameString(), "service ticket not as expected")
+	}
+	self, proxy = s.requests()
+	assert.Equal(t, 1, self, "valid evidence ticket should be reused")
+	assert.Equal(t, 2, proxy, "service tickets should be obtained with S4U2Proxy and cached")
+	err = icl.Login()
+	assert.NoError(t, err, "login of an impersonating client should succeed")
+	self, _ = s.requests()
+	assert.Equal(t, 1, self, "login should reuse a valid evidence ticket")
+
+	// An evidence ticket that has expired is replaced.
+	s.mux.Lock()
+	s.lifetime = 0
+	s.mux.Unlock()
+	icl, err = cl.Impersonate(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2"), "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error impersonating user: %v", err)
+	}
+	_, _, err = icl.GetServiceTicket("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	self, _ = s.requests()
+	assert.Equal(t, 3, self, "evidence ticket that has expired should be replaced")
+
+	s.mux.Lock()
+	s.lifetime = time.Hour
+	s.badChecksum = true
+	s.mux.Unlock()
+	_, err = cl.Impersonate(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2"), "TEST.GOKRB5")
+	assert.Error(t, err, "impersonation should fail if the S4U2Self reply is not valid")
+}
+
+func TestClient_S4U_RequireFAST(t *testing.T) {
+	t.Parallel()
+	s, cfg := s4uTestKDC(t, kdc.FAST(true))
+	err := s.k.AddPrincipal("host/armor.test.gokrb5", "armorpassword")
+	if err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	acl := NewWithPassword("host/armor.test.gokrb5", "TEST.GOKRB5", "armorpassword", cfg, KDCTransport(s))
+	defer acl.Destroy()
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, FASTArmor(acl), RequireFAST(true), KDCTransport(s))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	defer cl.Destroy()
+
+	evidence, _, err := cl.S4U2Self(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2"), "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error getting S4U2Self ticket with FAST required: %v", err)
+	}
+	_, _, err = cl.S4U2Proxy(evidence, "HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting S4U2Proxy ticket with FAST required: %v", err)
+	}
+	s.mux.Lock()
+	assert.Equal(t, 2, s.armored, "S4U requests should be FAST armored")
+	s.badChecksum = true
+	s.mux.Unlock()
+	_, _, err = cl.S4U2Self(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2"), "TEST.GOKRB5")
+	assert.Error(t, err, "S4U2Self reply with a PA-S4U-X509-USER checksum that is not valid should be rejected within FAST")
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"sort"
@@ -8,7 +9,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
 	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/messages"
 	"github.com/jcmturner/gokrb5/v8/types"
@@ -69,6 +73,8 @@ type session struct {
 	tgt                  messages.Ticket
 	sessionKey           types.EncryptionKey
 	sessionKeyExpiration time.Time
+	flags                asn1.BitString
+	fast                 bool
 	cancel               chan bool
 	mux                  sync.RWMutex
 }
@@ -98,10 +104,13 @@ func (cl *Client) addSession(tgt messages.Ticket, dep messages.EncKDCRepPart) {
 		tgt:                  tgt,
 		sessionKey:           dep.Key,
 		sessionKeyExpiration: dep.KeyExpiration,
+		flags:                dep.Flags,
+		fast:                 dep.EncPAData.Contains(patype.PA_FX_FAST),
 	}
 	cl.sessions.update(s)
 	cl.enableAutoSessionRenewal(s)
 	cl.Log("TGT session added for %s (EndTime: %v)", realm, dep.EndTime)
+	cl.saveCCache()
 }
 
 // update overwrites the session details with those from the TGT and decrypted encPart
@@ -114,6 +123,7 @@ func (s *session) update(tgt messages.Ticket, dep messages.EncKDCRepPart) {
 	s.tgt = tgt
 	s.sessionKey = dep.Key
 	s.sessionKeyExpiration = dep.KeyExpiration
+	s.flags = dep.Flags
 }
 
 // destroy will cancel any auto renewal of the session and set the expiration times to the current time
@@ -146,6 +156,20 @@ func (s *session) tgtDetails() (string, messages.Ticket, types.EncryptionKey) {
 	return s.realm, s.tgt, s.sessionKey
 }
 
+// fastAvailable indicates if the KDC that issued the session's TGT advertised support for FAST.
+func (s *session) fastAvailable() bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.fast
+}
+
+// forwardable indicates if the session's TGT is forwardable.
+func (s *session) forwardable() bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return types.IsFlagSet(&s.flags, flags.Forwardable)
+}
+
 // timeDetails is a thread safe way to get the session's validity time values
 func (s *session) timeDetails() (string, time.Time, time.Time, time.Time, time.Time) {
 	s.mux.RLock()
@@ -198,7 +222,7 @@ func (cl *Client) enableAutoSessionRenewal(s *session) {
 			timer = time.NewTimer(w)
 			select {
 			case <-timer.C:
-				renewal, err := cl.refreshSession(s)
+				renewal, err := cl.refreshSession(context.Background(), s)
 				if err != nil {
 					cl.Log("error refreshing session: %v", err)
 				}
@@ -216,40 +240,64 @@ func (cl *Client) enableAutoSessionRenewal(s *session) {
 }
 
 // renewTGT renews the client's TGT session.
-func (cl *Client) renewTGT(s *session) error {
+func (cl *Client) renewTGT(ctx context.Context, s *session) error {
 	realm, tgt, skey := s.tgtDetails()
 	spn := types.PrincipalName{
 		NameType:   nametype.KRB_NT_SRV_INST,
 		NameString: []string{"krbtgt", realm},
 	}
-	_, tgsRep, err := cl.TGSREQGenerateAndExchange(spn, cl.Credentials.Domain(), tgt, skey, true)
+	_, tgsRep, err := cl.tgsReqGenerateAndExchange(ctx, spn, cl.Credentials.Domain(), tgt, skey, true)
 	if err != nil {
 		return krberror.Errorf(err, krberror.KRBMsgError, "error renewing TGT for %s", realm)
 	}
 	s.update(tgsRep.Ticket, tgsRep.DecryptedEncPart)
 	cl.sessions.update(s)
 	cl.Log("TGT session renewed for %s (EndTime: %v)", realm, tgsRep.DecryptedEncPart.EndTime)
+	cl.saveCCache()
 	return nil
 }
 
+// RenewTGT renews the client's TGT for its realm, such as a TGT loaded from a credential cache with NewFromCCache, so
+// that it is valid for longer. The TGT must be renewable and its renewable lifetime must not have passed.
+func (cl *Client) RenewTGT() error {
+	return cl.RenewTGTContext(context.Background())
+}
+
+// RenewTGTContext renews the client's TGT for its realm.
+// If the context is done before the renewal completes the context's error is returned.
+func (cl *Client) RenewTGTContext(ctx context.Context) error {
+	realm := cl.Credentials.Domain()
+	s, ok := cl.sessions.get(realm)
+	if !ok {
+		return fmt.Errorf("could not find TGT session for %s", realm)
+	}
+	s.mux.RLock()
+	renewTill := s.renewTill
+	s.mux.RUnlock()
+	if !time.Now().UTC().Before(renewTill) {
+		return fmt.Errorf("TGT for %s is not renewable or its renewable lifetime has passed", realm)
+	}
+	return ctxErr(ctx, cl.renewTGT(ctx, s))
+}
+
 // refreshSession updates either through renewal or creating a new login.
 // The boolean indicates if the update was a renewal.
-func (cl *Client) refreshSession(s *session) (bool, error) {
+func (cl *Client) refreshSession(ctx context.Context, s *session) (bool, error) {
 	s.mux.RLock()
 	realm := s.realm
 	renewTill := s.renewTill
 	s.mux.RUnlock()
 	cl.Log("refreshing TGT session for %s", realm)
 	if time.Now().UTC().Before(renewTill) {
-		err := cl.renewTGT(s)
+		err := cl.renewTGT(ctx, s)
 		return true, err
 	}
-	err := cl.realmLogin(realm)
+	err := cl.realmLogin(ctx, realm)
 	return false, err
 }
 
 // ensureValidSession makes sure there is a valid session for the realm
-func (cl *Client) ensureValidSession(realm string) error {
+func (cl *Client) ensureValidSession(ctx context.Context, realm string) error {
 	s, ok := cl.sessions.get(realm)
 	if ok {
 		s.mux.RLock()
@@ -259,15 +307,15 @@ func (cl *Client) ensureValidSession(realm string) error {
 			return nil
 		}
 		s.mux.RUnlock()
-		_, err := cl.refreshSession(s)
+		_, err := cl.refreshSession(ctx, s)
 		return err
 	}
-	return cl.realmLogin(realm)
+	return cl.realmLogin(ctx, realm)
 }
 
 // sessionTGTDetails is a thread safe way to get the TGT and session key values for a realm
-func (cl *Client) sessionTGT(realm string) (tgt messages.Ticket, sessionKey types.EncryptionKey, err error) {
-	err = cl.ensureValidSession(realm)
+func (cl *Client) sessionTGT(ctx context.Context, realm string) (tgt messages.Ticket, sessionKey types.EncryptionKey, err error) {
+	err = cl.ensureValidSession(ctx, realm)
 	if err != nil {
 		return
 	}
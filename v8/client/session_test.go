@@ -1,20 +1,25 @@
 package client
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
 	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/jcmturner/gokrb5/v8/test"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -42,7 +47,7 @@ func TestMultiThreadedClientSession(t *testing.T) {
 	}
 	go func() {
 		for {
-			err := cl.renewTGT(s)
+			err := cl.renewTGT(context.Background(), s)
 			if err != nil {
 				t.Logf("error renewing TGT: %v", err)
 			}
@@ -55,7 +60,7 @@ func TestMultiThreadedClientSession(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		go func() {
 			defer wg.Done()
-			tgt, _, err := cl.sessionTGT("TEST.GOKRB5")
+			tgt, _, err := cl.sessionTGT(context.Background(), "TEST.GOKRB5")
 			if err != nil || tgt.Realm != "TEST.GOKRB5" {
 				t.Logf("error getting session: %v", err)
 			}
@@ -158,3 +163,68 @@ func TestSessions_JSON(t *testing.T) {
 ]`
 	assert.Equal(t, expected, j, "json output not as expected")
 }
+
+func TestClient_RenewTGT(t *testing.T) {
+	t.Parallel()
+	k, cfg := transportTestKDC(t)
+	tr := TransportFunc(func(ctx context.Context, network, address string, b []byte) ([]byte, error) {
+		return k.Handle(b), nil
+	})
+	dir, err := os.MkdirTemp("", "ccache")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cpath := filepath.Join(dir, "krb5cc_test")
+
+	cfg.LibDefaults.RenewLifetime = time.Hour
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, KDCTransport(tr), CCachePath(cpath))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	c, err := credentials.LoadCCache(cpath)
+	if err != nil {
+		t.Fatalf("error loading credential cache: %v", err)
+	}
+	tgt := types.PrincipalName{NameType: nametype.KRB_NT_SRV_INST, NameString: []string{"krbtgt", "TEST.GOKRB5"}}
+	before, ok := c.GetEntry(tgt)
+	if !ok {
+		t.Fatal("TGT not in credential cache")
+	}
+	fcl, err := NewFromCCache(c, cfg, KDCTransport(tr), CCachePath(cpath))
+	if err != nil {
+		t.Fatalf("error creating client from credential cache: %v", err)
+	}
+	err = fcl.RenewTGT()
+	if err != nil {
+		t.Fatalf("error renewing TGT: %v", err)
+	}
+	c, err = credentials.LoadCCache(cpath)
+	if err != nil {
+		t.Fatalf("error loading credential cache: %v", err)
+	}
+	after, ok := c.GetEntry(tgt)
+	if !ok {
+		t.Fatal("TGT not in credential cache after renewal")
+	}
+	assert.NotEqual(t, before.Ticket, after.Ticket, "renewed TGT not written to the credential cache")
+	cc, err := fcl.CCache()
+	if err != nil {
+		t.Fatalf("error getting credential cache of client: %v", err)
+	}
+	cred, ok := cc.GetEntry(tgt)
+	if !ok {
+		t.Fatal("TGT not in credential cache of client")
+	}
+	assert.Equal(t, after.Ticket, cred.Ticket, "TGT in credential cache of client not as expected")
+	assert.Equal(t, before.RenewTill, after.RenewTill, "renew till time not as expected")
+
+	// A TGT that is not renewable cannot be renewed.
+	after.RenewTill = time.Time{}
+	fcl, err = NewFromCCache(c, cfg, KDCTransport(tr))
+	if err != nil {
+		t.Fatalf("error creating client from credential cache: %v", err)
+	}
+	assert.Error(t, fcl.RenewTGT(), "TGT that is not renewable was renewed")
+}
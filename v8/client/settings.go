@@ -1,9 +1,14 @@
 package client
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4556"
 )
 
 // Settings holds optional client settings.
@@ -11,6 +16,19 @@ type Settings struct {
 	disablePAFXFast         bool
 	assumePreAuthentication bool
 	preAuthEType            int32
+	fastArmor               *Client
+	requireFAST             bool
+	ccachePath              string
+	pkinitTrustPool         *x509.CertPool
+	pkinitKDCNoPrincipal    bool
+	pkinitKeyAgreement      rfc4556.Group
+	transport               Transport
+	dialer                  Dialer
+	kdcProxyClient          *http.Client
+	kdcCooldown             time.Duration
+	cacheMaxEntries         int
+	cacheSweepInterval      time.Duration
+	cacheObserver           func(CacheEvent)
 	logger                  *log.Logger
 }
 
@@ -18,6 +36,19 @@ type Settings struct {
 type jsonSettings struct {
 	DisablePAFXFast         bool
 	AssumePreAuthentication bool
+	FASTArmor               bool
+	RequireFAST             bool
+	CCachePath              string
+	PKINITTrustPool         bool
+	PKINITKDCNoPrincipal    bool
+	PKINITKeyAgreement      int
+	KDCTransport            bool
+	KDCDialer               bool
+	KDCProxyHTTPClient      bool
+	KDCCooldown             time.Duration
+	CacheMaxEntries         int
+	CacheSweepInterval      time.Duration
+	CacheObserver           bool
 }
 
 // NewSettings creates a new client settings struct.
@@ -57,6 +88,230 @@ func (s *Settings) AssumePreAuthentication() bool {
 	return s.assumePreAuthentication
 }
 
+// FASTArmor used to configure the client to armor its AS exchanges, as defined in RFC 6113, using the TGT of the armor
+// client provided. The armor client could, for example, be created from a host's keytab. It must not be the client being
+// configured. TGS exchanges with the KDCs of realms that advertised FAST support when issuing the client's TGT are also
+// armored, using the subkey of the TGS_REQ's authenticator.
+//
+// s := NewSettings(FASTArmor(armorClient))
+func FASTArmor(cl *Client) func(*Settings) {
+	return func(s *Settings) {
+		s.fastArmor = cl
+	}
+}
+
+// FASTArmor returns the client whose TGT is used to armor AS exchanges, or nil if one is not configured.
+func (s *Settings) FASTArmor() *Client {
+	return s.fastArmor
+}
+
+// RequireFAST used to configure the client to fail exchanges with the KDC that cannot be protected with FAST armor.
+// All AS and TGS exchanges are armored. If no FASTArmor client is configured AS exchanges are armored with an anonymous
+// TGT obtained with anonymous PKINIT, as defined in RFC 8062, which requires the KDC's certificate to chain to a root in
+// the PKINITTrustPool or the pkinit_anchors of the configuration.
+//
+// s := NewSettings(RequireFAST(true))
+func RequireFAST(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.requireFAST = b
+	}
+}
+
+// RequireFAST indicates if the client must protect its exchanges with the KDC with FAST armor.
+func (s *Settings) RequireFAST() bool {
+	return s.requireFAST
+}
+
+// CCachePath used to configure the client to keep the credential cache at the path provided in sync with its tickets.
+// The path may be a credential cache name prefixed with its type, such as DIR:/run/user/%{uid}/krb5cc or
+// KEYRING:persistent:%{uid}, otherwise it is a file path. The credential cache is written when a TGT is obtained or
+// renewed and when a service ticket is added to the client's cache. It is destroyed when the client is destroyed.
+//
+// A short-lived process can reuse the tickets of a previous invocation by loading the credential cache with
+// credentials.LoadNamedCCache and creating the client with NewFromCCache, providing this setting.
+//
+// s := NewSettings(CCachePath("/tmp/krb5cc_1000"))
+func CCachePath(p string) func(*Settings) {
+	return func(s *Settings) {
+		s.ccachePath = p
+	}
+}
+
+// CCachePath returns the path of the credential cache file the client keeps in sync, or an empty string if one is not
+// configured.
+func (s *Settings) CCachePath() string {
+	return s.ccachePath
+}
+
+// PKINITTrustPool used to configure the pool of root certificates the KDC's certificate must chain to when the client
+// authenticates with PKINIT. If it is not configured the roots of the pkinit_anchors of the configuration are used, and
+// PKINIT fails if there are none.
+//
+// s := NewSettings(PKINITTrustPool(pool))
+func PKINITTrustPool(pool *x509.CertPool) func(*Settings) {
+	return func(s *Settings) {
+		s.pkinitTrustPool = pool
+	}
+}
+
+// PKINITTrustPool returns the pool of root certificates trusted to issue KDC certificates for PKINIT, or nil if one is
+// not configured.
+func (s *Settings) PKINITTrustPool() *x509.CertPool {
+	return s.pkinitTrustPool
+}
+
+// PKINITRequireKDCPrincipal used to configure if the KDC's certificate must have the id-pkinit-san subject alternative
+// name of the TGS principal of the realm, krbtgt/REALM@REALM, when the client authenticates with PKINIT.
+// Defaults to required. If not required a KDC certificate without any id-pkinit-san is accepted on its id-pkinit-KPKdc
+// extended key usage alone, so any KDC certificate issued by the trusted roots is accepted for every realm.
+//
+// s := NewSettings(PKINITRequireKDCPrincipal(false))
+func PKINITRequireKDCPrincipal(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.pkinitKDCNoPrincipal = !b
+	}
+}
+
+// PKINITRequireKDCPrincipal indicates if the KDC's certificate must have the id-pkinit-san of the TGS principal of the
+// realm for PKINIT.
+func (s *Settings) PKINITRequireKDCPrincipal() bool {
+	return !s.pkinitKDCNoPrincipal
+}
+
+// PKINITKeyAgreement used to configure the Diffie-Hellman group or elliptic curve of the key agreement with the KDC when
+// the client authenticates with PKINIT. The default is the 2048-bit MODP group.
+//
+// s := NewSettings(PKINITKeyAgreement(rfc4556.P256))
+func PKINITKeyAgreement(g rfc4556.Group) func(*Settings) {
+	return func(s *Settings) {
+		s.pkinitKeyAgreement = g
+	}
+}
+
+// PKINITKeyAgreement returns the Diffie-Hellman group or elliptic curve of the key agreement with the KDC for PKINIT.
+func (s *Settings) PKINITKeyAgreement() rfc4556.Group {
+	return s.pkinitKeyAgreement
+}
+
+// KDCTransport used to configure the transport the client exchanges messages with KDCs and kpasswd servers over.
+// This takes precedence over the KDCDialer setting.
+//
+// s := NewSettings(KDCTransport(t))
+func KDCTransport(t Transport) func(*Settings) {
+	return func(s *Settings) {
+		s.transport = t
+	}
+}
+
+// KDCTransport returns the transport for exchanging messages with KDCs and kpasswd servers. If one is not configured
+// the default transport is returned, using the dialer configured with the KDCDialer setting.
+func (s *Settings) KDCTransport() Transport {
+	if s.transport != nil {
+		return s.transport
+	}
+	return NewTransport(s.dialer)
+}
+
+// KDCDialer used to configure the dialer the default transport establishes connections to KDCs and kpasswd servers
+// with, for example to connect through a proxy.
+//
+// s := NewSettings(KDCDialer(d))
+func KDCDialer(d Dialer) func(*Settings) {
+	return func(s *Settings) {
+		s.dialer = d
+	}
+}
+
+// KDCDialer returns the dialer configured for the default transport, or nil if one is not configured.
+func (s *Settings) KDCDialer() Dialer {
+	return s.dialer
+}
+
+// KDCCooldown used to configure the client to mark a KDC or kpasswd server that fails to respond as down for the
+// duration provided. Servers marked down are only tried if none of the other servers for the realm respond. By default
+// servers are not marked down, though those that recently failed are tried after the others.
+//
+// s := NewSettings(KDCCooldown(time.Minute))
+func KDCCooldown(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcCooldown = d
+	}
+}
+
+// KDCCooldown returns the duration a KDC or kpasswd server that fails to respond is marked down for.
+func (s *Settings) KDCCooldown() time.Duration {
+	return s.kdcCooldown
+}
+
+// CacheMaxEntries used to configure the maximum number of service tickets held in the client's cache. When a ticket is
+// added to a full cache the least recently used entry is evicted. By default the number of entries is not limited.
+//
+// s := NewSettings(CacheMaxEntries(1000))
+func CacheMaxEntries(n int) func(*Settings) {
+	return func(s *Settings) {
+		s.cacheMaxEntries = n
+	}
+}
+
+// CacheMaxEntries returns the maximum number of service tickets held in the client's cache. Zero means no limit.
+func (s *Settings) CacheMaxEntries() int {
+	return s.cacheMaxEntries
+}
+
+// CacheSweepInterval used to configure the client to remove service tickets that have expired, and can no longer be
+// renewed, from its cache at the interval provided. By default expired tickets are only removed when next looked up.
+// The sweeping is stopped when the client is destroyed.
+//
+// s := NewSettings(CacheSweepInterval(10 * time.Minute))
+func CacheSweepInterval(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.cacheSweepInterval = d
+	}
+}
+
+// CacheSweepInterval returns the interval at which expired service tickets are removed from the client's cache.
+func (s *Settings) CacheSweepInterval() time.Duration {
+	return s.cacheSweepInterval
+}
+
+// CacheObserver used to configure a function that is called with each event on the client's service ticket cache,
+// such as hits, misses, renewals and evictions, for example to record metrics. The function is called synchronously so
+// should return quickly. Counts of the events are also available from the client's CacheStats method.
+//
+// s := NewSettings(CacheObserver(f))
+func CacheObserver(f func(CacheEvent)) func(*Settings) {
+	return func(s *Settings) {
+		s.cacheObserver = f
+	}
+}
+
+// CacheObserver returns the function called with each event on the client's service ticket cache, or nil if one is not
+// configured.
+func (s *Settings) CacheObserver() func(CacheEvent) {
+	return s.cacheObserver
+}
+
+// KDCProxyHTTPClient used to configure the HTTP client the client sends messages to KDC proxies (MS-KKDCP) with. KDC
+// proxies are used for KDCs and kpasswd servers configured in the krb5.conf with an https URL, such as
+// kdc = https://proxy.example.com/KdcProxy
+// The HTTP client's transport can be used to configure the trusted root certificates and any HTTP proxy.
+//
+// s := NewSettings(KDCProxyHTTPClient(c))
+func KDCProxyHTTPClient(c *http.Client) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcProxyClient = c
+	}
+}
+
+// KDCProxyHTTPClient returns the HTTP client for sending messages to KDC proxies. If one is not configured a client
+// using the default HTTP transport is returned.
+func (s *Settings) KDCProxyHTTPClient() *http.Client {
+	if s.kdcProxyClient != nil {
+		return s.kdcProxyClient
+	}
+	return defaultKDCProxyClient
+}
+
 // Logger used to configure client with a logger.
 //
 // s := NewSettings(kt, Logger(l))
@@ -83,6 +338,19 @@ func (s *Settings) JSON() (string, error) {
 	js := jsonSettings{
 		DisablePAFXFast:         s.disablePAFXFast,
 		AssumePreAuthentication: s.assumePreAuthentication,
+		FASTArmor:               s.fastArmor != nil,
+		RequireFAST:             s.requireFAST,
+		CCachePath:              s.ccachePath,
+		PKINITTrustPool:         s.pkinitTrustPool != nil,
+		PKINITKDCNoPrincipal:    s.pkinitKDCNoPrincipal,
+		PKINITKeyAgreement:      int(s.pkinitKeyAgreement),
+		KDCTransport:            s.transport != nil,
+		KDCDialer:               s.dialer != nil,
+		KDCProxyHTTPClient:      s.kdcProxyClient != nil,
+		KDCCooldown:             s.kdcCooldown,
+		CacheMaxEntries:         s.cacheMaxEntries,
+		CacheSweepInterval:      s.cacheSweepInterval,
+		CacheObserver:           s.cacheObserver != nil,
 	}
 	b, err := json.MarshalIndent(js, "", "  ")
 	if err != nil {
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Transport exchanges messages with KDCs and kpasswd servers.
+//
+// The default transport connects directly to the servers over UDP or TCP. A custom transport can be configured with
+// the KDCTransport setting to route the messages in some other way, for example through a proxy or to an in-memory
+// KDC in tests. KDCs and kpasswd servers configured with an https URL are sent messages with the HTTP client of the
+// KDCProxyHTTPClient setting rather than the transport.
+type Transport interface {
+	// Exchange sends the message to the server at the address over the network, which is either "udp" or "tcp", and
+	// returns the reply. The message and the reply do not include the length prefix used over TCP.
+	// If the context is done before the exchange completes the context's error should be returned.
+	Exchange(ctx context.Context, network, address string, b []byte) ([]byte, error)
+}
+
+// TransportFunc is an adapter to allow the use of an ordinary function as a Transport.
+type TransportFunc func(ctx context.Context, network, address string, b []byte) ([]byte, error)
+
+// Exchange calls f(ctx, network, address, b).
+func (f TransportFunc) Exchange(ctx context.Context, network, address string, b []byte) ([]byte, error) {
+	return f(ctx, network, address, b)
+}
+
+// Dialer establishes the connections to KDCs and kpasswd servers for the default transport. It is implemented by
+// net.Dialer.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// NewTransport returns the default transport, which connects directly to the servers using the dialer provided.
+// If the dialer is nil a net.Dialer is used.
+func NewTransport(d Dialer) Transport {
+	return newNetTransport(d)
+}
+
+func newNetTransport(d Dialer) *netTransport {
+	if d == nil {
+		d = &net.Dialer{Timeout: dialTimeout}
+	}
+	return &netTransport{dialer: d}
+}
+
+// netTransport is the default transport, exchanging each message over a new connection.
+type netTransport struct {
+	dialer Dialer
+}
+
+// Exchange sends the message to the server at the address over a new UDP or TCP connection and returns the reply.
+func (t *netTransport) Exchange(ctx context.Context, network, address string, b []byte) ([]byte, error) {
+	conn, err := t.dial(ctx, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("error establishing connection to %s: %v", address, err)
+	}
+	return sendContext(ctx, conn, func() ([]byte, error) {
+		if network == "udp" {
+			return sendUDP(conn, b)
+		}
+		return sendTCP(conn, b)
+	})
+}
+
+// dial establishes a connection to the address with a deadline for the exchange of a message that is the earlier of
+// the dial timeout and the context's deadline.
+func (t *netTransport) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	dctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	conn, err := t.dialer.DialContext(dctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(exchangeDeadline(ctx)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error setting deadline: %v", err)
+	}
+	return conn, nil
+}
+
+// exchangeDeadline returns the deadline for the exchange of a message, which is the earlier of the dial timeout and the
+// context's deadline.
+func exchangeDeadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(dialTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return deadline
+}
@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/test/kdc"
+	"github.com/stretchr/testify/assert"
+)
+
+const transportTestConf = `[libdefaults]
+  default_realm = TEST.GOKRB5
+  dns_lookup_kdc = false
+
+[realms]
+  TEST.GOKRB5 = {
+    kdc = kdc.test.gokrb5:88
+    kpasswd_server = kdc.test.gokrb5:464
+  }
+`
+
+func transportTestKDC(t *testing.T, settings ...func(*kdc.Settings)) (*kdc.KDC, *config.Config) {
+	k, err := kdc.New("TEST.GOKRB5", settings...)
+	if err != nil {
+		t.Fatalf("error creating KDC: %v", err)
+	}
+	err = k.AddPrincipal("testuser1", "passwordvalue")
+	if err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	err = k.AddPrincipal("HTTP/host.test.gokrb5", "servicepassword")
+	if err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	cfg, err := config.NewFromString(transportTestConf)
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	return k, cfg
+}
+
+func TestKDCTransport(t *testing.T) {
+	t.Parallel()
+	k, cfg := transportTestKDC(t)
+	var mux sync.Mutex
+	var addrs []string
+	tr := TransportFunc(func(ctx context.Context, network, address string, b []byte) ([]byte, error) {
+		mux.Lock()
+		addrs = append(addrs, address)
+		mux.Unlock()
+		if address == "kdc.test.gokrb5:464" {
+			return k.HandleKPasswd(b), nil
+		}
+		return k.Handle(b), nil
+	})
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, DisablePAFXFAST(true), KDCTransport(tr))
+	err := cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in over in-memory transport: %v", err)
+	}
+	defer cl.Destroy()
+	_, _, err = cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	assert.NoError(t, err, "error getting service ticket over in-memory transport")
+	ok, err := cl.ChangePasswd("newpasswordvalue")
+	assert.True(t, ok, "password should be changed over in-memory transport: %v", err)
+	assert.Contains(t, addrs, "kdc.test.gokrb5:88", "KDC messages should be sent over the transport")
+	assert.Contains(t, addrs, "kdc.test.gokrb5:464", "kpasswd messages should be sent over the transport")
+}
+
+// redirectDialer dials the address provided in place of the address requested.
+type redirectDialer struct {
+	address string
+	dials   int
+	mux     sync.Mutex
+}
+
+func (d *redirectDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.mux.Lock()
+	d.dials++
+	d.mux.Unlock()
+	var nd net.Dialer
+	return nd.DialContext(ctx, network, d.address)
+}
+
+func TestKDCDialer(t *testing.T) {
+	t.Parallel()
+	k, cfg := transportTestKDC(t)
+	err := k.Start()
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	defer k.Close()
+	for _, limit := range []int{1, 1465} {
+		cfg.LibDefaults.UDPPreferenceLimit = limit
+		d := &redirectDialer{address: k.Addr()}
+		cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg, DisablePAFXFAST(true), KDCDialer(d))
+		err = cl.Login()
+		if err != nil {
+			t.Fatalf("error logging in with UDP preference limit %d through dialer: %v", limit, err)
+		}
+		assert.True(t, d.dials > 0, "connections should be established with the dialer")
+		cl.Destroy()
+	}
+}
+
+func TestPrimaryKDCRetry(t *testing.T) {
+	t.Parallel()
+	// The replica has not yet received the user's new password from the primary.
+	replica, err := kdc.New("TEST.GOKRB5", kdc.RequirePreAuth(true))
+	if err != nil {
+		t.Fatalf("error creating KDC: %v", err)
+	}
+	replica.AddPrincipal("testuser1", "passwordvalue")
+	primary, err := kdc.New("TEST.GOKRB5", kdc.RequirePreAuth(true))
+	if err != nil {
+		t.Fatalf("error creating KDC: %v", err)
+	}
+	primary.AddPrincipal("testuser1", "newpasswordvalue")
+	var mux sync.Mutex
+	attempts := make(map[string]int)
+	tr := TransportFunc(func(ctx context.Context, network, address string, b []byte) ([]byte, error) {
+		mux.Lock()
+		attempts[address]++
+		mux.Unlock()
+		if address == "primary.test.gokrb5:88" {
+			return primary.Handle(b), nil
+		}
+		return replica.Handle(b), nil
+	})
+
+	cfg, err := config.NewFromString(transportTestConf)
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "newpasswordvalue", cfg, DisablePAFXFAST(true), KDCTransport(tr))
+	err = cl.Login()
+	assert.Error(t, err, "login should fail with the replica when there is no primary KDC")
+	assert.Equal(t, 0, attempts["primary.test.gokrb5:88"], "primary KDC should not be used when not configured")
+
+	cfg.Realms[0].MasterKDC = []string{"primary.test.gokrb5:88"}
+	cl = NewWithPassword("testuser1", "TEST.GOKRB5", "newpasswordvalue", cfg, DisablePAFXFAST(true), KDCTransport(tr))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("login should succeed by retrying with the primary KDC: %v", err)
+	}
+	cl.Destroy()
+	assert.True(t, attempts["kdc.test.gokrb5:88"] > 0, "replica should be tried first")
+	assert.True(t, attempts["primary.test.gokrb5:88"] > 0, "primary KDC should be retried after pre-authentication failed")
+
+	cl = NewWithPassword("testuser1", "TEST.GOKRB5", "wrongpassword", cfg, DisablePAFXFAST(true), KDCTransport(tr))
+	err = cl.Login()
+	assert.Error(t, err, "login with a password that is wrong on the primary KDC should fail")
+}
@@ -0,0 +1,121 @@
+// Package cli provides functions shared by the gokrb5 commands.
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+)
+
+// KRB5ConfPath returns the path of the krb5.conf file, which is that of the KRB5_CONFIG environment variable if it is
+// set.
+func KRB5ConfPath() string {
+	if p := os.Getenv("KRB5_CONFIG"); p != "" {
+		return p
+	}
+	return "/etc/krb5.conf"
+}
+
+// LoadConfig loads the krb5.conf file at the path. The default configuration is returned if the file does not exist, as
+// is often the case in minimal container images where the KDCs of realms are found with DNS.
+func LoadConfig(path string) (*config.Config, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		c := config.New()
+		c.LibDefaults.DNSLookupKDC = true
+		return c, nil
+	}
+	c, err := config.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading krb5.conf: %v", err)
+	}
+	return c, nil
+}
+
+// CCacheName returns the credential cache name provided, or the default credential cache name if it is empty, with its
+// type prefixed and its tokens expanded, such as FILE:/tmp/krb5cc_1000.
+func CCacheName(cfg *config.Config, name string) (string, error) {
+	if name == "" {
+		var err error
+		name, err = credentials.DefaultCCacheName(cfg)
+		if err != nil {
+			return "", err
+		}
+	}
+	t, r, err := credentials.ParseCCacheName(name)
+	if err != nil {
+		return "", err
+	}
+	return t + ":" + r, nil
+}
+
+// KeytabPath returns the path of the keytab file name provided, or of the default keytab if it is empty, which is
+// that of the KRB5_KTNAME environment variable if it is set.
+func KeytabPath(cfg *config.Config, name string) string {
+	if name == "" {
+		name = os.Getenv("KRB5_KTNAME")
+	}
+	if name == "" {
+		name = cfg.LibDefaults.DefaultKeytabName
+	}
+	if strings.HasPrefix(strings.ToUpper(name), "FILE:") {
+		name = name[len("FILE:"):]
+	}
+	return name
+}
+
+// EncTypeName returns the name of the encryption type.
+func EncTypeName(id int32) string {
+	switch id {
+	case etypeID.AES128_CTS_HMAC_SHA1_96:
+		return "aes128-cts-hmac-sha1-96"
+	case etypeID.AES256_CTS_HMAC_SHA1_96:
+		return "aes256-cts-hmac-sha1-96"
+	case etypeID.AES128_CTS_HMAC_SHA256_128:
+		return "aes128-cts-hmac-sha256-128"
+	case etypeID.AES256_CTS_HMAC_SHA384_192:
+		return "aes256-cts-hmac-sha384-192"
+	case etypeID.DES3_CBC_SHA1_KD:
+		return "des3-cbc-sha1-kd"
+	case etypeID.RC4_HMAC:
+		return "arcfour-hmac"
+	}
+	// Other encryption types have several names so the first in alphabetical order is used.
+	var names []string
+	for n, i := range etypeID.ETypesByName {
+		if i == id {
+			names = append(names, n)
+		}
+	}
+	if len(names) < 1 {
+		return fmt.Sprintf("etype %d", id)
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// ReadPassword prompts for a password on the writer and reads it from the first line of the reader. If the reader is a
+// terminal the password is not echoed, where the platform supports it.
+func ReadPassword(r io.Reader, w io.Writer, prompt string) (string, error) {
+	fmt.Fprint(w, prompt)
+	if f, ok := r.(*os.File); ok {
+		if restore, err := disableEcho(f); err == nil {
+			defer func() {
+				restore()
+				// The newline entered is not echoed.
+				fmt.Fprintln(w)
+			}()
+		}
+	}
+	s, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && (err != io.EOF || s == "") {
+		return "", fmt.Errorf("error reading password: %v", err)
+	}
+	return strings.TrimRight(s, "\r\n"), nil
+}
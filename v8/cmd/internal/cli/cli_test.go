@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig_Missing(t *testing.T) {
+	t.Parallel()
+	c, err := LoadConfig(filepath.Join(t.Name(), "missing.conf"))
+	if err != nil {
+		t.Fatalf("error loading missing config: %v", err)
+	}
+	assert.True(t, c.LibDefaults.DNSLookupKDC, "KDCs not looked up with DNS without a krb5.conf")
+}
+
+func TestCCacheName(t *testing.T) {
+	t.Parallel()
+	n, err := CCacheName(config.New(), "/tmp/krb5cc_test")
+	if err != nil {
+		t.Fatalf("error getting credential cache name: %v", err)
+	}
+	assert.Equal(t, "FILE:/tmp/krb5cc_test", n, "credential cache name not as expected")
+}
+
+func TestKeytabPath(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "/etc/test.keytab", KeytabPath(config.New(), "FILE:/etc/test.keytab"), "keytab path not as expected")
+	assert.Equal(t, "/etc/test.keytab", KeytabPath(config.New(), "/etc/test.keytab"), "keytab path not as expected")
+}
+
+func TestEncTypeName(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "aes256-cts-hmac-sha1-96", EncTypeName(etypeID.AES256_CTS_HMAC_SHA1_96), "name not as expected")
+	assert.Equal(t, "etype 9999", EncTypeName(9999), "name of an unknown encryption type not as expected")
+}
+
+func TestReadPassword(t *testing.T) {
+	t.Parallel()
+	var w bytes.Buffer
+	p, err := ReadPassword(strings.NewReader("secret\r\nnext\n"), &w, "Password: ")
+	if err != nil {
+		t.Fatalf("error reading password: %v", err)
+	}
+	assert.Equal(t, "secret", p, "password not as expected")
+	assert.Equal(t, "Password: ", w.String(), "prompt not as expected")
+	p, err = ReadPassword(strings.NewReader("secret"), &w, "")
+	assert.NoError(t, err, "error reading a password without a newline")
+	assert.Equal(t, "secret", p, "password without a newline not as expected")
+	_, err = ReadPassword(strings.NewReader(""), &w, "")
+	assert.Error(t, err, "no error reading an empty input")
+}
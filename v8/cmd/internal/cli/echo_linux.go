@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// disableEcho turns off the echoing of input to the terminal, returning a function that restores it. An error is
+// returned if the file is not a terminal.
+func disableEcho(f *os.File) (func(), error) {
+	var t syscall.Termios
+	if err := ioctl(f, syscall.TCGETS, &t); err != nil {
+		return nil, err
+	}
+	old := t
+	t.Lflag &^= syscall.ECHO
+	t.Lflag |= syscall.ICANON | syscall.ISIG
+	if err := ioctl(f, syscall.TCSETS, &t); err != nil {
+		return nil, err
+	}
+	return func() {
+		ioctl(f, syscall.TCSETS, &old)
+	}, nil
+}
+
+func ioctl(f *os.File, req uintptr, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
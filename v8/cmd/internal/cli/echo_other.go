@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package cli
+
+import (
+	"errors"
+	"os"
+)
+
+// disableEcho is not supported on this platform so the password is echoed.
+func disableEcho(f *os.File) (func(), error) {
+	return nil, errors.New("disabling terminal echo is not supported on this platform")
+}
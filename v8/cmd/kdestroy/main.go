@@ -0,0 +1,64 @@
+// Command kdestroy destroys a Kerberos credential cache, as the MIT Kerberos kdestroy command does, so that tickets can
+// be discarded in environments without the MIT Kerberos tools.
+//
+// Usage:
+//
+//	kdestroy [-q] [-c ccache]
+//
+// The default credential cache is that of the KRB5CCNAME environment variable or the krb5.conf. The krb5.conf file is
+// that of the KRB5_CONFIG environment variable, or /etc/krb5.conf.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jcmturner/gokrb5/v8/cmd/internal/cli"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// run executes the command with the arguments and returns the exit status.
+func run(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("kdestroy", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: kdestroy [flags]")
+		fs.PrintDefaults()
+	}
+	ccache := fs.String("c", "", "credential cache name, such as FILE:/tmp/krb5cc_1000 (default from KRB5CCNAME or krb5.conf)")
+	quiet := fs.Bool("q", false, "do not report errors")
+	cfgPath := fs.String("krb5conf", cli.KRB5ConfPath(), "krb5.conf file")
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := cli.LoadConfig(*cfgPath)
+	var name string
+	if err == nil {
+		name, err = cli.CCacheName(cfg, *ccache)
+	}
+	if err == nil {
+		err = credentials.DestroyNamedCCache(name)
+	}
+	if err != nil {
+		if !*quiet {
+			fmt.Fprintf(stderr, "kdestroy: %v\n", err)
+		}
+		return 1
+	}
+	return 0
+}
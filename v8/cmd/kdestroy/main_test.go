@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "gokrb5-kdestroy")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "krb5.conf")
+	path := filepath.Join(dir, "ccache")
+	err = ioutil.WriteFile(path, []byte{0x05, 0x04}, 0600)
+	if err != nil {
+		t.Fatalf("error writing credential cache: %v", err)
+	}
+
+	var stderr bytes.Buffer
+	assert.Equal(t, 2, run([]string{"extra"}, &stderr), "exit status for an argument not as expected")
+	assert.Equal(t, 0, run([]string{"-krb5conf", conf, "-c", "FILE:" + path}, &stderr), "exit status not as expected: %s", stderr.String())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "credential cache not destroyed")
+	assert.Equal(t, 0, run([]string{"-krb5conf", conf, "-c", "FILE:" + path}, &stderr), "exit status for a missing credential cache not as expected")
+
+	stderr.Reset()
+	assert.Equal(t, 1, run([]string{"-krb5conf", conf, "-q", "-c", "UNKNOWN:" + path}, &stderr), "exit status for an unsupported type not as expected")
+	assert.Empty(t, stderr.String(), "error reported with -q")
+}
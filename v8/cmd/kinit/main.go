@@ -0,0 +1,250 @@
+// Command kinit obtains a Kerberos ticket-granting ticket (TGT) and saves it to a credential cache, as the MIT Kerberos
+// kinit command does, so that it can be used in environments without the MIT Kerberos tools.
+//
+// Usage:
+//
+//	kinit [-c ccache] [-l lifetime] [-r renewable-lifetime] [-f | -F] [-k [-t keytab]] [-n] [-X X509_anchors=anchor] [principal]
+//	kinit -R [-c ccache]
+//
+// The password of the principal is read from standard input, without being echoed if it is a terminal, unless a
+// keytab is used. Anonymous PKINIT with -n requires the KDC's certificate to chain to a root of the pkinit_anchors of
+// the krb5.conf, or of the anchors given with -X X509_anchors=FILE:path or DIR:path instead. Lifetimes are durations such as 10h, 90m or 7d. The krb5.conf file is that of the KRB5_CONFIG
+// environment variable, or /etc/krb5.conf, and the default credential cache that of KRB5CCNAME or the krb5.conf.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/cmd/internal/cli"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command with the arguments and returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("kinit", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: kinit [flags] [principal]")
+		fs.PrintDefaults()
+	}
+	ccache := fs.String("c", "", "credential cache name, such as FILE:/tmp/krb5cc_1000 (default from KRB5CCNAME or krb5.conf)")
+	lifetime := fs.String("l", "", "requested lifetime of the ticket, such as 10h (default from krb5.conf)")
+	renewable := fs.String("r", "", "requested renewable lifetime of the ticket, such as 7d (default from krb5.conf)")
+	forwardable := fs.Bool("f", false, "request a forwardable ticket")
+	notForwardable := fs.Bool("F", false, "request a ticket that is not forwardable")
+	useKeytab := fs.Bool("k", false, "use a key from a keytab rather than a password")
+	ktName := fs.String("t", "", "keytab to use with -k (default from KRB5_KTNAME or krb5.conf)")
+	anonymous := fs.Bool("n", false, "obtain an anonymous ticket with anonymous PKINIT")
+	var attrs attributes
+	fs.Var(&attrs, "X", "PKINIT attribute X509_anchors=FILE:path or DIR:path of roots trusted for the KDC's certificate, repeatable (default pkinit_anchors from krb5.conf)")
+	renew := fs.Bool("R", false, "renew the ticket in the credential cache")
+	cfgPath := fs.String("krb5conf", cli.KRB5ConfPath(), "krb5.conf file")
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 || *forwardable && *notForwardable || *renew && (*useKeytab || *anonymous || fs.NArg() > 0) {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := cli.LoadConfig(*cfgPath)
+	if err == nil {
+		err = setLibDefaults(cfg, *lifetime, *renewable, *forwardable, *notForwardable)
+	}
+	if err == nil {
+		err = setAttributes(cfg, attrs)
+	}
+	var name string
+	if err == nil {
+		name, err = cli.CCacheName(cfg, *ccache)
+	}
+	if err == nil {
+		if *renew {
+			err = renewTGT(cfg, name)
+		} else {
+			err = login(cfg, name, fs.Arg(0), *useKeytab, *ktName, *anonymous, stdin, stderr)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "kinit: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// setLibDefaults sets the ticket options requested in the configuration.
+func setLibDefaults(cfg *config.Config, lifetime, renewable string, forwardable, notForwardable bool) error {
+	if lifetime != "" {
+		d, err := config.ParseDuration(lifetime)
+		if err != nil {
+			return fmt.Errorf("lifetime %q is not valid: %v", lifetime, err)
+		}
+		cfg.LibDefaults.TicketLifetime = d
+	}
+	if renewable != "" {
+		d, err := config.ParseDuration(renewable)
+		if err != nil {
+			return fmt.Errorf("renewable lifetime %q is not valid: %v", renewable, err)
+		}
+		cfg.LibDefaults.RenewLifetime = d
+	}
+	if forwardable {
+		cfg.LibDefaults.Forwardable = true
+	}
+	if notForwardable {
+		cfg.LibDefaults.Forwardable = false
+	}
+	return nil
+}
+
+// attributes holds the pre-authentication attributes of the -X flags.
+type attributes []string
+
+// String returns the attributes as a comma separated list.
+func (a *attributes) String() string {
+	return strings.Join(*a, ",")
+}
+
+// Set adds the attribute of a -X flag.
+func (a *attributes) Set(v string) error {
+	*a = append(*a, v)
+	return nil
+}
+
+// setAttributes sets the pre-authentication attributes in the configuration. Only the X509_anchors attribute is
+// supported, whose values replace the pkinit_anchors of the configuration.
+func setAttributes(cfg *config.Config, attrs attributes) error {
+	var anchors []string
+	for _, a := range attrs {
+		p := strings.SplitN(a, "=", 2)
+		if len(p) != 2 || p[0] != "X509_anchors" {
+			return fmt.Errorf("pre-authentication attribute %q is not supported", a)
+		}
+		anchors = append(anchors, p[1])
+	}
+	if len(anchors) > 0 {
+		cfg.LibDefaults.PKINITAnchors = anchors
+		for i := range cfg.Realms {
+			cfg.Realms[i].PKINITAnchors = nil
+		}
+	}
+	return nil
+}
+
+// login obtains a TGT for the principal and saves it to the named credential cache, replacing its content.
+func login(cfg *config.Config, ccache, principal string, useKeytab bool, ktName string, anonymous bool, stdin io.Reader, stderr io.Writer) error {
+	var cl *client.Client
+	if anonymous {
+		realm := principal
+		if i := strings.LastIndex(realm, "@"); i >= 0 {
+			realm = realm[i+1:]
+		}
+		if realm == "" {
+			realm = cfg.LibDefaults.DefaultRealm
+		}
+		cl = client.NewAnonymous(realm, cfg)
+	} else {
+		pn, realm, err := clientPrincipal(cfg, principal, useKeytab)
+		if err != nil {
+			return err
+		}
+		username := pn.PrincipalNameString()
+		if useKeytab {
+			path := cli.KeytabPath(cfg, ktName)
+			kt, err := keytab.Load(path)
+			if err != nil {
+				return fmt.Errorf("error loading keytab %s: %v", path, err)
+			}
+			cl = client.NewWithKeytab(username, realm, kt, cfg)
+		} else {
+			password, err := cli.ReadPassword(stdin, stderr, fmt.Sprintf("Password for %s@%s: ", username, realm))
+			if err != nil {
+				return err
+			}
+			cl = client.NewWithPassword(username, realm, password, cfg)
+		}
+	}
+	defer cl.Destroy()
+	err := cl.Login()
+	if err != nil {
+		return err
+	}
+	return saveCCache(cl, ccache)
+}
+
+// clientPrincipal returns the principal to obtain a TGT for, which if not provided is the host service principal of the
+// host for a keytab, or that of the current user otherwise.
+func clientPrincipal(cfg *config.Config, principal string, useKeytab bool) (types.PrincipalName, string, error) {
+	if principal == "" {
+		if useKeytab {
+			h, err := os.Hostname()
+			if err != nil {
+				return types.PrincipalName{}, "", fmt.Errorf("could not determine the host name: %v", err)
+			}
+			principal = "host/" + strings.ToLower(h)
+		} else {
+			u, err := user.Current()
+			if err != nil {
+				return types.PrincipalName{}, "", fmt.Errorf("could not determine the current user: %v", err)
+			}
+			principal = u.Username
+		}
+	}
+	pn, realm := types.ParseSPNString(principal)
+	if realm == "" {
+		realm = cfg.LibDefaults.DefaultRealm
+	}
+	if realm == "" {
+		return pn, realm, errors.New("the principal has no realm and there is no default realm")
+	}
+	return pn, realm, nil
+}
+
+// renewTGT renews the TGT in the named credential cache and saves it back to the credential cache.
+func renewTGT(cfg *config.Config, ccache string) error {
+	c, err := credentials.LoadNamedCCache(ccache)
+	if err != nil {
+		return fmt.Errorf("error loading credential cache %s: %v", ccache, err)
+	}
+	cl, err := client.NewFromCCache(c, cfg)
+	if err != nil {
+		return err
+	}
+	defer cl.Destroy()
+	err = cl.RenewTGT()
+	if err != nil {
+		return err
+	}
+	return saveCCache(cl, ccache)
+}
+
+// saveCCache saves the client's tickets to the named credential cache.
+func saveCCache(cl *client.Client, ccache string) error {
+	c, err := cl.CCache()
+	if err != nil {
+		return fmt.Errorf("error creating credential cache: %v", err)
+	}
+	err = c.SaveNamed(ccache)
+	if err != nil {
+		return fmt.Errorf("error saving credential cache %s: %v", ccache, err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	stdasn1 "encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4556"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/test/kdc"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRealm    = "TEST.GOKRB5"
+	testUser     = "testuser1"
+	testPassword = "passwordvalue"
+)
+
+// kinit runs the command with the arguments and input provided, returning its exit status and standard error.
+func kinit(t *testing.T, stdin string, args ...string) (int, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stderr.String()
+}
+
+// testDir starts a KDC with the settings provided and returns a temporary directory with a krb5.conf file for it.
+func testDir(t *testing.T, settings ...func(*kdc.Settings)) (*kdc.KDC, string) {
+	k, err := kdc.New(testRealm, append([]func(*kdc.Settings){kdc.RequirePreAuth(true)}, settings...)...)
+	if err != nil {
+		t.Fatalf("error creating KDC: %v", err)
+	}
+	err = k.AddPrincipal(testUser, testPassword)
+	if err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	err = k.Start()
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	t.Cleanup(func() { k.Close() })
+	dir, err := ioutil.TempDir("", "gokrb5-kinit")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	err = ioutil.WriteFile(filepath.Join(dir, "krb5.conf"), []byte(k.KRB5Conf()), 0600)
+	if err != nil {
+		t.Fatalf("error writing krb5.conf: %v", err)
+	}
+	return k, dir
+}
+
+// loadTGT loads the credential cache and returns its TGT.
+func loadTGT(t *testing.T, name string) *credentials.Credential {
+	c, err := credentials.LoadNamedCCache(name)
+	if err != nil {
+		t.Fatalf("error loading credential cache: %v", err)
+	}
+	tgt, ok := c.GetEntry(types.NewPrincipalName(2, "krbtgt/"+testRealm))
+	if !ok {
+		t.Fatal("credential cache does not have a TGT")
+	}
+	return tgt
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	code, _ := kinit(t, "", "-h")
+	assert.Equal(t, 0, code, "exit status for -h not as expected")
+	code, _ = kinit(t, "", "-f", "-F", "user")
+	assert.Equal(t, 2, code, "exit status for conflicting flags not as expected")
+	code, _ = kinit(t, "", "-R", "user")
+	assert.Equal(t, 2, code, "exit status for -R with a principal not as expected")
+	code, stderr := kinit(t, "", "-krb5conf", filepath.Join(t.Name(), "missing.conf"), "-l", "forever", "user")
+	assert.Equal(t, 1, code, "exit status for an invalid lifetime not as expected")
+	assert.Contains(t, stderr, "lifetime", "error for an invalid lifetime not as expected")
+}
+
+func TestLogin_Password(t *testing.T) {
+	t.Parallel()
+	_, dir := testDir(t)
+	conf := filepath.Join(dir, "krb5.conf")
+	ccache := "FILE:" + filepath.Join(dir, "ccache")
+
+	code, stderr := kinit(t, "wrongpassword\n", "-krb5conf", conf, "-c", ccache, testUser)
+	assert.Equal(t, 1, code, "exit status for a wrong password not as expected: %s", stderr)
+	_, err := os.Stat(filepath.Join(dir, "ccache"))
+	assert.True(t, os.IsNotExist(err), "credential cache created for a failed login")
+
+	code, stderr = kinit(t, testPassword+"\n", "-krb5conf", conf, "-c", ccache, "-l", "1h", "-r", "2h", "-f", testUser)
+	if !assert.Equal(t, 0, code, "exit status not as expected: %s", stderr) {
+		t.FailNow()
+	}
+	assert.Contains(t, stderr, "Password for "+testUser+"@"+testRealm, "password prompt not as expected")
+	tgt := loadTGT(t, ccache)
+	assert.Equal(t, testUser, tgt.Client.PrincipalName.PrincipalNameString(), "client principal not as expected")
+	assert.WithinDuration(t, time.Now().Add(time.Hour), tgt.EndTime, time.Minute, "ticket lifetime not as expected")
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), tgt.RenewTill, time.Minute, "renewable lifetime not as expected")
+	assert.True(t, types.IsFlagSet(&tgt.TicketFlags, flags.Forwardable), "ticket is not forwardable")
+
+	code, stderr = kinit(t, "", "-krb5conf", conf, "-c", ccache, "-R")
+	if !assert.Equal(t, 0, code, "exit status for renewal not as expected: %s", stderr) {
+		t.FailNow()
+	}
+	renewed := loadTGT(t, ccache)
+	assert.NotEqual(t, tgt.Ticket, renewed.Ticket, "ticket not renewed")
+	assert.Equal(t, tgt.RenewTill.Unix(), renewed.RenewTill.Unix(), "renew till of renewed ticket not as expected")
+}
+
+func TestLogin_Keytab(t *testing.T) {
+	t.Parallel()
+	k, dir := testDir(t)
+	kt, err := k.Keytab(testUser)
+	if err != nil {
+		t.Fatalf("error getting keytab: %v", err)
+	}
+	b, err := kt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling keytab: %v", err)
+	}
+	ktPath := filepath.Join(dir, "krb5.keytab")
+	err = ioutil.WriteFile(ktPath, b, 0600)
+	if err != nil {
+		t.Fatalf("error writing keytab: %v", err)
+	}
+	conf := filepath.Join(dir, "krb5.conf")
+	ccache := "FILE:" + filepath.Join(dir, "ccache")
+
+	code, stderr := kinit(t, "", "-krb5conf", conf, "-c", ccache, "-k", "-t", "FILE:"+ktPath, testUser+"@"+testRealm)
+	if !assert.Equal(t, 0, code, "exit status not as expected: %s", stderr) {
+		t.FailNow()
+	}
+	assert.Empty(t, stderr, "password prompted for with a keytab")
+	tgt := loadTGT(t, ccache)
+	assert.Equal(t, testUser, tgt.Client.PrincipalName.PrincipalNameString(), "client principal not as expected")
+
+	code, _ = kinit(t, "", "-krb5conf", conf, "-c", ccache, "-k", "-t", filepath.Join(dir, "missing.keytab"), testUser)
+	assert.Equal(t, 1, code, "exit status for a missing keytab not as expected")
+}
+
+func TestLogin_Anonymous(t *testing.T) {
+	t.Parallel()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	san, err := rfc4556.PrincipalNameExtension(rfc4556.KRB5PrincipalName{
+		Realm:         testRealm,
+		PrincipalName: types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+testRealm),
+	})
+	if err != nil {
+		t.Fatalf("error creating id-pkinit-san extension: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:       big.NewInt(1),
+		Subject:            pkix.Name{CommonName: "kdc"},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(time.Hour),
+		KeyUsage:           x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		UnknownExtKeyUsage: []stdasn1.ObjectIdentifier{stdasn1.ObjectIdentifier(rfc4556.OIDPKINITKPKdc)},
+		ExtraExtensions:    []pkix.Extension{san},
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(b)
+	_, dir := testDir(t, kdc.PKINIT([]*x509.Certificate{cert}, key, nil), kdc.Anonymous(true))
+	anchors := filepath.Join(dir, "kdc.pem")
+	err = ioutil.WriteFile(anchors, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b}), 0600)
+	if err != nil {
+		t.Fatalf("error writing anchors: %v", err)
+	}
+	conf := filepath.Join(dir, "krb5.conf")
+	ccache := "FILE:" + filepath.Join(dir, "ccache")
+
+	code, stderr := kinit(t, "", "-krb5conf", conf, "-c", ccache, "-n")
+	assert.Equal(t, 1, code, "exit status without PKINIT anchors not as expected: %s", stderr)
+	assert.Contains(t, stderr, "pkinit_anchors", "error without PKINIT anchors not as expected")
+
+	code, _ = kinit(t, "", "-krb5conf", conf, "-c", ccache, "-n", "-X", "X509_user_identity=FILE:"+anchors)
+	assert.Equal(t, 1, code, "exit status for an unsupported attribute not as expected")
+
+	code, stderr = kinit(t, "", "-krb5conf", conf, "-c", ccache, "-n", "-X", "X509_anchors=FILE:"+anchors)
+	if !assert.Equal(t, 0, code, "exit status not as expected: %s", stderr) {
+		t.FailNow()
+	}
+	tgt := loadTGT(t, ccache)
+	assert.True(t, tgt.Client.PrincipalName.IsAnonymous(), "client principal should be anonymous")
+}
@@ -0,0 +1,249 @@
+// Command klist lists the tickets in a Kerberos credential cache, or the keys in a keytab, as the MIT Kerberos klist
+// command does, so that they can be inspected in environments without the MIT Kerberos tools.
+//
+// Usage:
+//
+//	klist [-e] [-f] [-s] [-c] [ccache]
+//	klist -k [-e] [-t] [-K] [keytab]
+//
+// The default credential cache is that of the KRB5CCNAME environment variable or the krb5.conf, and the default keytab
+// that of KRB5_KTNAME or the krb5.conf. The krb5.conf file is that of the KRB5_CONFIG environment variable, or
+// /etc/krb5.conf.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/cmd/internal/cli"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// timeFormat is the format times are listed in, the month/day/year order of the MIT Kerberos tools.
+const timeFormat = "01/02/06 15:04:05"
+
+// ccacheConfPrincipal is the name of the principal of the configuration entries MIT Kerberos stores in credential
+// caches, which are not tickets.
+const ccacheConfPrincipal = "krb5_ccache_conf_data"
+
+// ticketFlags are the ticket flags and the characters they are listed as, in the order of MIT Kerberos klist.
+var ticketFlags = []struct {
+	flag int
+	c    byte
+}{
+	{flags.Forwardable, 'F'},
+	{flags.Forwarded, 'f'},
+	{flags.Proxiable, 'P'},
+	{flags.Proxy, 'p'},
+	{flags.MayPostDate, 'D'},
+	{flags.PostDated, 'd'},
+	{flags.Invalid, 'i'},
+	{flags.Renewable, 'R'},
+	{flags.Initial, 'I'},
+	{flags.HWAuthent, 'H'},
+	{flags.PreAuthent, 'A'},
+	{flags.TransitedPolicyChecked, 'T'},
+	{flags.OKAsDelegate, 'O'},
+	{flags.Anonymous, 'a'},
+}
+
+// options are the listing options of the command.
+type options struct {
+	etypes     bool
+	flags      bool
+	timestamps bool
+	keys       bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command with the arguments and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("klist", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: klist [flags] [ccache | keytab]")
+		fs.PrintDefaults()
+	}
+	fs.Bool("c", true, "list the tickets in a credential cache")
+	useKeytab := fs.Bool("k", false, "list the keys in a keytab")
+	var opts options
+	fs.BoolVar(&opts.etypes, "e", false, "display the encryption types of session keys and tickets, or of keys")
+	fs.BoolVar(&opts.flags, "f", false, "display the ticket flags")
+	fs.BoolVar(&opts.timestamps, "t", false, "display the timestamps of keys in a keytab")
+	fs.BoolVar(&opts.keys, "K", false, "display the keys in a keytab")
+	silent := fs.Bool("s", false, "list nothing, only exit with status 0 if the credential cache has a valid TGT")
+	cfgPath := fs.String("krb5conf", cli.KRB5ConfPath(), "krb5.conf file")
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := cli.LoadConfig(*cfgPath)
+	if err == nil {
+		switch {
+		case *useKeytab:
+			err = listKeytab(stdout, cli.KeytabPath(cfg, fs.Arg(0)), opts)
+		case *silent:
+			err = checkCCache(cfg, fs.Arg(0))
+			if err != nil {
+				return 1
+			}
+		default:
+			err = listCCache(stdout, cfg, fs.Arg(0), opts)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "klist: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// loadCCache loads the named credential cache, or the default credential cache if the name is empty.
+func loadCCache(cfg *config.Config, name string) (*credentials.CCache, string, error) {
+	name, err := cli.CCacheName(cfg, name)
+	if err != nil {
+		return nil, name, err
+	}
+	c, err := credentials.LoadNamedCCache(name)
+	if err != nil {
+		return nil, name, fmt.Errorf("no credentials cache found (name: %s): %v", name, err)
+	}
+	return c, name, nil
+}
+
+// listCCache writes the tickets in the credential cache.
+func listCCache(w io.Writer, cfg *config.Config, name string, opts options) error {
+	c, name, err := loadCCache(cfg, name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Ticket cache: %s\nDefault principal: %s\n\n", name, principalString(c.GetClientPrincipalName(), c.GetClientRealm()))
+	fmt.Fprintln(w, "Valid starting     Expires            Service principal")
+	now := time.Now()
+	for _, cred := range c.GetEntries() {
+		if isConfEntry(cred) {
+			continue
+		}
+		start := cred.StartTime
+		if start.IsZero() {
+			start = cred.AuthTime
+		}
+		fmt.Fprintf(w, "%s  %s  %s", start.Local().Format(timeFormat), cred.EndTime.Local().Format(timeFormat),
+			principalString(cred.Server.PrincipalName, cred.Server.Realm))
+		if now.After(cred.EndTime) {
+			fmt.Fprint(w, " (expired)")
+		}
+		fmt.Fprintln(w)
+		if !cred.RenewTill.IsZero() && (types.IsFlagSet(&cred.TicketFlags, flags.Renewable) || cred.RenewTill.After(cred.EndTime)) {
+			fmt.Fprintf(w, "\trenew until %s\n", cred.RenewTill.Local().Format(timeFormat))
+		}
+		if opts.flags {
+			fmt.Fprintf(w, "\tFlags: %s\n", flagString(cred.TicketFlags))
+		}
+		if opts.etypes {
+			tkt := "unknown"
+			var t messages.Ticket
+			if err := t.Unmarshal(cred.Ticket); err == nil {
+				tkt = cli.EncTypeName(t.EncPart.EType)
+			}
+			fmt.Fprintf(w, "\tEtype (skey, tkt): %s, %s\n", cli.EncTypeName(cred.Key.KeyType), tkt)
+		}
+	}
+	return nil
+}
+
+// checkCCache returns an error if the credential cache does not have a TGT for the client's realm that is valid.
+func checkCCache(cfg *config.Config, name string) error {
+	c, _, err := loadCCache(cfg, name)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, cred := range c.GetEntries() {
+		sn := cred.Server.PrincipalName.NameString
+		if len(sn) == 2 && sn[0] == "krbtgt" && sn[1] == c.GetClientRealm() && now.Before(cred.EndTime) &&
+			!types.IsFlagSet(&cred.TicketFlags, flags.Invalid) {
+			return nil
+		}
+	}
+	return errors.New("no valid TGT in the credential cache")
+}
+
+// listKeytab writes the keys in the keytab file at the path.
+func listKeytab(w io.Writer, path string, opts options) error {
+	kt, err := keytab.Load(path)
+	if err != nil {
+		return fmt.Errorf("error loading keytab %s: %v", path, err)
+	}
+	fmt.Fprintf(w, "Keytab name: FILE:%s\n", path)
+	var hdr, line strings.Builder
+	hdr.WriteString("KVNO ")
+	line.WriteString("---- ")
+	if opts.timestamps {
+		hdr.WriteString("Timestamp         ")
+		line.WriteString("----------------- ")
+	}
+	hdr.WriteString("Principal")
+	line.WriteString("--------------------------------------------------------")
+	fmt.Fprintln(w, hdr.String())
+	fmt.Fprintln(w, line.String())
+	for _, e := range kt.Entries {
+		fmt.Fprintf(w, "%4d ", e.KVNO)
+		if opts.timestamps {
+			fmt.Fprintf(w, "%s ", e.Timestamp.Local().Format(timeFormat))
+		}
+		fmt.Fprint(w, e.Principal.String())
+		if opts.etypes {
+			fmt.Fprintf(w, " (%s)", cli.EncTypeName(e.Key.KeyType))
+		}
+		if opts.keys {
+			fmt.Fprintf(w, " (0x%x)", e.Key.KeyValue)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// isConfEntry indicates if the credential cache entry is a configuration entry rather than a ticket.
+func isConfEntry(cred *credentials.Credential) bool {
+	sn := cred.Server.PrincipalName.NameString
+	return len(sn) > 0 && sn[0] == ccacheConfPrincipal
+}
+
+// principalString returns the principal name with its realm, such as HTTP/host.example.com@EXAMPLE.COM.
+func principalString(pn types.PrincipalName, realm string) string {
+	return pn.PrincipalNameString() + "@" + realm
+}
+
+// flagString returns the characters of the ticket flags that are set.
+func flagString(f asn1.BitString) string {
+	var b []byte
+	for _, tf := range ticketFlags {
+		if types.IsFlagSet(&f, tf.flag) {
+			b = append(b, tf.c)
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/test/kdc"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRealm    = "TEST.GOKRB5"
+	testUser     = "testuser1"
+	testPassword = "passwordvalue"
+)
+
+// klist runs the command with the arguments, returning its exit status and output.
+func klist(t *testing.T, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// testDir returns a temporary directory with a krb5.conf file, a credential cache with a TGT for the test user and a
+// keytab with the test user's keys.
+func testDir(t *testing.T) string {
+	k, err := kdc.New(testRealm)
+	if err != nil {
+		t.Fatalf("error creating KDC: %v", err)
+	}
+	err = k.AddPrincipal(testUser, testPassword)
+	if err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	err = k.Start()
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	t.Cleanup(func() { k.Close() })
+	cfg, err := k.Config()
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+	cfg.LibDefaults.Forwardable = true
+	dir, err := ioutil.TempDir("", "gokrb5-klist")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	err = ioutil.WriteFile(filepath.Join(dir, "krb5.conf"), []byte(k.KRB5Conf()), 0600)
+	if err != nil {
+		t.Fatalf("error writing krb5.conf: %v", err)
+	}
+
+	cl := client.NewWithPassword(testUser, testRealm, testPassword, cfg)
+	defer cl.Destroy()
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	c, err := cl.CCache()
+	if err != nil {
+		t.Fatalf("error creating credential cache: %v", err)
+	}
+	err = c.SaveNamed("FILE:" + filepath.Join(dir, "ccache"))
+	if err != nil {
+		t.Fatalf("error saving credential cache: %v", err)
+	}
+
+	kt, err := k.Keytab(testUser)
+	if err != nil {
+		t.Fatalf("error getting keytab: %v", err)
+	}
+	b, err := kt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling keytab: %v", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "krb5.keytab"), b, 0600)
+	if err != nil {
+		t.Fatalf("error writing keytab: %v", err)
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	code, _, _ := klist(t, "-h")
+	assert.Equal(t, 0, code, "exit status for -h not as expected")
+	code, _, _ = klist(t, "a", "b")
+	assert.Equal(t, 2, code, "exit status for two names not as expected")
+}
+
+func TestListCCache(t *testing.T) {
+	t.Parallel()
+	dir := testDir(t)
+	conf := filepath.Join(dir, "krb5.conf")
+	ccache := "FILE:" + filepath.Join(dir, "ccache")
+
+	code, stdout, stderr := klist(t, "-krb5conf", conf, "-e", "-f", ccache)
+	if !assert.Equal(t, 0, code, "exit status not as expected: %s", stderr) {
+		t.FailNow()
+	}
+	assert.Contains(t, stdout, "Ticket cache: "+ccache+"\n", "ticket cache not listed")
+	assert.Contains(t, stdout, "Default principal: "+testUser+"@"+testRealm+"\n", "default principal not listed")
+	assert.Contains(t, stdout, "  krbtgt/"+testRealm+"@"+testRealm+"\n", "TGT not listed")
+	assert.Contains(t, stdout, "\trenew until ", "renewable lifetime not listed")
+	assert.Contains(t, stdout, "\tFlags: F", "forwardable flag not listed")
+	assert.Contains(t, stdout, "\tEtype (skey, tkt): aes256-cts-hmac-sha1-96, aes256-cts-hmac-sha1-96\n", "encryption types not listed")
+
+	code, _, _ = klist(t, "-krb5conf", conf, "-s", ccache)
+	assert.Equal(t, 0, code, "exit status with a valid TGT not as expected")
+	code, stdout, stderr = klist(t, "-krb5conf", conf, "-s", "FILE:"+filepath.Join(dir, "missing"))
+	assert.Equal(t, 1, code, "exit status without a credential cache not as expected")
+	assert.Empty(t, stdout+stderr, "output with -s not as expected")
+
+	code, _, stderr = klist(t, "-krb5conf", conf, "FILE:"+filepath.Join(dir, "missing"))
+	assert.Equal(t, 1, code, "exit status without a credential cache not as expected")
+	assert.Contains(t, stderr, "no credentials cache found", "error without a credential cache not as expected")
+}
+
+func TestListKeytab(t *testing.T) {
+	t.Parallel()
+	dir := testDir(t)
+	conf := filepath.Join(dir, "krb5.conf")
+	ktPath := filepath.Join(dir, "krb5.keytab")
+
+	code, stdout, stderr := klist(t, "-krb5conf", conf, "-k", "-e", "-t", "FILE:"+ktPath)
+	if !assert.Equal(t, 0, code, "exit status not as expected: %s", stderr) {
+		t.FailNow()
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if !assert.True(t, len(lines) > 3, "keys not listed: %s", stdout) {
+		t.FailNow()
+	}
+	assert.Equal(t, "Keytab name: FILE:"+ktPath, lines[0], "keytab name not as expected")
+	assert.True(t, strings.HasPrefix(lines[1], "KVNO Timestamp"), "header not as expected: %s", lines[1])
+	kt, err := keytab.Load(ktPath)
+	if err != nil {
+		t.Fatalf("error loading keytab: %v", err)
+	}
+	assert.Contains(t, lines[3], " "+kt.Entries[0].Timestamp.Local().Format("01/02/06 15:04:05")+" ",
+		"timestamp not listed month first")
+	for _, l := range lines[3:] {
+		assert.Contains(t, l, testUser+"@"+testRealm+" (", "key not as expected")
+		assert.NotContains(t, l, "0x", "key value listed without -K")
+	}
+	assert.Contains(t, stdout, "(aes256-cts-hmac-sha1-96)", "encryption type not listed")
+
+	code, stdout, _ = klist(t, "-krb5conf", conf, "-k", "-K", ktPath)
+	assert.Equal(t, 0, code, "exit status with -K not as expected")
+	assert.Contains(t, stdout, " (0x", "key values not listed")
+
+	code, _, _ = klist(t, "-krb5conf", conf, "-k", filepath.Join(dir, "missing.keytab"))
+	assert.Equal(t, 1, code, "exit status for a missing keytab not as expected")
+}
@@ -0,0 +1,413 @@
+// Command ktutil manages keytab files without requiring the MIT Kerberos tools to be installed.
+//
+// Usage:
+//
+//	ktutil list [-keys] keytab
+//	ktutil add -p principal [-k kvno] [-e enctypes] [-random | -key hex | -salt salt | -fetch-salt [-c krb5.conf]] keytab
+//	ktutil remove -p principal [-k kvno] [-e enctype] keytab
+//	ktutil prune -older-than duration keytab
+//	ktutil merge keytab source-keytab...
+//	ktutil convert -v version [-o output] keytab
+//
+// The password of a key added from a password is read from standard input. Its salt is derived from the principal
+// name, unless a salt is provided or it is fetched from the principal's KDC with -fetch-salt, which is needed for
+// principals whose salt is not the default such as those of Active Directory computer accounts.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/cmd/internal/cli"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+const usage = `usage: ktutil <command> [flags] keytab
+
+Commands:
+  list     list the entries of a keytab
+  add      add keys for a principal to a keytab, creating it if it does not exist
+  remove   remove the keys of a principal from a keytab
+  prune    remove the keys older than a duration, except the newest keys of each principal
+  merge    add the keys of other keytabs to a keytab
+  convert  convert a keytab to another keytab file format version
+
+Run "ktutil <command> -h" for the flags of a command.
+`
+
+// defaultEncTypes are the encryption types of the keys added for a principal if none are specified.
+const defaultEncTypes = "aes256-cts-hmac-sha1-96,aes128-cts-hmac-sha1-96"
+
+// timeFormat is the format entry timestamps are listed in, the month/day/year order of the MIT Kerberos tools.
+const timeFormat = "01/02/06 15:04:05"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command in the arguments and returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) < 1 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	commands := map[string]func([]string, io.Reader, io.Writer, io.Writer) error{
+		"list":    list,
+		"add":     add,
+		"remove":  remove,
+		"prune":   prune,
+		"merge":   merge,
+		"convert": convert,
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "ktutil: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+	err := cmd(args[1:], stdin, stdout, stderr)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "ktutil %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// newFlagSet returns a flag set for the command that writes its usage to the writer provided.
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: ktutil %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses the command's arguments, which must leave the number of positional arguments provided, or at least
+// that number if min is true.
+func parseArgs(fs *flag.FlagSet, args []string, n int, min bool) error {
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() < n || (!min && fs.NArg() > n) {
+		fs.Usage()
+		return errors.New("wrong number of arguments")
+	}
+	return nil
+}
+
+// list writes the entries of the keytab.
+func list(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("list", "keytab", stderr)
+	keys := fs.Bool("keys", false, "display the keys")
+	if err := parseArgs(fs, args, 1, false); err != nil {
+		return err
+	}
+	kt, err := keytab.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Keytab name: FILE:%s\nKeytab version: %d\n", fs.Arg(0), kt.Version())
+	fmt.Fprintln(stdout, "KVNO Timestamp         Principal")
+	fmt.Fprintln(stdout, "---- ----------------- --------------------------------------------------------")
+	for _, e := range kt.Entries {
+		fmt.Fprintf(stdout, "%4d %s %s (%s)", e.KVNO, e.Timestamp.Format(timeFormat), e.Principal.String(),
+			cli.EncTypeName(e.Key.KeyType))
+		if *keys {
+			fmt.Fprintf(stdout, " (0x%x)", e.Key.KeyValue)
+		}
+		fmt.Fprintln(stdout)
+	}
+	return nil
+}
+
+// add adds keys for a principal to the keytab, from a password, a random key or a key provided.
+func add(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("add", "keytab", stderr)
+	p := fs.String("p", "", "principal to add keys for, such as HTTP/host.example.com@EXAMPLE.COM (required)")
+	kvno := fs.Uint("k", 0, "key version number (default one more than the newest of the principal in the keytab)")
+	etypes := fs.String("e", defaultEncTypes, "comma separated encryption types of the keys to add")
+	random := fs.Bool("random", false, "add random keys rather than keys derived from a password")
+	key := fs.String("key", "", "add the hex encoded key provided, for a single encryption type")
+	salt := fs.String("salt", "", "salt to derive keys from the password with")
+	fetch := fs.Bool("fetch-salt", false, "fetch the salt to derive keys from the password with from the KDC")
+	cfgPath := fs.String("c", cli.KRB5ConfPath(), "krb5.conf file used to find the realm and KDCs of the principal")
+	if err := parseArgs(fs, args, 1, false); err != nil {
+		return err
+	}
+	if *p == "" {
+		fs.Usage()
+		return errors.New("a principal must be provided")
+	}
+	if *random && *key != "" || (*random || *key != "") && (*salt != "" || *fetch) || *salt != "" && *fetch {
+		return errors.New("only one of -random, -key, -salt and -fetch-salt can be used")
+	}
+	ets, err := parseEncTypes(*etypes)
+	if err != nil {
+		return err
+	}
+	if *key != "" && len(ets) != 1 {
+		return errors.New("a single encryption type must be specified with -e for a key")
+	}
+
+	pn, realm := types.ParseSPNString(*p)
+	var cfg *config.Config
+	if realm == "" || *fetch {
+		cfg, err = cli.LoadConfig(*cfgPath)
+		if err != nil {
+			return err
+		}
+		if realm == "" {
+			realm = cfg.LibDefaults.DefaultRealm
+		}
+	}
+	if realm == "" {
+		return errors.New("the principal has no realm and there is no default realm")
+	}
+	name := pn.PrincipalNameString()
+
+	path := fs.Arg(0)
+	kt, err := loadOrNew(path)
+	if err != nil {
+		return err
+	}
+	if *kvno == 0 {
+		*kvno = uint(newestKVNO(kt, name+"@"+realm)) + 1
+	}
+	ts := time.Now()
+
+	var password string
+	if !*random && *key == "" {
+		password, err = cli.ReadPassword(stdin, stderr, fmt.Sprintf("Password for %s@%s: ", name, realm))
+		if err != nil {
+			return err
+		}
+	}
+	for _, et := range ets {
+		switch {
+		case *random:
+			_, err = kt.AddRandomKeyEntry(name, realm, ts, uint32(*kvno), et)
+		case *key != "":
+			var b []byte
+			b, err = hex.DecodeString(strings.TrimPrefix(*key, "0x"))
+			if err != nil {
+				return fmt.Errorf("key is not valid hex: %v", err)
+			}
+			err = kt.AddKeyEntry(name, realm, types.EncryptionKey{KeyType: et, KeyValue: b}, ts, uint32(*kvno))
+		default:
+			var pas types.PADataSequence
+			if *salt != "" {
+				pas = types.PADataSequence{{PADataType: patype.PA_PW_SALT, PADataValue: []byte(*salt)}}
+			} else if *fetch {
+				pas, err = fetchPAData(cfg, pn, realm, et)
+				if err != nil {
+					return fmt.Errorf("error fetching salt from the KDC: %v", err)
+				}
+			}
+			var k types.EncryptionKey
+			k, _, err = crypto.GetKeyFromPassword(password, pn, realm, et, pas)
+			if err == nil {
+				err = kt.AddKeyEntry(name, realm, k, ts, uint32(*kvno))
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error adding %s key: %v", cli.EncTypeName(et), err)
+		}
+	}
+	return writeKeytab(kt, path)
+}
+
+// remove removes the keys of a principal from the keytab.
+func remove(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("remove", "keytab", stderr)
+	p := fs.String("p", "", "principal to remove keys of (required)")
+	kvno := fs.Uint("k", 0, "key version number of the keys to remove (default all)")
+	etype := fs.String("e", "", "encryption type of the keys to remove (default all)")
+	if err := parseArgs(fs, args, 1, false); err != nil {
+		return err
+	}
+	if *p == "" {
+		fs.Usage()
+		return errors.New("a principal must be provided")
+	}
+	var et int32
+	if *etype != "" {
+		ets, err := parseEncTypes(*etype)
+		if err != nil {
+			return err
+		}
+		if len(ets) != 1 {
+			return errors.New("only one encryption type can be specified")
+		}
+		et = ets[0]
+	}
+	kt, err := keytab.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	pn, realm := types.ParseSPNString(*p)
+	n := kt.RemoveEntries(pn.PrincipalNameString(), realm, uint32(*kvno), et)
+	if n < 1 {
+		return fmt.Errorf("no matching keys of %s found", *p)
+	}
+	fmt.Fprintf(stdout, "%d keys removed\n", n)
+	return writeKeytab(kt, fs.Arg(0))
+}
+
+// prune removes the keys older than a duration from the keytab, except the newest keys of each principal.
+func prune(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("prune", "keytab", stderr)
+	d := fs.Duration("older-than", 0, "age of the keys to remove, such as 720h (required)")
+	if err := parseArgs(fs, args, 1, false); err != nil {
+		return err
+	}
+	if *d <= 0 {
+		fs.Usage()
+		return errors.New("a duration must be provided")
+	}
+	kt, err := keytab.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	n := kt.PruneOlderThan(time.Now().Add(-*d))
+	fmt.Fprintf(stdout, "%d keys removed\n", n)
+	if n < 1 {
+		return nil
+	}
+	return writeKeytab(kt, fs.Arg(0))
+}
+
+// merge adds the keys of the source keytabs to the keytab, creating it if it does not exist.
+func merge(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("merge", "keytab source-keytab...", stderr)
+	if err := parseArgs(fs, args, 2, true); err != nil {
+		return err
+	}
+	kt, err := loadOrNew(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var n int
+	for _, src := range fs.Args()[1:] {
+		other, err := keytab.Load(src)
+		if err != nil {
+			return err
+		}
+		n += kt.Merge(other)
+	}
+	fmt.Fprintf(stdout, "%d keys added\n", n)
+	return writeKeytab(kt, fs.Arg(0))
+}
+
+// convert converts the keytab to another version of the keytab file format.
+func convert(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("convert", "keytab", stderr)
+	v := fs.Uint("v", 2, "keytab file format version to convert to, 1 or 2")
+	out := fs.String("o", "", "file to write the converted keytab to (default the keytab)")
+	if err := parseArgs(fs, args, 1, false); err != nil {
+		return err
+	}
+	kt, err := keytab.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *v > 2 {
+		return fmt.Errorf("keytab version %d is not supported, it must be 1 or 2", *v)
+	}
+	err = kt.SetVersion(uint8(*v))
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = fs.Arg(0)
+	}
+	return writeKeytab(kt, *out)
+}
+
+// parseEncTypes parses a comma separated list of encryption type names or numbers.
+func parseEncTypes(s string) ([]int32, error) {
+	var ets []int32
+	for _, n := range strings.Split(s, ",") {
+		n = strings.TrimSpace(n)
+		id := etypeID.EtypeSupported(n)
+		if id == 0 {
+			if i, err := strconv.ParseInt(n, 10, 32); err == nil {
+				if _, err := crypto.GetEtype(int32(i)); err == nil {
+					id = int32(i)
+				}
+			}
+		}
+		if id == 0 {
+			return nil, fmt.Errorf("encryption type %q is not supported", n)
+		}
+		ets = append(ets, id)
+	}
+	return ets, nil
+}
+
+// newestKVNO returns the newest key version number of the principal in the keytab, or zero if it has no keys.
+func newestKVNO(kt *keytab.Keytab, principal string) uint32 {
+	var kvno uint32
+	for _, e := range kt.Entries {
+		if e.Principal.String() == principal && e.KVNO > kvno {
+			kvno = e.KVNO
+		}
+	}
+	return kvno
+}
+
+// loadOrNew loads the keytab file at the path, or returns a new keytab if the file does not exist.
+func loadOrNew(path string) (*keytab.Keytab, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return keytab.New(), nil
+	}
+	return keytab.Load(path)
+}
+
+// writeKeytab writes the keytab to the file at the path. The file is replaced by renaming a new file over it, so that
+// services reading it do not see it partially written.
+func writeKeytab(kt *keytab.Keytab, path string) error {
+	b, err := kt.Marshal()
+	if err != nil {
+		return fmt.Errorf("error marshaling keytab: %v", err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("error creating keytab file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing keytab file: %v", err)
+	}
+	if fi, err := os.Stat(path); err == nil {
+		// Keep the permissions of the keytab being replaced.
+		os.Chmod(f.Name(), fi.Mode().Perm())
+	}
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return fmt.Errorf("error replacing keytab file: %v", err)
+	}
+	return nil
+}
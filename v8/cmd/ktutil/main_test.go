@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/test/kdc"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKRB5Conf = `[libdefaults]
+  default_realm = TEST.GOKRB5
+
+[realms]
+  TEST.GOKRB5 = {
+    kdc = kdc.test.gokrb5:88
+  }
+`
+
+// ktutil runs the command with the arguments and input provided, returning its exit status and output.
+func ktutil(t *testing.T, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// testDir returns a temporary directory with a krb5.conf file, and a function to remove it.
+func testDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "gokrb5-ktutil")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "krb5.conf"), []byte(testKRB5Conf), 0600)
+	if err != nil {
+		t.Fatalf("error writing krb5.conf: %v", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func loadKeytab(t *testing.T, path string) *keytab.Keytab {
+	kt, err := keytab.Load(path)
+	if err != nil {
+		t.Fatalf("error loading keytab: %v", err)
+	}
+	return kt
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	code, _, stderr := ktutil(t, "")
+	assert.Equal(t, 2, code, "exit status not as expected")
+	assert.Contains(t, stderr, "usage: ktutil", "usage not written")
+	code, _, stderr = ktutil(t, "", "unknown")
+	assert.Equal(t, 2, code, "exit status not as expected")
+	assert.Contains(t, stderr, "unknown command", "error not written")
+	code, _, stderr = ktutil(t, "", "list", "-h")
+	assert.Equal(t, 0, code, "exit status not as expected")
+	assert.Contains(t, stderr, "usage: ktutil list", "usage not written")
+	code, _, stderr = ktutil(t, "", "list")
+	assert.Equal(t, 1, code, "exit status not as expected")
+	assert.Contains(t, stderr, "wrong number of arguments", "error not written")
+}
+
+func TestAddListRemove(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "krb5.keytab")
+	conf := filepath.Join(dir, "krb5.conf")
+
+	code, _, stderr := ktutil(t, "passwordvalue\n", "add", "-c", conf, "-p", "HTTP/host.test.gokrb5", path)
+	if code != 0 {
+		t.Fatalf("add failed: %s", stderr)
+	}
+	assert.Contains(t, stderr, "Password for HTTP/host.test.gokrb5@TEST.GOKRB5", "password prompt not as expected")
+	kt := loadKeytab(t, path)
+	assert.Equal(t, 2, len(kt.Entries), "number of entries not as expected")
+	pn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	key, _, err := crypto.GetKeyFromPassword("passwordvalue", pn, "TEST.GOKRB5", etypeID.AES256_CTS_HMAC_SHA1_96, types.PADataSequence{})
+	if err != nil {
+		t.Fatalf("error deriving key: %v", err)
+	}
+	k, kvno, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting key: %v", err)
+	}
+	assert.Equal(t, key, k, "key not derived from the password")
+	assert.Equal(t, 1, kvno, "KVNO not as expected")
+
+	// Keys are added at the next KVNO by default.
+	code, _, stderr = ktutil(t, "", "add", "-random", "-e", "aes128-sha2", "-p", "HTTP/host.test.gokrb5@TEST.GOKRB5", path)
+	if code != 0 {
+		t.Fatalf("add failed: %s", stderr)
+	}
+	hexKey := strings.Repeat("01", 16)
+	code, _, stderr = ktutil(t, "", "add", "-key", hexKey, "-e", "17", "-k", "7", "-p", "user@TEST.GOKRB5", path)
+	if code != 0 {
+		t.Fatalf("add failed: %s", stderr)
+	}
+	code, _, stderr = ktutil(t, "", "add", "-key", hexKey, "-p", "user@TEST.GOKRB5", path)
+	assert.Equal(t, 1, code, "key added for several encryption types")
+	assert.Contains(t, stderr, "single encryption type", "error not as expected")
+
+	code, stdout, stderr := ktutil(t, "", "list", path)
+	if code != 0 {
+		t.Fatalf("list failed: %s", stderr)
+	}
+	assert.Contains(t, stdout, "Keytab version: 2", "version not listed")
+	assert.Contains(t, stdout, " "+loadKeytab(t, path).Entries[0].Timestamp.Format("01/02/06 15:04:05")+" ",
+		"timestamp not listed month first")
+	assert.Contains(t, stdout, "   1 ", "KVNO not listed")
+	assert.Contains(t, stdout, "HTTP/host.test.gokrb5@TEST.GOKRB5 (aes256-cts-hmac-sha1-96)", "entry not listed")
+	assert.Contains(t, stdout, "   2 ", "KVNO not listed")
+	assert.Contains(t, stdout, "HTTP/host.test.gokrb5@TEST.GOKRB5 (aes128-cts-hmac-sha256-128)", "entry not listed")
+	assert.Contains(t, stdout, "   7 ", "KVNO not listed")
+	assert.Contains(t, stdout, "user@TEST.GOKRB5 (aes128-cts-hmac-sha1-96)", "entry not listed")
+	assert.NotContains(t, stdout, hexKey, "key listed without -keys")
+	_, stdout, _ = ktutil(t, "", "list", "-keys", path)
+	assert.Contains(t, stdout, "(0x"+hexKey+")", "key not listed")
+
+	code, stdout, stderr = ktutil(t, "", "remove", "-p", "HTTP/host.test.gokrb5", "-k", "1", "-e", "aes256-cts", path)
+	if code != 0 {
+		t.Fatalf("remove failed: %s", stderr)
+	}
+	assert.Contains(t, stdout, "1 keys removed", "output not as expected")
+	assert.Equal(t, 3, len(loadKeytab(t, path).Entries), "number of entries not as expected")
+	code, _, stderr = ktutil(t, "", "remove", "-p", "HTTP/other.test.gokrb5", path)
+	assert.Equal(t, 1, code, "exit status not as expected")
+	assert.Contains(t, stderr, "no matching keys", "error not as expected")
+}
+
+func TestPruneMergeConvert(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := testDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "krb5.keytab")
+	other := filepath.Join(dir, "other.keytab")
+
+	kt := keytab.New()
+	now := time.Now()
+	for kvno := uint8(1); kvno <= 3; kvno++ {
+		ts := now.Add(-time.Duration(3-kvno) * 48 * time.Hour)
+		kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", ts, kvno, etypeID.AES256_CTS_HMAC_SHA1_96)
+	}
+	err := writeKeytab(kt, path)
+	if err != nil {
+		t.Fatalf("error writing keytab: %v", err)
+	}
+	code, stdout, stderr := ktutil(t, "", "prune", "-older-than", "72h", path)
+	if code != 0 {
+		t.Fatalf("prune failed: %s", stderr)
+	}
+	assert.Contains(t, stdout, "1 keys removed", "output not as expected")
+	assert.Equal(t, 2, len(loadKeytab(t, path).Entries), "number of entries not as expected")
+
+	ot := keytab.New()
+	ot.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", now, 3, etypeID.AES256_CTS_HMAC_SHA1_96)
+	ot.AddEntry("HTTP/other.test.gokrb5", "TEST.GOKRB5", "passwordvalue", now, 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	err = writeKeytab(ot, other)
+	if err != nil {
+		t.Fatalf("error writing keytab: %v", err)
+	}
+	code, stdout, stderr = ktutil(t, "", "merge", path, other)
+	if code != 0 {
+		t.Fatalf("merge failed: %s", stderr)
+	}
+	assert.Contains(t, stdout, "1 keys added", "output not as expected")
+	assert.Equal(t, 3, len(loadKeytab(t, path).Entries), "number of entries not as expected")
+
+	v1 := filepath.Join(dir, "v1.keytab")
+	code, _, stderr = ktutil(t, "", "convert", "-v", "1", "-o", v1, path)
+	if code != 0 {
+		t.Fatalf("convert failed: %s", stderr)
+	}
+	b, err := ioutil.ReadFile(v1)
+	if err != nil {
+		t.Fatalf("error reading keytab: %v", err)
+	}
+	assert.Equal(t, []byte{0x05, 0x01}, b[:2], "keytab not converted to version 1")
+	kt = loadKeytab(t, path)
+	assert.Equal(t, uint8(2), kt.Version(), "keytab converted in place")
+	code, _, _ = ktutil(t, "", "convert", "-v", "3", path)
+	assert.Equal(t, 1, code, "keytab converted to an unsupported version")
+
+	code, _, stderr = ktutil(t, "", "convert", v1)
+	if code != 0 {
+		t.Fatalf("convert failed: %s", stderr)
+	}
+	converted := loadKeytab(t, v1)
+	assert.Equal(t, kt.Entries, converted.Entries, "entries not as expected after converting back to version 2")
+}
+
+func TestAdd_FetchSalt(t *testing.T) {
+	dir, cleanup := testDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "krb5.keytab")
+	conf := filepath.Join(dir, "krb5.conf")
+	defer func(t client.Transport) { transport = t }(transport)
+
+	k, err := kdc.New("TEST.GOKRB5", kdc.RequirePreAuth(true))
+	if err != nil {
+		t.Fatalf("error creating KDC: %v", err)
+	}
+	err = k.AddPrincipal("HTTP/host.test.gokrb5", "passwordvalue")
+	if err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	transport = client.TransportFunc(func(ctx context.Context, network, address string, b []byte) ([]byte, error) {
+		return k.Handle(b), nil
+	})
+	code, _, stderr := ktutil(t, "passwordvalue\n", "add", "-fetch-salt", "-c", conf, "-p", "HTTP/host.test.gokrb5", path)
+	if code != 0 {
+		t.Fatalf("add failed: %s", stderr)
+	}
+	want, err := k.Keytab("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting keytab from KDC: %v", err)
+	}
+	pn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	kt := loadKeytab(t, path)
+	for _, et := range []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96} {
+		wk, _, err := want.GetEncryptionKey(pn, "TEST.GOKRB5", 0, et)
+		if err != nil {
+			t.Fatalf("error getting key from KDC keytab: %v", err)
+		}
+		key, _, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 0, et)
+		if err != nil {
+			t.Fatalf("error getting key: %v", err)
+		}
+		assert.Equal(t, wk, key, "key not as held by the KDC")
+	}
+
+	// A salt that is not the default, such as that of an Active Directory computer account, is used.
+	salt := "TEST.GOKRB5hosthost.test.gokrb5"
+	transport = client.TransportFunc(func(ctx context.Context, network, address string, b []byte) ([]byte, error) {
+		info, err := asn1.Marshal(types.ETypeInfo2{{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Salt: salt}})
+		if err != nil {
+			return nil, err
+		}
+		ed, err := asn1.Marshal(types.PADataSequence{{PADataType: patype.PA_ETYPE_INFO2, PADataValue: info}})
+		if err != nil {
+			return nil, err
+		}
+		e := messages.NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5",
+			errorcode.KDC_ERR_PREAUTH_REQUIRED, "pre-authentication required")
+		e.EData = ed
+		return e.Marshal()
+	})
+	code, _, stderr = ktutil(t, "passwordvalue\n", "add", "-fetch-salt", "-e", "aes256-cts-hmac-sha1-96", "-c", conf,
+		"-p", "host/host.test.gokrb5", path)
+	if code != 0 {
+		t.Fatalf("add failed: %s", stderr)
+	}
+	hn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "host/host.test.gokrb5")
+	wk, _, err := crypto.GetKeyFromPassword("passwordvalue", hn, "TEST.GOKRB5", etypeID.AES256_CTS_HMAC_SHA1_96,
+		types.PADataSequence{{PADataType: patype.PA_PW_SALT, PADataValue: []byte(salt)}})
+	if err != nil {
+		t.Fatalf("error deriving key: %v", err)
+	}
+	key, _, err := loadKeytab(t, path).GetEncryptionKey(hn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting key: %v", err)
+	}
+	assert.Equal(t, hex.EncodeToString(wk.KeyValue), hex.EncodeToString(key.KeyValue), "key not derived with the KDC's salt")
+
+	transport = client.TransportFunc(func(ctx context.Context, network, address string, b []byte) ([]byte, error) {
+		e := messages.NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5",
+			errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN, "principal unknown")
+		return e.Marshal()
+	})
+	code, _, stderr = ktutil(t, "passwordvalue\n", "add", "-fetch-salt", "-c", conf, "-p", "unknown", path)
+	assert.Equal(t, 1, code, "exit status not as expected")
+	assert.Contains(t, stderr, "KDC_ERR_C_PRINCIPAL_UNKNOWN", "error not as expected")
+}
+
+func TestAdd_FetchSaltKDCProxy(t *testing.T) {
+	dir, cleanup := testDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "krb5.keytab")
+	conf := filepath.Join(dir, "krb5.conf")
+	defer func(c *http.Client) { proxyClient = c }(proxyClient)
+
+	k, err := kdc.New("TEST.GOKRB5", kdc.RequirePreAuth(true))
+	if err != nil {
+		t.Fatalf("error creating KDC: %v", err)
+	}
+	err = k.AddPrincipal("HTTP/host.test.gokrb5", "passwordvalue")
+	if err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		var m messages.KDCProxyMessage
+		if err := m.Unmarshal(b); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		km, err := m.Message()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rm := messages.NewKDCProxyMessage(k.Handle(km), "")
+		mb, _ := rm.Marshal()
+		w.Header().Set("Content-Type", "application/kerberos")
+		w.Write(mb)
+	}))
+	defer s.Close()
+	proxyClient = s.Client()
+	err = ioutil.WriteFile(conf, []byte("[libdefaults]\n  default_realm = TEST.GOKRB5\n\n[realms]\n  TEST.GOKRB5 = {\n    kdc = "+s.URL+"/KdcProxy\n  }\n"), 0600)
+	if err != nil {
+		t.Fatalf("error writing krb5.conf: %v", err)
+	}
+	code, _, stderr := ktutil(t, "passwordvalue\n", "add", "-fetch-salt", "-e", "aes256-cts-hmac-sha1-96", "-c", conf,
+		"-p", "HTTP/host.test.gokrb5", path)
+	if code != 0 {
+		t.Fatalf("add failed: %s", stderr)
+	}
+	want, err := k.Keytab("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting keytab from KDC: %v", err)
+	}
+	pn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	wk, _, err := want.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting key from KDC keytab: %v", err)
+	}
+	key, _, err := loadKeytab(t, path).GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting key: %v", err)
+	}
+	assert.Equal(t, wk, key, "key not as held by the KDC")
+}
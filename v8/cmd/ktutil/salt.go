@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// fetchTimeout is the maximum time to fetch the salt of a principal from its KDCs.
+const fetchTimeout = 30 * time.Second
+
+// transport is used to exchange messages with KDCs. It is replaced in tests.
+var transport = client.NewTransport(nil)
+
+// proxyClient is the HTTP client used to exchange messages with KDC proxies, or nil for the default. It is replaced in
+// tests.
+var proxyClient *http.Client
+
+// fetchPAData returns the pre-authentication data, which holds the salt of the principal's key of the encryption type,
+// sent by the KDC in reply to an AS_REQ for the principal without pre-authentication. The reply is either a
+// KDC_ERR_PREAUTH_REQUIRED error, with the data in its e-data, or an AS_REP if the principal does not require
+// pre-authentication.
+func fetchPAData(cfg *config.Config, pn types.PrincipalName, realm string, etype int32) (types.PADataSequence, error) {
+	req, err := messages.NewASReqForTGT(realm, cfg, pn)
+	if err != nil {
+		return nil, fmt.Errorf("error creating AS_REQ: %v", err)
+	}
+	// Only request the encryption type of the key so that the KDC replies with its salt.
+	req.ReqBody.EType = []int32{etype}
+	b, err := req.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling AS_REQ: %v", err)
+	}
+	settings := []func(*client.Settings){client.KDCTransport(transport)}
+	if proxyClient != nil {
+		settings = append(settings, client.KDCProxyHTTPClient(proxyClient))
+	}
+	// The client is only used to send the AS_REQ to the realm's KDCs, or KDC proxies, so it has no password.
+	cl := client.NewWithPassword(pn.PrincipalNameString(), realm, "", cfg, settings...)
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	rb, err := cl.SendToKDCContext(ctx, b, realm)
+	if err != nil {
+		krberr, ok := err.(messages.KRBError)
+		if !ok || krberr.ErrorCode != errorcode.KDC_ERR_PREAUTH_REQUIRED {
+			return nil, err
+		}
+		var pas types.PADataSequence
+		err = pas.Unmarshal(krberr.EData)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshaling pre-authentication data of KRB_ERROR: %v", err)
+		}
+		return pas, nil
+	}
+	var asRep messages.ASRep
+	if err := asRep.Unmarshal(rb); err != nil {
+		return nil, fmt.Errorf("reply is not an AS_REP or KRB_ERROR: %v", err)
+	}
+	return asRep.PAData, nil
+}
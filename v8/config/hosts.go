@@ -6,10 +6,12 @@ import (
 	"net"
 	"strconv"
 	"strings"
-
-	"github.com/jcmturner/dnsutils/v2"
 )
 
+// lookupSRV resolves the SRV records of a service. The records are returned sorted by priority and randomised by
+// weight within a priority as specified by RFC 2782.
+var lookupSRV = net.LookupSRV
+
 // GetKDCs returns the count of KDCs available and a map of KDC host names keyed on preference order.
 func (c *Config) GetKDCs(realm string, tcp bool) (int, map[int]string, error) {
 	if realm == "" {
@@ -43,16 +45,47 @@ func (c *Config) GetKDCs(realm string, tcp bool) (int, map[int]string, error) {
 	if tcp {
 		proto = "tcp"
 	}
-	index, addrs, err := dnsutils.OrderedSRV("kerberos", proto, realm)
+	count, kdcs, err := orderedSRV("kerberos", proto, realm)
 	if err != nil {
 		return count, kdcs, err
 	}
-	if len(addrs) < 1 {
+	if count < 1 {
 		return count, kdcs, fmt.Errorf("no KDC SRV records found for realm %s", realm)
 	}
-	count = index
-	for k, v := range addrs {
-		kdcs[k] = strings.TrimRight(v.Target, ".") + ":" + strconv.Itoa(int(v.Port))
+	return count, kdcs, nil
+}
+
+// GetPrimaryKDCs returns the count of primary KDCs available and a map of primary KDC host names keyed on preference
+// order. The primary KDCs are those of the primary_kdc, or master_kdc, entries of the realm, or if there are none and
+// DNS lookup of KDCs is enabled those of the kerberos-master SRV records.
+// https://web.mit.edu/kerberos/krb5-latest/doc/admin/conf_files/krb5_conf.html#realms - see primary_kdc section
+func (c *Config) GetPrimaryKDCs(realm string, tcp bool) (int, map[int]string, error) {
+	if realm == "" {
+		realm = c.LibDefaults.DefaultRealm
+	}
+	var ks []string
+	for _, r := range c.Realms {
+		if r.Realm == realm {
+			ks = r.MasterKDC
+			break
+		}
+	}
+	if len(ks) > 0 {
+		return len(ks), randServOrder(ks), nil
+	}
+	if !c.LibDefaults.DNSLookupKDC {
+		return 0, make(map[int]string), fmt.Errorf("no primary KDCs defined in configuration for realm %s", realm)
+	}
+	proto := "udp"
+	if tcp {
+		proto = "tcp"
+	}
+	count, kdcs, err := orderedSRV("kerberos-master", proto, realm)
+	if err != nil {
+		return count, kdcs, err
+	}
+	if count < 1 {
+		return count, kdcs, fmt.Errorf("no primary KDC SRV records found for realm %s", realm)
 	}
 	return count, kdcs, nil
 }
@@ -69,23 +102,20 @@ func (c *Config) GetKpasswdServers(realm string, tcp bool) (int, map[int]string,
 		if tcp {
 			proto = "tcp"
 		}
-		c, addrs, err := dnsutils.OrderedSRV("kpasswd", proto, realm)
+		c, addrs, err := orderedSRV("kpasswd", proto, realm)
 		if err != nil {
 			return count, kdcs, err
 		}
 		if c < 1 {
-			c, addrs, err = dnsutils.OrderedSRV("kerberos-adm", proto, realm)
+			c, addrs, err = orderedSRV("kerberos-adm", proto, realm)
 			if err != nil {
 				return count, kdcs, err
 			}
 		}
-		if len(addrs) < 1 {
+		if c < 1 {
 			return count, kdcs, fmt.Errorf("no kpasswd or kadmin SRV records found for realm %s", realm)
 		}
-		count = c
-		for k, v := range addrs {
-			kdcs[k] = strings.TrimRight(v.Target, ".") + ":" + strconv.Itoa(int(v.Port))
-		}
+		count, kdcs = c, addrs
 	} else {
 		// Get the KDCs from the krb5.conf an order them randomly for preference.
 		var ks []string
@@ -115,7 +145,29 @@ func (c *Config) GetKpasswdServers(realm string, tcp bool) (int, map[int]string,
 	return count, kdcs, nil
 }
 
+// orderedSRV returns the count of targets of the service's SRV records and a map of the targets, as host:port
+// addresses, keyed on preference order. The targets are in the order the records are resolved in, which honours their
+// priority and weight as specified by RFC 2782. A target of "." indicates the service is not available and is omitted.
+func orderedSRV(service, proto, name string) (int, map[int]string, error) {
+	addrs := make(map[int]string)
+	_, srvs, err := lookupSRV(service, proto, name)
+	if err != nil {
+		return 0, addrs, err
+	}
+	for _, srv := range srvs {
+		target := strings.TrimRight(srv.Target, ".")
+		if target == "" {
+			continue
+		}
+		addrs[len(addrs)+1] = target + ":" + strconv.Itoa(int(srv.Port))
+	}
+	return len(addrs), addrs, nil
+}
+
+// randServOrder returns the servers keyed on a random preference order. The slice provided, which may be that of the
+// configuration shared by concurrent callers, is not modified.
 func randServOrder(ks []string) map[int]string {
+	ks = append([]string(nil), ks...)
 	kdcs := make(map[int]string)
 	count := len(ks)
 	i := 1
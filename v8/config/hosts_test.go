@@ -1,9 +1,12 @@
 package config
 
 import (
-	"github.com/jcmturner/gokrb5/v8/test"
+	"net"
+	"sync"
 	"testing"
 
+	"github.com/jcmturner/gokrb5/v8/test"
+
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
 	"github.com/stretchr/testify/assert"
 )
@@ -101,3 +104,95 @@ func TestResolveKDCNoDNS(t *testing.T) {
 		assert.True(t, found, "Record %s not found in results", s)
 	}
 }
+
+func TestGetPrimaryKDCs(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`
+[realms]
+ TEST.GOKRB5 = {
+  kdc = kdc1.test.gokrb5
+  primary_kdc = kdc.test.gokrb5
+ }
+ OLD.GOKRB5 = {
+  kdc = kdc1.old.gokrb5
+  master_kdc = kdc.old.gokrb5:8888
+ }
+ REPLICAS.GOKRB5 = {
+  kdc = kdc1.replicas.gokrb5
+ }
+`)
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	count, kdcs, err := c.GetPrimaryKDCs("TEST.GOKRB5", true)
+	if err != nil {
+		t.Fatalf("error getting primary KDCs: %v", err)
+	}
+	assert.Equal(t, 1, count, "count of primary KDCs not as expected")
+	assert.Equal(t, map[int]string{1: "kdc.test.gokrb5:88"}, kdcs, "primary_kdc should be used with the default port")
+	_, kdcs, err = c.GetPrimaryKDCs("OLD.GOKRB5", true)
+	if err != nil {
+		t.Fatalf("error getting primary KDCs: %v", err)
+	}
+	assert.Equal(t, map[int]string{1: "kdc.old.gokrb5:8888"}, kdcs, "master_kdc should be used as the primary KDC")
+	_, _, err = c.GetPrimaryKDCs("REPLICAS.GOKRB5", true)
+	assert.Error(t, err, "error expected when no primary KDC is configured")
+}
+
+func TestOrderedSRV(t *testing.T) {
+	// Not parallel as the DNS lookup is replaced.
+	defer func(l func(string, string, string) (string, []*net.SRV, error)) { lookupSRV = l }(lookupSRV)
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		if service != "kerberos-master" || proto != "udp" || name != "TEST.GOKRB5" {
+			return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		}
+		return "_kerberos-master._udp.TEST.GOKRB5.", []*net.SRV{
+			{Target: "kdc2.test.gokrb5.", Port: 88, Priority: 0, Weight: 10},
+			{Target: "kdc1.test.gokrb5.", Port: 88, Priority: 0, Weight: 5},
+			{Target: ".", Port: 0, Priority: 1, Weight: 0},
+			{Target: "kdc3.test.gokrb5.", Port: 750, Priority: 2, Weight: 0},
+		}, nil
+	}
+	c := New()
+	c.LibDefaults.DNSLookupKDC = true
+	count, kdcs, err := c.GetPrimaryKDCs("TEST.GOKRB5", false)
+	if err != nil {
+		t.Fatalf("error getting primary KDCs from DNS: %v", err)
+	}
+	assert.Equal(t, 3, count, "count of primary KDCs not as expected")
+	assert.Equal(t, map[int]string{
+		1: "kdc2.test.gokrb5:88",
+		2: "kdc1.test.gokrb5:88",
+		3: "kdc3.test.gokrb5:750",
+	}, kdcs, "primary KDCs should be in the order resolved")
+	_, _, err = c.GetPrimaryKDCs("TEST.GOKRB5", true)
+	assert.Error(t, err, "error expected when there are no SRV records")
+}
+
+func TestGetPrimaryKDCs_Concurrent(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`
+[realms]
+ TEST.GOKRB5 = {
+  primary_kdc = kdc1.test.gokrb5
+  primary_kdc = kdc2.test.gokrb5
+  primary_kdc = kdc3.test.gokrb5
+ }
+`)
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	want := append([]string(nil), c.Realms[0].MasterKDC...)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.GetPrimaryKDCs("TEST.GOKRB5", true)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, want, c.Realms[0].MasterKDC, "configured primary KDCs should not be reordered")
+}
@@ -46,12 +46,12 @@ func New() *Config {
 type LibDefaults struct {
 	AllowWeakCrypto bool //default false
 	// ap_req_checksum_type int //unlikely to support this
-	Canonicalize bool          //default false
-	CCacheType   int           //default is 4. unlikely to implement older
-	Clockskew    time.Duration //max allowed skew in seconds, default 300
-	//Default_ccache_name string // default /tmp/krb5cc_%{uid} //Not implementing as will hold in memory
-	DefaultClientKeytabName string //default /usr/local/var/krb5/user/%{euid}/client.keytab
-	DefaultKeytabName       string //default /etc/krb5.keytab
+	Canonicalize            bool          //default false
+	CCacheType              int           //default is 4. unlikely to implement older
+	Clockskew               time.Duration //max allowed skew in seconds, default 300
+	DefaultCCacheName       string        //default FILE:/tmp/krb5cc_%{uid}
+	DefaultClientKeytabName string        //default /usr/local/var/krb5/user/%{euid}/client.keytab
+	DefaultKeytabName       string        //default /etc/krb5.keytab
 	DefaultRealm            string
 	DefaultTGSEnctypes      []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
 	DefaultTktEnctypes      []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
@@ -71,6 +71,7 @@ type LibDefaults struct {
 	NoAddresses         bool     //default true
 	PermittedEnctypes   []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
 	PermittedEnctypeIDs []int32
+	PKINITAnchors       []string // roots trusted to issue KDC certificates for PKINIT, as FILE:path or DIR:path
 	//plugin_base_dir string //not supporting plugins
 	PreferredPreauthTypes []int         //default “17, 16, 15, 14”, which forces libkrb5 to attempt to use PKINIT if it is supported
 	Proxiable             bool          //default false
@@ -98,6 +99,7 @@ func newLibDefaults() LibDefaults {
 	l := LibDefaults{
 		CCacheType:              4,
 		Clockskew:               time.Duration(300) * time.Second,
+		DefaultCCacheName:       "FILE:/tmp/krb5cc_%{uid}",
 		DefaultClientKeytabName: fmt.Sprintf("/usr/local/var/krb5/user/%s/client.keytab", uid),
 		DefaultKeytabName:       "/etc/krb5.keytab",
 		DefaultTGSEnctypes:      []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
@@ -164,6 +166,8 @@ func (l *LibDefaults) parseLines(lines []string) error {
 				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
 			}
 			l.Clockskew = d
+		case "default_ccache_name":
+			l.DefaultCCacheName = strings.TrimSpace(p[1])
 		case "default_client_keytab_name":
 			l.DefaultClientKeytabName = strings.TrimSpace(p[1])
 		case "default_keytab_name":
@@ -243,6 +247,8 @@ func (l *LibDefaults) parseLines(lines []string) error {
 			l.NoAddresses = v
 		case "permitted_enctypes":
 			l.PermittedEnctypes = strings.Fields(p[1])
+		case "pkinit_anchors":
+			l.PKINITAnchors = append(l.PKINITAnchors, strings.TrimSpace(p[1]))
 		case "preferred_preauth_types":
 			p[1] = strings.TrimSpace(p[1])
 			t := strings.Split(p[1], ",")
@@ -323,7 +329,8 @@ type Realm struct {
 	DefaultDomain string
 	KDC           []string
 	KPasswdServer []string //default admin_server:464
-	MasterKDC     []string
+	MasterKDC     []string // primary_kdc, or its former name master_kdc
+	PKINITAnchors []string // roots trusted to issue the realm's KDC certificates for PKINIT, as FILE:path or DIR:path
 }
 
 // Parse the lines of a [realms] entry into the Realm struct.
@@ -333,6 +340,7 @@ func (r *Realm) parseLines(name string, lines []string) (err error) {
 	var KDCFinal bool
 	var kpasswdServerFinal bool
 	var masterKDCFinal bool
+	var pkinitAnchorsFinal bool
 	var ignore bool
 	var c int // counts the depth of blocks within brackets { }
 	for _, line := range lines {
@@ -383,19 +391,13 @@ func (r *Realm) parseLines(name string, lines []string) (err error) {
 		case "default_domain":
 			r.DefaultDomain = v
 		case "kdc":
-			if !strings.Contains(v, ":") {
-				// No port number specified default to 88
-				if strings.HasSuffix(v, `*`) {
-					v = strings.TrimSpace(strings.TrimSuffix(v, `*`)) + ":88*"
-				} else {
-					v = strings.TrimSpace(v) + ":88"
-				}
-			}
-			appendUntilFinal(&r.KDC, v, &KDCFinal)
+			appendUntilFinal(&r.KDC, defaultKDCPort(v), &KDCFinal)
 		case "kpasswd_server":
 			appendUntilFinal(&r.KPasswdServer, v, &kpasswdServerFinal)
-		case "master_kdc":
-			appendUntilFinal(&r.MasterKDC, v, &masterKDCFinal)
+		case "primary_kdc", "master_kdc":
+			appendUntilFinal(&r.MasterKDC, defaultKDCPort(v), &masterKDCFinal)
+		case "pkinit_anchors":
+			appendUntilFinal(&r.PKINITAnchors, v, &pkinitAnchorsFinal)
 		}
 	}
 	//default for Kpasswd_server = admin_server:464
@@ -408,6 +410,17 @@ func (r *Realm) parseLines(name string, lines []string) (err error) {
 	return
 }
 
+// defaultKDCPort adds the default KDC port of 88 to a KDC entry that does not specify a port number.
+func defaultKDCPort(v string) string {
+	if strings.Contains(v, ":") {
+		return v
+	}
+	if strings.HasSuffix(v, `*`) {
+		return strings.TrimSpace(strings.TrimSuffix(v, `*`)) + ":88*"
+	}
+	return strings.TrimSpace(v) + ":88"
+}
+
 // Parse the lines of the [realms] section of the configuration into an slice of Realm structs.
 func parseRealms(lines []string) (realms []Realm, err error) {
 	var name string
@@ -514,6 +527,17 @@ func (c *Config) ResolveRealm(domainName string) string {
 	return ""
 }
 
+// GetPKINITAnchors returns the pkinit_anchors configured for the realm, or those of the [libdefaults] section if the
+// realm does not configure any.
+func (c *Config) GetPKINITAnchors(realm string) []string {
+	for _, r := range c.Realms {
+		if r.Realm == realm && len(r.PKINITAnchors) > 0 {
+			return r.PKINITAnchors
+		}
+	}
+	return c.LibDefaults.PKINITAnchors
+}
+
 // Load the KRB5 configuration from the specified file path.
 func Load(cfgPath string) (*Config, error) {
 	fh, err := os.Open(cfgPath)
@@ -633,6 +657,12 @@ func parseETypes(s []string, w bool) []int32 {
 	return eti
 }
 
+// ParseDuration parses a time duration in the formats used in the configuration, such as 10h30m, 1d, 1d2h or a number
+// of seconds, as accepted for the lifetimes of tickets by kinit.
+func ParseDuration(s string) (time.Duration, error) {
+	return parseDuration(s)
+}
+
 // Parse a time duration string in the configuration to a golang time.Duration.
 func parseDuration(s string) (time.Duration, error) {
 	s = strings.Replace(strings.TrimSpace(s), " ", "", -1)
@@ -28,6 +28,7 @@ const (
  forwardable = yes #comment to be ignored
  default_keytab_name = FILE:/etc/krb5.keytab
 
+ default_ccache_name = KEYRING:persistent:%{uid}
  default_client_keytab_name = FILE:/home/gokrb5/client.keytab
  default_tkt_enctypes = aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 # comment to be ignored
 
@@ -84,6 +85,7 @@ const (
     "Canonicalize": false,
     "CCacheType": 4,
     "Clockskew": 300000000000,
+    "DefaultCCacheName": "KEYRING:persistent:%{uid}",
     "DefaultClientKeytabName": "FILE:/home/gokrb5/client.keytab",
     "DefaultKeytabName": "FILE:/etc/krb5.keytab",
     "DefaultRealm": "TEST.GOKRB5",
@@ -141,6 +143,7 @@ const (
       17,
       23
     ],
+    "PKINITAnchors": null,
     "PreferredPreauthTypes": [
       17,
       16,
@@ -172,7 +175,8 @@ const (
       "KPasswdServer": [
         "10.80.88.88:464"
       ],
-      "MasterKDC": null
+      "MasterKDC": null,
+      "PKINITAnchors": null
     },
     {
       "Realm": "EXAMPLE.COM",
@@ -187,7 +191,8 @@ const (
       "KPasswdServer": [
         "kerberos.example.com:464"
       ],
-      "MasterKDC": null
+      "MasterKDC": null,
+      "PKINITAnchors": null
     },
     {
       "Realm": "lowercase.org",
@@ -201,7 +206,8 @@ const (
       "KPasswdServer": [
         "kerberos.lowercase.org:464"
       ],
-      "MasterKDC": null
+      "MasterKDC": null,
+      "PKINITAnchors": null
     }
   ],
   "DomainRealm": {
@@ -459,6 +465,7 @@ func TestLoad(t *testing.T) {
 	assert.Equal(t, time.Duration(10)*time.Hour, c.LibDefaults.TicketLifetime, "[libdefaults] Ticket lifetime not as expected")
 	assert.Equal(t, true, c.LibDefaults.Forwardable, "[libdefaults] forwardable not as expected")
 	assert.Equal(t, "FILE:/etc/krb5.keytab", c.LibDefaults.DefaultKeytabName, "[libdefaults] default_keytab_name not as expected")
+	assert.Equal(t, "KEYRING:persistent:%{uid}", c.LibDefaults.DefaultCCacheName, "[libdefaults] default_ccache_name not as expected")
 	assert.Equal(t, "FILE:/home/gokrb5/client.keytab", c.LibDefaults.DefaultClientKeytabName, "[libdefaults] default_client_keytab_name not as expected")
 	assert.Equal(t, []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96"}, c.LibDefaults.DefaultTktEnctypes, "[libdefaults] default_tkt_enctypes not as expected")
 
@@ -678,3 +685,29 @@ func TestJSON(t *testing.T) {
 
 	t.Log(j)
 }
+
+func TestGetPKINITAnchors(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`[libdefaults]
+ default_realm = TEST.GOKRB5
+ pkinit_anchors = FILE:/etc/pki/ca.pem
+ pkinit_anchors = DIR:/etc/pki/anchors
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = 127.0.0.1:88
+ }
+ EXAMPLE.COM = {
+  kdc = kerberos.example.com
+  pkinit_anchors = FILE:/etc/pki/example.pem*
+  pkinit_anchors = FILE:/etc/pki/ignored.pem
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, []string{"FILE:/etc/pki/ca.pem", "DIR:/etc/pki/anchors"}, c.GetPKINITAnchors("TEST.GOKRB5"),
+		"anchors of realm without pkinit_anchors not as expected")
+	assert.Equal(t, []string{"FILE:/etc/pki/example.pem"}, c.GetPKINITAnchors("EXAMPLE.COM"),
+		"anchors of realm with pkinit_anchors not as expected")
+}
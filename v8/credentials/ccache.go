@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -15,6 +17,8 @@ import (
 
 const (
 	headerFieldTagKDCOffset = 1
+	ccacheFirstByte         = 5
+	ccacheDefaultVersion    = 4
 )
 
 // CCache is the file credentials cache as define here: https://web.mit.edu/kerberos/krb5-latest/doc/formats/ccache_file_format.html
@@ -60,17 +64,175 @@ type Credential struct {
 	SecondTicket []byte
 }
 
+// NewCCache creates a new, empty, version 4 credential cache for the client principal provided.
+func NewCCache(cname types.PrincipalName, realm string) *CCache {
+	return &CCache{
+		Version: ccacheDefaultVersion,
+		DefaultPrincipal: principal{
+			Realm:         realm,
+			PrincipalName: cname,
+		},
+	}
+}
+
+// NewCredential creates a new credential cache entry for the client and server principals provided.
+// The other fields of the Credential, such as the key, ticket and times, should then be set.
+func NewCredential(cname types.PrincipalName, crealm string, sname types.PrincipalName, srealm string) *Credential {
+	return &Credential{
+		Client: principal{
+			Realm:         crealm,
+			PrincipalName: cname,
+		},
+		Server: principal{
+			Realm:         srealm,
+			PrincipalName: sname,
+		},
+		TicketFlags: types.NewKrbFlags(),
+	}
+}
+
 // LoadCCache loads a credential cache file into a CCache type.
 func LoadCCache(cpath string) (*CCache, error) {
 	c := new(CCache)
-	b, err := os.ReadFile(cpath)
+	f, err := os.Open(cpath)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+	err = lockFile(f, false)
+	if err != nil {
+		return c, fmt.Errorf("error locking credential cache file %s: %v", cpath, err)
+	}
+	defer unlockFile(f)
+	b, err := io.ReadAll(f)
 	if err != nil {
 		return c, err
 	}
 	err = c.Unmarshal(b)
+	c.Path = cpath
 	return c, err
 }
 
+// Save the credential cache to the file path provided, replacing any existing content of the file.
+// The file is locked while it is written.
+func (c *CCache) Save(cpath string) error {
+	b, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(cpath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = lockFile(f, true)
+	if err != nil {
+		return fmt.Errorf("error locking credential cache file %s: %v", cpath, err)
+	}
+	defer unlockFile(f)
+	err = f.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteAt(b, 0)
+	if err != nil {
+		return err
+	}
+	c.Path = cpath
+	return nil
+}
+
+// AppendCredential appends the credential to the end of an existing credential cache file.
+// The file is locked while the credential is appended.
+func AppendCredential(cpath string, cred *Credential) error {
+	f, err := os.OpenFile(cpath, os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = lockFile(f, true)
+	if err != nil {
+		return fmt.Errorf("error locking credential cache file %s: %v", cpath, err)
+	}
+	defer unlockFile(f)
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	// Validate the existing content and determine the version to marshal the credential with
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		return fmt.Errorf("error parsing existing credential cache file %s: %v", cpath, err)
+	}
+	cb, err := cred.marshal(c.Version, c.endian())
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteAt(cb, int64(len(b)))
+	return err
+}
+
+// AddCredential adds the credential to the cache, replacing any existing credential for the same client and server.
+func (c *CCache) AddCredential(cred *Credential) {
+	for i, e := range c.Credentials {
+		if e.Server.Realm == cred.Server.Realm && e.Server.PrincipalName.Equal(cred.Server.PrincipalName) &&
+			e.Client.Realm == cred.Client.Realm && e.Client.PrincipalName.Equal(cred.Client.PrincipalName) {
+			c.Credentials[i] = cred
+			return
+		}
+	}
+	c.Credentials = append(c.Credentials, cred)
+}
+
+// Marshal the CCache into the bytes of the credential cache file format.
+func (c *CCache) Marshal() ([]byte, error) {
+	if c.Version < 1 || c.Version > 4 {
+		return nil, fmt.Errorf("credential cache version %d is not within 1 to 4", c.Version)
+	}
+	e := c.endian()
+	b := []byte{ccacheFirstByte, c.Version}
+	if c.Version == 4 {
+		hb, err := c.Header.marshal(e)
+		if err != nil {
+			return b, err
+		}
+		b = append(b, hb...)
+	}
+	pb, err := c.DefaultPrincipal.marshal(c.Version, e)
+	if err != nil {
+		return b, err
+	}
+	b = append(b, pb...)
+	for _, cred := range c.Credentials {
+		cb, err := cred.marshal(c.Version, e)
+		if err != nil {
+			return b, err
+		}
+		b = append(b, cb...)
+	}
+	return b, nil
+}
+
+// Write the credential cache bytes to io.Writer.
+// Returns the number of bytes written
+func (c *CCache) Write(w io.Writer) (int, error) {
+	b, err := c.Marshal()
+	if err != nil {
+		return 0, fmt.Errorf("error marshaling credential cache: %v", err)
+	}
+	return w.Write(b)
+}
+
+// endian returns the byte order used for integer representations by the version of the credential cache.
+func (c *CCache) endian() binary.ByteOrder {
+	//Version 1 or 2 of the file format uses native byte order for integer representations. Versions 3 & 4 always uses big-endian byte order
+	if (c.Version == 1 || c.Version == 2) && isNativeEndianLittle() {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
 // Unmarshal a byte slice of credential cache data into CCache type.
 func (c *CCache) Unmarshal(b []byte) error {
 	p := 0
@@ -247,6 +409,86 @@ func (c *CCache) GetEntries() []*Credential {
 	return creds
 }
 
+func (h *header) marshal(e binary.ByteOrder) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for _, f := range h.fields {
+		if !f.valid() {
+			return nil, errors.New("invalid credential cache header field")
+		}
+		writeInt16(buf, int16(f.tag), e)
+		writeInt16(buf, int16(len(f.value)), e)
+		buf.Write(f.value)
+	}
+	b := make([]byte, 2, 2+buf.Len())
+	e.PutUint16(b, uint16(buf.Len()))
+	return append(b, buf.Bytes()...), nil
+}
+
+func (p principal) marshal(v uint8, e binary.ByteOrder) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if v != 1 {
+		//Name Type is omitted in version 1
+		writeInt32(buf, p.PrincipalName.NameType, e)
+	}
+	nc := len(p.PrincipalName.NameString)
+	if v == 1 {
+		//In version 1 the number of components includes the realm
+		nc++
+	}
+	writeInt32(buf, int32(nc), e)
+	writeData(buf, []byte(p.Realm), e)
+	for _, s := range p.PrincipalName.NameString {
+		writeData(buf, []byte(s), e)
+	}
+	return buf.Bytes(), nil
+}
+
+func (cred *Credential) marshal(v uint8, e binary.ByteOrder) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	cb, err := cred.Client.marshal(v, e)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(cb)
+	sb, err := cred.Server.marshal(v, e)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(sb)
+	writeInt16(buf, int16(cred.Key.KeyType), e)
+	if v == 3 {
+		//repeated twice in version 3
+		writeInt16(buf, int16(cred.Key.KeyType), e)
+	}
+	writeData(buf, cred.Key.KeyValue, e)
+	writeTimestamp(buf, cred.AuthTime, e)
+	writeTimestamp(buf, cred.StartTime, e)
+	writeTimestamp(buf, cred.EndTime, e)
+	writeTimestamp(buf, cred.RenewTill, e)
+	if cred.IsSKey {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	// Ticket flags are always 4 bytes
+	fb := make([]byte, 4)
+	copy(fb, cred.TicketFlags.Bytes)
+	buf.Write(fb)
+	writeInt32(buf, int32(len(cred.Addresses)), e)
+	for _, a := range cred.Addresses {
+		writeInt16(buf, int16(a.AddrType), e)
+		writeData(buf, a.Address, e)
+	}
+	writeInt32(buf, int32(len(cred.AuthData)), e)
+	for _, a := range cred.AuthData {
+		writeInt16(buf, int16(a.ADType), e)
+		writeData(buf, a.ADData, e)
+	}
+	writeData(buf, cred.Ticket, e)
+	writeData(buf, cred.SecondTicket, e)
+	return buf.Bytes(), nil
+}
+
 func (h *headerField) valid() bool {
 	// See https://web.mit.edu/kerberos/krb5-latest/doc/formats/ccache_file_format.html - Header format
 	switch h.tag {
@@ -315,6 +557,37 @@ func readBytes(b []byte, p *int, s int, e *binary.ByteOrder) []byte {
 	return r
 }
 
+// Write bytes representing a timestamp. A zero time is written as 0.
+func writeTimestamp(buf *bytes.Buffer, t time.Time, e binary.ByteOrder) {
+	var u uint32
+	if !t.IsZero() {
+		u = uint32(t.Unix())
+	}
+	b := make([]byte, 4)
+	e.PutUint32(b, u)
+	buf.Write(b)
+}
+
+// Write bytes representing a sixteen bit integer.
+func writeInt16(buf *bytes.Buffer, i int16, e binary.ByteOrder) {
+	b := make([]byte, 2)
+	e.PutUint16(b, uint16(i))
+	buf.Write(b)
+}
+
+// Write bytes representing a thirty two bit integer.
+func writeInt32(buf *bytes.Buffer, i int32, e binary.ByteOrder) {
+	b := make([]byte, 4)
+	e.PutUint32(b, uint32(i))
+	buf.Write(b)
+}
+
+// Write bytes prefixed with their thirty two bit length.
+func writeData(buf *bytes.Buffer, d []byte, e binary.ByteOrder) {
+	writeInt32(buf, int32(len(d)), e)
+	buf.Write(d)
+}
+
 func isNativeEndianLittle() bool {
 	var x = 0x012345678
 	var p = unsafe.Pointer(&x)
@@ -0,0 +1,358 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// The layout of KEYRING credential caches follows that of MIT Kerberos:
+// https://web.mit.edu/kerberos/krb5-latest/doc/basic/ccache_def.html
+//
+// An anchor keyring (process, thread, session, user or persistent) holds a collection keyring. The collection holds a
+// keyring for each credential cache and a user key identifying the primary credential cache. A credential cache keyring
+// holds a user key for the default principal and a user key for each credential.
+
+const (
+	keyctlDescribe      = 6
+	keyctlClear         = 7
+	keyctlUnlink        = 9
+	keyctlSearch        = 10
+	keyctlRead          = 11
+	keyctlGetPersistent = 22
+
+	keySpecThreadKeyring  = -1
+	keySpecProcessKeyring = -2
+	keySpecSessionKeyring = -3
+	keySpecUserKeyring    = -4
+
+	keyringCollectionPrefix  = "_krb_"
+	keyringPersistentName    = "_krb"
+	keyringPrimaryKey        = "krb_ccache:primary"
+	keyringPrincipalKey      = "__krb5_princ__"
+	keyringTimeOffsetsKey    = "__krb5_time_offsets__"
+	keyringCollectionVersion = 1
+	keyringDefaultSubsidiary = "tkt"
+)
+
+// keyringName is a parsed KEYRING credential cache name.
+type keyringName struct {
+	anchor     int
+	uid        int
+	collection string
+	subsidiary string
+}
+
+// parseKeyringName parses the residual of a KEYRING credential cache name. The forms supported are:
+//
+// persistent:<uid>[:<subsidiary>], user:<name>[:<subsidiary>], session:<name>[:<subsidiary>],
+// process:<name>[:<subsidiary>], thread:<name>[:<subsidiary>] and the legacy form <name>, which is a session keyring.
+func parseKeyringName(residual string) (keyringName, error) {
+	var n keyringName
+	p := strings.SplitN(residual, ":", 3)
+	if len(p) == 1 {
+		// Legacy name
+		n.anchor = keySpecSessionKeyring
+		n.collection = keyringCollectionPrefix + p[0]
+		n.subsidiary = p[0]
+		return n, nil
+	}
+	if len(p) == 3 {
+		n.subsidiary = p[2]
+	}
+	n.collection = keyringCollectionPrefix + p[1]
+	switch p[0] {
+	case "persistent":
+		n.anchor = 0
+		n.uid = -1
+		if p[1] != "" {
+			uid, err := strconv.Atoi(p[1])
+			if err != nil {
+				return n, fmt.Errorf("KEYRING credential cache persistent uid %s is not valid", p[1])
+			}
+			n.uid = uid
+		}
+		n.collection = keyringPersistentName
+	case "user":
+		n.anchor = keySpecUserKeyring
+	case "session":
+		n.anchor = keySpecSessionKeyring
+	case "process":
+		n.anchor = keySpecProcessKeyring
+	case "thread":
+		n.anchor = keySpecThreadKeyring
+	default:
+		return n, fmt.Errorf("KEYRING credential cache anchor %s is not supported", p[0])
+	}
+	return n, nil
+}
+
+// collectionKeyring returns the ID of the collection keyring, creating it if create is true.
+func (n keyringName) collectionKeyring(create bool) (int, error) {
+	anchor := n.anchor
+	if n.anchor == 0 {
+		var err error
+		dest := keySpecProcessKeyring
+		anchor, err = keyctl(keyctlGetPersistent, uintptr(n.uid), uintptr(dest), 0, 0)
+		if err != nil {
+			return 0, fmt.Errorf("could not get persistent keyring: %v", err)
+		}
+	}
+	if create {
+		return addKey("keyring", n.collection, nil, anchor)
+	}
+	return searchKey(anchor, "keyring", n.collection)
+}
+
+// cacheKeyring returns the ID of the credential cache keyring, creating it if create is true.
+func (n keyringName) cacheKeyring(create bool) (int, error) {
+	col, err := n.collectionKeyring(create)
+	if err != nil {
+		return 0, err
+	}
+	sub := n.subsidiary
+	if sub == "" {
+		sub, err = keyringPrimary(col)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if !create {
+		return searchKey(col, "keyring", sub)
+	}
+	id, err := addKey("keyring", sub, nil, col)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := searchKey(col, "user", keyringPrimaryKey); err != nil {
+		// Make this the primary credential cache of the collection
+		b := make([]byte, 8, 8+len(sub))
+		binary.BigEndian.PutUint32(b[0:4], keyringCollectionVersion)
+		binary.BigEndian.PutUint32(b[4:8], uint32(len(sub)))
+		b = append(b, sub...)
+		_, err = addKey("user", keyringPrimaryKey, b, col)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// keyringPrimary returns the name of the primary credential cache of the collection.
+func keyringPrimary(col int) (string, error) {
+	id, err := searchKey(col, "user", keyringPrimaryKey)
+	if err != nil {
+		return keyringDefaultSubsidiary, nil
+	}
+	b, err := readKey(id)
+	if err != nil {
+		return "", err
+	}
+	if len(b) < 8 || binary.BigEndian.Uint32(b[0:4]) != keyringCollectionVersion || int(binary.BigEndian.Uint32(b[4:8])) != len(b)-8 {
+		return "", errors.New("KEYRING credential cache collection primary key is not valid")
+	}
+	return string(b[8:]), nil
+}
+
+func loadKeyringCCache(residual string) (*CCache, error) {
+	c := &CCache{Version: 4}
+	n, err := parseKeyringName(residual)
+	if err != nil {
+		return c, err
+	}
+	kr, err := n.cacheKeyring(false)
+	if err != nil {
+		return c, fmt.Errorf("KEYRING credential cache %s not found: %v", residual, err)
+	}
+	b, err := readKey(kr)
+	if err != nil {
+		return c, err
+	}
+	var e binary.ByteOrder = binary.BigEndian
+	// The key IDs of a keyring's payload are in native byte order
+	var ne binary.ByteOrder = binary.BigEndian
+	if isNativeEndianLittle() {
+		ne = binary.LittleEndian
+	}
+	var foundPrinc bool
+	for i := 0; i+4 <= len(b); i += 4 {
+		id := int(int32(ne.Uint32(b[i : i+4])))
+		t, desc, err := describeKey(id)
+		if err != nil || t != "user" || desc == keyringTimeOffsetsKey {
+			continue
+		}
+		kb, err := readKey(id)
+		if err != nil {
+			return c, err
+		}
+		p := 0
+		if desc == keyringPrincipalKey {
+			c.DefaultPrincipal = parsePrincipal(kb, &p, c, &e)
+			foundPrinc = true
+			continue
+		}
+		cred, err := parseCredential(kb, &p, c, &e)
+		if err != nil {
+			return c, err
+		}
+		c.Credentials = append(c.Credentials, cred)
+	}
+	if !foundPrinc {
+		return c, fmt.Errorf("KEYRING credential cache %s does not have a default principal", residual)
+	}
+	return c, nil
+}
+
+func saveKeyringCCache(residual string, c *CCache) error {
+	n, err := parseKeyringName(residual)
+	if err != nil {
+		return err
+	}
+	kr, err := n.cacheKeyring(true)
+	if err != nil {
+		return fmt.Errorf("could not create KEYRING credential cache %s: %v", residual, err)
+	}
+	_, err = keyctl(keyctlClear, uintptr(kr), 0, 0, 0)
+	if err != nil {
+		return fmt.Errorf("could not clear KEYRING credential cache %s: %v", residual, err)
+	}
+	// Keyring credential caches are always in the version 4 format
+	e := binary.BigEndian
+	pb, err := c.DefaultPrincipal.marshal(4, e)
+	if err != nil {
+		return err
+	}
+	_, err = addKey("user", keyringPrincipalKey, pb, kr)
+	if err != nil {
+		return err
+	}
+	for _, cred := range c.Credentials {
+		cb, err := cred.marshal(4, e)
+		if err != nil {
+			return err
+		}
+		desc := fmt.Sprintf("%s@%s %s@%s", cred.Client.PrincipalName.PrincipalNameString(), cred.Client.Realm,
+			cred.Server.PrincipalName.PrincipalNameString(), cred.Server.Realm)
+		_, err = addKey("user", desc, cb, kr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func destroyKeyringCCache(residual string) error {
+	n, err := parseKeyringName(residual)
+	if err != nil {
+		return err
+	}
+	col, err := n.collectionKeyring(false)
+	if err != nil {
+		// No collection so no credential cache to destroy
+		return nil
+	}
+	kr, err := n.cacheKeyring(false)
+	if err != nil {
+		return nil
+	}
+	_, err = keyctl(keyctlClear, uintptr(kr), 0, 0, 0)
+	if err != nil {
+		return err
+	}
+	_, err = keyctl(keyctlUnlink, uintptr(kr), uintptr(col), 0, 0)
+	return err
+}
+
+func keyctl(cmd int, a2, a3, a4, a5 uintptr) (int, error) {
+	r, _, errno := syscall.Syscall6(syscall.SYS_KEYCTL, uintptr(cmd), a2, a3, a4, a5, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(int32(r)), nil
+}
+
+// addKey adds a key to the keyring, or updates the key if one of the same type and description exists.
+func addKey(keyType, desc string, payload []byte, keyring int) (int, error) {
+	t, err := syscall.BytePtrFromString(keyType)
+	if err != nil {
+		return 0, err
+	}
+	d, err := syscall.BytePtrFromString(desc)
+	if err != nil {
+		return 0, err
+	}
+	var p unsafe.Pointer
+	if len(payload) > 0 {
+		p = unsafe.Pointer(&payload[0])
+	}
+	r, _, errno := syscall.Syscall6(syscall.SYS_ADD_KEY, uintptr(unsafe.Pointer(t)), uintptr(unsafe.Pointer(d)),
+		uintptr(p), uintptr(len(payload)), uintptr(keyring), 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(int32(r)), nil
+}
+
+// searchKey searches the keyring for a key of the type and description.
+func searchKey(keyring int, keyType, desc string) (int, error) {
+	t, err := syscall.BytePtrFromString(keyType)
+	if err != nil {
+		return 0, err
+	}
+	d, err := syscall.BytePtrFromString(desc)
+	if err != nil {
+		return 0, err
+	}
+	return keyctl(keyctlSearch, uintptr(keyring), uintptr(unsafe.Pointer(t)), uintptr(unsafe.Pointer(d)), 0)
+}
+
+// readKey returns the payload of a key. The payload of a keyring is the list of IDs of the keys it holds.
+func readKey(id int) ([]byte, error) {
+	l, err := keyctl(keyctlRead, uintptr(id), 0, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		b := make([]byte, l)
+		if l == 0 {
+			return b, nil
+		}
+		n, err := keyctl(keyctlRead, uintptr(id), uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), 0)
+		if err != nil {
+			return nil, err
+		}
+		if n <= l {
+			return b[:n], nil
+		}
+		// The key grew between calls
+		l = n
+	}
+}
+
+// describeKey returns the type and description of a key.
+func describeKey(id int) (string, string, error) {
+	b := make([]byte, 512)
+	n, err := keyctl(keyctlDescribe, uintptr(id), uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), 0)
+	if err != nil {
+		return "", "", err
+	}
+	if n > len(b) {
+		b = make([]byte, n)
+		n, err = keyctl(keyctlDescribe, uintptr(id), uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), 0)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	// The description is of the form type;uid;gid;perm;description and is NUL terminated
+	d := string(bytes.TrimRight(b[:n], "\x00"))
+	p := strings.SplitN(d, ";", 5)
+	if len(p) != 5 {
+		return "", "", fmt.Errorf("key description %s is not valid", d)
+	}
+	return p[0], p[4], nil
+}
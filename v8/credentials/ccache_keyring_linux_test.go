@@ -0,0 +1,38 @@
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamedCCache_Keyring(t *testing.T) {
+	t.Parallel()
+	// The process keyring is used so the test does not modify the user's keyrings
+	name := fmt.Sprintf("KEYRING:process:gokrb5test%d", os.Getpid())
+	c := testCCache(t)
+	err := c.SaveNamed(name)
+	if err != nil {
+		t.Skipf("kernel keyring not available: %v", err)
+	}
+	l, err := LoadNamedCCache(name)
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	assert.Equal(t, c.DefaultPrincipal, l.DefaultPrincipal, "default principal not as expected")
+	assert.Equal(t, len(c.Credentials), len(l.Credentials), "number of credentials not as expected")
+	for _, cred := range c.Credentials {
+		lc, ok := l.GetEntry(cred.Server.PrincipalName)
+		if assert.True(t, ok, "credential for %s not found", cred.Server.PrincipalName.PrincipalNameString()) {
+			assert.Equal(t, cred.Ticket, lc.Ticket, "ticket not as expected")
+		}
+	}
+	err = DestroyNamedCCache(name)
+	if err != nil {
+		t.Fatalf("error destroying: %v", err)
+	}
+	_, err = LoadNamedCCache(name)
+	assert.Error(t, err, "destroyed cache should not load")
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package credentials
+
+import "errors"
+
+var errKeyringNotSupported = errors.New("KEYRING credential caches are only supported on Linux")
+
+func loadKeyringCCache(residual string) (*CCache, error) {
+	return new(CCache), errKeyringNotSupported
+}
+
+func saveKeyringCCache(residual string, c *CCache) error {
+	return errKeyringNotSupported
+}
+
+func destroyKeyringCCache(residual string) error {
+	return errKeyringNotSupported
+}
@@ -0,0 +1,32 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package credentials
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// lockFile takes a POSIX advisory lock on the whole of the credential cache file, as done by MIT Kerberos,
+// blocking until the lock is obtained. An exclusive lock is required to modify the file.
+func lockFile(f *os.File, exclusive bool) error {
+	lk := syscall.Flock_t{
+		Type:   syscall.F_RDLCK,
+		Whence: io.SeekStart,
+	}
+	if exclusive {
+		lk.Type = syscall.F_WRLCK
+	}
+	return syscall.FcntlFlock(f.Fd(), syscall.F_SETLKW, &lk)
+}
+
+// unlockFile releases the lock on the credential cache file.
+func unlockFile(f *os.File) error {
+	lk := syscall.Flock_t{
+		Type:   syscall.F_UNLCK,
+		Whence: io.SeekStart,
+	}
+	return syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lk)
+}
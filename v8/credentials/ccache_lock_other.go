@@ -0,0 +1,16 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package credentials
+
+import "os"
+
+// lockFile is a no-op on platforms without POSIX advisory file locks.
+func lockFile(f *os.File, exclusive bool) error {
+	return nil
+}
+
+// unlockFile is a no-op on platforms without POSIX advisory file locks.
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,285 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+)
+
+// Credential cache types. The type of a credential cache is given by the prefix of its name, for example
+// KEYRING:persistent:1000. A name without a type prefix is a FILE credential cache.
+const (
+	CCacheTypeFile    = "FILE"
+	CCacheTypeDir     = "DIR"
+	CCacheTypeKeyring = "KEYRING"
+	CCacheTypeMemory  = "MEMORY"
+)
+
+const (
+	// envCCacheName is the environment variable that overrides the default credential cache name.
+	envCCacheName = "KRB5CCNAME"
+	// dirPrimaryFile holds the name of the primary credential cache within a DIR collection.
+	dirPrimaryFile = "primary"
+	// dirDefaultSubsidiary is the name of the credential cache file created within a DIR collection.
+	dirDefaultSubsidiary = "tkt"
+)
+
+// memoryCCaches holds the MEMORY credential caches of the process, keyed on name.
+var memoryCCaches = struct {
+	sync.Mutex
+	entries map[string][]byte
+}{entries: make(map[string][]byte)}
+
+// DefaultCCacheName returns the name of the default credential cache with any tokens expanded.
+// As with MIT Kerberos, the KRB5CCNAME environment variable takes precedence over the default_ccache_name in the
+// [libdefaults] section of the krb5.conf.
+func DefaultCCacheName(cfg *config.Config) (string, error) {
+	name := os.Getenv(envCCacheName)
+	if name == "" {
+		name = cfg.LibDefaults.DefaultCCacheName
+	}
+	return ExpandCCacheName(name)
+}
+
+// ExpandCCacheName expands the tokens, such as %{uid}, within a credential cache name.
+// The tokens supported are %{uid}, %{euid}, %{USERID}, %{username}, %{TEMP} and %{null}.
+func ExpandCCacheName(name string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(name, "%{")
+		if i < 0 {
+			b.WriteString(name)
+			return b.String(), nil
+		}
+		j := strings.Index(name[i:], "}")
+		if j < 0 {
+			return "", fmt.Errorf("credential cache name %s has an unterminated token", name)
+		}
+		v, err := expandToken(name[i+2 : i+j])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(name[:i])
+		b.WriteString(v)
+		name = name[i+j+1:]
+	}
+}
+
+func expandToken(t string) (string, error) {
+	switch t {
+	case "uid":
+		if uid := os.Getuid(); uid >= 0 {
+			return strconv.Itoa(uid), nil
+		}
+		return currentUserID()
+	case "euid", "USERID":
+		if uid := os.Geteuid(); uid >= 0 {
+			return strconv.Itoa(uid), nil
+		}
+		return currentUserID()
+	case "username":
+		usr, err := user.Current()
+		if err != nil {
+			return "", fmt.Errorf("could not determine the current user: %v", err)
+		}
+		return usr.Username, nil
+	case "TEMP":
+		return os.TempDir(), nil
+	case "null":
+		return "", nil
+	}
+	return "", fmt.Errorf("credential cache name token %%{%s} is not supported", t)
+}
+
+func currentUserID() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("could not determine the current user: %v", err)
+	}
+	return usr.Uid, nil
+}
+
+// ParseCCacheName expands the tokens within the credential cache name and returns its type and the type specific
+// residual of the name.
+func ParseCCacheName(name string) (string, string, error) {
+	name, err := ExpandCCacheName(name)
+	if err != nil {
+		return "", "", err
+	}
+	i := strings.Index(name, ":")
+	// A name without a type prefix, or with a drive letter on Windows, is a file path.
+	if i < 0 || (i == 1 && runtime.GOOS == "windows") {
+		return CCacheTypeFile, name, nil
+	}
+	t := strings.ToUpper(name[:i])
+	switch t {
+	case CCacheTypeFile, CCacheTypeDir, CCacheTypeKeyring, CCacheTypeMemory:
+		return t, name[i+1:], nil
+	}
+	return "", "", fmt.Errorf("credential cache type %s is not supported", name[:i])
+}
+
+// LoadNamedCCache loads the credential cache with the name provided into a CCache type.
+// The name is prefixed with its type, for example FILE:/tmp/krb5cc_1000, DIR:/run/user/1000/krb5cc,
+// KEYRING:persistent:1000 or MEMORY:name, and may contain tokens such as %{uid}.
+func LoadNamedCCache(name string) (*CCache, error) {
+	t, r, err := ParseCCacheName(name)
+	if err != nil {
+		return new(CCache), err
+	}
+	var c *CCache
+	switch t {
+	case CCacheTypeFile:
+		return LoadCCache(r)
+	case CCacheTypeDir:
+		var p string
+		p, err = dirCCachePath(r, false)
+		if err != nil {
+			return new(CCache), err
+		}
+		return LoadCCache(p)
+	case CCacheTypeKeyring:
+		c, err = loadKeyringCCache(r)
+	case CCacheTypeMemory:
+		c, err = loadMemoryCCache(r)
+	}
+	if err != nil {
+		return c, err
+	}
+	c.Path = t + ":" + r
+	return c, nil
+}
+
+// SaveNamed saves the credential cache to the named credential cache, replacing any existing content.
+// See LoadNamedCCache for the format of the name.
+func (c *CCache) SaveNamed(name string) error {
+	t, r, err := ParseCCacheName(name)
+	if err != nil {
+		return err
+	}
+	switch t {
+	case CCacheTypeFile:
+		return c.Save(r)
+	case CCacheTypeDir:
+		p, err := dirCCachePath(r, true)
+		if err != nil {
+			return err
+		}
+		return c.Save(p)
+	case CCacheTypeKeyring:
+		err = saveKeyringCCache(r, c)
+	case CCacheTypeMemory:
+		err = saveMemoryCCache(r, c)
+	}
+	if err != nil {
+		return err
+	}
+	c.Path = t + ":" + r
+	return nil
+}
+
+// DestroyNamedCCache removes the named credential cache. It is not an error if the credential cache does not exist.
+// See LoadNamedCCache for the format of the name.
+func DestroyNamedCCache(name string) error {
+	t, r, err := ParseCCacheName(name)
+	if err != nil {
+		return err
+	}
+	switch t {
+	case CCacheTypeFile:
+		return removeIfExists(r)
+	case CCacheTypeDir:
+		p, err := dirCCachePath(r, false)
+		if err != nil {
+			return err
+		}
+		return removeIfExists(p)
+	case CCacheTypeKeyring:
+		return destroyKeyringCCache(r)
+	case CCacheTypeMemory:
+		memoryCCaches.Lock()
+		defer memoryCCaches.Unlock()
+		delete(memoryCCaches.entries, r)
+	}
+	return nil
+}
+
+func removeIfExists(p string) error {
+	err := os.Remove(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// dirCCachePath returns the path of the credential cache file within a DIR collection.
+// The residual is either the collection directory, in which case the primary credential cache is used, or the path of
+// a credential cache file within a collection prefixed with a colon.
+// If create is true the collection directory and its primary file are created if they do not exist.
+func dirCCachePath(residual string, create bool) (string, error) {
+	if strings.HasPrefix(residual, ":") {
+		p := residual[1:]
+		if !strings.HasPrefix(filepath.Base(p), dirDefaultSubsidiary) {
+			return "", fmt.Errorf("DIR credential cache file name %s must begin with %s", p, dirDefaultSubsidiary)
+		}
+		return p, nil
+	}
+	if residual == "" {
+		return "", errors.New("DIR credential cache name does not define a directory")
+	}
+	pf := filepath.Join(residual, dirPrimaryFile)
+	b, err := os.ReadFile(pf)
+	if err == nil {
+		sub := strings.TrimSpace(string(b))
+		if !strings.HasPrefix(sub, dirDefaultSubsidiary) || strings.ContainsAny(sub, `/\`) {
+			return "", fmt.Errorf("DIR credential cache primary file %s is not valid", pf)
+		}
+		return filepath.Join(residual, sub), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	if create {
+		err = os.MkdirAll(residual, 0700)
+		if err != nil {
+			return "", err
+		}
+		err = os.WriteFile(pf, []byte(dirDefaultSubsidiary+"\n"), 0600)
+		if err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(residual, dirDefaultSubsidiary), nil
+}
+
+func loadMemoryCCache(name string) (*CCache, error) {
+	c := new(CCache)
+	memoryCCaches.Lock()
+	b, ok := memoryCCaches.entries[name]
+	memoryCCaches.Unlock()
+	if !ok {
+		return c, fmt.Errorf("MEMORY credential cache %s not found", name)
+	}
+	err := c.Unmarshal(b)
+	return c, err
+}
+
+func saveMemoryCCache(name string, c *CCache) error {
+	// The marshaled bytes are held so that the cache cannot be modified other than by saving it again
+	b, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	memoryCCaches.Lock()
+	defer memoryCCaches.Unlock()
+	memoryCCaches.entries[name] = b
+	return nil
+}
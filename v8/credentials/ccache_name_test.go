@@ -0,0 +1,150 @@
+package credentials
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCCache(t *testing.T) *CCache {
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	return c
+}
+
+func TestExpandCCacheName(t *testing.T) {
+	t.Parallel()
+	uid := strconv.Itoa(os.Getuid())
+	var tests = []struct {
+		name     string
+		expected string
+	}{
+		{"/tmp/krb5cc_%{uid}", "/tmp/krb5cc_" + uid},
+		{"KEYRING:persistent:%{uid}", "KEYRING:persistent:" + uid},
+		{"DIR:%{TEMP}/cc%{null}", "DIR:" + os.TempDir() + "/cc"},
+		{"MEMORY:plain", "MEMORY:plain"},
+	}
+	for _, test := range tests {
+		n, err := ExpandCCacheName(test.name)
+		if err != nil {
+			t.Errorf("error expanding %s: %v", test.name, err)
+		}
+		assert.Equal(t, test.expected, n, "expanded name not as expected")
+	}
+	_, err := ExpandCCacheName("/tmp/krb5cc_%{unknown}")
+	assert.Error(t, err, "unknown token should error")
+	_, err = ExpandCCacheName("/tmp/krb5cc_%{uid")
+	assert.Error(t, err, "unterminated token should error")
+}
+
+func TestParseCCacheName(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name     string
+		typ      string
+		residual string
+	}{
+		{"/tmp/krb5cc_1000", CCacheTypeFile, "/tmp/krb5cc_1000"},
+		{"FILE:/tmp/krb5cc_1000", CCacheTypeFile, "/tmp/krb5cc_1000"},
+		{"dir:/run/user/1000/krb5cc", CCacheTypeDir, "/run/user/1000/krb5cc"},
+		{"KEYRING:persistent:1000", CCacheTypeKeyring, "persistent:1000"},
+		{"MEMORY:test", CCacheTypeMemory, "test"},
+	}
+	for _, test := range tests {
+		typ, r, err := ParseCCacheName(test.name)
+		if err != nil {
+			t.Errorf("error parsing %s: %v", test.name, err)
+		}
+		assert.Equal(t, test.typ, typ, "type not as expected for %s", test.name)
+		assert.Equal(t, test.residual, r, "residual not as expected for %s", test.name)
+	}
+	_, _, err := ParseCCacheName("API:test")
+	assert.Error(t, err, "unsupported type should error")
+}
+
+func TestDefaultCCacheName(t *testing.T) {
+	c := config.New()
+	c.LibDefaults.DefaultCCacheName = "DIR:/run/user/%{uid}/krb5cc"
+	os.Setenv(envCCacheName, "")
+	n, err := DefaultCCacheName(c)
+	if err != nil {
+		t.Fatalf("error getting default name: %v", err)
+	}
+	assert.Equal(t, "DIR:/run/user/"+strconv.Itoa(os.Getuid())+"/krb5cc", n, "default name from config not as expected")
+	os.Setenv(envCCacheName, "MEMORY:env")
+	defer os.Unsetenv(envCCacheName)
+	n, err = DefaultCCacheName(c)
+	if err != nil {
+		t.Fatalf("error getting default name: %v", err)
+	}
+	assert.Equal(t, "MEMORY:env", n, "default name from environment not as expected")
+}
+
+func TestNamedCCache_Memory(t *testing.T) {
+	t.Parallel()
+	c := testCCache(t)
+	err := c.SaveNamed("MEMORY:test")
+	if err != nil {
+		t.Fatalf("error saving: %v", err)
+	}
+	l, err := LoadNamedCCache("MEMORY:test")
+	if err != nil {
+		t.Fatalf("error loading: %v", err)
+	}
+	assert.Equal(t, c.DefaultPrincipal, l.DefaultPrincipal, "default principal not as expected")
+	assert.Equal(t, len(c.Credentials), len(l.Credentials), "number of credentials not as expected")
+	assert.Equal(t, "MEMORY:test", l.Path, "path not as expected")
+	err = DestroyNamedCCache("MEMORY:test")
+	if err != nil {
+		t.Fatalf("error destroying: %v", err)
+	}
+	_, err = LoadNamedCCache("MEMORY:test")
+	assert.Error(t, err, "destroyed cache should not load")
+}
+
+func TestNamedCCache_Dir(t *testing.T) {
+	t.Parallel()
+	dir, err := os.MkdirTemp("", "ccache")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	col := filepath.Join(dir, "krb5cc")
+	c := testCCache(t)
+	err = c.SaveNamed("DIR:" + col)
+	if err != nil {
+		t.Fatalf("error saving: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(col, dirPrimaryFile))
+	if err != nil {
+		t.Fatalf("error reading primary file: %v", err)
+	}
+	assert.Equal(t, "tkt\n", string(b), "primary file content not as expected")
+	for _, n := range []string{"DIR:" + col, "DIR::" + filepath.Join(col, "tkt"), "FILE:" + filepath.Join(col, "tkt")} {
+		l, err := LoadNamedCCache(n)
+		if err != nil {
+			t.Fatalf("error loading %s: %v", n, err)
+		}
+		assert.Equal(t, c.DefaultPrincipal, l.DefaultPrincipal, "default principal not as expected for %s", n)
+		assert.Equal(t, len(c.Credentials), len(l.Credentials), "number of credentials not as expected for %s", n)
+	}
+	err = DestroyNamedCCache("DIR:" + col)
+	if err != nil {
+		t.Fatalf("error destroying: %v", err)
+	}
+	_, err = os.Stat(filepath.Join(col, "tkt"))
+	assert.True(t, os.IsNotExist(err), "cache file should be removed")
+}
@@ -2,7 +2,10 @@ package credentials
 
 import (
 	"encoding/hex"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
@@ -129,3 +132,76 @@ func TestCCache_GetEntries(t *testing.T) {
 	creds := c.GetEntries()
 	assert.Equal(t, 2, len(creds), "Number of credentials entries not as expected")
 }
+
+func TestCCache_Marshal(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	mb, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling cache: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshaled bytes not as expected")
+}
+
+func TestCCache_SaveAndAppend(t *testing.T) {
+	t.Parallel()
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	c := NewCCache(cname, "TEST.GOKRB5")
+	tgt := NewCredential(cname, "TEST.GOKRB5", types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5")
+	tgt.Key = types.EncryptionKey{KeyType: 18, KeyValue: make([]byte, 32)}
+	tgt.AuthTime = time.Unix(1500000000, 0)
+	tgt.StartTime = tgt.AuthTime
+	tgt.EndTime = tgt.AuthTime.Add(time.Hour)
+	tgt.Ticket = []byte("ticket")
+	c.AddCredential(tgt)
+
+	dir, err := os.MkdirTemp("", "ccache")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cpath := filepath.Join(dir, "krb5cc_test")
+	err = c.Save(cpath)
+	if err != nil {
+		t.Fatalf("Error saving cache: %v", err)
+	}
+	fi, err := os.Stat(cpath)
+	if err != nil {
+		t.Fatalf("Error getting cache file info: %v", err)
+	}
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "Cache file permissions not as expected")
+
+	httppn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	svc := NewCredential(cname, "TEST.GOKRB5", httppn, "TEST.GOKRB5")
+	svc.Key = types.EncryptionKey{KeyType: 18, KeyValue: make([]byte, 32)}
+	svc.EndTime = time.Unix(1500003600, 0)
+	svc.Ticket = []byte("service ticket")
+	err = AppendCredential(cpath, svc)
+	if err != nil {
+		t.Fatalf("Error appending to cache: %v", err)
+	}
+
+	l, err := LoadCCache(cpath)
+	if err != nil {
+		t.Fatalf("Error loading cache: %v", err)
+	}
+	assert.Equal(t, cname, l.GetClientPrincipalName(), "Default principal not as expected")
+	assert.Equal(t, 2, len(l.GetEntries()), "Number of credentials entries not as expected")
+	cred, ok := l.GetEntry(httppn)
+	if !ok {
+		t.Fatal("Appended credential not found")
+	}
+	assert.Equal(t, svc.Ticket, cred.Ticket, "Appended ticket not as expected")
+	assert.True(t, cred.StartTime.Equal(time.Unix(0, 0)), "Unset start time not as expected")
+	cred, _ = l.GetEntry(tgt.Server.PrincipalName)
+	assert.True(t, tgt.EndTime.Equal(cred.EndTime), "TGT end time not as expected")
+	assert.Equal(t, tgt.Key, cred.Key, "TGT key not as expected")
+}
@@ -3,6 +3,8 @@ package credentials
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/x509"
 	"encoding/gob"
 	"encoding/json"
 	"time"
@@ -19,7 +21,7 @@ const (
 )
 
 // Credentials struct for a user.
-// Contains either a keytab, password or both.
+// Contains either a keytab, password or both, or a certificate and its private key for PKINIT.
 // Keytabs are used over passwords if both are defined.
 type Credentials struct {
 	username        string
@@ -28,6 +30,8 @@ type Credentials struct {
 	cname           types.PrincipalName
 	keytab          *keytab.Keytab
 	password        string
+	certificates    []*x509.Certificate
+	signer          crypto.Signer
 	attributes      map[string]interface{}
 	validUntil      time.Time
 	authenticated   bool
@@ -46,6 +50,7 @@ type marshalCredentials struct {
 	CName           types.PrincipalName `json:"-"`
 	Keytab          bool
 	Password        bool
+	Certificate     bool
 	Attributes      map[string]interface{} `json:"-"`
 	ValidUntil      time.Time
 	Authenticated   bool
@@ -89,6 +94,14 @@ func New(username string, realm string) *Credentials {
 	}
 }
 
+// NewAnonymous creates a new Credentials instance for the well-known anonymous principal, to obtain anonymous tickets
+// from the KDC of the realm with anonymous PKINIT.
+func NewAnonymous(realm string) *Credentials {
+	c := NewFromPrincipalName(types.NewAnonymousPrincipalName(), realm)
+	c.human = false
+	return c
+}
+
 // NewFromPrincipalName creates a new Credentials instance with the user details provides as a PrincipalName type.
 func NewFromPrincipalName(cname types.PrincipalName, realm string) *Credentials {
 	c := New(cname.PrincipalNameString(), realm)
@@ -136,6 +149,37 @@ func (c *Credentials) HasPassword() bool {
 	return false
 }
 
+// WithCertificate sets the certificate chain and private key in the Credentials struct for PKINIT.
+// The first certificate must be the user's, any others are intermediates to the KDC's trusted roots.
+func (c *Credentials) WithCertificate(certs []*x509.Certificate, signer crypto.Signer) *Credentials {
+	c.certificates = certs
+	c.signer = signer
+	return c
+}
+
+// Certificates returns the credential's certificate chain.
+func (c *Credentials) Certificates() []*x509.Certificate {
+	return c.certificates
+}
+
+// Signer returns the private key of the credential's certificate.
+func (c *Credentials) Signer() crypto.Signer {
+	return c.signer
+}
+
+// HasCertificate queries if the Credentials has a certificate and private key defined.
+func (c *Credentials) HasCertificate() bool {
+	if len(c.certificates) > 0 && c.signer != nil {
+		return true
+	}
+	return false
+}
+
+// Anonymous queries if the Credentials are for the anonymous principal.
+func (c *Credentials) Anonymous() bool {
+	return c.cname.IsAnonymous()
+}
+
 // SetValidUntil sets the expiry time of the credentials
 func (c *Credentials) SetValidUntil(t time.Time) {
 	c.validUntil = t
@@ -342,6 +386,7 @@ func (c *Credentials) Marshal() ([]byte, error) {
 		CName:           c.cname,
 		Keytab:          c.HasKeytab(),
 		Password:        c.HasPassword(),
+		Certificate:     c.HasCertificate(),
 		Attributes:      c.attributes,
 		ValidUntil:      c.validUntil,
 		Authenticated:   c.authenticated,
@@ -391,6 +436,7 @@ func (c *Credentials) JSON() (string, error) {
 		CName:         c.cname,
 		Keytab:        c.HasKeytab(),
 		Password:      c.HasPassword(),
+		Certificate:   c.HasCertificate(),
 		ValidUntil:    c.validUntil,
 		Authenticated: c.authenticated,
 		Human:         c.human,
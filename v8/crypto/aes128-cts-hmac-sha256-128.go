@@ -130,3 +130,8 @@ func (e Aes128CtsHmacSha256128) VerifyChecksum(protocolKey, data, chksum []byte,
 	}
 	return hmac.Equal(chksum, c)
 }
+
+// PseudoRandom returns the output of the etype's pseudo-random function (PRF) for the data provided.
+func (e Aes128CtsHmacSha256128) PseudoRandom(protocolKey, data []byte) ([]byte, error) {
+	return rfc8009.PseudoRandom(protocolKey, data, e), nil
+}
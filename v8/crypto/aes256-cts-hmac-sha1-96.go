@@ -127,3 +127,8 @@ func (e Aes256CtsHmacSha96) VerifyChecksum(protocolKey, data, chksum []byte, usa
 	}
 	return hmac.Equal(chksum, c)
 }
+
+// PseudoRandom returns the output of the etype's pseudo-random function (PRF) for the data provided.
+func (e Aes256CtsHmacSha96) PseudoRandom(protocolKey, data []byte) ([]byte, error) {
+	return rfc3962.PseudoRandom(protocolKey, data, e)
+}
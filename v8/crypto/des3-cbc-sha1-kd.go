@@ -137,3 +137,8 @@ func (e Des3CbcSha1Kd) VerifyChecksum(protocolKey, data, chksum []byte, usage ui
 	}
 	return hmac.Equal(chksum, c)
 }
+
+// PseudoRandom returns the output of the etype's pseudo-random function (PRF) for the data provided.
+func (e Des3CbcSha1Kd) PseudoRandom(protocolKey, data []byte) ([]byte, error) {
+	return rfc3961.DES3PseudoRandom(protocolKey, data, e)
+}
@@ -0,0 +1,76 @@
+package crypto
+
+import (
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// prfEType is implemented by the etypes that provide a pseudo-random function.
+type prfEType interface {
+	PseudoRandom(protocolKey, data []byte) ([]byte, error)
+}
+
+// PseudoRandom returns the output of the pseudo-random function (PRF) of the key's etype for the data provided.
+func PseudoRandom(key types.EncryptionKey, b []byte) ([]byte, error) {
+	et, err := GetEtype(key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := et.(prfEType)
+	if !ok {
+		return nil, fmt.Errorf("etype %d does not provide a pseudo-random function", key.KeyType)
+	}
+	return p.PseudoRandom(key.KeyValue, b)
+}
+
+// PRFPlus implements the PRF+ function defined in RFC 6113 section 5.1, returning l bytes of output:
+//
+// PRF+(protocol key, octet string) -> (octet string) = pseudo-random(key, 1 || shared-info ) || pseudo-random(key, 2 || shared-info ) || ...
+func PRFPlus(key types.EncryptionKey, b []byte, l int) ([]byte, error) {
+	var out []byte
+	for i := 1; len(out) < l; i++ {
+		if i > 255 {
+			return nil, fmt.Errorf("PRF+ output length of %d bytes is too large", l)
+		}
+		r, err := PseudoRandom(key, append([]byte{byte(i)}, b...))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r...)
+	}
+	return out[:l], nil
+}
+
+// KRBFXCF2 combines two keys as defined in RFC 6113 section 5.1.
+// The key returned is of the same etype as key1.
+//
+// KRB-FX-CF2(protocol key, protocol key, octet string, octet string) -> (protocol key)
+func KRBFXCF2(key1, key2 types.EncryptionKey, pepper1, pepper2 string) (types.EncryptionKey, error) {
+	var key types.EncryptionKey
+	et, err := GetEtype(key1.KeyType)
+	if err != nil {
+		return key, err
+	}
+	l := et.GetKeySeedBitLength() / 8
+	if et.GetETypeID() == etypeID.AES256_CTS_HMAC_SHA384_192 {
+		l = 32
+	}
+	r1, err := PRFPlus(key1, []byte(pepper1), l)
+	if err != nil {
+		return key, fmt.Errorf("error calculating PRF+ of key1: %v", err)
+	}
+	r2, err := PRFPlus(key2, []byte(pepper2), l)
+	if err != nil {
+		return key, fmt.Errorf("error calculating PRF+ of key2: %v", err)
+	}
+	for i := range r1 {
+		r1[i] ^= r2[i]
+	}
+	key = types.EncryptionKey{
+		KeyType:  key1.KeyType,
+		KeyValue: et.RandomToKey(r1),
+	}
+	return key, nil
+}
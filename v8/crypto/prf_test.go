@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPseudoRandom_RFC8009(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 8009 Appendix A
+	var tests = []struct {
+		etype int32
+		key   string
+		out   string
+	}{
+		{etypeID.AES128_CTS_HMAC_SHA256_128, "3705d96080c17728a0e800eab6e0d23c", "9d188616f63852fe86915bb840b4a886ff3e6bb0f819b49b893393d393854295"},
+		{etypeID.AES256_CTS_HMAC_SHA384_192, "6d404d37faf79f9df0d33568d320669800eb4836472ea8a026d16b7182460c52", "9801f69a368c2bf675e59521e177d9a07f67efe1cfde8d3c8d6f6a0256e3b17db3c1b62ad1b8553360d17367eb1514d2"},
+	}
+	for _, test := range tests {
+		kb, _ := hex.DecodeString(test.key)
+		key := types.EncryptionKey{KeyType: test.etype, KeyValue: kb}
+		b, err := PseudoRandom(key, []byte("test"))
+		if err != nil {
+			t.Fatalf("error calculating PRF for etype %d: %v", test.etype, err)
+		}
+		assert.Equal(t, test.out, hex.EncodeToString(b), "PRF output not as expected for etype %d", test.etype)
+	}
+}
+
+func TestKRBFXCF2(t *testing.T) {
+	t.Parallel()
+	// Test vectors from MIT krb5 lib/crypto/crypto_tests/t_cf2.expected
+	var tests = []struct {
+		etype int32
+		out   string
+	}{
+		{etypeID.AES128_CTS_HMAC_SHA1_96, "97df97e4b798b29eb31ed7280287a92a"},
+		{etypeID.AES256_CTS_HMAC_SHA1_96, "4d6ca4e629785c1f01baf55e2e548566b9617ae3a96868c337cb93b5e72b1c7b"},
+		{etypeID.DES3_CBC_SHA1_KD, "e58f9eb643862c13ad38e529313462a7f73e62834fe54a01"},
+	}
+	for _, test := range tests {
+		et, _ := GetEtype(test.etype)
+		k1, err := et.StringToKey("key1", "key1", et.GetDefaultStringToKeyParams())
+		if err != nil {
+			t.Fatalf("error generating key1: %v", err)
+		}
+		k2, err := et.StringToKey("key2", "key2", et.GetDefaultStringToKeyParams())
+		if err != nil {
+			t.Fatalf("error generating key2: %v", err)
+		}
+		key, err := KRBFXCF2(types.EncryptionKey{KeyType: test.etype, KeyValue: k1}, types.EncryptionKey{KeyType: test.etype, KeyValue: k2}, "a", "b")
+		if err != nil {
+			t.Fatalf("error calculating KRB-FX-CF2 for etype %d: %v", test.etype, err)
+		}
+		assert.Equal(t, test.etype, key.KeyType, "KRB-FX-CF2 key type not as expected")
+		assert.Equal(t, test.out, hex.EncodeToString(key.KeyValue), "KRB-FX-CF2 output not as expected for etype %d", test.etype)
+	}
+}
@@ -131,3 +131,8 @@ func (e RC4HMAC) VerifyChecksum(protocolKey, data, chksum []byte, usage uint32)
 	}
 	return hmac.Equal(checksum, chksum)
 }
+
+// PseudoRandom returns the output of the etype's pseudo-random function (PRF) for the data provided.
+func (e RC4HMAC) PseudoRandom(protocolKey, data []byte) ([]byte, error) {
+	return rfc4757.PseudoRandom(protocolKey, data), nil
+}
@@ -167,3 +167,23 @@ func weak(b []byte) bool {
 	}
 	return false
 }
+
+// DES3PseudoRandom implements the pseudo-random function (PRF) of the RFC 3961 simplified profile for DES3 etypes:
+// PRF = E(DK(protocol-key, prfconstant), truncate(H(octet-string)), initial-cipher-state)
+func DES3PseudoRandom(key, b []byte, e etype.EType) ([]byte, error) {
+	h := e.GetHashFunc()()
+	h.Write(b)
+	// Truncate the hash to a multiple of the message block size.
+	m := e.GetMessageBlockByteSize()
+	tmp := h.Sum(nil)
+	tmp = tmp[:(len(tmp)/m)*m]
+	k, err := e.DeriveKey(key, []byte(prfconstant))
+	if err != nil {
+		return []byte{}, err
+	}
+	_, prf, err := e.EncryptData(k, tmp)
+	if err != nil {
+		return []byte{}, err
+	}
+	return prf, nil
+}
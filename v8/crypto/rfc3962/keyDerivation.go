@@ -11,6 +11,7 @@ import (
 
 const (
 	s2kParamsZero = 4294967296
+	prfConstant   = "prf"
 )
 
 // StringToKey returns a key derived from the string provided according to the definition in RFC 3961.
@@ -49,3 +50,23 @@ func S2KparamsToItertions(s2kparams string) (int64, error) {
 	i = binary.BigEndian.Uint32(b)
 	return int64(i), nil
 }
+
+// PseudoRandom implements the pseudo-random function (PRF) defined in RFC 3962 section 6:
+// PRF = E(DK(protocol-key, prfconstant), truncate(SHA1(octet-string)), initial-cipher-state)
+func PseudoRandom(protocolKey, b []byte, e etype.EType) ([]byte, error) {
+	h := e.GetHashFunc()()
+	h.Write(b)
+	// Truncate the hash to a multiple of the cipher block size.
+	bs := e.GetCypherBlockBitLength() / 8
+	tmp := h.Sum(nil)
+	tmp = tmp[:(len(tmp)/bs)*bs]
+	k, err := e.DeriveKey(protocolKey, []byte(prfConstant))
+	if err != nil {
+		return nil, err
+	}
+	_, prf, err := e.EncryptData(k, tmp)
+	if err != nil {
+		return nil, err
+	}
+	return prf, nil
+}
@@ -0,0 +1,129 @@
+package rfc4556
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	stdasn1 "encoding/asn1"
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// KRB5PrincipalName is the Kerberos principal name within the id-pkinit-san otherName subject alternative name of a
+// certificate. RFC 4556 Section 3.2.2.
+type KRB5PrincipalName struct {
+	Realm         string              `asn1:"generalstring,explicit,tag:0"`
+	PrincipalName types.PrincipalName `asn1:"explicit,tag:1"`
+}
+
+// PrincipalNames returns the Kerberos principal names within the id-pkinit-san subject alternative names of the
+// certificate.
+func PrincipalNames(cert *x509.Certificate) ([]KRB5PrincipalName, error) {
+	var names []KRB5PrincipalName
+	for _, ext := range cert.Extensions {
+		if !asn1.ObjectIdentifier(ext.Id).Equal(oidExtensionSubjectAltName) {
+			continue
+		}
+		var seq asn1.RawValue
+		_, err := asn1.Unmarshal(ext.Value, &seq)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshaling subject alternative names: %v", err)
+		}
+		b := seq.Bytes
+		for len(b) > 0 {
+			var gn asn1.RawValue
+			b, err = asn1.Unmarshal(b, &gn)
+			if err != nil {
+				return nil, fmt.Errorf("error unmarshaling subject alternative name: %v", err)
+			}
+			// otherName [0] IMPLICIT SEQUENCE { type-id OID, value [0] EXPLICIT ANY }
+			if gn.Class != asn1.ClassContextSpecific || gn.Tag != 0 {
+				continue
+			}
+			var typeID asn1.ObjectIdentifier
+			rest, err := asn1.Unmarshal(gn.Bytes, &typeID)
+			if err != nil || !typeID.Equal(OIDPKINITSAN) {
+				continue
+			}
+			var v asn1.RawValue
+			_, err = asn1.Unmarshal(rest, &v)
+			if err != nil {
+				return nil, fmt.Errorf("error unmarshaling id-pkinit-san: %v", err)
+			}
+			var n KRB5PrincipalName
+			_, err = asn1.Unmarshal(v.Bytes, &n)
+			if err != nil {
+				return nil, fmt.Errorf("error unmarshaling id-pkinit-san: %v", err)
+			}
+			names = append(names, n)
+		}
+	}
+	return names, nil
+}
+
+// PrincipalNameExtension returns a subject alternative name certificate extension holding the id-pkinit-san for the
+// Kerberos principal names provided, for use in x509.Certificate ExtraExtensions.
+func PrincipalNameExtension(names ...KRB5PrincipalName) (pkix.Extension, error) {
+	var b []byte
+	for _, n := range names {
+		nb, err := asn1.Marshal(n)
+		if err != nil {
+			return pkix.Extension{}, fmt.Errorf("error marshaling id-pkinit-san: %v", err)
+		}
+		oid, _ := asn1.Marshal(OIDPKINITSAN)
+		v, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: nb})
+		if err != nil {
+			return pkix.Extension{}, fmt.Errorf("error marshaling id-pkinit-san: %v", err)
+		}
+		gn, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: append(oid, v...)})
+		if err != nil {
+			return pkix.Extension{}, fmt.Errorf("error marshaling id-pkinit-san: %v", err)
+		}
+		b = append(b, gn...)
+	}
+	v, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: b})
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("error marshaling subject alternative names: %v", err)
+	}
+	return pkix.Extension{Id: stdasn1.ObjectIdentifier(oidExtensionSubjectAltName), Value: v}, nil
+}
+
+// VerifyKDCCertificate checks the KDC's certificate is for a KDC of the realm. RFC 4556 Section 3.2.4.
+// The certificate must have the id-pkinit-KPKdc extended key usage and an id-pkinit-san subject alternative name of the
+// TGS principal of the realm, krbtgt/REALM@REALM. If requirePrincipal is false a certificate without any id-pkinit-san
+// is accepted on its extended key usage alone, in which case any KDC certificate issued by the trusted roots is
+// accepted for every realm. The certificate chain is not verified.
+func VerifyKDCCertificate(cert *x509.Certificate, realm string, requirePrincipal bool) error {
+	var kpKdc bool
+	for _, eku := range cert.UnknownExtKeyUsage {
+		if asn1.ObjectIdentifier(eku).Equal(OIDPKINITKPKdc) {
+			kpKdc = true
+			break
+		}
+	}
+	if !kpKdc {
+		return errors.New("KDC certificate does not have the id-pkinit-KPKdc extended key usage")
+	}
+	names, err := PrincipalNames(cert)
+	if err != nil {
+		return err
+	}
+	if len(names) < 1 {
+		if requirePrincipal {
+			return fmt.Errorf("KDC certificate does not have the id-pkinit-san of the KDC of realm %s", realm)
+		}
+		return nil
+	}
+	tgs := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+realm)
+	for _, n := range names {
+		if n.Realm == realm && n.PrincipalName.Equal(tgs) {
+			return nil
+		}
+	}
+	return fmt.Errorf("KDC certificate is not for the KDC of realm %s", realm)
+}
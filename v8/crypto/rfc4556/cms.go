@@ -0,0 +1,472 @@
+// Package rfc4556 provides the cryptography of public key cryptography for initial authentication in Kerberos (PKINIT),
+// as defined in RFC 4556, including the CMS SignedData (RFC 5652) profile it uses.
+package rfc4556
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// Object identifiers used by PKINIT.
+var (
+	OIDSignedData         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	OIDPKINITAuthData     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 1}
+	OIDPKINITDHKeyData    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 2}
+	OIDPKINITRKeyData     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 3}
+	OIDPKINITKPClientAuth = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 4}
+	OIDPKINITKPKdc        = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 5}
+	OIDPKINITSAN          = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 2}
+
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSAWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+// AlgorithmIdentifier as defined in RFC 5280.
+type AlgorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+// contentInfo implements RFC 5652 ContentInfo. The content is the [0] EXPLICIT tagged value.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// encapsulatedContentInfo implements RFC 5652 EncapsulatedContentInfo.
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+// signedData implements RFC 5652 SignedData. The digest algorithms and signer infos are SET OF values.
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     []asn1.RawValue `asn1:"optional,set,tag:0"`
+	CRLs             []asn1.RawValue `asn1:"optional,set,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// signerInfo implements RFC 5652 SignerInfo. Signed attributes are mandatory in PKINIT as the content type is not id-data.
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm AlgorithmIdentifier
+	Signature          []byte
+}
+
+// issuerAndSerialNumber implements RFC 5652 IssuerAndSerialNumber.
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// attribute implements RFC 5652 Attribute. The values are a SET OF values.
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// SignedData holds the content and certificates of a parsed CMS SignedData.
+type SignedData struct {
+	ContentType  asn1.ObjectIdentifier
+	Content      []byte
+	Certificates []*x509.Certificate
+	signerInfos  []signerInfo
+}
+
+// NewSignedData returns the DER encoding of a CMS ContentInfo holding SignedData with the content signed by the signer.
+// The first certificate must be that of the signer. All the certificates provided are included in the SignedData.
+// The content is digested with SHA-256.
+func NewSignedData(contentType asn1.ObjectIdentifier, content []byte, certs []*x509.Certificate, signer crypto.Signer) ([]byte, error) {
+	if len(certs) < 1 || signer == nil {
+		return nil, errors.New("a certificate and signer are required to create signed data")
+	}
+	var sigAlg asn1.ObjectIdentifier
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg = oidSHA256WithRSA
+	case *ecdsa.PublicKey:
+		sigAlg = oidECDSAWithSHA256
+	default:
+		return nil, fmt.Errorf("signer key type %T not supported", signer.Public())
+	}
+	digest := crypto.SHA256.New()
+	digest.Write(content)
+	attrs, err := marshalSignedAttributes(contentType, digest.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	sb, err := signedAttributesSet(attrs)
+	if err != nil {
+		return nil, err
+	}
+	h := crypto.SHA256.New()
+	h.Write(sb)
+	sig, err := signer.Sign(rand.Reader, h.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("error signing data: %v", err)
+	}
+	sid, err := asn1.Marshal(issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: certs[0].RawIssuer},
+		SerialNumber: certs[0].SerialNumber,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling signer identifier: %v", err)
+	}
+	das, err := setOf(AlgorithmIdentifier{Algorithm: oidSHA256})
+	if err != nil {
+		return nil, err
+	}
+	sis, err := setOf(signerInfo{
+		Version:            1,
+		SID:                asn1.RawValue{FullBytes: sid},
+		DigestAlgorithm:    AlgorithmIdentifier{Algorithm: oidSHA256},
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+		SignatureAlgorithm: AlgorithmIdentifier{Algorithm: sigAlg},
+		Signature:          sig,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: das,
+		EncapContentInfo: encapsulatedContentInfo{
+			EContentType: contentType,
+			EContent:     content,
+		},
+		SignerInfos: sis,
+	}
+	for _, c := range certs {
+		sd.Certificates = append(sd.Certificates, asn1.RawValue{FullBytes: c.Raw})
+	}
+	return marshalContentInfo(sd)
+}
+
+// NewUnsignedData returns the DER encoding of a CMS ContentInfo holding SignedData with the content but without any
+// signers or certificates, as used by an anonymous PKINIT client. RFC 8062 Section 4.1.
+func NewUnsignedData(contentType asn1.ObjectIdentifier, content []byte) ([]byte, error) {
+	das, err := setOf()
+	if err != nil {
+		return nil, err
+	}
+	sis, err := setOf()
+	if err != nil {
+		return nil, err
+	}
+	return marshalContentInfo(signedData{
+		Version:          3,
+		DigestAlgorithms: das,
+		EncapContentInfo: encapsulatedContentInfo{
+			EContentType: contentType,
+			EContent:     content,
+		},
+		SignerInfos: sis,
+	})
+}
+
+// setOf returns a SET OF the elements provided. The elements are expected to be of a single type whose encodings,
+// except for a single element, are already in the order required by DER.
+func setOf(elements ...interface{}) (asn1.RawValue, error) {
+	var b []byte
+	for _, e := range elements {
+		eb, err := asn1.Marshal(e)
+		if err != nil {
+			return asn1.RawValue{}, fmt.Errorf("error marshaling set element: %v", err)
+		}
+		b = append(b, eb...)
+	}
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: b}, nil
+}
+
+// marshalContentInfo returns the DER encoding of a ContentInfo holding the SignedData.
+func marshalContentInfo(sd signedData) ([]byte, error) {
+	b, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling signed data: %v", err)
+	}
+	b, err = asn1.Marshal(contentInfo{
+		ContentType: OIDSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling content info: %v", err)
+	}
+	return b, nil
+}
+
+// marshalSignedAttributes returns the DER encoded content type and message digest attributes in the order required for
+// the SET OF signed attributes.
+func marshalSignedAttributes(contentType asn1.ObjectIdentifier, digest []byte) ([]byte, error) {
+	ct, err := setOf(contentType)
+	if err != nil {
+		return nil, err
+	}
+	md, err := setOf(digest)
+	if err != nil {
+		return nil, err
+	}
+	var encoded [][]byte
+	for _, a := range []attribute{
+		{Type: oidAttributeContentType, Values: ct},
+		{Type: oidAttributeMessageDigest, Values: md},
+	} {
+		b, err := asn1.Marshal(a)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling signed attribute: %v", err)
+		}
+		encoded = append(encoded, b)
+	}
+	// DER requires the elements of a SET OF to be in ascending order of their encodings
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	return bytes.Join(encoded, nil), nil
+}
+
+// signedAttributesSet returns the DER encoding of the signed attributes with the SET OF tag rather than the implicit
+// tag used within the signer info. This is the encoding over which the signature is calculated.
+func signedAttributesSet(attrs []byte) ([]byte, error) {
+	b, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling signed attributes: %v", err)
+	}
+	return b, nil
+}
+
+// ParseSignedData parses the DER encoding of a CMS ContentInfo holding SignedData.
+// The signature is not verified, use Verify to do so.
+func ParseSignedData(b []byte) (*SignedData, error) {
+	var ci contentInfo
+	_, err := asn1.Unmarshal(b, &ci)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling content info: %v", err)
+	}
+	if !ci.ContentType.Equal(OIDSignedData) {
+		return nil, fmt.Errorf("content type %v is not signed data", ci.ContentType)
+	}
+	if ci.Content.Class != asn1.ClassContextSpecific || ci.Content.Tag != 0 {
+		return nil, errors.New("content info does not hold explicitly tagged content")
+	}
+	var sd signedData
+	_, err = asn1.Unmarshal(ci.Content.Bytes, &sd)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling signed data: %v", err)
+	}
+	s := &SignedData{
+		ContentType: sd.EncapContentInfo.EContentType,
+		Content:     sd.EncapContentInfo.EContent,
+	}
+	b = sd.SignerInfos.Bytes
+	for len(b) > 0 {
+		var si signerInfo
+		b, err = asn1.Unmarshal(b, &si)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshaling signer info: %v", err)
+		}
+		s.signerInfos = append(s.signerInfos, si)
+	}
+	for _, c := range sd.Certificates {
+		cert, err := x509.ParseCertificate(c.FullBytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate in signed data: %v", err)
+		}
+		s.Certificates = append(s.Certificates, cert)
+	}
+	return s, nil
+}
+
+// Signed indicates if the SignedData has any signers.
+func (s *SignedData) Signed() bool {
+	return len(s.signerInfos) > 0
+}
+
+// Verify the signature of the SignedData and that the signer's certificate, which must be included in the SignedData,
+// chains to a root in the verify options. Other certificates in the SignedData are used as intermediates.
+// The signer's certificate is returned.
+func (s *SignedData) Verify(opts x509.VerifyOptions) (*x509.Certificate, error) {
+	if !s.Signed() {
+		return nil, errors.New("signed data has no signer")
+	}
+	si := s.signerInfos[0]
+	cert, err := s.signerCertificate(si.SID)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := digestAlgorithm(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if si.SignedAttrs.Class != asn1.ClassContextSpecific || si.SignedAttrs.Tag != 0 {
+		return nil, errors.New("signer info does not have signed attributes")
+	}
+	err = s.verifySignedAttributes(si.SignedAttrs.Bytes, hash)
+	if err != nil {
+		return nil, err
+	}
+	alg, err := signatureAlgorithm(si.SignatureAlgorithm.Algorithm, hash)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := signedAttributesSet(si.SignedAttrs.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	err = cert.CheckSignature(alg, attrs, si.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("signature of signed data is not valid: %v", err)
+	}
+	if opts.Intermediates == nil {
+		opts.Intermediates = x509.NewCertPool()
+	}
+	for _, c := range s.Certificates {
+		if c != cert {
+			opts.Intermediates.AddCert(c)
+		}
+	}
+	if len(opts.KeyUsages) == 0 {
+		// PKINIT extended key usages are checked by the caller
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	_, err = cert.Verify(opts)
+	if err != nil {
+		return nil, fmt.Errorf("signer certificate is not trusted: %v", err)
+	}
+	return cert, nil
+}
+
+// signerCertificate returns the certificate identified by the signer identifier.
+func (s *SignedData) signerCertificate(sid asn1.RawValue) (*x509.Certificate, error) {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		// subjectKeyIdentifier
+		for _, c := range s.Certificates {
+			if bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c, nil
+			}
+		}
+		return nil, errors.New("signer certificate not found in signed data")
+	}
+	var ias issuerAndSerialNumber
+	_, err := asn1.Unmarshal(sid.FullBytes, &ias)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling signer identifier: %v", err)
+	}
+	for _, c := range s.Certificates {
+		if bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) && c.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+			return c, nil
+		}
+	}
+	return nil, errors.New("signer certificate not found in signed data")
+}
+
+// verifySignedAttributes checks the content type and message digest signed attributes match the content.
+func (s *SignedData) verifySignedAttributes(b []byte, hash crypto.Hash) error {
+	var ct, md bool
+	for len(b) > 0 {
+		var a attribute
+		var err error
+		b, err = asn1.Unmarshal(b, &a)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling signed attribute: %v", err)
+		}
+		switch {
+		case a.Type.Equal(oidAttributeContentType):
+			var oid asn1.ObjectIdentifier
+			_, err = asn1.Unmarshal(a.Values.Bytes, &oid)
+			if err != nil || !oid.Equal(s.ContentType) {
+				return errors.New("content type signed attribute does not match the content")
+			}
+			ct = true
+		case a.Type.Equal(oidAttributeMessageDigest):
+			var d []byte
+			_, err = asn1.Unmarshal(a.Values.Bytes, &d)
+			h := hash.New()
+			h.Write(s.Content)
+			if err != nil || !bytes.Equal(d, h.Sum(nil)) {
+				return errors.New("message digest signed attribute does not match the content")
+			}
+			md = true
+		}
+	}
+	if !ct || !md {
+		return errors.New("content type or message digest signed attribute missing")
+	}
+	return nil
+}
+
+// digestAlgorithm returns the hash for the digest algorithm OID.
+func digestAlgorithm(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("digest algorithm %v not supported", oid)
+}
+
+// signatureAlgorithm returns the x509 signature algorithm for the signature algorithm OID and digest.
+func signatureAlgorithm(oid asn1.ObjectIdentifier, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	switch {
+	case oid.Equal(oidRSAEncryption):
+		switch hash {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case oid.Equal(oidSHA1WithRSA):
+		return x509.SHA1WithRSA, nil
+	case oid.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, nil
+	case oid.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, nil
+	case oid.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, nil
+	case oid.Equal(oidECDSAWithSHA1):
+		return x509.ECDSAWithSHA1, nil
+	case oid.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, nil
+	case oid.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, nil
+	case oid.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("signature algorithm %v not supported", oid)
+}
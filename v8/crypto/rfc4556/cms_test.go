@@ -0,0 +1,137 @@
+package rfc4556
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	stdasn1 "encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCertificate creates a certificate signed by the parent, or self-signed if the parent is nil.
+func testCertificate(t *testing.T, cn string, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer, ca bool, ekus []stdasn1.ObjectIdentifier, exts ...pkix.Extension) *x509.Certificate {
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+		UnknownExtKeyUsage:    ekus,
+		ExtraExtensions:       exts,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	return cert
+}
+
+func TestSignedData(t *testing.T) {
+	t.Parallel()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := testCertificate(t, "CA", caKey, nil, nil, true, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	for _, key := range []crypto.Signer{rsaKey, ecKey} {
+		cert := testCertificate(t, "signer", key, ca, caKey, false, nil)
+		b, err := NewSignedData(OIDPKINITAuthData, []byte("content"), []*x509.Certificate{cert}, key)
+		if err != nil {
+			t.Fatalf("error creating signed data: %v", err)
+		}
+		sd, err := ParseSignedData(b)
+		if err != nil {
+			t.Fatalf("error parsing signed data: %v", err)
+		}
+		assert.True(t, sd.ContentType.Equal(OIDPKINITAuthData), "content type not as expected")
+		assert.Equal(t, []byte("content"), sd.Content, "content not as expected")
+		assert.True(t, sd.Signed(), "signed data should be signed")
+		signer, err := sd.Verify(x509.VerifyOptions{Roots: roots})
+		if err != nil {
+			t.Fatalf("signed data not verified: %v", err)
+		}
+		assert.Equal(t, cert.Raw, signer.Raw, "signer certificate not as expected")
+
+		_, err = sd.Verify(x509.VerifyOptions{Roots: x509.NewCertPool()})
+		assert.Error(t, err, "signer should not be trusted without the CA")
+
+		sd.Content = []byte("modified")
+		_, err = sd.Verify(x509.VerifyOptions{Roots: roots})
+		assert.Error(t, err, "signed data should not verify with modified content")
+	}
+}
+
+func TestUnsignedData(t *testing.T) {
+	t.Parallel()
+	b, err := NewUnsignedData(OIDPKINITAuthData, []byte("content"))
+	if err != nil {
+		t.Fatalf("error creating unsigned data: %v", err)
+	}
+	sd, err := ParseSignedData(b)
+	if err != nil {
+		t.Fatalf("error parsing unsigned data: %v", err)
+	}
+	assert.False(t, sd.Signed(), "unsigned data should not have a signer")
+	assert.True(t, sd.ContentType.Equal(OIDPKINITAuthData), "content type not as expected")
+	assert.Equal(t, []byte("content"), sd.Content, "content not as expected")
+	assert.Empty(t, sd.Certificates, "unsigned data should not have certificates")
+	_, err = sd.Verify(x509.VerifyOptions{})
+	assert.Error(t, err, "verifying unsigned data should error")
+}
+
+func TestVerifyKDCCertificate(t *testing.T) {
+	t.Parallel()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	san, err := PrincipalNameExtension(KRB5PrincipalName{
+		Realm:         "TEST.GOKRB5",
+		PrincipalName: types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+	})
+	if err != nil {
+		t.Fatalf("error creating id-pkinit-san extension: %v", err)
+	}
+	kpKdc := []stdasn1.ObjectIdentifier{stdasn1.ObjectIdentifier(OIDPKINITKPKdc)}
+
+	cert := testCertificate(t, "kdc", key, nil, nil, false, kpKdc, san)
+	names, err := PrincipalNames(cert)
+	if err != nil {
+		t.Fatalf("error getting principal names: %v", err)
+	}
+	if assert.Len(t, names, 1, "number of principal names not as expected") {
+		assert.Equal(t, "TEST.GOKRB5", names[0].Realm, "realm not as expected")
+		assert.Equal(t, "krbtgt/TEST.GOKRB5", names[0].PrincipalName.PrincipalNameString(), "principal name not as expected")
+	}
+	assert.NoError(t, VerifyKDCCertificate(cert, "TEST.GOKRB5", true))
+	assert.Error(t, VerifyKDCCertificate(cert, "OTHER.GOKRB5", true), "certificate should not be valid for another realm")
+	assert.Error(t, VerifyKDCCertificate(cert, "OTHER.GOKRB5", false),
+		"certificate should not be valid for another realm when the principal is not required")
+	noSAN := testCertificate(t, "kdc", key, nil, nil, false, kpKdc)
+	assert.Error(t, VerifyKDCCertificate(noSAN, "TEST.GOKRB5", true), "certificate without id-pkinit-san should not be valid")
+	assert.NoError(t, VerifyKDCCertificate(noSAN, "TEST.GOKRB5", false),
+		"certificate without id-pkinit-san should be valid when the principal is not required")
+	assert.Error(t, VerifyKDCCertificate(testCertificate(t, "kdc", key, nil, nil, false, nil, san), "TEST.GOKRB5", true),
+		"certificate without id-pkinit-KPKdc should not be valid")
+}
@@ -0,0 +1,262 @@
+package rfc4556
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+var (
+	oidDHPublicNumber = asn1.ObjectIdentifier{1, 2, 840, 10046, 2, 1}
+	oidECPublicKey    = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidCurveP256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidCurveP384      = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidCurveP521      = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+)
+
+// Group identifies the Diffie-Hellman group or elliptic curve used for PKINIT key agreement.
+type Group int
+
+// Groups supported for key agreement. Diffie-Hellman uses the MODP groups of RFC 3526 and elliptic curve
+// Diffie-Hellman the NIST curves of RFC 5349.
+const (
+	MODP2048 Group = iota
+	MODP4096
+	P256
+	P384
+	P521
+)
+
+// RFC 3526 MODP group primes. The generator for both is 2.
+const (
+	modp2048Prime = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+		"83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+		"15728E5A8AACAA68FFFFFFFFFFFFFFFF"
+	modp4096Prime = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+		"83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+		"15728E5A8AAAC42DAD33170D04507A33A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7" +
+		"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864D87602733EC86A64521F2B18177B200C" +
+		"BBE117577A615D6C770988C0BAD946E208E24FA074E5AB3143DB5BFCE0FD108E4B82D120A92108011A723C12A787E6D7" +
+		"88719A10BDBA5B2699C327186AF4E23C1A946834B6150BDA2583E9CA2AD44CE8DBBBC2DB04DE8EF92E8EFC141FBECAA6" +
+		"287C59474E6BC05D99B2964FA090C3A2233BA186515BE7ED1F612970CEE2D7AFB81BDD762170481CD0069127D5B05AA9" +
+		"93B4EA988D8FDDC186FFB7DC90A6C08F4DF435C934063199FFFFFFFFFFFFFFFF"
+)
+
+// SubjectPublicKeyInfo as defined in RFC 5280. It carries the client's public key and key agreement parameters.
+type SubjectPublicKeyInfo struct {
+	Algorithm        AlgorithmIdentifier
+	SubjectPublicKey asn1.BitString
+}
+
+// domainParameters implements the Diffie-Hellman DomainParameters of RFC 3279.
+type domainParameters struct {
+	P *big.Int
+	G *big.Int
+	Q *big.Int
+}
+
+// KeyAgreement holds an ephemeral key for PKINIT Diffie-Hellman or elliptic curve Diffie-Hellman key agreement.
+type KeyAgreement interface {
+	// PublicKeyInfo returns the public key and key agreement parameters, as sent in the client's clientPublicValue.
+	PublicKeyInfo() (SubjectPublicKeyInfo, error)
+	// PublicKey returns the encoded public key, as sent in the subjectPublicKey of the KDC's KDCDHKeyInfo.
+	PublicKey() []byte
+	// SharedSecret returns the shared secret from the peer's encoded public key.
+	SharedSecret(peerPublicKey []byte) ([]byte, error)
+}
+
+// NewKeyAgreement generates an ephemeral key for key agreement in the group specified.
+func NewKeyAgreement(g Group) (KeyAgreement, error) {
+	switch g {
+	case MODP2048:
+		return newDHKeyAgreement(modpParameters(modp2048Prime))
+	case MODP4096:
+		return newDHKeyAgreement(modpParameters(modp4096Prime))
+	case P256:
+		return newECDHKeyAgreement(elliptic.P256())
+	case P384:
+		return newECDHKeyAgreement(elliptic.P384())
+	case P521:
+		return newECDHKeyAgreement(elliptic.P521())
+	}
+	return nil, fmt.Errorf("key agreement group %d not supported", g)
+}
+
+// NewKeyAgreementFromPublicKeyInfo generates an ephemeral key using the same group as the public key information
+// provided by a peer, such as the clientPublicValue received by a KDC. The peer's encoded public key is also returned.
+func NewKeyAgreementFromPublicKeyInfo(spki SubjectPublicKeyInfo) (KeyAgreement, []byte, error) {
+	switch {
+	case spki.Algorithm.Algorithm.Equal(oidDHPublicNumber):
+		var params domainParameters
+		_, err := asn1.Unmarshal(spki.Algorithm.Parameters.FullBytes, &params)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error unmarshaling Diffie-Hellman domain parameters: %v", err)
+		}
+		for _, p := range []string{modp2048Prime, modp4096Prime} {
+			known := modpParameters(p)
+			if params.P != nil && params.G != nil && known.P.Cmp(params.P) == 0 && known.G.Cmp(params.G) == 0 {
+				ka, err := newDHKeyAgreement(known)
+				return ka, spki.SubjectPublicKey.Bytes, err
+			}
+		}
+		return nil, nil, errors.New("Diffie-Hellman group not supported")
+	case spki.Algorithm.Algorithm.Equal(oidECPublicKey):
+		var curve asn1.ObjectIdentifier
+		_, err := asn1.Unmarshal(spki.Algorithm.Parameters.FullBytes, &curve)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error unmarshaling elliptic curve parameters: %v", err)
+		}
+		var c elliptic.Curve
+		switch {
+		case curve.Equal(oidCurveP256):
+			c = elliptic.P256()
+		case curve.Equal(oidCurveP384):
+			c = elliptic.P384()
+		case curve.Equal(oidCurveP521):
+			c = elliptic.P521()
+		default:
+			return nil, nil, fmt.Errorf("elliptic curve %v not supported", curve)
+		}
+		ka, err := newECDHKeyAgreement(c)
+		return ka, spki.SubjectPublicKey.Bytes, err
+	}
+	return nil, nil, fmt.Errorf("key agreement algorithm %v not supported", spki.Algorithm.Algorithm)
+}
+
+// modpParameters returns the domain parameters of the MODP group with the prime provided.
+func modpParameters(prime string) domainParameters {
+	p, _ := new(big.Int).SetString(prime, 16)
+	// The MODP primes are safe primes so q = (p-1)/2
+	q := new(big.Int).Rsh(p, 1)
+	return domainParameters{P: p, G: big.NewInt(2), Q: q}
+}
+
+// dhKeyAgreement is Diffie-Hellman key agreement in a MODP group.
+type dhKeyAgreement struct {
+	params domainParameters
+	x      *big.Int
+	y      *big.Int
+}
+
+func newDHKeyAgreement(params domainParameters) (*dhKeyAgreement, error) {
+	// The private exponent is taken from [2, q-1]
+	x, err := rand.Int(rand.Reader, new(big.Int).Sub(params.Q, big.NewInt(2)))
+	if err != nil {
+		return nil, fmt.Errorf("error generating Diffie-Hellman private key: %v", err)
+	}
+	x.Add(x, big.NewInt(2))
+	return &dhKeyAgreement{
+		params: params,
+		x:      x,
+		y:      new(big.Int).Exp(params.G, x, params.P),
+	}, nil
+}
+
+// PublicKeyInfo returns the Diffie-Hellman public key and domain parameters.
+func (k *dhKeyAgreement) PublicKeyInfo() (SubjectPublicKeyInfo, error) {
+	params, err := asn1.Marshal(k.params)
+	if err != nil {
+		return SubjectPublicKeyInfo{}, fmt.Errorf("error marshaling Diffie-Hellman domain parameters: %v", err)
+	}
+	return SubjectPublicKeyInfo{
+		Algorithm: AlgorithmIdentifier{
+			Algorithm:  oidDHPublicNumber,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		SubjectPublicKey: asn1.BitString{Bytes: k.PublicKey(), BitLength: len(k.PublicKey()) * 8},
+	}, nil
+}
+
+// PublicKey returns the Diffie-Hellman public key encoded as an ASN.1 INTEGER.
+func (k *dhKeyAgreement) PublicKey() []byte {
+	b, _ := asn1.Marshal(k.y)
+	return b
+}
+
+// SharedSecret returns the Diffie-Hellman shared secret padded to the size of the prime.
+func (k *dhKeyAgreement) SharedSecret(peerPublicKey []byte) ([]byte, error) {
+	y := new(big.Int)
+	_, err := asn1.Unmarshal(peerPublicKey, &y)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling Diffie-Hellman public key: %v", err)
+	}
+	if y.Cmp(big.NewInt(1)) <= 0 || y.Cmp(new(big.Int).Sub(k.params.P, big.NewInt(1))) >= 0 {
+		return nil, errors.New("Diffie-Hellman public key not valid")
+	}
+	z := new(big.Int).Exp(y, k.x, k.params.P)
+	return padLeft(z.Bytes(), (k.params.P.BitLen()+7)/8), nil
+}
+
+// ecdhKeyAgreement is elliptic curve Diffie-Hellman key agreement as defined in RFC 5349.
+type ecdhKeyAgreement struct {
+	curve elliptic.Curve
+	d     []byte
+	x, y  *big.Int
+}
+
+func newECDHKeyAgreement(c elliptic.Curve) (*ecdhKeyAgreement, error) {
+	d, x, y, err := elliptic.GenerateKey(c, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating elliptic curve private key: %v", err)
+	}
+	return &ecdhKeyAgreement{curve: c, d: d, x: x, y: y}, nil
+}
+
+// PublicKeyInfo returns the elliptic curve public key and named curve.
+func (k *ecdhKeyAgreement) PublicKeyInfo() (SubjectPublicKeyInfo, error) {
+	var curve asn1.ObjectIdentifier
+	switch k.curve {
+	case elliptic.P256():
+		curve = oidCurveP256
+	case elliptic.P384():
+		curve = oidCurveP384
+	case elliptic.P521():
+		curve = oidCurveP521
+	}
+	params, err := asn1.Marshal(curve)
+	if err != nil {
+		return SubjectPublicKeyInfo{}, fmt.Errorf("error marshaling elliptic curve parameters: %v", err)
+	}
+	return SubjectPublicKeyInfo{
+		Algorithm: AlgorithmIdentifier{
+			Algorithm:  oidECPublicKey,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		SubjectPublicKey: asn1.BitString{Bytes: k.PublicKey(), BitLength: len(k.PublicKey()) * 8},
+	}, nil
+}
+
+// PublicKey returns the elliptic curve public key as an uncompressed point.
+func (k *ecdhKeyAgreement) PublicKey() []byte {
+	return elliptic.Marshal(k.curve, k.x, k.y)
+}
+
+// SharedSecret returns the x-coordinate of the shared point, as specified by RFC 5349.
+func (k *ecdhKeyAgreement) SharedSecret(peerPublicKey []byte) ([]byte, error) {
+	x, y := elliptic.Unmarshal(k.curve, peerPublicKey)
+	if x == nil {
+		return nil, errors.New("elliptic curve public key not valid")
+	}
+	z, _ := k.curve.ScalarMult(x, y, k.d)
+	return padLeft(z.Bytes(), (k.curve.Params().BitSize+7)/8), nil
+}
+
+// padLeft pads the bytes with leading zeros to the length provided.
+func padLeft(b []byte, l int) []byte {
+	if len(b) >= l {
+		return b
+	}
+	p := make([]byte, l)
+	copy(p[l-len(b):], b)
+	return p
+}
@@ -0,0 +1,49 @@
+package rfc4556
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyAgreement(t *testing.T) {
+	t.Parallel()
+	for _, g := range []Group{MODP2048, MODP4096, P256, P384, P521} {
+		client, err := NewKeyAgreement(g)
+		if err != nil {
+			t.Fatalf("error creating key agreement for group %d: %v", g, err)
+		}
+		spki, err := client.PublicKeyInfo()
+		if err != nil {
+			t.Fatalf("error getting public key info for group %d: %v", g, err)
+		}
+		kdc, clientPublicKey, err := NewKeyAgreementFromPublicKeyInfo(spki)
+		if err != nil {
+			t.Fatalf("error creating key agreement from public key info for group %d: %v", g, err)
+		}
+		kdcSecret, err := kdc.SharedSecret(clientPublicKey)
+		if err != nil {
+			t.Fatalf("error getting KDC shared secret for group %d: %v", g, err)
+		}
+		clientSecret, err := client.SharedSecret(kdc.PublicKey())
+		if err != nil {
+			t.Fatalf("error getting client shared secret for group %d: %v", g, err)
+		}
+		assert.Equal(t, clientSecret, kdcSecret, "shared secrets do not match for group %d", g)
+		assert.NotEqual(t, make([]byte, len(clientSecret)), clientSecret, "shared secret should not be zero")
+	}
+}
+
+func TestKeyAgreement_InvalidPublicKey(t *testing.T) {
+	t.Parallel()
+	for _, g := range []Group{MODP2048, P256} {
+		ka, err := NewKeyAgreement(g)
+		if err != nil {
+			t.Fatalf("error creating key agreement for group %d: %v", g, err)
+		}
+		_, err = ka.SharedSecret([]byte{0x02, 0x01, 0x01})
+		assert.Error(t, err, "public key should not be valid for group %d", g)
+	}
+	_, err := NewKeyAgreement(Group(99))
+	assert.Error(t, err, "unknown group should not be supported")
+}
@@ -0,0 +1,33 @@
+package rfc4556
+
+import (
+	"crypto/sha1"
+
+	"github.com/jcmturner/gokrb5/v8/crypto/etype"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// OctetString2Key derives the AS reply key from the key agreement shared secret and the client's and KDC's DH nonces,
+// which may be nil, for the encryption type provided. RFC 4556 Section 3.2.3.1:
+//
+// octetstring2key(x) == random-to-key(K-truncate(SHA1(0x00 | x) | SHA1(0x01 | x) | SHA1(0x02 | x) | ...))
+//
+// where x is the shared secret concatenated with the client's DH nonce and then the KDC's DH nonce.
+func OctetString2Key(e etype.EType, secret, clientNonce, serverNonce []byte) types.EncryptionKey {
+	x := make([]byte, 0, len(secret)+len(clientNonce)+len(serverNonce))
+	x = append(x, secret...)
+	x = append(x, clientNonce...)
+	x = append(x, serverNonce...)
+	l := e.GetKeySeedBitLength() / 8
+	var k []byte
+	for i := 0; len(k) < l; i++ {
+		h := sha1.New()
+		h.Write([]byte{byte(i)})
+		h.Write(x)
+		k = h.Sum(k)
+	}
+	return types.EncryptionKey{
+		KeyType:  e.GetETypeID(),
+		KeyValue: e.RandomToKey(k[:l]),
+	}
+}
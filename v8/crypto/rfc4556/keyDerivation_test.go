@@ -0,0 +1,36 @@
+package rfc4556
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOctetString2Key(t *testing.T) {
+	t.Parallel()
+	secret := make([]byte, 64)
+	for i := range secret {
+		secret[i] = byte(i)
+	}
+	var tests = []struct {
+		etype       int32
+		clientNonce []byte
+		serverNonce []byte
+		key         string
+	}{
+		{etypeID.AES256_CTS_HMAC_SHA1_96, []byte("client"), []byte("server"), "5d94415d83155ddfa973bf74071cf2764f21c69a06a7862ba3d9e6f6b1dc18a7"},
+		{etypeID.AES128_CTS_HMAC_SHA1_96, nil, nil, "322bd22cf094ad8240eb9ffdae847d26"},
+	}
+	for _, test := range tests {
+		et, err := crypto.GetEtype(test.etype)
+		if err != nil {
+			t.Fatalf("error getting etype: %v", err)
+		}
+		k := OctetString2Key(et, secret, test.clientNonce, test.serverNonce)
+		assert.Equal(t, test.etype, k.KeyType, "key type not as expected")
+		assert.Equal(t, test.key, hex.EncodeToString(k.KeyValue), "key not as expected for etype %d", test.etype)
+	}
+}
@@ -2,6 +2,8 @@ package rfc4757
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -38,3 +40,11 @@ func deriveKeys(key, checksum []byte, usage uint32, export bool) (k1, k2, k3 []b
 	k3 = HMAC(k2, checksum)
 	return
 }
+
+// PseudoRandom returns the output of the pseudo-random function (PRF) for the RC4-HMAC encryption type.
+// RFC 4757 does not define a PRF. This follows the MIT and Microsoft implementations: PRF = HMAC-SHA1(key, octet-string)
+func PseudoRandom(key, b []byte) []byte {
+	mac := hmac.New(sha1.New, key)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
@@ -133,3 +133,13 @@ func S2KparamsToItertions(s2kparams string) (int, error) {
 	}
 	return int(i), nil
 }
+
+// PseudoRandom implements the pseudo-random function (PRF) defined in RFC 8009 section 5:
+// PRF = KDF-HMAC-SHA2(input-key, "prf", octet-string, 256 or 384)
+func PseudoRandom(protocolKey, b []byte, e etype.EType) []byte {
+	kl := 256
+	if e.GetETypeID() == etypeID.AES256_CTS_HMAC_SHA384_192 {
+		kl = 384
+	}
+	return KDF_HMAC_SHA2(protocolKey, []byte("prf"), b, kl, e)
+}
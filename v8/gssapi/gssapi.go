@@ -108,10 +108,10 @@ type Mechanism interface {
 	AcquireCred() error                                               // acquire credentials for use (eg. AS exchange for KRB5)
 	InitSecContext() (ContextToken, error)                            // initiate outbound security context (eg TGS exchange builds AP_REQ to go into ContextToken to send to service)
 	AcceptSecContext(ct ContextToken) (bool, context.Context, Status) // service verifies the token server side to establish a context
-	MIC() MICToken                                                    // apply integrity check, receive as token separate from message
-	VerifyMIC(mt MICToken) (bool, error)                              // validate integrity check token along with message
-	Wrap(msg []byte) WrapToken                                        // sign, optionally encrypt, encapsulate
-	Unwrap(wt WrapToken) []byte                                       // decapsulate, decrypt if needed, validate integrity check
+	GetMIC(msg []byte) ([]byte, error)                                // apply integrity check, receive as token separate from message
+	VerifyMIC(msg, token []byte) (bool, error)                        // validate integrity check token along with message
+	Wrap(msg []byte, confReq bool) ([]byte, error)                    // sign, optionally encrypt, encapsulate
+	Unwrap(token []byte) ([]byte, bool, error)                        // decapsulate, decrypt if needed, validate integrity check
 }
 
 // OIDName is the type for defined GSS-API OIDs.
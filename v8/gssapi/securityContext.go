@@ -0,0 +1,253 @@
+package gssapi
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// seqWindow is the number of sequence numbers before the next expected one that are tracked for replay detection.
+const seqWindow = 64
+
+// SecurityContext is an established Kerberos V5 GSS-API security context, as defined in RFC 4121.
+// It holds the keys and sequence numbers agreed during the AP exchange and provides the per-message calls
+// GetMIC, VerifyMIC, Wrap and Unwrap.
+//
+// RFC 4121 section 2: if the acceptor asserted a subkey it is used to protect all messages, otherwise the initiator's
+// subkey is used if there is one, otherwise the ticket's session key.
+type SecurityContext struct {
+	initiator       bool
+	flags           int
+	sessionKey      types.EncryptionKey
+	initiatorSubkey *types.EncryptionKey
+	acceptorSubkey  *types.EncryptionKey
+	sendSeqNum      uint64
+	recvSeq         sequenceState
+	mux             sync.Mutex
+}
+
+// NewInitiatorSecurityContext creates the initiator's security context.
+// The session key is that of the service ticket and the subkey and sequence number are those sent in the
+// authenticator of the AP_REQ. The subkey may be nil. The flags are the GSS-API context flags, such as
+// ContextFlagReplay and ContextFlagSequence, that were requested.
+func NewInitiatorSecurityContext(sessionKey types.EncryptionKey, subkey *types.EncryptionKey, seqNum uint64, flags int) *SecurityContext {
+	return &SecurityContext{
+		initiator:       true,
+		flags:           flags,
+		sessionKey:      sessionKey,
+		initiatorSubkey: subkey,
+		sendSeqNum:      seqNum,
+		recvSeq:         newSequenceState(seqNum, flags),
+	}
+}
+
+// NewAcceptorSecurityContext creates the acceptor's security context.
+// The session key is that of the service ticket and the subkey and sequence number are those received in the
+// authenticator of the AP_REQ. The subkey may be nil. The flags are the GSS-API context flags from the
+// authenticator's checksum.
+func NewAcceptorSecurityContext(sessionKey types.EncryptionKey, initiatorSubkey *types.EncryptionKey, seqNum uint64, flags int) *SecurityContext {
+	// Without mutual authentication the acceptor uses the initiator's sequence number.
+	return &SecurityContext{
+		flags:           flags,
+		sessionKey:      sessionKey,
+		initiatorSubkey: initiatorSubkey,
+		sendSeqNum:      seqNum,
+		recvSeq:         newSequenceState(seqNum, flags),
+	}
+}
+
+// SetAcceptorSubkey records the subkey and sequence number asserted by the acceptor in the AP_REP of mutual
+// authentication. The subkey may be nil if the acceptor did not assert one.
+func (c *SecurityContext) SetAcceptorSubkey(subkey *types.EncryptionKey, seqNum uint64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.acceptorSubkey = subkey
+	if c.initiator {
+		c.recvSeq = newSequenceState(seqNum, c.flags)
+		return
+	}
+	c.sendSeqNum = seqNum
+}
+
+// Initiator indicates if this is the initiator's side of the security context.
+func (c *SecurityContext) Initiator() bool {
+	return c.initiator
+}
+
+// Flags returns the GSS-API context flags of the security context.
+func (c *SecurityContext) Flags() int {
+	return c.flags
+}
+
+// GetMIC returns the marshaled MIC token for the message (GSS_GetMIC).
+func (c *SecurityContext) GetMIC(msg []byte) ([]byte, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	key, flags := c.sendKey()
+	mt := MICToken{
+		Flags:     flags,
+		SndSeqNum: c.sendSeqNum,
+		Payload:   msg,
+	}
+	err := mt.SetChecksum(key, micKeyUsage(flags))
+	if err != nil {
+		return nil, err
+	}
+	b, err := mt.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	c.sendSeqNum++
+	return b, nil
+}
+
+// VerifyMIC verifies the MIC token received from the peer against the message (GSS_VerifyMIC).
+//
+// When replay or sequence detection is enabled for the context a Status error is returned for tokens received out of
+// sequence. For the codes StatusDuplicateToken and StatusOldToken the token is rejected and the boolean is false.
+// For the codes StatusGapToken and StatusUnseqToken the token is valid, the boolean is true and the Status is
+// informational.
+func (c *SecurityContext) VerifyMIC(msg, token []byte) (bool, error) {
+	var mt MICToken
+	err := mt.Unmarshal(token, c.initiator)
+	if err != nil {
+		return false, Status{Code: StatusDefectiveToken, Message: err.Error()}
+	}
+	mt.Payload = msg
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	key, err := c.recvKey(mt.Flags&MICTokenFlagAcceptorSubkey != 0)
+	if err != nil {
+		return false, Status{Code: StatusDefectiveToken, Message: err.Error()}
+	}
+	if ok, err := mt.Verify(key, micKeyUsage(mt.Flags)); !ok {
+		return false, Status{Code: StatusBadMIC, Message: err.Error()}
+	}
+	return c.recvSeq.check(mt.SndSeqNum)
+}
+
+// Wrap returns the marshaled wrap token for the message (GSS_Wrap).
+// If confReq is true the message is encrypted, otherwise only its integrity is protected.
+func (c *SecurityContext) Wrap(msg []byte, confReq bool) ([]byte, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	key, flags := c.sendKey()
+	b, err := Wrap(msg, key, flags, c.sendSeqNum, confReq)
+	if err != nil {
+		return nil, err
+	}
+	c.sendSeqNum++
+	return b, nil
+}
+
+// Unwrap verifies, and decrypts if sealed, the wrap token received from the peer (GSS_Unwrap).
+// The message is returned along with a boolean indicating if the token provided confidentiality.
+//
+// As with VerifyMIC a Status error is returned for tokens received out of sequence. For the codes
+// StatusDuplicateToken and StatusOldToken the token is rejected and no message is returned. For the codes
+// StatusGapToken and StatusUnseqToken the message is returned and the Status is informational.
+func (c *SecurityContext) Unwrap(token []byte) ([]byte, bool, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	key := c.sessionKey
+	if c.initiatorSubkey != nil {
+		key = *c.initiatorSubkey
+	}
+	wt, err := Unwrap(token, key, c.acceptorSubkey, c.initiator)
+	if err != nil {
+		return nil, false, Status{Code: StatusBadSig, Message: err.Error()}
+	}
+	ok, err := c.recvSeq.check(wt.SndSeqNum)
+	if !ok {
+		return nil, false, err
+	}
+	return wt.Payload, wt.Sealed(), err
+}
+
+// sendKey returns the key used to protect tokens sent and the token flags indicating the sender and key.
+func (c *SecurityContext) sendKey() (types.EncryptionKey, byte) {
+	var flags byte
+	if !c.initiator {
+		flags |= MICTokenFlagSentByAcceptor
+	}
+	if c.acceptorSubkey != nil {
+		return *c.acceptorSubkey, flags | MICTokenFlagAcceptorSubkey
+	}
+	if c.initiatorSubkey != nil {
+		return *c.initiatorSubkey, flags
+	}
+	return c.sessionKey, flags
+}
+
+// recvKey returns the key used to verify a token received.
+func (c *SecurityContext) recvKey(acceptorSubkey bool) (types.EncryptionKey, error) {
+	if acceptorSubkey {
+		if c.acceptorSubkey == nil {
+			return types.EncryptionKey{}, errors.New("token is protected with an acceptor subkey but none is available")
+		}
+		return *c.acceptorSubkey, nil
+	}
+	if c.initiatorSubkey != nil {
+		return *c.initiatorSubkey, nil
+	}
+	return c.sessionKey, nil
+}
+
+// micKeyUsage returns the key usage for a MIC token with the flags provided.
+func micKeyUsage(flags byte) uint32 {
+	if flags&MICTokenFlagSentByAcceptor != 0 {
+		return keyusage.GSSAPI_ACCEPTOR_SIGN
+	}
+	return keyusage.GSSAPI_INITIATOR_SIGN
+}
+
+// sequenceState tracks the sequence numbers of the tokens received to detect replayed and out of sequence tokens.
+type sequenceState struct {
+	next     uint64 // next sequence number expected
+	received uint64 // bit n is set if next-1-n has been received
+	replay   bool
+	sequence bool
+}
+
+func newSequenceState(seqNum uint64, flags int) sequenceState {
+	return sequenceState{
+		next:     seqNum,
+		replay:   flags&ContextFlagReplay != 0,
+		sequence: flags&ContextFlagSequence != 0,
+	}
+}
+
+// check records the sequence number of a token received. The boolean indicates if the token should be accepted and a
+// Status error is returned if the token is out of sequence.
+func (s *sequenceState) check(seqNum uint64) (bool, error) {
+	if !s.replay && !s.sequence {
+		return true, nil
+	}
+	if seqNum >= s.next {
+		gap := seqNum - s.next
+		if gap+1 >= seqWindow {
+			s.received = 1
+		} else {
+			s.received = s.received<<(gap+1) | 1
+		}
+		s.next = seqNum + 1
+		if gap > 0 && s.sequence {
+			return true, Status{Code: StatusGapToken}
+		}
+		return true, nil
+	}
+	offset := s.next - 1 - seqNum
+	if offset >= seqWindow {
+		return false, Status{Code: StatusOldToken}
+	}
+	if s.received&(1<<offset) != 0 {
+		return false, Status{Code: StatusDuplicateToken}
+	}
+	s.received |= 1 << offset
+	if s.sequence {
+		return true, Status{Code: StatusUnseqToken}
+	}
+	return true, nil
+}
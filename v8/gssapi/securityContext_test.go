@@ -0,0 +1,174 @@
+package gssapi
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testKey(t *testing.T) types.EncryptionKey {
+	et, err := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting etype: %v", err)
+	}
+	k, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	return k
+}
+
+func testSecurityContexts(t *testing.T, flags int) (*SecurityContext, *SecurityContext) {
+	sk := testKey(t)
+	subkey := testKey(t)
+	return NewInitiatorSecurityContext(sk, &subkey, 100, flags), NewAcceptorSecurityContext(sk, &subkey, 100, flags)
+}
+
+func TestSecurityContext_MIC(t *testing.T) {
+	t.Parallel()
+	ini, acc := testSecurityContexts(t, ContextFlagInteg)
+	msg := []byte("hello acceptor")
+	mic, err := ini.GetMIC(msg)
+	if err != nil {
+		t.Fatalf("error getting MIC: %v", err)
+	}
+	ok, err := acc.VerifyMIC(msg, mic)
+	assert.NoError(t, err)
+	assert.True(t, ok, "MIC from the initiator not valid")
+	ok, err = acc.VerifyMIC([]byte("other"), mic)
+	assert.False(t, ok, "MIC should not be valid for another message")
+	assert.Equal(t, StatusBadMIC, err.(Status).Code)
+	_, err = ini.VerifyMIC(msg, mic)
+	assert.Error(t, err, "initiator should not accept its own MIC token")
+
+	msg = []byte("hello initiator")
+	mic, err = acc.GetMIC(msg)
+	if err != nil {
+		t.Fatalf("error getting MIC: %v", err)
+	}
+	ok, err = ini.VerifyMIC(msg, mic)
+	assert.NoError(t, err)
+	assert.True(t, ok, "MIC from the acceptor not valid")
+}
+
+func TestSecurityContext_Wrap(t *testing.T) {
+	t.Parallel()
+	ini, acc := testSecurityContexts(t, ContextFlagInteg|ContextFlagConf)
+	for _, conf := range []bool{true, false} {
+		msg := []byte("hello acceptor")
+		b, err := ini.Wrap(msg, conf)
+		if err != nil {
+			t.Fatalf("error wrapping: %v", err)
+		}
+		m, sealed, err := acc.Unwrap(b)
+		assert.NoError(t, err)
+		assert.Equal(t, msg, m, "message not as expected")
+		assert.Equal(t, conf, sealed, "confidentiality state not as expected")
+
+		msg = []byte("hello initiator")
+		b, err = acc.Wrap(msg, conf)
+		if err != nil {
+			t.Fatalf("error wrapping: %v", err)
+		}
+		m, sealed, err = ini.Unwrap(b)
+		assert.NoError(t, err)
+		assert.Equal(t, msg, m, "message not as expected")
+		assert.Equal(t, conf, sealed, "confidentiality state not as expected")
+	}
+}
+
+func TestSecurityContext_AcceptorSubkey(t *testing.T) {
+	t.Parallel()
+	ini, acc := testSecurityContexts(t, ContextFlagInteg|ContextFlagReplay)
+	subkey := testKey(t)
+	acc.SetAcceptorSubkey(&subkey, 500)
+
+	b, err := acc.Wrap([]byte("hello"), true)
+	if err != nil {
+		t.Fatalf("error wrapping: %v", err)
+	}
+	_, _, err = ini.Unwrap(b)
+	assert.Error(t, err, "initiator should not unwrap before it has the acceptor subkey")
+	ini.SetAcceptorSubkey(&subkey, 500)
+	b, err = acc.Wrap([]byte("hello"), true)
+	if err != nil {
+		t.Fatalf("error wrapping: %v", err)
+	}
+	m, _, err := ini.Unwrap(b)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), m, "message not as expected")
+
+	// Once asserted the acceptor subkey is used in both directions
+	b, err = ini.Wrap([]byte("hello"), false)
+	if err != nil {
+		t.Fatalf("error wrapping: %v", err)
+	}
+	var wt WrapToken
+	err = wt.Unmarshal(b, false)
+	if err != nil {
+		t.Fatalf("error unmarshaling wrap token: %v", err)
+	}
+	assert.NotZero(t, wt.Flags&WrapTokenFlagAcceptorSubkey, "acceptor subkey flag not set")
+	m, _, err = acc.Unwrap(b)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), m, "message not as expected")
+}
+
+func TestSecurityContext_Sequence(t *testing.T) {
+	t.Parallel()
+	ini, acc := testSecurityContexts(t, ContextFlagInteg|ContextFlagReplay|ContextFlagSequence)
+	var toks [][]byte
+	for i := 0; i < 4; i++ {
+		b, err := ini.Wrap([]byte{byte(i)}, false)
+		if err != nil {
+			t.Fatalf("error wrapping: %v", err)
+		}
+		toks = append(toks, b)
+	}
+	_, _, err := acc.Unwrap(toks[0])
+	assert.NoError(t, err)
+	_, _, err = acc.Unwrap(toks[0])
+	assert.Equal(t, StatusDuplicateToken, err.(Status).Code, "replay not detected")
+	m, _, err := acc.Unwrap(toks[2])
+	assert.Equal(t, StatusGapToken, err.(Status).Code, "gap not detected")
+	assert.Equal(t, []byte{2}, m, "message should be returned with a gap status")
+	m, _, err = acc.Unwrap(toks[1])
+	assert.Equal(t, StatusUnseqToken, err.(Status).Code, "out of sequence token not detected")
+	assert.Equal(t, []byte{1}, m, "message should be returned with an unsequenced status")
+	_, _, err = acc.Unwrap(toks[1])
+	assert.Equal(t, StatusDuplicateToken, err.(Status).Code, "replay not detected")
+	_, _, err = acc.Unwrap(toks[3])
+	assert.NoError(t, err)
+
+	for i := 0; i < seqWindow; i++ {
+		_, err = ini.GetMIC([]byte{byte(i)})
+		if err != nil {
+			t.Fatalf("error getting MIC: %v", err)
+		}
+	}
+	mic, err := ini.GetMIC([]byte("last"))
+	if err != nil {
+		t.Fatalf("error getting MIC: %v", err)
+	}
+	ok, err := acc.VerifyMIC([]byte("last"), mic)
+	assert.True(t, ok, "MIC should be valid")
+	assert.Equal(t, StatusGapToken, err.(Status).Code, "gap not detected")
+	_, _, err = acc.Unwrap(toks[3])
+	assert.Equal(t, StatusOldToken, err.(Status).Code, "old token not detected")
+}
+
+func TestSecurityContext_NoSequenceDetection(t *testing.T) {
+	t.Parallel()
+	ini, acc := testSecurityContexts(t, ContextFlagInteg)
+	b, err := ini.Wrap([]byte("hello"), false)
+	if err != nil {
+		t.Fatalf("error wrapping: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		_, _, err = acc.Unwrap(b)
+		assert.NoError(t, err, "replay should not be detected when not requested")
+	}
+}
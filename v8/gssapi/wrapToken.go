@@ -22,6 +22,15 @@ const (
 	FillerByte byte = 0xFF
 )
 
+const (
+	// WrapTokenFlagSentByAcceptor - this flag indicates the sender is the context acceptor.  When not set, it indicates the sender is the context initiator
+	WrapTokenFlagSentByAcceptor = 1 << iota
+	// WrapTokenFlagSealed - this flag indicates confidentiality is provided for, the payload is encrypted
+	WrapTokenFlagSealed
+	// WrapTokenFlagAcceptorSubkey - a subkey asserted by the context acceptor is used to protect the message
+	WrapTokenFlagAcceptorSubkey
+)
+
 // WrapToken represents a GSS API Wrap token, as defined in RFC 4121.
 // It contains the header fields, the payload and the checksum, and provides
 // the logic for converting to/from bytes plus computing and verifying checksums
@@ -29,11 +38,12 @@ type WrapToken struct {
 	// const GSS Token ID: 0x0504
 	Flags byte // contains three flags: acceptor, sealed, acceptor subkey
 	// const Filler: 0xFF
-	EC        uint16 // checksum length. big-endian
+	EC        uint16 // checksum length, or the number of filler bytes when sealed. big-endian
 	RRC       uint16 // right rotation count. big-endian
 	SndSeqNum uint64 // sender's sequence number. big-endian
 	Payload   []byte // your data! :)
 	CheckSum  []byte // authenticated checksum of { payload | header }
+	cipher    []byte // encryption of { payload | filler | header } when sealed
 }
 
 // Return the 2 bytes identifying a GSS API Wrap token
@@ -44,6 +54,14 @@ func getGssWrapTokenId() *[2]byte {
 // Marshal the WrapToken into a byte slice.
 // The payload should have been set and the checksum computed, otherwise an error is returned.
 func (wt *WrapToken) Marshal() ([]byte, error) {
+	if wt.Sealed() {
+		if wt.cipher == nil {
+			return nil, errors.New("token has not been sealed")
+		}
+		b := make([]byte, HdrLen, HdrLen+len(wt.cipher))
+		copy(b, wt.header(wt.RRC))
+		return append(b, rotateRight(wt.cipher, int(wt.RRC))...), nil
+	}
 	if wt.CheckSum == nil {
 		return nil, errors.New("checksum has not been set")
 	}
@@ -63,9 +81,85 @@ func (wt *WrapToken) Marshal() ([]byte, error) {
 	binary.BigEndian.PutUint64(bytes[8:16], wt.SndSeqNum)
 	copy(bytes[pldOffset:], wt.Payload)
 	copy(bytes[chkSOffset:], wt.CheckSum)
+	if wt.RRC != 0 {
+		copy(bytes[HdrLen:], rotateRight(bytes[HdrLen:], int(wt.RRC)))
+	}
 	return bytes, nil
 }
 
+// Sealed indicates if the token's payload is encrypted to provide confidentiality.
+func (wt *WrapToken) Sealed() bool {
+	return wt.Flags&WrapTokenFlagSealed != 0
+}
+
+// header returns the token header with the RRC value provided.
+func (wt *WrapToken) header(rrc uint16) []byte {
+	h := make([]byte, HdrLen)
+	copy(h[0:], getGssWrapTokenId()[:])
+	h[2] = wt.Flags
+	h[3] = FillerByte
+	binary.BigEndian.PutUint16(h[4:6], wt.EC)
+	binary.BigEndian.PutUint16(h[6:8], rrc)
+	binary.BigEndian.PutUint64(h[8:16], wt.SndSeqNum)
+	return h
+}
+
+// Seal encrypts the payload with the passed encryption key and key usage, setting the sealed flag of this WrapToken.
+// The EC field defines the number of filler bytes to append to the payload before encryption and the RRC field the
+// number of bytes the encrypted data is rotated by when marshaled.
+// If the payload has not been set or the checksum has already been set, an error is returned.
+func (wt *WrapToken) Seal(key types.EncryptionKey, keyUsage uint32) error {
+	if wt.Payload == nil {
+		return errors.New("payload has not been set")
+	}
+	if wt.CheckSum != nil {
+		return errors.New("checksum has already been computed")
+	}
+	encType, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return err
+	}
+	wt.Flags |= WrapTokenFlagSealed
+	// Build a slice containing { payload | filler | header }, where the header has an RRC of zero
+	plain := make([]byte, len(wt.Payload)+int(wt.EC)+HdrLen)
+	copy(plain, wt.Payload)
+	for i := len(wt.Payload); i < len(wt.Payload)+int(wt.EC); i++ {
+		plain[i] = FillerByte
+	}
+	copy(plain[len(wt.Payload)+int(wt.EC):], wt.header(0))
+	_, cipher, err := encType.EncryptMessage(key.KeyValue, plain, keyUsage)
+	if err != nil {
+		return fmt.Errorf("error encrypting wrap token: %v", err)
+	}
+	wt.cipher = cipher
+	return nil
+}
+
+// Unseal decrypts the token's encrypted data with the passed encryption key and key usage, verifies its integrity and
+// sets the Payload of this WrapToken.
+func (wt *WrapToken) Unseal(key types.EncryptionKey, keyUsage uint32) error {
+	if !wt.Sealed() || wt.cipher == nil {
+		return errors.New("token is not sealed")
+	}
+	encType, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return err
+	}
+	plain, err := encType.DecryptMessage(key.KeyValue, wt.cipher, keyUsage)
+	if err != nil {
+		return fmt.Errorf("error decrypting wrap token: %v", err)
+	}
+	if len(plain) < int(wt.EC)+HdrLen {
+		return errors.New("decrypted wrap token is shorter than the filler and header")
+	}
+	// The encrypted copy of the header must match the token header, other than the RRC which is zero
+	if !hmac.Equal(plain[len(plain)-HdrLen:], wt.header(0)) {
+		return errors.New("encrypted header of wrap token does not match the token header")
+	}
+	wt.Payload = plain[:len(plain)-int(wt.EC)-HdrLen]
+	return nil
+}
+
 // SetCheckSum uses the passed encryption key and key usage to compute the checksum over the payload and
 // the header, and sets the CheckSum field of this WrapToken.
 // If the payload has not been set or the checksum has already been set, an error is returned.
@@ -154,17 +248,30 @@ func (wt *WrapToken) Unmarshal(b []byte, expectFromAcceptor bool) error {
 		return fmt.Errorf("unexpected filler byte: expecting 0xFF, was %s ", hex.EncodeToString(b[3:4]))
 	}
 	checksumL := binary.BigEndian.Uint16(b[4:6])
-	// Sanity check on the checksum length
-	if int(checksumL) > len(b)-HdrLen {
-		return fmt.Errorf("inconsistent checksum length: %d bytes to parse, checksum length is %d", len(b), checksumL)
+	rrc := binary.BigEndian.Uint16(b[6:8])
+	// Undo any rotation of the data following the header
+	body := b[HdrLen:]
+	if rrc != 0 {
+		body = rotateLeft(body, int(rrc))
 	}
 
 	wt.Flags = flags
 	wt.EC = checksumL
-	wt.RRC = binary.BigEndian.Uint16(b[6:8])
+	wt.RRC = rrc
 	wt.SndSeqNum = binary.BigEndian.Uint64(b[8:16])
-	wt.Payload = b[16 : len(b)-int(checksumL)]
-	wt.CheckSum = b[len(b)-int(checksumL):]
+	if wt.Sealed() {
+		wt.Payload = nil
+		wt.CheckSum = nil
+		wt.cipher = body
+		return nil
+	}
+	// Sanity check on the checksum length
+	if int(checksumL) > len(body) {
+		return fmt.Errorf("inconsistent checksum length: %d bytes to parse, checksum length is %d", len(b), checksumL)
+	}
+	wt.Payload = body[:len(body)-int(checksumL)]
+	wt.CheckSum = body[len(body)-int(checksumL):]
+	wt.cipher = nil
 	return nil
 }
 
@@ -193,3 +300,87 @@ func NewInitiatorWrapToken(payload []byte, key types.EncryptionKey) (*WrapToken,
 
 	return &token, nil
 }
+
+// Wrap builds a wrap token for the message and returns its marshaled bytes (GSS_Wrap).
+// If confReq is true the token is sealed to provide confidentiality, otherwise only its integrity is protected.
+// The flags define if the token is sent by the acceptor and if the key is a subkey asserted by the acceptor.
+// The sequence number should be the next in the sender's sequence for the security context.
+func Wrap(msg []byte, key types.EncryptionKey, flags byte, seqNum uint64, confReq bool) ([]byte, error) {
+	encType, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	wt := WrapToken{
+		Flags:     flags &^ WrapTokenFlagSealed,
+		SndSeqNum: seqNum,
+		Payload:   msg,
+	}
+	if confReq {
+		// The encryption types of RFC 4121 do not require padding so no filler is added
+		err = wt.Seal(key, wrapKeyUsage(flags))
+	} else {
+		wt.EC = uint16(encType.GetHMACBitLength() / 8)
+		err = wt.SetCheckSum(key, wrapKeyUsage(flags))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return wt.Marshal()
+}
+
+// Unwrap unmarshals the wrap token bytes, decrypting the token if it is sealed and verifying its integrity (GSS_Unwrap).
+// The message is the Payload of the WrapToken returned and its Sealed method gives the confidentiality state.
+// The key used is selected by the token's acceptor subkey flag. The acceptorSubkey is used if the flag is set,
+// otherwise key is used. The acceptorSubkey may be nil if the acceptor has not asserted a subkey.
+func Unwrap(b []byte, key types.EncryptionKey, acceptorSubkey *types.EncryptionKey, expectFromAcceptor bool) (*WrapToken, error) {
+	var wt WrapToken
+	err := wt.Unmarshal(b, expectFromAcceptor)
+	if err != nil {
+		return nil, err
+	}
+	if wt.Flags&WrapTokenFlagAcceptorSubkey != 0 {
+		if acceptorSubkey == nil {
+			return nil, errors.New("wrap token is protected with an acceptor subkey but none is available")
+		}
+		key = *acceptorSubkey
+	}
+	if wt.Sealed() {
+		err = wt.Unseal(key, wrapKeyUsage(wt.Flags))
+		if err != nil {
+			return nil, err
+		}
+		return &wt, nil
+	}
+	if ok, err := wt.Verify(key, wrapKeyUsage(wt.Flags)); !ok {
+		return nil, err
+	}
+	return &wt, nil
+}
+
+// wrapKeyUsage returns the key usage for a wrap token with the flags provided.
+func wrapKeyUsage(flags byte) uint32 {
+	if flags&WrapTokenFlagSentByAcceptor != 0 {
+		return keyusage.GSSAPI_ACCEPTOR_SEAL
+	}
+	return keyusage.GSSAPI_INITIATOR_SEAL
+}
+
+// rotateRight returns a copy of the bytes rotated right by n.
+func rotateRight(b []byte, n int) []byte {
+	r := make([]byte, len(b))
+	if len(b) == 0 {
+		return r
+	}
+	n = n % len(b)
+	copy(r, b[len(b)-n:])
+	copy(r[n:], b[:len(b)-n])
+	return r
+}
+
+// rotateLeft returns a copy of the bytes rotated left by n.
+func rotateLeft(b []byte, n int) []byte {
+	if len(b) == 0 {
+		return []byte{}
+	}
+	return rotateRight(b, len(b)-n%len(b))
+}
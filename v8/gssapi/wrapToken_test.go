@@ -189,3 +189,113 @@ func TestNewInitiatorTokenSignatureAndMarshalling(t *testing.T) {
 	assert.Nil(t, tErr, "Unexpected error.")
 	assert.Equal(t, getResponseReference(), token, "Token failed to be marshalled to the expected bytes.")
 }
+
+func TestWrapUnwrap(t *testing.T) {
+	t.Parallel()
+	msg := []byte("the quick brown fox jumps over the lazy dog")
+	var tests = []struct {
+		name    string
+		flags   byte
+		confReq bool
+	}{
+		{"initiator integrity", 0x00, false},
+		{"initiator sealed", 0x00, true},
+		{"acceptor integrity", WrapTokenFlagSentByAcceptor, false},
+		{"acceptor sealed", WrapTokenFlagSentByAcceptor, true},
+	}
+	key := getSessionKey()
+	for _, test := range tests {
+		b, err := Wrap(msg, key, test.flags, 42, test.confReq)
+		if err != nil {
+			t.Fatalf("%s: error wrapping: %v", test.name, err)
+		}
+		if test.confReq {
+			assert.NotContains(t, string(b), string(msg), "%s: message should not be in clear text", test.name)
+		}
+		wt, err := Unwrap(b, key, nil, test.flags&WrapTokenFlagSentByAcceptor != 0)
+		if err != nil {
+			t.Fatalf("%s: error unwrapping: %v", test.name, err)
+		}
+		assert.Equal(t, msg, wt.Payload, "%s: message not as expected", test.name)
+		assert.Equal(t, test.confReq, wt.Sealed(), "%s: confidentiality state not as expected", test.name)
+		assert.Equal(t, uint64(42), wt.SndSeqNum, "%s: sequence number not as expected", test.name)
+
+		// Tampering must be detected
+		b[len(b)-1] ^= 0x01
+		_, err = Unwrap(b, key, nil, test.flags&WrapTokenFlagSentByAcceptor != 0)
+		assert.Error(t, err, "%s: tampered token should not unwrap", test.name)
+	}
+}
+
+func TestSealedWrapToken_RotationAndFiller(t *testing.T) {
+	t.Parallel()
+	msg := []byte{0x01, 0x02, 0x03, 0x04, 0x05}
+	key := getSessionKey()
+	for _, rrc := range []uint16{0, 12, 28, 1000} {
+		wt := WrapToken{
+			Flags:     WrapTokenFlagSentByAcceptor,
+			EC:        4,
+			RRC:       rrc,
+			SndSeqNum: 7,
+			Payload:   msg,
+		}
+		err := wt.Seal(key, acceptorSeal)
+		if err != nil {
+			t.Fatalf("error sealing: %v", err)
+		}
+		b, err := wt.Marshal()
+		if err != nil {
+			t.Fatalf("error marshaling: %v", err)
+		}
+		assert.Equal(t, rrc, binary.BigEndian.Uint16(b[6:8]), "RRC not as expected")
+		var u WrapToken
+		err = u.Unmarshal(b, true)
+		if err != nil {
+			t.Fatalf("error unmarshaling token with RRC %d: %v", rrc, err)
+		}
+		assert.True(t, u.Sealed(), "token should be sealed")
+		assert.Nil(t, u.Payload, "payload should not be set until unsealed")
+		err = u.Unseal(key, acceptorSeal)
+		if err != nil {
+			t.Fatalf("error unsealing token with RRC %d: %v", rrc, err)
+		}
+		assert.Equal(t, msg, u.Payload, "payload not as expected for RRC %d", rrc)
+		assert.Error(t, u.Unseal(key, initiatorSeal), "unsealing with the wrong key usage should fail")
+	}
+}
+
+func TestUnwrap_AcceptorSubkey(t *testing.T) {
+	t.Parallel()
+	msg := []byte("message")
+	key := getSessionKey()
+	subkey := types.EncryptionKey{
+		KeyType:  sessionKeyType,
+		KeyValue: []byte("0123456789abcdef"),
+	}
+	b, err := Wrap(msg, subkey, WrapTokenFlagSentByAcceptor|WrapTokenFlagAcceptorSubkey, 1, true)
+	if err != nil {
+		t.Fatalf("error wrapping: %v", err)
+	}
+	_, err = Unwrap(b, key, nil, true)
+	assert.Error(t, err, "unwrap without the acceptor subkey should fail")
+	wt, err := Unwrap(b, key, &subkey, true)
+	if err != nil {
+		t.Fatalf("error unwrapping: %v", err)
+	}
+	assert.Equal(t, msg, wt.Payload, "message not as expected")
+}
+
+func TestUnwrap_ChecksumRotated(t *testing.T) {
+	t.Parallel()
+	// The reference token rotated by its checksum length, as sent by some implementations
+	b, _ := hex.DecodeString(testChallengeFromAcceptor)
+	r := make([]byte, len(b))
+	copy(r, b[:HdrLen])
+	copy(r[HdrLen:], rotateRight(b[HdrLen:], 12))
+	binary.BigEndian.PutUint16(r[6:8], 12)
+	wt, err := Unwrap(r, getSessionKey(), nil, true)
+	if err != nil {
+		t.Fatalf("error unwrapping rotated token: %v", err)
+	}
+	assert.Equal(t, []byte{0x01, 0x01, 0x00, 0x00}, wt.Payload, "payload not as expected")
+}
@@ -17,10 +17,12 @@ const (
 	PreAuthent             = 10
 	HWAuthent              = 11
 	OptHardwareAuth        = 11
-	RequestAnonymous       = 12
 	TransitedPolicyChecked = 12
 	OKAsDelegate           = 13
+	Anonymous              = 14
 	EncPARep               = 15
+	CNameInAddlTkt         = 14
+	RequestAnonymous       = 16 // RFC 8062 Section 3
 	Canonicalize           = 15
 	DisableTransitedCheck  = 26
 	RenewableOK            = 27
@@ -33,4 +35,20 @@ const (
 	APOptionUseSessionKey  = 1
 	APOptionMutualRequired = 2
 	// 3-31 Reserved for future use.
+
+	// FAST Option Flags (RFC 6113)
+	// 0 Reserved.
+	FASTOptionHideClientNames = 1
+	// 2-15 Critical options for future use.
+	FASTOptionKDCFollowReferrals = 16
+
+	// PAC Option Flags (MS-KILE 2.2.10)
+	PACOptionClaims                             = 0
+	PACOptionBranchAware                        = 1
+	PACOptionForwardToFullDC                    = 2
+	PACOptionResourceBasedConstrainedDelegation = 3
+
+	// S4U Option Flags (MS-SFU 2.2.2)
+	S4UOptionCheckLogonHours  = 1
+	S4UOptionUseReplyKeyUsage = 2
 )
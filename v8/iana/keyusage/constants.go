@@ -27,6 +27,9 @@ const (
 	GSSAPI_ACCEPTOR_SIGN           = 23
 	GSSAPI_INITIATOR_SEAL          = 24
 	GSSAPI_INITIATOR_SIGN          = 25
+	PA_S4U_X509_USER_REQUEST       = 26
+	PA_S4U_X509_USER_REPLY         = 27
+	KEY_USAGE_PA_PKINIT_KX         = 44
 	KEY_USAGE_FAST_REQ_CHKSUM      = 50
 	KEY_USAGE_FAST_ENC             = 51
 	KEY_USAGE_FAST_REP             = 52
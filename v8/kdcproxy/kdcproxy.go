@@ -0,0 +1,181 @@
+// Package kdcproxy provides a Kerberos KDC proxy implementing the Kerberos Key Distribution Center (KDC) Proxy Protocol
+// (MS-KKDCP).
+//
+// The proxy allows clients that cannot reach the KDCs directly, such as those outside of a corporate network, to
+// exchange messages with them over HTTPS. Clients POST a KDC-PROXY-MESSAGE holding an AS_REQ, TGS_REQ or kpasswd request
+// and the realm it is for. The proxy forwards the message to the realm's KDCs, or kpasswd servers, from the krb5.conf
+// configuration and returns the reply in a KDC-PROXY-MESSAGE. Only realms on the allow list are proxied:
+//
+//	h := kdcproxy.NewHandler(cfg, kdcproxy.Realms("EXAMPLE.COM"))
+//	http.Handle("/KdcProxy", h)
+//	log.Fatal(http.ListenAndServeTLS(":443", "cert.pem", "key.pem", nil))
+//
+// The handler should be served over TLS as the proxy does not protect the messages itself.
+package kdcproxy
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/messages"
+)
+
+// Reference: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-kkdcp
+
+const (
+	// contentType is the content type of KDC proxy requests and replies.
+	contentType = "application/kerberos"
+	// maxRequestSize is the maximum size of a request that will be read.
+	maxRequestSize = 1 << 20
+	// kpasswdVersion is the protocol version number of a set password request.
+	kpasswdVersion = 0xff80
+)
+
+// Handler is an http.Handler that proxies Kerberos messages to KDCs and kpasswd servers.
+type Handler struct {
+	config    *config.Config
+	settings  *Settings
+	transport client.Transport
+}
+
+// NewHandler returns a KDC proxy handler that forwards messages to the servers in the krb5.conf configuration provided.
+func NewHandler(cfg *config.Config, settings ...func(*Settings)) *Handler {
+	s := NewSettings(settings...)
+	return &Handler{
+		config:    cfg,
+		settings:  s,
+		transport: s.Transport(),
+	}
+}
+
+// ServeHTTP forwards the Kerberos message of the KDC-PROXY-MESSAGE in the request body to the target realm and writes
+// the reply.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.error(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+	if err != nil {
+		h.error(w, http.StatusBadRequest, "error reading request: %v", err)
+		return
+	}
+	if len(b) > maxRequestSize {
+		h.error(w, http.StatusRequestEntityTooLarge, "request is larger than %d bytes", maxRequestSize)
+		return
+	}
+	var m messages.KDCProxyMessage
+	err = m.Unmarshal(b)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, "error unmarshaling KDC-PROXY-MESSAGE: %v", err)
+		return
+	}
+	km, err := m.Message()
+	if err != nil {
+		h.error(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if m.TargetDomain == "" {
+		h.error(w, http.StatusBadRequest, "KDC-PROXY-MESSAGE does not have a target domain")
+		return
+	}
+	if !h.settings.RealmAllowed(m.TargetDomain) {
+		h.error(w, http.StatusForbidden, "realm %s is not allowed", m.TargetDomain)
+		return
+	}
+	kpasswd, ok := messageType(km)
+	if !ok {
+		h.error(w, http.StatusBadRequest, "message for %s is not a KDC or kpasswd request", m.TargetDomain)
+		return
+	}
+	rb, err := h.forward(r.Context(), m.TargetDomain, kpasswd, km)
+	if err != nil {
+		h.error(w, http.StatusServiceUnavailable, "error forwarding message for %s: %v", m.TargetDomain, err)
+		return
+	}
+	rm := messages.NewKDCProxyMessage(rb, "")
+	mb, err := rm.Marshal()
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, "error marshaling KDC-PROXY-MESSAGE: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write(mb)
+}
+
+// forward sends the message to each of the realm's KDCs, or kpasswd servers, in turn until a reply is received.
+// Servers that are themselves KDC proxies are skipped.
+func (h *Handler) forward(ctx context.Context, realm string, kpasswd bool, b []byte) ([]byte, error) {
+	var servers map[int]string
+	var err error
+	if kpasswd {
+		_, servers, err = h.config.GetKpasswdServers(realm, true)
+	} else {
+		_, servers, err = h.config.GetKDCs(realm, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var errs []string
+	for i := 1; i <= len(servers); i++ {
+		if strings.HasPrefix(strings.ToLower(servers[i]), "https://") {
+			continue
+		}
+		rb, err := h.transport.Exchange(ctx, "tcp", servers[i], b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			errs = append(errs, fmt.Sprintf("error sending to %s: %v", servers[i], err))
+			continue
+		}
+		return rb, nil
+	}
+	if len(errs) < 1 {
+		return nil, fmt.Errorf("no servers to forward to")
+	}
+	return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+// messageType indicates if the message is a kpasswd request rather than a KDC request. False is returned for ok if it
+// is neither.
+func messageType(b []byte) (kpasswd, ok bool) {
+	if len(b) < 6 {
+		return false, false
+	}
+	// The identifier octet of the constructed application tag of an AS_REQ or TGS_REQ.
+	if b[0] == 0x60|asnAppTag.ASREQ || b[0] == 0x60|asnAppTag.TGSREQ {
+		return false, true
+	}
+	// A kpasswd request starts with its length and protocol version https://tools.ietf.org/html/rfc3244#section-2
+	l := binary.BigEndian.Uint16(b[0:2])
+	v := binary.BigEndian.Uint16(b[2:4])
+	if int(l) == len(b) && (v == 1 || v == kpasswdVersion) {
+		return true, true
+	}
+	return false, false
+}
+
+// error writes an HTTP error response with the status and logs the reason.
+func (h *Handler) error(w http.ResponseWriter, status int, format string, v ...interface{}) {
+	h.log(format, v...)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// log will write to the KDC proxy's logger if it is configured.
+func (h *Handler) log(format string, v ...interface{}) {
+	if h.settings.Logger() != nil {
+		h.settings.Logger().Output(3, fmt.Sprintf(format, v...))
+	}
+}
@@ -0,0 +1,92 @@
+package kdcproxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/test/kdc"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRealm = "TEST.GOKRB5"
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+	k, err := kdc.New(testRealm, kdc.RequirePreAuth(true))
+	if err != nil {
+		t.Fatalf("error creating KDC: %v", err)
+	}
+	k.AddPrincipal("testuser1", "passwordvalue")
+	k.AddPrincipal("HTTP/host.test.gokrb5", "servicepassword")
+	err = k.Start()
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	defer k.Close()
+	kcfg, err := k.Config()
+	if err != nil {
+		t.Fatalf("error loading KDC config: %v", err)
+	}
+	s := httptest.NewTLSServer(NewHandler(kcfg, Realms(testRealm)))
+	defer s.Close()
+
+	cfg, err := config.NewFromString("[libdefaults]\n  default_realm = " + testRealm + "\n\n[realms]\n  " + testRealm + " = {\n    kdc = " + s.URL + "/KdcProxy\n    kpasswd_server = " + s.URL + "/KdcProxy\n  }\n  OTHER.GOKRB5 = {\n    kdc = " + s.URL + "/KdcProxy\n  }\n")
+	if err != nil {
+		t.Fatalf("error loading client config: %v", err)
+	}
+	cl := client.NewWithPassword("testuser1", testRealm, "passwordvalue", cfg, client.DisablePAFXFAST(true), client.KDCProxyHTTPClient(s.Client()))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in through KDC proxy: %v", err)
+	}
+	defer cl.Destroy()
+	_, _, err = cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	assert.NoError(t, err, "error getting service ticket through KDC proxy")
+	ok, err := cl.ChangePasswd("newpasswordvalue")
+	assert.True(t, ok, "password should be changed through KDC proxy: %v", err)
+
+	cl = client.NewWithPassword("testuser1", "OTHER.GOKRB5", "passwordvalue", cfg, client.DisablePAFXFAST(true), client.KDCProxyHTTPClient(s.Client()))
+	err = cl.Login()
+	assert.Error(t, err, "login to a realm that is not allowed should fail")
+}
+
+func TestHandler_BadRequest(t *testing.T) {
+	t.Parallel()
+	cfg, err := config.NewFromString("[libdefaults]\n  default_realm = " + testRealm + "\n\n[realms]\n  " + testRealm + " = {\n    kdc = 127.0.0.1:1\n  }\n")
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	h := NewHandler(cfg, Realms(testRealm))
+	proxyMessage := func(b []byte, realm string) []byte {
+		m := messages.NewKDCProxyMessage(b, realm)
+		mb, err := m.Marshal()
+		if err != nil {
+			t.Fatalf("error marshaling KDC-PROXY-MESSAGE: %v", err)
+		}
+		return mb
+	}
+	asReq := []byte{0x6a, 0x81, 0x03, 0x30, 0x01, 0x00}
+	var tests = []struct {
+		method string
+		body   []byte
+		status int
+	}{
+		{http.MethodGet, nil, http.StatusMethodNotAllowed},
+		{http.MethodPost, []byte("not a KDC-PROXY-MESSAGE"), http.StatusBadRequest},
+		{http.MethodPost, proxyMessage(asReq, ""), http.StatusBadRequest},
+		{http.MethodPost, proxyMessage(asReq, "OTHER.GOKRB5"), http.StatusForbidden},
+		{http.MethodPost, proxyMessage([]byte{0x30, 0x01, 0x02, 0x03, 0x04, 0x05}, testRealm), http.StatusBadRequest},
+		{http.MethodPost, proxyMessage(asReq, testRealm), http.StatusServiceUnavailable},
+	}
+	for i, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.method, "/KdcProxy", bytes.NewReader(test.body))
+		h.ServeHTTP(w, r)
+		assert.Equal(t, test.status, w.Code, "status of request %d not as expected", i)
+	}
+}
@@ -0,0 +1,74 @@
+package kdcproxy
+
+import (
+	"log"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+)
+
+// Settings defines KDC proxy configuration settings.
+type Settings struct {
+	realms    map[string]bool
+	transport client.Transport
+	logger    *log.Logger
+}
+
+// NewSettings creates a new KDC proxy Settings.
+func NewSettings(settings ...func(*Settings)) *Settings {
+	s := &Settings{
+		realms: make(map[string]bool),
+	}
+	for _, set := range settings {
+		set(s)
+	}
+	return s
+}
+
+// Realms used to configure the realms the KDC proxy will forward messages to. Requests for any other realm are refused,
+// so at least one realm must be configured. The realms are compared case sensitively.
+//
+// s := NewSettings(Realms("EXAMPLE.COM", "CHILD.EXAMPLE.COM"))
+func Realms(realms ...string) func(*Settings) {
+	return func(s *Settings) {
+		for _, realm := range realms {
+			s.realms[realm] = true
+		}
+	}
+}
+
+// RealmAllowed indicates if the KDC proxy will forward messages to the realm.
+func (s *Settings) RealmAllowed(realm string) bool {
+	return s.realms[realm]
+}
+
+// Transport used to configure the transport the KDC proxy forwards messages to KDCs and kpasswd servers over.
+// The default is client.NewTransport(nil).
+//
+// s := NewSettings(Realms("EXAMPLE.COM"), Transport(t))
+func Transport(t client.Transport) func(*Settings) {
+	return func(s *Settings) {
+		s.transport = t
+	}
+}
+
+// Transport returns the transport for forwarding messages to KDCs and kpasswd servers.
+func (s *Settings) Transport() client.Transport {
+	if s.transport != nil {
+		return s.transport
+	}
+	return client.NewTransport(nil)
+}
+
+// Logger used to configure the KDC proxy with a logger.
+//
+// s := NewSettings(Realms("EXAMPLE.COM"), Logger(l))
+func Logger(l *log.Logger) func(*Settings) {
+	return func(s *Settings) {
+		s.logger = l
+	}
+}
+
+// Logger returns the KDC proxy's logger instance.
+func (s *Settings) Logger() *log.Logger {
+	return s.logger
+}
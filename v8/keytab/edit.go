@@ -0,0 +1,167 @@
+package keytab
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// AddKeyEntry adds an entry to the keytab for the key provided, such as one exported from a KDC's database as raw key
+// bytes. The length of the key must be that of the key's encryption type.
+func (kt *Keytab) AddKeyEntry(principalName, realm string, key types.EncryptionKey, ts time.Time, KVNO uint32) error {
+	et, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return fmt.Errorf("error getting encryption type of key: %v", err)
+	}
+	if len(key.KeyValue) != et.GetKeyByteSize() {
+		return fmt.Errorf("key length of %d bytes is not valid for encryption type %d, which requires %d bytes",
+			len(key.KeyValue), key.KeyType, et.GetKeyByteSize())
+	}
+	princ, _ := types.ParseSPNString(principalName)
+	kt.addKey(princ, realm, types.EncryptionKey{
+		KeyType:  key.KeyType,
+		KeyValue: append([]byte{}, key.KeyValue...),
+	}, ts, KVNO)
+	return nil
+}
+
+// AddRandomKeyEntry adds an entry to the keytab with a new random key of the encryption type, returning the key so that
+// it can also be set for the principal in the KDC's database.
+func (kt *Keytab) AddRandomKeyEntry(principalName, realm string, ts time.Time, KVNO uint32, encType int32) (types.EncryptionKey, error) {
+	et, err := crypto.GetEtype(encType)
+	if err != nil {
+		return types.EncryptionKey{}, fmt.Errorf("error getting encryption type: %v", err)
+	}
+	key, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		return key, fmt.Errorf("error generating random key: %v", err)
+	}
+	princ, _ := types.ParseSPNString(principalName)
+	kt.addKey(princ, realm, key, ts, KVNO)
+	return key, nil
+}
+
+// addKey adds an entry for the principal's key to the keytab.
+func (kt *Keytab) addKey(princ types.PrincipalName, realm string, key types.EncryptionKey, ts time.Time, KVNO uint32) {
+	ktep := newPrincipal()
+	ktep.Realm = realm
+	ktep.Components = princ.NameString
+	ktep.NameType = princ.NameType
+	kt.setNumComponents(&ktep)
+
+	e := newEntry()
+	e.Principal = ktep
+	e.Timestamp = ts
+	// The 8 bit KVNO holds the least significant bits of the KVNO for readers that do not support the 32 bit KVNO.
+	e.KVNO8 = uint8(KVNO)
+	e.KVNO = KVNO
+	e.Key = key
+
+	kt.Entries = append(kt.Entries, e)
+}
+
+// setNumComponents sets the number of components of the principal as it is recorded for the keytab's version.
+func (kt *Keytab) setNumComponents(p *principal) {
+	p.NumComponents = int16(len(p.Components))
+	if kt.version == 1 {
+		p.NumComponents++
+	}
+}
+
+// RemoveEntries removes the entries for the principal with the key version number (KVNO) and encryption type provided,
+// returning the number of entries removed. An empty principal name or realm, a zero KVNO or a zero encryption type
+// matches all entries, so for example all the entries of a principal are removed with a zero KVNO and encryption type.
+func (kt *Keytab) RemoveEntries(principalName, realm string, KVNO uint32, encType int32) int {
+	var princ types.PrincipalName
+	if principalName != "" {
+		princ, _ = types.ParseSPNString(principalName)
+	}
+	return kt.removeIf(func(e entry) bool {
+		return (principalName == "" || principalMatches(e.Principal, princ)) &&
+			(realm == "" || e.Principal.Realm == realm) &&
+			(KVNO == 0 || e.KVNO == KVNO) &&
+			(encType == 0 || e.Key.KeyType == encType)
+	})
+}
+
+// PruneOlderThan removes the entries with a timestamp before the time provided, returning the number of entries
+// removed. The entries of the newest key version number (KVNO) of each principal are kept whatever their timestamp, so
+// that the current keys of the principals remain in the keytab.
+func (kt *Keytab) PruneOlderThan(t time.Time) int {
+	newest := make(map[string]uint32)
+	for _, e := range kt.Entries {
+		p := e.Principal.String()
+		if kvno, ok := newest[p]; !ok || e.KVNO > kvno {
+			newest[p] = e.KVNO
+		}
+	}
+	return kt.removeIf(func(e entry) bool {
+		return e.Timestamp.Before(t) && e.KVNO != newest[e.Principal.String()]
+	})
+}
+
+// Merge adds the entries of the other keytab to the keytab, except those for which it already has an entry with the
+// same principal, key version number (KVNO) and encryption type. The number of entries added is returned.
+func (kt *Keytab) Merge(other *Keytab) int {
+	var n int
+	for _, o := range other.Entries {
+		if kt.hasKey(o) {
+			continue
+		}
+		e := o
+		e.Principal.Components = append([]string{}, o.Principal.Components...)
+		kt.setNumComponents(&e.Principal)
+		e.Key.KeyValue = append([]byte{}, o.Key.KeyValue...)
+		kt.Entries = append(kt.Entries, e)
+		n++
+	}
+	return n
+}
+
+// hasKey indicates if the keytab has an entry with the same principal, key version number and encryption type as the
+// entry provided.
+func (kt *Keytab) hasKey(o entry) bool {
+	for _, e := range kt.Entries {
+		if sameKey(e, o) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameKey indicates if the entries are for the same principal, key version number and encryption type.
+func sameKey(a, b entry) bool {
+	return a.KVNO == b.KVNO && a.Key.KeyType == b.Key.KeyType && a.Principal.String() == b.Principal.String()
+}
+
+// removeIf removes the entries for which the function returns true, returning the number removed.
+func (kt *Keytab) removeIf(f func(entry) bool) int {
+	kept := kt.Entries[:0]
+	for _, e := range kt.Entries {
+		if !f(e) {
+			kept = append(kept, e)
+		}
+	}
+	n := len(kt.Entries) - len(kept)
+	// Clear the entries no longer referenced so that their keys are not retained by the underlying array.
+	for i := len(kept); i < len(kt.Entries); i++ {
+		kt.Entries[i] = entry{}
+	}
+	kt.Entries = kept
+	return n
+}
+
+// principalMatches indicates if the keytab principal has the name components of the principal name.
+func principalMatches(p principal, pn types.PrincipalName) bool {
+	if len(p.Components) != len(pn.NameString) {
+		return false
+	}
+	for i, c := range p.Components {
+		if pn.NameString[i] != c {
+			return false
+		}
+	}
+	return true
+}
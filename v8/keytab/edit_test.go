@@ -0,0 +1,182 @@
+package keytab
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeytab_AddKeyEntry(t *testing.T) {
+	t.Parallel()
+	realm := "TEST.GOKRB5"
+	kt := New()
+	key := types.EncryptionKey{
+		KeyType:  etypeID.AES128_CTS_HMAC_SHA1_96,
+		KeyValue: bytes.Repeat([]byte{0x01}, 16),
+	}
+	err := kt.AddKeyEntry("HTTP/host.test.gokrb5", realm, key, time.Unix(100, 0), 300)
+	if err != nil {
+		t.Fatalf("error adding key entry: %v", err)
+	}
+	assert.Equal(t, uint32(300), kt.Entries[0].KVNO, "KVNO not as expected")
+	assert.Equal(t, uint8(44), kt.Entries[0].KVNO8, "8 bit KVNO not as expected")
+	assert.Equal(t, int16(2), kt.Entries[0].Principal.NumComponents, "number of components not as expected")
+
+	pn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	k, kvno, err := kt.GetEncryptionKey(pn, realm, 0, etypeID.AES128_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting key: %v", err)
+	}
+	assert.Equal(t, key, k, "key not as expected")
+	assert.Equal(t, 300, kvno, "KVNO not as expected")
+
+	// The keytab must not share the key bytes of the caller.
+	key.KeyValue[0] = 0xff
+	assert.Equal(t, byte(0x01), kt.Entries[0].Key.KeyValue[0], "key bytes changed with the caller's")
+
+	err = kt.AddKeyEntry("HTTP/host.test.gokrb5", realm, types.EncryptionKey{
+		KeyType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+		KeyValue: bytes.Repeat([]byte{0x01}, 16),
+	}, time.Unix(100, 0), 1)
+	assert.Error(t, err, "key of the wrong length was added")
+	err = kt.AddKeyEntry("HTTP/host.test.gokrb5", realm, types.EncryptionKey{KeyType: 9999}, time.Unix(100, 0), 1)
+	assert.Error(t, err, "key of an unsupported encryption type was added")
+	assert.Equal(t, 1, len(kt.Entries), "number of entries not as expected")
+}
+
+func TestKeytab_AddRandomKeyEntry(t *testing.T) {
+	t.Parallel()
+	kt := New()
+	k1, err := kt.AddRandomKeyEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", time.Unix(100, 0), 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error adding random key entry: %v", err)
+	}
+	k2, err := kt.AddRandomKeyEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", time.Unix(100, 0), 1, etypeID.AES128_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error adding random key entry: %v", err)
+	}
+	assert.Equal(t, 32, len(k1.KeyValue), "key length not as expected")
+	assert.Equal(t, 16, len(k2.KeyValue), "key length not as expected")
+	assert.Equal(t, k1, kt.Entries[0].Key, "key in keytab not as returned")
+	assert.Equal(t, k2, kt.Entries[1].Key, "key in keytab not as returned")
+
+	_, err = kt.AddRandomKeyEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", time.Unix(100, 0), 1, 9999)
+	assert.Error(t, err, "key of an unsupported encryption type was added")
+
+	// The entries must survive a round trip through the keytab format.
+	b, err := kt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling keytab: %v", err)
+	}
+	kt2 := New()
+	err = kt2.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling keytab: %v", err)
+	}
+	assert.Equal(t, kt.Entries, kt2.Entries, "entries not as expected after round trip")
+}
+
+// editTestKeytab returns a keytab with entries for two principals at KVNOs 1 to 3, with timestamps of 100 times the
+// KVNO, in two encryption types.
+func editTestKeytab(t *testing.T) *Keytab {
+	kt := New()
+	for _, p := range []string{"HTTP/a.test.gokrb5", "HTTP/b.test.gokrb5"} {
+		for kvno := uint8(1); kvno <= 3; kvno++ {
+			for _, et := range []int32{etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA1_96} {
+				err := kt.AddEntry(p, "TEST.GOKRB5", "passwordvalue", time.Unix(int64(kvno)*100, 0), kvno, et)
+				if err != nil {
+					t.Fatalf("error adding entry: %v", err)
+				}
+			}
+		}
+	}
+	return kt
+}
+
+func TestKeytab_RemoveEntries(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name      string
+		principal string
+		realm     string
+		kvno      uint32
+		etype     int32
+		removed   int
+	}{
+		{"none matching", "HTTP/c.test.gokrb5", "", 0, 0, 0},
+		{"wrong realm", "HTTP/a.test.gokrb5", "OTHER.GOKRB5", 0, 0, 0},
+		{"principal", "HTTP/a.test.gokrb5", "", 0, 0, 6},
+		{"principal and realm", "HTTP/a.test.gokrb5", "TEST.GOKRB5", 0, 0, 6},
+		{"principal and kvno", "HTTP/a.test.gokrb5", "", 2, 0, 2},
+		{"principal, kvno and etype", "HTTP/a.test.gokrb5", "", 2, etypeID.AES256_CTS_HMAC_SHA1_96, 1},
+		{"kvno", "", "", 1, 0, 4},
+		{"etype", "", "", 0, etypeID.AES128_CTS_HMAC_SHA1_96, 6},
+		{"all", "", "", 0, 0, 12},
+	}
+	for _, test := range tests {
+		kt := editTestKeytab(t)
+		n := kt.RemoveEntries(test.principal, test.realm, test.kvno, test.etype)
+		assert.Equal(t, test.removed, n, "%s: number removed not as expected", test.name)
+		assert.Equal(t, 12-test.removed, len(kt.Entries), "%s: number of entries not as expected", test.name)
+		for _, e := range kt.Entries {
+			assert.False(t, (test.principal == "" || e.Principal.String() == test.principal+"@TEST.GOKRB5") &&
+				(test.realm == "" || e.Principal.Realm == test.realm) &&
+				(test.kvno == 0 || e.KVNO == test.kvno) &&
+				(test.etype == 0 || e.Key.KeyType == test.etype), "%s: matching entry not removed: %s", test.name, e)
+		}
+	}
+}
+
+func TestKeytab_PruneOlderThan(t *testing.T) {
+	t.Parallel()
+	kt := editTestKeytab(t)
+	// Make the entries of the newest KVNO of one principal older than those of previous KVNOs.
+	for i, e := range kt.Entries {
+		if e.Principal.String() == "HTTP/b.test.gokrb5@TEST.GOKRB5" && e.KVNO == 3 {
+			kt.Entries[i].Timestamp = time.Unix(50, 0)
+		}
+	}
+	n := kt.PruneOlderThan(time.Unix(250, 0))
+	assert.Equal(t, 8, n, "number removed not as expected")
+	kvnos := make(map[string][]uint32)
+	for _, e := range kt.Entries {
+		kvnos[e.Principal.String()] = append(kvnos[e.Principal.String()], e.KVNO)
+	}
+	assert.Equal(t, []uint32{3, 3}, kvnos["HTTP/a.test.gokrb5@TEST.GOKRB5"], "KVNOs kept not as expected")
+	assert.Equal(t, []uint32{3, 3}, kvnos["HTTP/b.test.gokrb5@TEST.GOKRB5"], "KVNOs kept not as expected")
+
+	assert.Equal(t, 0, kt.PruneOlderThan(time.Unix(1000, 0)), "entries of the newest KVNO were pruned")
+}
+
+func TestKeytab_Merge(t *testing.T) {
+	t.Parallel()
+	kt := editTestKeytab(t)
+	kt.RemoveEntries("HTTP/b.test.gokrb5", "", 0, 0)
+	other := editTestKeytab(t)
+	other.RemoveEntries("", "", 1, 0)
+	_, err := other.AddRandomKeyEntry("HTTP/a.test.gokrb5", "TEST.GOKRB5", time.Unix(400, 0), 4, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error adding random key entry: %v", err)
+	}
+
+	n := kt.Merge(other)
+	// The four entries of HTTP/b at KVNOs 2 and 3 and the entry of HTTP/a at KVNO 4.
+	assert.Equal(t, 5, n, "number of entries merged not as expected")
+	assert.Equal(t, 11, len(kt.Entries), "number of entries not as expected")
+	pn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/a.test.gokrb5")
+	_, kvno, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting key: %v", err)
+	}
+	assert.Equal(t, 4, kvno, "KVNO of merged key not as expected")
+	assert.Equal(t, 0, kt.Merge(other), "entries merged twice")
+
+	// The merged entries must not share the key bytes of the other keytab.
+	other.Entries[len(other.Entries)-1].Key.KeyValue[0] ^= 0xff
+	assert.NotEqual(t, other.Entries[len(other.Entries)-1].Key, kt.Entries[len(kt.Entries)-1].Key, "merged key bytes shared")
+}
@@ -14,6 +14,7 @@ import (
 	"unsafe"
 
 	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/types"
 )
 
@@ -67,6 +68,28 @@ func New() *Keytab {
 	}
 }
 
+// Version returns the version of the keytab file format, which is 1 or 2, that the keytab is marshaled in.
+func (kt *Keytab) Version() uint8 {
+	return kt.version
+}
+
+// SetVersion sets the version of the keytab file format, which must be 1 or 2, that the keytab is marshaled in.
+// Version 1 keytabs do not hold the name types of principals, so principals without one are given the KRB_NT_PRINCIPAL
+// name type when a keytab is converted to version 2.
+func (kt *Keytab) SetVersion(v uint8) error {
+	if v != 1 && v != 2 {
+		return fmt.Errorf("keytab version %d is not supported, it must be 1 or 2", v)
+	}
+	kt.version = v
+	for i := range kt.Entries {
+		kt.setNumComponents(&kt.Entries[i].Principal)
+		if v == 2 && kt.Entries[i].Principal.NameType == 0 {
+			kt.Entries[i].Principal.NameType = nametype.KRB_NT_PRINCIPAL
+		}
+	}
+	return nil
+}
+
 // GetEncryptionKey returns the EncryptionKey from the Keytab for the newest entry with the required kvno, etype and matching principal.
 // If the kvno is zero then the latest kvno will be returned. The kvno is also returned for
 func (kt *Keytab) GetEncryptionKey(princName types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, int, error) {
@@ -133,26 +156,7 @@ func (kt *Keytab) AddEntry(principalName, realm, password string, ts time.Time,
 		return err
 	}
 
-	// Populate the keytab entry principal
-	ktep := newPrincipal()
-	ktep.NumComponents = int16(len(princ.NameString))
-	if kt.version == 1 {
-		ktep.NumComponents += 1
-	}
-
-	ktep.Realm = realm
-	ktep.Components = princ.NameString
-	ktep.NameType = princ.NameType
-
-	// Populate the keytab entry
-	e := newEntry()
-	e.Principal = ktep
-	e.Timestamp = ts
-	e.KVNO8 = KVNO
-	e.KVNO = uint32(KVNO)
-	e.Key = key
-
-	kt.Entries = append(kt.Entries, e)
+	kt.addKey(princ, realm, key, ts, uint32(KVNO))
 	return nil
 }
 
@@ -391,7 +395,12 @@ func (p principal) marshal(v int) ([]byte, error) {
 	if v == 1 && isNativeEndianLittle() {
 		endian = binary.LittleEndian
 	}
-	endian.PutUint16(b[0:], uint16(p.NumComponents))
+	// The number of components is derived from the components as it includes the realm in version 1.
+	n := len(p.Components)
+	if v == 1 {
+		n++
+	}
+	endian.PutUint16(b[0:], uint16(n))
 	realm, err := marshalString(p.Realm, v)
 	if err != nil {
 		return b, err
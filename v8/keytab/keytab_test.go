@@ -249,3 +249,72 @@ func TestKeytab_GetEncryptionKey(t *testing.T) {
 	}
 	assert.Equal(t, 3, kvno)
 }
+
+func TestKeytab_SetVersion(t *testing.T) {
+	t.Parallel()
+	kt := New()
+	err := kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", time.Unix(100, 0), 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error adding entry: %v", err)
+	}
+	assert.Error(t, kt.SetVersion(3), "unsupported version set")
+	err = kt.SetVersion(1)
+	if err != nil {
+		t.Fatalf("error setting version: %v", err)
+	}
+	b, err := kt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling version 1 keytab: %v", err)
+	}
+	assert.Equal(t, byte(1), b[1], "version not as expected")
+
+	v1 := New()
+	err = v1.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling version 1 keytab: %v", err)
+	}
+	assert.Equal(t, uint8(1), v1.Version(), "version not as expected")
+	assert.Equal(t, []string{"HTTP", "host.test.gokrb5"}, v1.Entries[0].Principal.Components, "principal not as expected")
+	assert.Equal(t, int32(0), v1.Entries[0].Principal.NameType, "version 1 keytab has a name type")
+	mb, err := v1.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling version 1 keytab: %v", err)
+	}
+	assert.Equal(t, b, mb, "version 1 keytab not the same after round trip")
+
+	err = v1.SetVersion(2)
+	if err != nil {
+		t.Fatalf("error setting version: %v", err)
+	}
+	assert.Equal(t, int32(nametype.KRB_NT_PRINCIPAL), v1.Entries[0].Principal.NameType, "name type not as expected")
+	err = kt.SetVersion(2)
+	if err != nil {
+		t.Fatalf("error setting version: %v", err)
+	}
+	assert.Equal(t, kt.Entries, v1.Entries, "entries not as expected after conversion")
+}
+
+func TestMarshal_Version1(t *testing.T) {
+	t.Parallel()
+	kt := New()
+	err := kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", time.Unix(100, 0), 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error adding entry: %v", err)
+	}
+	kt.version = 1
+	b, err := kt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling version 1 keytab: %v", err)
+	}
+	v1 := New()
+	err = v1.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling version 1 keytab: %v", err)
+	}
+	assert.Equal(t, []string{"HTTP", "host.test.gokrb5"}, v1.Entries[0].Principal.Components, "principal not as expected")
+	mb, err := v1.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling version 1 keytab: %v", err)
+	}
+	assert.Equal(t, b, mb, "version 1 keytab not the same after round trip")
+}
@@ -0,0 +1,167 @@
+package keytab
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Source provides a keytab that may be replaced while it is in use, such as when the keys of a service are rotated.
+type Source interface {
+	// Keytab returns the current keytab. The keytab returned must not be modified.
+	Keytab() *Keytab
+}
+
+// FileSource is a Source that loads a keytab file and reloads it when the file changes, so that a long-running service
+// can use new keys without being restarted after they are rotated, for example with msktutil or ktpass.
+//
+// When the file is reloaded the keys of the previous version of the file that are not in the new version are kept, so
+// that tickets encrypted with the previous key version number (KVNO), which clients may hold until they expire, are
+// still accepted. Keys are only kept for one rotation, which is a change to the file that removes keys from it, so a file
+// that is touched or rewritten with the same keys keeps the previous keys. If the file cannot be loaded the current
+// keytab continues to be used and the error is written to the logger.
+type FileSource struct {
+	path   string
+	logger *log.Logger
+	kt     atomic.Value // *Keytab in use
+
+	mux    sync.Mutex // serialises reloads
+	loaded *Keytab    // keytab last loaded from the file
+	prev   *Keytab    // keytab loaded from the file before the last rotation
+	state  fileState  // state of the file when last loaded
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// fileState is the modification time and size of a file, used to detect that it has changed.
+type fileState struct {
+	modTime int64
+	size    int64
+}
+
+// NewFileSource loads the keytab file at the path and returns a source of its keytab. If the interval is greater than
+// zero the file is checked for changes at the interval and reloaded when it has changed, until the source is closed.
+// Reload errors are written to the logger if one is provided.
+func NewFileSource(path string, interval time.Duration, l *log.Logger) (*FileSource, error) {
+	s := &FileSource{
+		path:   path,
+		logger: l,
+		stop:   make(chan struct{}),
+	}
+	err := s.Reload()
+	if err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		go s.poll(interval)
+	}
+	return s, nil
+}
+
+// Keytab returns the current keytab, which holds the keys of the file as last loaded and those of the previous version
+// of the file that are not in it.
+func (s *FileSource) Keytab() *Keytab {
+	return s.kt.Load().(*Keytab)
+}
+
+// Reload loads the keytab file and replaces the current keytab with it. If the file cannot be loaded the current keytab
+// is kept and the error is returned.
+func (s *FileSource) Reload() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("error reading keytab file: %v", err)
+	}
+	kt, err := Load(s.path)
+	if err != nil {
+		return fmt.Errorf("error loading keytab file %s: %v", s.path, err)
+	}
+	if s.loaded != nil && rotated(kt, s.loaded) {
+		s.prev = s.loaded
+	}
+	if s.prev != nil {
+		s.kt.Store(withPrevious(kt, s.prev))
+	} else {
+		s.kt.Store(kt)
+	}
+	s.loaded = kt
+	s.state = fileState{modTime: fi.ModTime().UnixNano(), size: fi.Size()}
+	return nil
+}
+
+// Close stops checking the keytab file for changes. The current keytab remains available.
+func (s *FileSource) Close() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// poll reloads the keytab file at each interval if it has changed, until the source is closed.
+func (s *FileSource) poll(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var failed fileState
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			st, ok := s.changed()
+			if !ok || st == failed {
+				continue
+			}
+			// A file that is being rewritten may not be complete, in which case it is loaded once it changes again.
+			if err := s.Reload(); err != nil {
+				failed = st
+				s.log("%v", err)
+				continue
+			}
+			s.log("keytab file %s reloaded", s.path)
+		}
+	}
+}
+
+// changed returns the state of the keytab file and indicates if it has been modified since it was last loaded.
+func (s *FileSource) changed() (fileState, bool) {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return fileState{}, false
+	}
+	st := fileState{modTime: fi.ModTime().UnixNano(), size: fi.Size()}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return st, st != s.state
+}
+
+// log will write to the source's logger if it is configured.
+func (s *FileSource) log(format string, v ...interface{}) {
+	if s.logger != nil {
+		s.logger.Output(2, fmt.Sprintf(format, v...))
+	}
+}
+
+// rotated indicates if the keytab does not have all the keys of the previous keytab, in which case keys have been
+// rotated.
+func rotated(kt, prev *Keytab) bool {
+	return len(withPrevious(kt, prev).Entries) > len(kt.Entries)
+}
+
+// withPrevious returns a keytab holding the entries of the keytab and the entries of the previous keytab for which it
+// does not have an entry with the same principal, key version number and encryption type.
+func withPrevious(kt, prev *Keytab) *Keytab {
+	merged := &Keytab{
+		version: kt.version,
+		Entries: append([]entry{}, kt.Entries...),
+	}
+	for _, p := range prev.Entries {
+		if !kt.hasKey(p) {
+			merged.Entries = append(merged.Entries, p)
+		}
+	}
+	return merged
+}
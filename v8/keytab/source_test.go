@@ -0,0 +1,153 @@
+package keytab
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeSourceTestKeytab(t *testing.T, path string, kvno uint8, mtime time.Time) {
+	kt := New()
+	err := kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "password", time.Unix(int64(kvno)*100, 0), kvno, 18)
+	if err != nil {
+		t.Fatalf("error adding keytab entry: %v", err)
+	}
+	b, err := kt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling keytab: %v", err)
+	}
+	err = ioutil.WriteFile(path, b, 0600)
+	if err != nil {
+		t.Fatalf("error writing keytab: %v", err)
+	}
+	// Set the modification time as the file may otherwise appear unchanged when rewritten within its resolution.
+	err = os.Chtimes(path, mtime, mtime)
+	if err != nil {
+		t.Fatalf("error setting keytab modification time: %v", err)
+	}
+}
+
+// waitForSourceLog reads the log of a source until it has the text. The file is rewritten in place, as tools that rotate
+// keys do, so it may be read while it is incomplete and other messages logged first.
+func waitForSourceLog(t *testing.T, r io.Reader, text string) {
+	var log []byte
+	b := make([]byte, 1024)
+	for !strings.Contains(string(log), text) {
+		n, err := r.Read(b)
+		if err != nil {
+			t.Fatalf("error reading log for %q: %v", text, err)
+		}
+		log = append(log, b[:n]...)
+	}
+}
+
+func sourceKVNOs(src Source) []int {
+	pn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	var kvnos []int
+	for kvno := 1; kvno <= 3; kvno++ {
+		if _, _, err := src.Keytab().GetEncryptionKey(pn, "TEST.GOKRB5", kvno, 18); err == nil {
+			kvnos = append(kvnos, kvno)
+		}
+	}
+	return kvnos
+}
+
+func TestFileSource(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "gokrb5-keytab")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "krb5.keytab")
+	now := time.Now()
+	writeSourceTestKeytab(t, path, 1, now.Add(-time.Hour))
+
+	src, err := NewFileSource(path, 0, nil)
+	if err != nil {
+		t.Fatalf("error creating keytab source: %v", err)
+	}
+	assert.Equal(t, []int{1}, sourceKVNOs(src), "keys of the keytab not as expected")
+
+	writeSourceTestKeytab(t, path, 2, now.Add(-time.Minute))
+	err = src.Reload()
+	if err != nil {
+		t.Fatalf("error reloading keytab: %v", err)
+	}
+	assert.Equal(t, []int{1, 2}, sourceKVNOs(src), "keys of the previous keytab should be kept")
+
+	// Reloading the file when it is unchanged, touched or rewritten with the same keys is not a rotation.
+	err = src.Reload()
+	if err != nil {
+		t.Fatalf("error reloading keytab: %v", err)
+	}
+	assert.Equal(t, []int{1, 2}, sourceKVNOs(src), "keys of the previous keytab should be kept when reloaded unchanged")
+	writeSourceTestKeytab(t, path, 2, now.Add(-time.Second))
+	err = src.Reload()
+	if err != nil {
+		t.Fatalf("error reloading keytab: %v", err)
+	}
+	assert.Equal(t, []int{1, 2}, sourceKVNOs(src), "keys of the previous keytab should be kept when rewritten with the same keys")
+
+	writeSourceTestKeytab(t, path, 3, now)
+	err = src.Reload()
+	if err != nil {
+		t.Fatalf("error reloading keytab: %v", err)
+	}
+	assert.Equal(t, []int{2, 3}, sourceKVNOs(src), "keys should only be kept for one rotation")
+
+	err = ioutil.WriteFile(path, []byte{0x05}, 0600)
+	if err != nil {
+		t.Fatalf("error writing keytab: %v", err)
+	}
+	err = src.Reload()
+	assert.Error(t, err, "error expected reloading an invalid keytab")
+	assert.Equal(t, []int{2, 3}, sourceKVNOs(src), "keytab should be kept when the file cannot be reloaded")
+
+	_, err = NewFileSource(filepath.Join(dir, "missing.keytab"), 0, nil)
+	assert.Error(t, err, "error expected creating a source of a missing keytab file")
+}
+
+func TestFileSource_Poll(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "gokrb5-keytab")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "krb5.keytab")
+	now := time.Now()
+	writeSourceTestKeytab(t, path, 1, now.Add(-time.Hour))
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("error creating pipe: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+	src, err := NewFileSource(path, 5*time.Millisecond, log.New(w, "", 0))
+	if err != nil {
+		t.Fatalf("error creating keytab source: %v", err)
+	}
+	defer src.Close()
+
+	err = ioutil.WriteFile(path, []byte{0x05}, 0600)
+	if err != nil {
+		t.Fatalf("error writing keytab: %v", err)
+	}
+	waitForSourceLog(t, r, "error loading keytab file")
+	assert.Equal(t, []int{1}, sourceKVNOs(src), "keytab should be kept when the file cannot be reloaded")
+
+	writeSourceTestKeytab(t, path, 2, now)
+	waitForSourceLog(t, r, "reloaded")
+	assert.Equal(t, []int{1, 2}, sourceKVNOs(src), "changed keytab should be reloaded")
+}
@@ -5,7 +5,11 @@ import (
 	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/types"
@@ -13,9 +17,10 @@ import (
 
 // APRep implements RFC 4120 KRB_AP_REP: https://tools.ietf.org/html/rfc4120#section-5.5.2.
 type APRep struct {
-	PVNO    int                 `asn1:"explicit,tag:0"`
-	MsgType int                 `asn1:"explicit,tag:1"`
-	EncPart types.EncryptedData `asn1:"explicit,tag:2"`
+	PVNO             int                 `asn1:"explicit,tag:0"`
+	MsgType          int                 `asn1:"explicit,tag:1"`
+	EncPart          types.EncryptedData `asn1:"explicit,tag:2"`
+	DecryptedEncPart EncAPRepPart        `asn1:"optional,omitempty"` // Not part of ASN1 bytes so marked as optional so unmarshalling works
 }
 
 // EncAPRepPart is the encrypted part of KRB_AP_REP.
@@ -26,6 +31,15 @@ type EncAPRepPart struct {
 	SequenceNumber int64               `asn1:"optional,explicit,tag:3"`
 }
 
+// NewAPRep returns a new APRep type. EncryptEncPart must be called with the session key before it is marshaled.
+func NewAPRep(part EncAPRepPart) APRep {
+	return APRep{
+		PVNO:             iana.PVNO,
+		MsgType:          msgtype.KRB_AP_REP,
+		DecryptedEncPart: part,
+	}
+}
+
 // Unmarshal bytes b into the APRep struct.
 func (a *APRep) Unmarshal(b []byte) error {
 	_, err := asn1.UnmarshalWithParams(b, a, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.APREP))
@@ -47,3 +61,72 @@ func (a *EncAPRepPart) Unmarshal(b []byte) error {
 	}
 	return nil
 }
+
+// Marshal the APRep.
+func (a *APRep) Marshal() ([]byte, error) {
+	m := APRep{
+		PVNO:    a.PVNO,
+		MsgType: a.MsgType,
+		EncPart: a.EncPart,
+	}
+	b, err := asn1.Marshal(m)
+	if err != nil {
+		return []byte{}, krberror.Errorf(err, krberror.EncodingError, "marshaling error of AP_REP")
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.APREP)
+	return b, nil
+}
+
+// Marshal the EncAPRepPart.
+func (a *EncAPRepPart) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*a)
+	if err != nil {
+		return []byte{}, krberror.Errorf(err, krberror.EncodingError, "marshaling error of AP_REP encrypted part")
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncAPRepPart)
+	return b, nil
+}
+
+// EncryptEncPart encrypts the DecryptedEncPart within the APRep with the session key of the ticket in the AP_REQ.
+// Use to prepare for marshaling.
+func (a *APRep) EncryptEncPart(sessionKey types.EncryptionKey) error {
+	b, err := a.DecryptedEncPart.Marshal()
+	if err != nil {
+		return err
+	}
+	a.EncPart, err = crypto.GetEncryptedData(b, sessionKey, keyusage.AP_REP_ENCPART, 0)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncryptingError, "error encrypting AP_REP EncPart")
+	}
+	return nil
+}
+
+// DecryptEncPart decrypts the encrypted part of the AP_REP with the session key of the ticket in the AP_REQ.
+func (a *APRep) DecryptEncPart(sessionKey types.EncryptionKey) error {
+	b, err := crypto.DecryptEncPart(a.EncPart, sessionKey, keyusage.AP_REP_ENCPART)
+	if err != nil {
+		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting AP_REP EncPart")
+	}
+	var denc EncAPRepPart
+	err = denc.Unmarshal(b)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling encrypted part of AP_REP")
+	}
+	a.DecryptedEncPart = denc
+	return nil
+}
+
+// Verify the AP_REP sent by the service for mutual authentication.
+// The encrypted part is decrypted with the session key and its ctime and cusec must match those of the authenticator
+// sent in the AP_REQ.
+func (a *APRep) Verify(sessionKey types.EncryptionKey, auth types.Authenticator) (bool, error) {
+	err := a.DecryptEncPart(sessionKey)
+	if err != nil {
+		return false, err
+	}
+	// The ctime is encoded to a precision of seconds
+	if !a.DecryptedEncPart.CTime.Equal(auth.CTime.Truncate(time.Second)) || a.DecryptedEncPart.Cusec != auth.Cusec {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "AP_REP ctime and cusec do not match those of the authenticator")
+	}
+	return true, nil
+}
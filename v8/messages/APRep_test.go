@@ -5,9 +5,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/crypto"
 	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -67,3 +74,45 @@ func TestUnmarshalEncAPRepPart_optionalsNULL(t *testing.T) {
 	assert.Equal(t, tt, a.CTime, "CTime not as expected")
 	assert.Equal(t, 123456, a.Cusec, "Client microseconds not as expected")
 }
+
+func TestAPRep_Verify(t *testing.T) {
+	t.Parallel()
+	key := testArmorKey(t)
+	auth, err := types.NewAuthenticator(testdata.TEST_REALM, types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"))
+	if err != nil {
+		t.Fatalf("error creating authenticator: %v", err)
+	}
+	encPart := EncAPRepPart{
+		CTime:          auth.CTime.Truncate(time.Second),
+		Cusec:          auth.Cusec,
+		Subkey:         testArmorKey(t),
+		SequenceNumber: 42,
+	}
+	b, err := asn1.Marshal(encPart)
+	if err != nil {
+		t.Fatalf("error marshaling EncAPRepPart: %v", err)
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncAPRepPart)
+	ed, err := crypto.GetEncryptedData(b, key, keyusage.AP_REP_ENCPART, 1)
+	if err != nil {
+		t.Fatalf("error encrypting EncAPRepPart: %v", err)
+	}
+	a := APRep{
+		PVNO:    iana.PVNO,
+		MsgType: msgtype.KRB_AP_REP,
+		EncPart: ed,
+	}
+	ok, err := a.Verify(key, auth)
+	assert.NoError(t, err)
+	assert.True(t, ok, "AP_REP not valid")
+	assert.Equal(t, encPart.Subkey, a.DecryptedEncPart.Subkey, "subkey not as expected")
+	assert.Equal(t, int64(42), a.DecryptedEncPart.SequenceNumber, "sequence number not as expected")
+
+	ok, err = a.Verify(testArmorKey(t), auth)
+	assert.Error(t, err, "AP_REP should not decrypt with another key")
+	assert.False(t, ok)
+	auth.Cusec++
+	ok, err = a.Verify(key, auth)
+	assert.Error(t, err, "AP_REP should not be valid for another authenticator")
+	assert.False(t, ok)
+}
@@ -0,0 +1,438 @@
+package messages
+
+// Reference: https://tools.ietf.org/html/rfc6113
+// Section: 5.4
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// FAST armor types.
+const (
+	FXFastArmorAPRequest int32 = 1
+)
+
+// KrbFastArmor implements RFC 6113 KrbFastArmor: https://tools.ietf.org/html/rfc6113#section-5.4.1
+type KrbFastArmor struct {
+	ArmorType  int32  `asn1:"explicit,tag:0"`
+	ArmorValue []byte `asn1:"explicit,tag:1"`
+}
+
+// KrbFastArmoredReq implements RFC 6113 KrbFastArmoredReq: https://tools.ietf.org/html/rfc6113#section-5.4.2
+type KrbFastArmoredReq struct {
+	Armor            KrbFastArmor        `asn1:"explicit,optional,tag:0"`
+	ReqChecksum      types.Checksum      `asn1:"explicit,tag:1"`
+	EncFastReq       types.EncryptedData `asn1:"explicit,tag:2"`
+	DecryptedEncPart KrbFastReq          `asn1:"optional"` // Not part of ASN1 bytes so marked as optional so unmarshalling works
+}
+
+type marshalKrbFastArmoredReq struct {
+	Armor       KrbFastArmor        `asn1:"explicit,optional,tag:0"`
+	ReqChecksum types.Checksum      `asn1:"explicit,tag:1"`
+	EncFastReq  types.EncryptedData `asn1:"explicit,tag:2"`
+}
+
+// KrbFastReq implements RFC 6113 KrbFastReq: https://tools.ietf.org/html/rfc6113#section-5.4.2
+type KrbFastReq struct {
+	FastOptions asn1.BitString
+	PAData      types.PADataSequence
+	ReqBody     KDCReqBody
+}
+
+type marshalKrbFastReq struct {
+	FastOptions asn1.BitString       `asn1:"explicit,tag:0"`
+	PAData      types.PADataSequence `asn1:"explicit,tag:1"`
+	ReqBody     asn1.RawValue        `asn1:"explicit,tag:2"`
+}
+
+// KrbFastArmoredRep implements RFC 6113 KrbFastArmoredRep: https://tools.ietf.org/html/rfc6113#section-5.4.3
+type KrbFastArmoredRep struct {
+	EncFastRep       types.EncryptedData `asn1:"explicit,tag:0"`
+	DecryptedEncPart KrbFastResponse     `asn1:"optional"` // Not part of ASN1 bytes so marked as optional so unmarshalling works
+}
+
+type marshalKrbFastArmoredRep struct {
+	EncFastRep types.EncryptedData `asn1:"explicit,tag:0"`
+}
+
+// KrbFastResponse implements RFC 6113 KrbFastResponse: https://tools.ietf.org/html/rfc6113#section-5.4.3
+type KrbFastResponse struct {
+	PAData        types.PADataSequence `asn1:"explicit,tag:0"`
+	StrengthenKey types.EncryptionKey  `asn1:"explicit,optional,tag:1"`
+	Finished      KrbFastFinished      `asn1:"explicit,optional,tag:2"`
+	Nonce         int                  `asn1:"explicit,tag:3"`
+}
+
+// KrbFastFinished implements RFC 6113 KrbFastFinished: https://tools.ietf.org/html/rfc6113#section-5.4.3
+type KrbFastFinished struct {
+	Timestamp      time.Time           `asn1:"generalized,explicit,tag:0"`
+	Usec           int                 `asn1:"explicit,tag:1"`
+	CRealm         string              `asn1:"generalstring,explicit,tag:2"`
+	CName          types.PrincipalName `asn1:"explicit,tag:3"`
+	TicketChecksum types.Checksum      `asn1:"explicit,tag:4"`
+}
+
+// NewFASTArmorAPReq generates the FAST armor from a TGT, the session key of the TGT and the client principal the TGT was
+// issued to. The armor key to use with the armor is also returned.
+//
+// The armor key is KRB-FX-CF2(subkey, ticket session key, "subkeyarmor", "ticketarmor").
+func NewFASTArmorAPReq(tgt Ticket, sessionKey types.EncryptionKey, cname types.PrincipalName, crealm string) (KrbFastArmor, types.EncryptionKey, error) {
+	var armor KrbFastArmor
+	var armorKey types.EncryptionKey
+	etype, err := crypto.GetEtype(sessionKey.KeyType)
+	if err != nil {
+		return armor, armorKey, krberror.Errorf(err, krberror.EncryptingError, "error getting etype for FAST armor")
+	}
+	auth, err := types.NewAuthenticator(crealm, cname)
+	if err != nil {
+		return armor, armorKey, krberror.Errorf(err, krberror.KRBMsgError, "error generating new authenticator for FAST armor")
+	}
+	err = auth.GenerateSeqNumberAndSubKey(etype.GetETypeID(), etype.GetKeyByteSize())
+	if err != nil {
+		return armor, armorKey, krberror.Errorf(err, krberror.KRBMsgError, "error generating subkey for FAST armor")
+	}
+	// The armor AP_REQ is an AP_REQ in its own right rather than a PA-TGS-REQ
+	apReq, err := newAPReq(tgt, sessionKey, auth, keyusage.AP_REQ_AUTHENTICATOR)
+	if err != nil {
+		return armor, armorKey, krberror.Errorf(err, krberror.KRBMsgError, "error generating AP_REQ for FAST armor")
+	}
+	b, err := apReq.Marshal()
+	if err != nil {
+		return armor, armorKey, krberror.Errorf(err, krberror.EncodingError, "error marshaling AP_REQ for FAST armor")
+	}
+	armorKey, err = crypto.KRBFXCF2(auth.SubKey, sessionKey, "subkeyarmor", "ticketarmor")
+	if err != nil {
+		return armor, armorKey, krberror.Errorf(err, krberror.EncryptingError, "error generating FAST armor key")
+	}
+	armor = KrbFastArmor{
+		ArmorType:  FXFastArmorAPRequest,
+		ArmorValue: b,
+	}
+	return armor, armorKey, nil
+}
+
+// NewKrbFastArmoredReq generates a new KrbFastArmoredReq.
+//
+// The armor is optional and should be nil for TGS requests using the implicit armor of the TGS_REQ's authenticator subkey.
+// The req-checksum is calculated over the chksumData provided which should be the marshaled KDC_REQ body for AS
+// requests and the marshaled AP_REQ within the PA-TGS-REQ for TGS requests.
+func NewKrbFastArmoredReq(armor *KrbFastArmor, armorKey types.EncryptionKey, fastReq KrbFastReq, chksumData []byte) (KrbFastArmoredReq, error) {
+	var a KrbFastArmoredReq
+	etype, err := crypto.GetEtype(armorKey.KeyType)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.ChksumError, "error getting etype for FAST armor key")
+	}
+	cb, err := etype.GetChecksumHash(armorKey.KeyValue, chksumData, keyusage.KEY_USAGE_FAST_REQ_CHKSUM)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.ChksumError, "error calculating FAST request checksum")
+	}
+	b, err := fastReq.Marshal()
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastReq")
+	}
+	ed, err := crypto.GetEncryptedData(b, armorKey, keyusage.KEY_USAGE_FAST_ENC, 0)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncryptingError, "error encrypting KrbFastReq")
+	}
+	a = KrbFastArmoredReq{
+		ReqChecksum: types.Checksum{
+			CksumType: etype.GetHashID(),
+			Checksum:  cb,
+		},
+		EncFastReq:       ed,
+		DecryptedEncPart: fastReq,
+	}
+	if armor != nil {
+		a.Armor = *armor
+	}
+	return a, nil
+}
+
+// Marshal the KrbFastReq.
+func (k *KrbFastReq) Marshal() ([]byte, error) {
+	m := marshalKrbFastReq{
+		FastOptions: k.FastOptions,
+		PAData:      k.PAData,
+	}
+	if m.PAData == nil {
+		m.PAData = types.PADataSequence{}
+	}
+	b, err := k.ReqBody.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	m.ReqBody = asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		IsCompound: true,
+		Tag:        2,
+		Bytes:      b,
+	}
+	mk, err := asn1.Marshal(m)
+	if err != nil {
+		return mk, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastReq")
+	}
+	return mk, nil
+}
+
+// Unmarshal bytes b into the KrbFastReq.
+func (k *KrbFastReq) Unmarshal(b []byte) error {
+	var m marshalKrbFastReq
+	_, err := asn1.Unmarshal(b, &m)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastReq")
+	}
+	var reqb KDCReqBody
+	err = reqb.Unmarshal(m.ReqBody.Bytes)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error processing KrbFastReq body")
+	}
+	k.FastOptions = m.FastOptions
+	k.PAData = m.PAData
+	k.ReqBody = reqb
+	return nil
+}
+
+// Marshal the KrbFastArmoredReq into the bytes of a PA-FX-FAST-REQUEST.
+func (a *KrbFastArmoredReq) Marshal() ([]byte, error) {
+	m := marshalKrbFastArmoredReq{
+		Armor:       a.Armor,
+		ReqChecksum: a.ReqChecksum,
+		EncFastReq:  a.EncFastReq,
+	}
+	b, err := asn1.Marshal(m)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastArmoredReq")
+	}
+	return marshalFASTChoice(b)
+}
+
+// Unmarshal bytes b, the value of a PA-FX-FAST-REQUEST, into the KrbFastArmoredReq.
+func (a *KrbFastArmoredReq) Unmarshal(b []byte) error {
+	b, err := unmarshalFASTChoice(b)
+	if err != nil {
+		return err
+	}
+	var m marshalKrbFastArmoredReq
+	_, err = asn1.Unmarshal(b, &m)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastArmoredReq")
+	}
+	a.Armor = m.Armor
+	a.ReqChecksum = m.ReqChecksum
+	a.EncFastReq = m.EncFastReq
+	return nil
+}
+
+// DecryptEncPart decrypts the KrbFastReq within the KrbFastArmoredReq using the armor key.
+func (a *KrbFastArmoredReq) DecryptEncPart(armorKey types.EncryptionKey) error {
+	b, err := crypto.DecryptEncPart(a.EncFastReq, armorKey, keyusage.KEY_USAGE_FAST_ENC)
+	if err != nil {
+		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting KrbFastReq")
+	}
+	var r KrbFastReq
+	err = r.Unmarshal(b)
+	if err != nil {
+		return err
+	}
+	a.DecryptedEncPart = r
+	return nil
+}
+
+// VerifyChecksum verifies the req-checksum of the KrbFastArmoredReq against the data provided.
+func (a *KrbFastArmoredReq) VerifyChecksum(armorKey types.EncryptionKey, chksumData []byte) bool {
+	etype, err := crypto.GetChksumEtype(a.ReqChecksum.CksumType)
+	if err != nil {
+		return false
+	}
+	return etype.VerifyChecksum(armorKey.KeyValue, chksumData, a.ReqChecksum.Checksum, keyusage.KEY_USAGE_FAST_REQ_CHKSUM)
+}
+
+// PAData returns the KrbFastArmoredReq as PA-FX-FAST PAData.
+func (a *KrbFastArmoredReq) PAData() (types.PAData, error) {
+	b, err := a.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return types.PAData{
+		PADataType:  patype.PA_FX_FAST,
+		PADataValue: b,
+	}, nil
+}
+
+// NewKrbFastArmoredRep generates a new KrbFastArmoredRep with the KrbFastResponse encrypted with the armor key.
+func NewKrbFastArmoredRep(armorKey types.EncryptionKey, r KrbFastResponse) (KrbFastArmoredRep, error) {
+	var a KrbFastArmoredRep
+	b, err := r.Marshal()
+	if err != nil {
+		return a, err
+	}
+	ed, err := crypto.GetEncryptedData(b, armorKey, keyusage.KEY_USAGE_FAST_REP, 0)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncryptingError, "error encrypting KrbFastResponse")
+	}
+	a = KrbFastArmoredRep{
+		EncFastRep:       ed,
+		DecryptedEncPart: r,
+	}
+	return a, nil
+}
+
+// Marshal the KrbFastArmoredRep into the bytes of a PA-FX-FAST-REPLY.
+func (a *KrbFastArmoredRep) Marshal() ([]byte, error) {
+	m := marshalKrbFastArmoredRep{
+		EncFastRep: a.EncFastRep,
+	}
+	b, err := asn1.Marshal(m)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastArmoredRep")
+	}
+	return marshalFASTChoice(b)
+}
+
+// Unmarshal bytes b, the value of a PA-FX-FAST-REPLY, into the KrbFastArmoredRep.
+func (a *KrbFastArmoredRep) Unmarshal(b []byte) error {
+	b, err := unmarshalFASTChoice(b)
+	if err != nil {
+		return err
+	}
+	var m marshalKrbFastArmoredRep
+	_, err = asn1.Unmarshal(b, &m)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastArmoredRep")
+	}
+	a.EncFastRep = m.EncFastRep
+	return nil
+}
+
+// DecryptEncPart decrypts the KrbFastResponse within the KrbFastArmoredRep using the armor key.
+func (a *KrbFastArmoredRep) DecryptEncPart(armorKey types.EncryptionKey) error {
+	b, err := crypto.DecryptEncPart(a.EncFastRep, armorKey, keyusage.KEY_USAGE_FAST_REP)
+	if err != nil {
+		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting KrbFastResponse")
+	}
+	var r KrbFastResponse
+	err = r.Unmarshal(b)
+	if err != nil {
+		return err
+	}
+	a.DecryptedEncPart = r
+	return nil
+}
+
+// PAData returns the KrbFastArmoredRep as PA-FX-FAST PAData.
+func (a *KrbFastArmoredRep) PAData() (types.PAData, error) {
+	b, err := a.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return types.PAData{
+		PADataType:  patype.PA_FX_FAST,
+		PADataValue: b,
+	}, nil
+}
+
+// Marshal the KrbFastResponse.
+func (r *KrbFastResponse) Marshal() ([]byte, error) {
+	m := *r
+	if m.PAData == nil {
+		m.PAData = types.PADataSequence{}
+	}
+	b, err := asn1.Marshal(m)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastResponse")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the KrbFastResponse.
+func (r *KrbFastResponse) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, r)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastResponse")
+	}
+	return nil
+}
+
+// StrengthenReplyKey returns the reply key to use to decrypt the KDC_REP encrypted part.
+// If the KrbFastResponse contains a strengthen-key the reply key is KRB-FX-CF2(strengthen-key, reply-key, "strengthenkey", "replykey")
+// otherwise the reply key provided is returned unchanged.
+func (r *KrbFastResponse) StrengthenReplyKey(replyKey types.EncryptionKey) (types.EncryptionKey, error) {
+	if len(r.StrengthenKey.KeyValue) == 0 {
+		return replyKey, nil
+	}
+	key, err := crypto.KRBFXCF2(r.StrengthenKey, replyKey, "strengthenkey", "replykey")
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.EncryptingError, "error strengthening FAST reply key")
+	}
+	return key, nil
+}
+
+// VerifyFinished checks the ticket-checksum within the KrbFastFinished is valid for the ticket provided.
+func (r *KrbFastResponse) VerifyFinished(armorKey types.EncryptionKey, tkt Ticket) error {
+	if r.Finished.TicketChecksum.CksumType == 0 {
+		return krberror.NewErrorf(krberror.KRBMsgError, "FAST response does not contain a finished field")
+	}
+	etype, err := crypto.GetChksumEtype(r.Finished.TicketChecksum.CksumType)
+	if err != nil {
+		return krberror.Errorf(err, krberror.ChksumError, "FAST finished ticket checksum type not supported")
+	}
+	b, err := tkt.Marshal()
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error marshaling ticket to verify FAST finished checksum")
+	}
+	if !etype.VerifyChecksum(armorKey.KeyValue, b, r.Finished.TicketChecksum.Checksum, keyusage.KEY_USAGE_FAST_FINISHED) {
+		return krberror.NewErrorf(krberror.ChksumError, "FAST finished ticket checksum is not valid")
+	}
+	return nil
+}
+
+// marshalFASTChoice wraps the bytes in the armored-data [0] choice of the PA-FX-FAST-REQUEST and PA-FX-FAST-REPLY types.
+func marshalFASTChoice(b []byte) ([]byte, error) {
+	r := asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		IsCompound: true,
+		Tag:        0,
+		Bytes:      b,
+	}
+	mk, err := asn1.Marshal(r)
+	if err != nil {
+		return mk, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-FX-FAST armored data")
+	}
+	return mk, nil
+}
+
+// unmarshalFASTChoice extracts the bytes from the armored-data [0] choice of the PA-FX-FAST-REQUEST and PA-FX-FAST-REPLY types.
+func unmarshalFASTChoice(b []byte) ([]byte, error) {
+	var r asn1.RawValue
+	_, err := asn1.Unmarshal(b, &r)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-FX-FAST")
+	}
+	if r.Class != asn1.ClassContextSpecific || r.Tag != 0 {
+		return nil, krberror.NewErrorf(krberror.EncodingError, "PA-FX-FAST choice not supported: class %d tag %d", r.Class, r.Tag)
+	}
+	return r.Bytes, nil
+}
+
+// GetFASTArmoredRep returns the KrbFastArmoredRep from the PA-FX-FAST PAData within the PAData sequence provided.
+func GetFASTArmoredRep(pas types.PADataSequence) (KrbFastArmoredRep, bool, error) {
+	var a KrbFastArmoredRep
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_FX_FAST {
+			err := a.Unmarshal(pa.PADataValue)
+			if err != nil {
+				return a, true, fmt.Errorf("error unmarshaling PA-FX-FAST reply: %v", err)
+			}
+			return a, true, nil
+		}
+	}
+	return a, false, nil
+}
@@ -0,0 +1,138 @@
+package messages
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testArmorKey(t *testing.T) types.EncryptionKey {
+	et, err := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting etype: %v", err)
+	}
+	k, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	return k
+}
+
+func TestKrbFastArmoredReq_RoundTrip(t *testing.T) {
+	t.Parallel()
+	var body KDCReqBody
+	b, err := hex.DecodeString(testdata.MarshaledKRB5kdc_req_body)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	err = body.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	armorKey := testArmorKey(t)
+	armor := KrbFastArmor{ArmorType: FXFastArmorAPRequest, ArmorValue: []byte{1, 2, 3}}
+	fastReq := KrbFastReq{
+		FastOptions: types.NewKrbFlags(),
+		PAData:      types.PADataSequence{types.PAData{PADataType: patype.PA_FX_COOKIE, PADataValue: []byte("cookie")}},
+		ReqBody:     body,
+	}
+	a, err := NewKrbFastArmoredReq(&armor, armorKey, fastReq, b)
+	if err != nil {
+		t.Fatalf("error creating armored request: %v", err)
+	}
+	pa, err := a.PAData()
+	if err != nil {
+		t.Fatalf("error marshaling armored request PAData: %v", err)
+	}
+	assert.Equal(t, patype.PA_FX_FAST, pa.PADataType, "PAData type not as expected")
+
+	var u KrbFastArmoredReq
+	err = u.Unmarshal(pa.PADataValue)
+	if err != nil {
+		t.Fatalf("error unmarshaling armored request: %v", err)
+	}
+	assert.Equal(t, armor, u.Armor, "armor not as expected")
+	assert.True(t, u.VerifyChecksum(armorKey, b), "request checksum not valid")
+	assert.False(t, u.VerifyChecksum(armorKey, []byte("other")), "request checksum should not be valid for other data")
+	err = u.DecryptEncPart(armorKey)
+	if err != nil {
+		t.Fatalf("error decrypting armored request: %v", err)
+	}
+	assert.Equal(t, fastReq.PAData, u.DecryptedEncPart.PAData, "inner PAData not as expected")
+	assert.Equal(t, body.Nonce, u.DecryptedEncPart.ReqBody.Nonce, "request body nonce not as expected")
+	assert.Equal(t, body.SName, u.DecryptedEncPart.ReqBody.SName, "request body sname not as expected")
+	err = u.DecryptEncPart(testArmorKey(t))
+	assert.Error(t, err, "decryption with the wrong armor key should fail")
+}
+
+func TestKrbFastArmoredRep_RoundTrip(t *testing.T) {
+	t.Parallel()
+	var tkt Ticket
+	b, err := hex.DecodeString(testdata.MarshaledKRB5ticket)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	err = tkt.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	armorKey := testArmorKey(t)
+	et, _ := crypto.GetEtype(armorKey.KeyType)
+	cb, err := et.GetChecksumHash(armorKey.KeyValue, b, keyusage.KEY_USAGE_FAST_FINISHED)
+	if err != nil {
+		t.Fatalf("error generating ticket checksum: %v", err)
+	}
+	r := KrbFastResponse{
+		PAData:        types.PADataSequence{types.PAData{PADataType: patype.PA_FX_COOKIE, PADataValue: []byte("cookie")}},
+		StrengthenKey: testArmorKey(t),
+		Finished: KrbFastFinished{
+			Timestamp:      time.Now().UTC().Truncate(time.Second),
+			CRealm:         testdata.TEST_REALM,
+			CName:          tkt.SName,
+			TicketChecksum: types.Checksum{CksumType: et.GetHashID(), Checksum: cb},
+		},
+		Nonce: 42,
+	}
+	a, err := NewKrbFastArmoredRep(armorKey, r)
+	if err != nil {
+		t.Fatalf("error creating armored reply: %v", err)
+	}
+	pa, err := a.PAData()
+	if err != nil {
+		t.Fatalf("error marshaling armored reply PAData: %v", err)
+	}
+	u, ok, err := GetFASTArmoredRep(types.PADataSequence{types.PAData{PADataType: patype.PA_REQ_ENC_PA_REP}, pa})
+	if err != nil {
+		t.Fatalf("error getting armored reply: %v", err)
+	}
+	assert.True(t, ok, "armored reply not found")
+	err = u.DecryptEncPart(armorKey)
+	if err != nil {
+		t.Fatalf("error decrypting armored reply: %v", err)
+	}
+	assert.Equal(t, r.Nonce, u.DecryptedEncPart.Nonce, "nonce not as expected")
+	assert.Equal(t, r.PAData, u.DecryptedEncPart.PAData, "PAData not as expected")
+	assert.Equal(t, r.StrengthenKey, u.DecryptedEncPart.StrengthenKey, "strengthen key not as expected")
+	assert.Equal(t, r.Finished.CRealm, u.DecryptedEncPart.Finished.CRealm, "finished crealm not as expected")
+	assert.NoError(t, u.DecryptedEncPart.VerifyFinished(armorKey, tkt), "finished ticket checksum not valid")
+	assert.Error(t, u.DecryptedEncPart.VerifyFinished(testArmorKey(t), tkt), "finished ticket checksum should not be valid with wrong key")
+
+	replyKey := testArmorKey(t)
+	sk, err := u.DecryptedEncPart.StrengthenReplyKey(replyKey)
+	if err != nil {
+		t.Fatalf("error strengthening reply key: %v", err)
+	}
+	assert.NotEqual(t, replyKey.KeyValue, sk.KeyValue, "reply key not strengthened")
+
+	_, ok, err = GetFASTArmoredRep(types.PADataSequence{types.PAData{PADataType: patype.PA_REQ_ENC_PA_REP}})
+	assert.NoError(t, err)
+	assert.False(t, ok, "armored reply should not be found")
+}
@@ -0,0 +1,52 @@
+package messages
+
+// Reference: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-kkdcp
+// Section: 2.2.2
+
+import (
+	"encoding/binary"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+)
+
+// KDCProxyMessage implements MS-KKDCP KDC-PROXY-MESSAGE: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-kkdcp/5778aff5-b182-4b97-a970-29c7f911eef2
+type KDCProxyMessage struct {
+	KerbMessage   []byte `asn1:"explicit,tag:0"`
+	TargetDomain  string `asn1:"generalstring,optional,explicit,tag:1"`
+	DCLocatorHint int    `asn1:"optional,explicit,tag:2"`
+}
+
+// NewKDCProxyMessage wraps the Kerberos message, such as an AS_REQ or kpasswd request, in a KDC-PROXY-MESSAGE for the
+// realm. The message is prefixed with its length as when sent over TCP.
+func NewKDCProxyMessage(b []byte, realm string) KDCProxyMessage {
+	km := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(km, uint32(len(b)))
+	return KDCProxyMessage{
+		KerbMessage:  append(km, b...),
+		TargetDomain: realm,
+	}
+}
+
+// Message returns the Kerberos message of the KDC-PROXY-MESSAGE with the length prefix removed.
+func (m *KDCProxyMessage) Message() ([]byte, error) {
+	if len(m.KerbMessage) < 4 {
+		return nil, krberror.NewErrorf(krberror.EncodingError, "KDC-PROXY-MESSAGE kerb-message is too short")
+	}
+	l := binary.BigEndian.Uint32(m.KerbMessage[:4])
+	if int64(l) != int64(len(m.KerbMessage)-4) {
+		return nil, krberror.NewErrorf(krberror.EncodingError, "KDC-PROXY-MESSAGE kerb-message length %d does not match the length prefix %d", len(m.KerbMessage)-4, l)
+	}
+	return m.KerbMessage[4:], nil
+}
+
+// Unmarshal bytes b into the KDCProxyMessage struct.
+func (m *KDCProxyMessage) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, m)
+	return err
+}
+
+// Marshal the KDCProxyMessage struct.
+func (m *KDCProxyMessage) Marshal() ([]byte, error) {
+	return asn1.Marshal(*m)
+}
@@ -0,0 +1,35 @@
+package messages
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKDCProxyMessage_MarshalUnmarshal(t *testing.T) {
+	t.Parallel()
+	m := NewKDCProxyMessage([]byte{0x6a, 0x01, 0x00}, "TEST.GOKRB5")
+	b, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KDC-PROXY-MESSAGE: %v", err)
+	}
+	assert.Equal(t, "301aa0090407000000036a0100a10d1b0b544553542e474f4b524235", hex.EncodeToString(b), "KDC-PROXY-MESSAGE encoding not as expected")
+
+	var u KDCProxyMessage
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling KDC-PROXY-MESSAGE: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", u.TargetDomain, "target domain not as expected")
+	assert.Equal(t, 0, u.DCLocatorHint, "DC locator hint not as expected")
+	km, err := u.Message()
+	if err != nil {
+		t.Fatalf("error getting Kerberos message: %v", err)
+	}
+	assert.Equal(t, []byte{0x6a, 0x01, 0x00}, km, "Kerberos message not as expected")
+
+	u.KerbMessage = u.KerbMessage[:5]
+	_, err = u.Message()
+	assert.Error(t, err, "Kerberos message not matching its length prefix should be rejected")
+}
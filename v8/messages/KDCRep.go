@@ -231,17 +231,24 @@ func (k *ASRep) DecryptEncPart(c *credentials.Credentials) (types.EncryptionKey,
 	if !c.HasKeytab() && !c.HasPassword() {
 		return key, krberror.NewErrorf(krberror.DecryptingError, "no secret available in credentials to perform decryption of AS_REP encrypted part")
 	}
+	err = k.DecryptEncPartWithKey(key)
+	return key, err
+}
+
+// DecryptEncPartWithKey decrypts the encrypted part of an AS_REP using the reply key provided.
+// This is used where the reply key is not the client's long term key, for example when it has been strengthened by FAST.
+func (k *ASRep) DecryptEncPartWithKey(key types.EncryptionKey) error {
 	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.AS_REP_ENCPART)
 	if err != nil {
-		return key, krberror.Errorf(err, krberror.DecryptingError, "error decrypting AS_REP encrypted part")
+		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting AS_REP encrypted part")
 	}
 	var denc EncKDCRepPart
 	err = denc.Unmarshal(b)
 	if err != nil {
-		return key, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling decrypted encpart of AS_REP")
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling decrypted encpart of AS_REP")
 	}
 	k.DecryptedEncPart = denc
-	return key, nil
+	return nil
 }
 
 // Verify checks the validity of AS_REP message.
@@ -257,6 +264,27 @@ func (k *ASRep) Verify(cfg *config.Config, creds *credentials.Credentials, asReq
 	if err != nil {
 		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting EncPart of AS_REP")
 	}
+	return k.verifyDecrypted(cfg, key, asReq)
+}
+
+// VerifyWithKey checks the validity of AS_REP message using the reply key provided to decrypt the encrypted part.
+// An anonymous ticket may be issued in the anonymous realm rather than the realm requested.
+func (k *ASRep) VerifyWithKey(cfg *config.Config, key types.EncryptionKey, asReq ASReq) (bool, error) {
+	if !k.CName.Equal(asReq.ReqBody.CName) {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "CName in response does not match what was requested. Requested: %+v; Reply: %+v", asReq.ReqBody.CName, k.CName)
+	}
+	if k.CRealm != asReq.ReqBody.Realm && !(asReq.ReqBody.CName.IsAnonymous() && k.CRealm == types.AnonymousRealm) {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "CRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.CRealm)
+	}
+	err := k.DecryptEncPartWithKey(key)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting EncPart of AS_REP")
+	}
+	return k.verifyDecrypted(cfg, key, asReq)
+}
+
+// verifyDecrypted checks the validity of the decrypted encrypted part of the AS_REP message.
+func (k *ASRep) verifyDecrypted(cfg *config.Config, key types.EncryptionKey, asReq ASReq) (bool, error) {
 	if k.DecryptedEncPart.Nonce != asReq.ReqBody.Nonce {
 		return false, krberror.NewErrorf(krberror.KRBMsgError, "possible replay attack, nonce in response does not match that in request")
 	}
@@ -303,7 +331,16 @@ func (k *ASRep) Verify(cfg *config.Config, creds *credentials.Credentials, asReq
 
 // DecryptEncPart decrypts the encrypted part of an TGS_REP.
 func (k *TGSRep) DecryptEncPart(key types.EncryptionKey) error {
-	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.TGS_REP_ENCPART_SESSION_KEY)
+	return k.decryptEncPart(key, keyusage.TGS_REP_ENCPART_SESSION_KEY)
+}
+
+// DecryptEncPartWithSubKey decrypts the encrypted part of an TGS_REP where the TGS_REQ authenticator contained a sub-session key.
+func (k *TGSRep) DecryptEncPartWithSubKey(subKey types.EncryptionKey) error {
+	return k.decryptEncPart(subKey, keyusage.TGS_REP_ENCPART_AUTHENTICATOR_SUB_KEY)
+}
+
+func (k *TGSRep) decryptEncPart(key types.EncryptionKey, usage uint32) error {
+	b, err := crypto.DecryptEncPart(k.EncPart, key, usage)
 	if err != nil {
 		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting TGS_REP EncPart")
 	}
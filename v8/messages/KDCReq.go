@@ -92,6 +92,17 @@ func NewASReqForTGT(realm string, c *config.Config, cname types.PrincipalName) (
 	return NewASReq(realm, c, cname, sname)
 }
 
+// NewASReqForAnonymousTGT generates a new KRB_AS_REQ struct for an anonymous TGT request by the anonymous principal
+// with the request-anonymous KDC option set. RFC 8062 Section 3.
+func NewASReqForAnonymousTGT(realm string, c *config.Config) (ASReq, error) {
+	a, err := NewASReqForTGT(realm, c, types.NewAnonymousPrincipalName())
+	if err != nil {
+		return a, err
+	}
+	types.SetFlag(&a.ReqBody.KDCOptions, flags.RequestAnonymous)
+	return a, nil
+}
+
 // NewASReqForChgPasswd generates a new KRB_AS_REQ struct for a change password request.
 func NewASReqForChgPasswd(realm string, c *config.Config, cname types.PrincipalName) (ASReq, error) {
 	sname := types.PrincipalName{
@@ -140,7 +151,6 @@ func NewASReq(realm string, c *config.Config, cname, sname types.PrincipalName)
 	if c.LibDefaults.RenewLifetime != 0 {
 		types.SetFlag(&a.ReqBody.KDCOptions, flags.Renewable)
 		a.ReqBody.RTime = t.Add(c.LibDefaults.RenewLifetime)
-		a.ReqBody.RTime = t.Add(time.Duration(48) * time.Hour)
 	}
 	if !c.LibDefaults.NoAddresses {
 		ha, err := types.LocalHostAddresses()
@@ -159,7 +169,18 @@ func NewTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Config, tgt
 	if err != nil {
 		return a, err
 	}
-	err = a.setPAData(tgt, sessionKey)
+	err = a.setPAData(tgt, sessionKey, nil)
+	return a, err
+}
+
+// NewTGSReqWithSubKey generates a new KRB_TGS_REQ struct where the authenticator carries the sub-session key provided.
+// The KDC will encrypt the TGS_REP using the sub-session key.
+func NewTGSReqWithSubKey(cname types.PrincipalName, kdcRealm string, c *config.Config, tgt Ticket, sessionKey, subKey types.EncryptionKey, sname types.PrincipalName, renewal bool) (TGSReq, error) {
+	a, err := tgsReq(cname, sname, kdcRealm, renewal, c)
+	if err != nil {
+		return a, err
+	}
+	err = a.setPAData(tgt, sessionKey, &subKey)
 	return a, err
 }
 
@@ -171,10 +192,46 @@ func NewUser2UserTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Co
 	}
 	a.ReqBody.AdditionalTickets = []Ticket{verifyingTGT}
 	types.SetFlag(&a.ReqBody.KDCOptions, flags.EncTktInSkey)
-	err = a.setPAData(clientTGT, sessionKey)
+	err = a.setPAData(clientTGT, sessionKey, nil)
+	return a, err
+}
+
+// NewForwardedTGTReq returns a TGS_REQ for a forwarded TGT for the realm, suitable for delegating to a service
+// (https://tools.ietf.org/html/rfc4120#section-2.6). The TGT provided must be forwardable. The ticket requested has no
+// addresses so that it can be used from the service's host.
+func NewForwardedTGTReq(cname types.PrincipalName, kdcRealm string, c *config.Config, tgt Ticket, sessionKey types.EncryptionKey) (TGSReq, error) {
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_SRV_INST,
+		NameString: []string{"krbtgt", kdcRealm},
+	}
+	a, err := tgsReq(cname, sname, kdcRealm, false, c)
+	if err != nil {
+		return a, err
+	}
+	a.ReqBody.Addresses = nil
+	types.SetFlag(&a.ReqBody.KDCOptions, flags.Forwardable)
+	types.SetFlag(&a.ReqBody.KDCOptions, flags.Forwarded)
+	err = a.setPAData(tgt, sessionKey, nil)
 	return a, err
 }
 
+// SetSubKey replaces the PA-TGS-REQ of the TGS_REQ with one whose authenticator carries the sub-session key provided,
+// keeping any other PAData. The KDC will encrypt the TGS_REP using the sub-session key.
+func (k *TGSReq) SetSubKey(tgt Ticket, sessionKey, subKey types.EncryptionKey) error {
+	pas := k.PAData
+	err := k.setPAData(tgt, sessionKey, &subKey)
+	if err != nil {
+		k.PAData = pas
+		return err
+	}
+	for _, pa := range pas {
+		if pa.PADataType != patype.PA_TGS_REQ {
+			k.PAData = append(k.PAData, pa)
+		}
+	}
+	return nil
+}
+
 // tgsReq populates the fields for a TGS_REQ
 func tgsReq(cname, sname types.PrincipalName, kdcRealm string, renewal bool, c *config.Config) (TGSReq, error) {
 	nonce, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt32))
@@ -226,7 +283,7 @@ func tgsReq(cname, sname types.PrincipalName, kdcRealm string, renewal bool, c *
 	}, nil
 }
 
-func (k *TGSReq) setPAData(tgt Ticket, sessionKey types.EncryptionKey) error {
+func (k *TGSReq) setPAData(tgt Ticket, sessionKey types.EncryptionKey, subKey *types.EncryptionKey) error {
 	// Marshal the request and calculate checksum
 	b, err := k.ReqBody.Marshal()
 	if err != nil {
@@ -251,6 +308,9 @@ func (k *TGSReq) setPAData(tgt Ticket, sessionKey types.EncryptionKey) error {
 		CksumType: etype.GetHashID(),
 		Checksum:  cb,
 	}
+	if subKey != nil {
+		auth.SubKey = *subKey
+	}
 	// Create AP_REQ
 	apReq, err := NewAPReq(tgt, sessionKey, auth)
 	if err != nil {
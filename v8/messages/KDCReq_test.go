@@ -6,12 +6,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gokrb5/v8/config"
 	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/addrtype"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/iana/patype"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -424,3 +427,28 @@ func TestMarshalTGSReq(t *testing.T) {
 	}
 	assert.Equal(t, b, mb, "Marshal bytes of TGSReq not as expected")
 }
+
+func TestNewASReq_RenewLifetime(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.LibDefaults.NoAddresses = true
+	c.LibDefaults.TicketLifetime = time.Hour
+	c.LibDefaults.RenewLifetime = 2 * time.Hour
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	a, err := NewASReqForTGT("TEST.GOKRB5", c, cname)
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&a.ReqBody.KDCOptions, flags.Renewable), "renewable option not set")
+	// The request times are relative to the same time, which is the till time less the ticket lifetime.
+	now := a.ReqBody.Till.Add(-c.LibDefaults.TicketLifetime)
+	assert.Equal(t, now.Add(c.LibDefaults.RenewLifetime), a.ReqBody.RTime, "renew till time not as expected")
+
+	c.LibDefaults.RenewLifetime = 0
+	a, err = NewASReqForTGT("TEST.GOKRB5", c, cname)
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	assert.False(t, types.IsFlagSet(&a.ReqBody.KDCOptions, flags.Renewable), "renewable option set")
+	assert.True(t, a.ReqBody.RTime.IsZero(), "renew till time set")
+}
@@ -5,7 +5,9 @@ import (
 	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
 	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
 	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
@@ -49,11 +51,49 @@ type KrbCredInfo struct {
 	StartTime time.Time           `asn1:"generalized,optional,explicit,tag:5"`
 	EndTime   time.Time           `asn1:"generalized,optional,explicit,tag:6"`
 	RenewTill time.Time           `asn1:"generalized,optional,explicit,tag:7"`
-	SRealm    string              `asn1:"optional,explicit,ia5,tag:8"`
+	SRealm    string              `asn1:"generalstring,optional,explicit,tag:8"`
 	SName     types.PrincipalName `asn1:"optional,explicit,tag:9"`
 	CAddr     types.HostAddresses `asn1:"optional,explicit,tag:10"`
 }
 
+// NewKRBCred creates a KRB_CRED carrying the tickets, with the encrypted part holding the corresponding KrbCredInfo
+// for each ticket encrypted with the key provided.
+func NewKRBCred(tickets []Ticket, info []KrbCredInfo, key types.EncryptionKey) (KRBCred, error) {
+	if len(tickets) != len(info) {
+		return KRBCred{}, krberror.NewErrorf(krberror.KRBMsgError, "the number of tickets (%d) and ticket information (%d) for the KRB_CRED do not match", len(tickets), len(info))
+	}
+	t := time.Now().UTC()
+	k := KRBCred{
+		PVNO:    iana.PVNO,
+		MsgType: msgtype.KRB_CRED,
+		Tickets: tickets,
+		DecryptedEncPart: EncKrbCredPart{
+			TicketInfo: info,
+			Timestamp:  t.Truncate(time.Second),
+			Usec:       int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6)),
+		},
+	}
+	err := k.EncryptEncPart(key)
+	return k, err
+}
+
+// NewKrbCredInfo creates the KrbCredInfo for a ticket issued to the client from the decrypted part of the KDC reply.
+func NewKrbCredInfo(cname types.PrincipalName, crealm string, dep EncKDCRepPart) KrbCredInfo {
+	return KrbCredInfo{
+		Key:       dep.Key,
+		PRealm:    crealm,
+		PName:     cname,
+		Flags:     dep.Flags,
+		AuthTime:  dep.AuthTime,
+		StartTime: dep.StartTime,
+		EndTime:   dep.EndTime,
+		RenewTill: dep.RenewTill,
+		SRealm:    dep.SRealm,
+		SName:     dep.SName,
+		CAddr:     dep.CAddr,
+	}
+}
+
 // Unmarshal bytes b into the KRBCred struct.
 func (k *KRBCred) Unmarshal(b []byte) error {
 	var m marshalKRBCred
@@ -77,14 +117,55 @@ func (k *KRBCred) Unmarshal(b []byte) error {
 	return nil
 }
 
+// Marshal the KRBCred.
+func (k *KRBCred) Marshal() ([]byte, error) {
+	m := marshalKRBCred{
+		PVNO:    k.PVNO,
+		MsgType: k.MsgType,
+		EncPart: k.EncPart,
+	}
+	rawtkts, err := MarshalTicketSequence(k.Tickets)
+	if err != nil {
+		return []byte{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling tickets within KRB_CRED")
+	}
+	rawtkts.Tag = 2
+	m.Tickets = rawtkts
+	b, err := asn1.Marshal(m)
+	if err != nil {
+		return []byte{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling KRB_CRED")
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.KRBCred)
+	return b, nil
+}
+
+// EncryptEncPart encrypts the DecryptedEncPart within the KRBCred with the key provided.
+// Use to prepare for marshaling.
+func (k *KRBCred) EncryptEncPart(key types.EncryptionKey) error {
+	b, err := k.DecryptedEncPart.Marshal()
+	if err != nil {
+		return err
+	}
+	k.EncPart, err = crypto.GetEncryptedData(b, key, keyusage.KRB_CRED_ENCPART, 0)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncryptingError, "error encrypting KRB_CRED EncPart")
+	}
+	return nil
+}
+
 // DecryptEncPart decrypts the encrypted part of a KRB_CRED.
+// An encrypted part with the etype of zero is not encrypted, as sent by some implementations when the KRB_CRED is
+// protected by other means.
 func (k *KRBCred) DecryptEncPart(key types.EncryptionKey) error {
-	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.KRB_CRED_ENCPART)
-	if err != nil {
-		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting KRB_CRED EncPart")
+	b := k.EncPart.Cipher
+	if k.EncPart.EType != 0 {
+		var err error
+		b, err = crypto.DecryptEncPart(k.EncPart, key, keyusage.KRB_CRED_ENCPART)
+		if err != nil {
+			return krberror.Errorf(err, krberror.DecryptingError, "error decrypting KRB_CRED EncPart")
+		}
 	}
 	var denc EncKrbCredPart
-	err = denc.Unmarshal(b)
+	err := denc.Unmarshal(b)
 	if err != nil {
 		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling encrypted part of KRB_CRED")
 	}
@@ -100,3 +181,13 @@ func (k *EncKrbCredPart) Unmarshal(b []byte) error {
 	}
 	return nil
 }
+
+// Marshal the encrypted part of KRB_CRED.
+func (k *EncKrbCredPart) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*k)
+	if err != nil {
+		return []byte{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling EncKrbCredPart")
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncKrbCredPart)
+	return b, nil
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -130,3 +131,50 @@ func TestUnmarshalEncCredPart_optionalsNULL(t *testing.T) {
 		assert.Equal(t, "12d00023", hex.EncodeToString(addr.Address), fmt.Sprintf("Host address not as expected for address item %d within ticket info %d", j+1, i+1))
 	}
 }
+
+func TestNewKRBCred(t *testing.T) {
+	t.Parallel()
+	key := testArmorKey(t)
+	tkt := testS4UTicket(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	info := NewKrbCredInfo(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"), testdata.TEST_REALM, EncKDCRepPart{
+		Key:       testArmorKey(t),
+		Flags:     types.NewKrbFlags(),
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		RenewTill: now.Add(time.Hour),
+		SRealm:    tkt.Realm,
+		SName:     tkt.SName,
+	})
+	k, err := NewKRBCred([]Ticket{tkt}, []KrbCredInfo{info}, key)
+	if err != nil {
+		t.Fatalf("error creating KRB_CRED: %v", err)
+	}
+	b, err := k.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRB_CRED: %v", err)
+	}
+	var a KRBCred
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling KRB_CRED: %v", err)
+	}
+	assert.Equal(t, msgtype.KRB_CRED, a.MsgType, "message type not as expected")
+	if !assert.Len(t, a.Tickets, 1, "number of tickets not as expected") {
+		t.FailNow()
+	}
+	assert.Equal(t, tkt.EncPart.Cipher, a.Tickets[0].EncPart.Cipher, "ticket not as expected")
+	assert.Error(t, a.DecryptEncPart(testArmorKey(t)), "KRB_CRED should not decrypt with another key")
+	err = a.DecryptEncPart(key)
+	if err != nil {
+		t.Fatalf("error decrypting KRB_CRED: %v", err)
+	}
+	if !assert.Len(t, a.DecryptedEncPart.TicketInfo, 1, "number of ticket info not as expected") {
+		t.FailNow()
+	}
+	assert.Equal(t, info, a.DecryptedEncPart.TicketInfo[0], "ticket info not as expected")
+
+	_, err = NewKRBCred([]Ticket{tkt, tkt}, []KrbCredInfo{info}, key)
+	assert.Error(t, err, "tickets without ticket info should not be accepted")
+}
@@ -0,0 +1,299 @@
+package messages
+
+// Reference: https://tools.ietf.org/html/rfc4556
+// Section: 3.2
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	kcrypto "github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4556"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// PAPKASReq implements RFC 4556 PA-PK-AS-REQ: https://tools.ietf.org/html/rfc4556#section-3.2.1
+type PAPKASReq struct {
+	SignedAuthPack []byte `asn1:"tag:0"`
+}
+
+// AuthPack implements RFC 4556 AuthPack: https://tools.ietf.org/html/rfc4556#section-3.2.1
+type AuthPack struct {
+	PKAuthenticator   PKAuthenticator               `asn1:"explicit,tag:0"`
+	ClientPublicValue rfc4556.SubjectPublicKeyInfo  `asn1:"explicit,optional,tag:1"`
+	SupportedCMSTypes []rfc4556.AlgorithmIdentifier `asn1:"explicit,optional,tag:2"`
+	ClientDHNonce     []byte                        `asn1:"explicit,optional,tag:3"`
+}
+
+// PKAuthenticator implements RFC 4556 PKAuthenticator: https://tools.ietf.org/html/rfc4556#section-3.2.1
+type PKAuthenticator struct {
+	CUSec      int       `asn1:"explicit,tag:0"`
+	CTime      time.Time `asn1:"generalized,explicit,tag:1"`
+	Nonce      int       `asn1:"explicit,tag:2"`
+	PAChecksum []byte    `asn1:"explicit,optional,tag:3"`
+}
+
+// PAPKASRep implements RFC 4556 PA-PK-AS-REP: https://tools.ietf.org/html/rfc4556#section-3.2.3
+// It is a CHOICE so only one of the Diffie-Hellman information or the encrypted key pack is present.
+type PAPKASRep struct {
+	DHInfo     DHRepInfo
+	EncKeyPack []byte
+}
+
+// DHRepInfo implements RFC 4556 DHRepInfo: https://tools.ietf.org/html/rfc4556#section-3.2.3
+type DHRepInfo struct {
+	DHSignedData  []byte `asn1:"tag:0"`
+	ServerDHNonce []byte `asn1:"explicit,optional,tag:1"`
+}
+
+// KDCDHKeyInfo implements RFC 4556 KDCDHKeyInfo: https://tools.ietf.org/html/rfc4556#section-3.2.3.1
+type KDCDHKeyInfo struct {
+	SubjectPublicKey asn1.BitString `asn1:"explicit,tag:0"`
+	Nonce            int            `asn1:"explicit,tag:1"`
+	DHKeyExpiration  time.Time      `asn1:"generalized,explicit,optional,tag:2"`
+}
+
+// NewPAPKASReq generates the PA-PK-AS-REQ PAData for an AS_REQ with the request body provided. The AuthPack carries the
+// public key of the key agreement and is signed with the client's certificate key. The first certificate must be the
+// client's and any others are included to allow the KDC to build the certificate chain.
+func NewPAPKASReq(reqBody KDCReqBody, ka rfc4556.KeyAgreement, certs []*x509.Certificate, signer crypto.Signer) (types.PAData, error) {
+	ab, err := newAuthPack(reqBody, ka)
+	if err != nil {
+		return types.PAData{}, err
+	}
+	sd, err := rfc4556.NewSignedData(rfc4556.OIDPKINITAuthData, ab, certs, signer)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncryptingError, "error signing PKINIT AuthPack")
+	}
+	return paPKASReq(sd)
+}
+
+// NewAnonymousPAPKASReq generates the PA-PK-AS-REQ PAData for an anonymous AS_REQ with the request body provided.
+// The AuthPack carries the public key of the key agreement and is not signed. RFC 8062 Section 4.1.
+func NewAnonymousPAPKASReq(reqBody KDCReqBody, ka rfc4556.KeyAgreement) (types.PAData, error) {
+	ab, err := newAuthPack(reqBody, ka)
+	if err != nil {
+		return types.PAData{}, err
+	}
+	sd, err := rfc4556.NewUnsignedData(rfc4556.OIDPKINITAuthData, ab)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling anonymous PKINIT AuthPack")
+	}
+	return paPKASReq(sd)
+}
+
+// newAuthPack returns the marshaled AuthPack for the request body and key agreement.
+func newAuthPack(reqBody KDCReqBody, ka rfc4556.KeyAgreement) ([]byte, error) {
+	bb, err := reqBody.Marshal()
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling AS_REQ body for PKINIT checksum")
+	}
+	// RFC 4556 Section 3.2.1: the paChecksum is the SHA1 of the DER encoded KDC-REQ-BODY
+	sum := sha1.Sum(bb)
+	spki, err := ka.PublicKeyInfo()
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error getting PKINIT client public value")
+	}
+	t := time.Now().UTC()
+	a := AuthPack{
+		PKAuthenticator: PKAuthenticator{
+			CUSec:      int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6)),
+			CTime:      t.Truncate(time.Second),
+			Nonce:      reqBody.Nonce,
+			PAChecksum: sum[:],
+		},
+		ClientPublicValue: spki,
+	}
+	b, err := asn1.Marshal(a)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling PKINIT AuthPack")
+	}
+	return b, nil
+}
+
+// paPKASReq returns the PA-PK-AS-REQ PAData holding the signed AuthPack.
+func paPKASReq(signedAuthPack []byte) (types.PAData, error) {
+	b, err := asn1.Marshal(PAPKASReq{SignedAuthPack: signedAuthPack})
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PK-AS-REQ")
+	}
+	return types.PAData{
+		PADataType:  patype.PA_PK_AS_REQ,
+		PADataValue: b,
+	}, nil
+}
+
+// Unmarshal bytes b into the PAPKASReq struct.
+func (p *PAPKASReq) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, p)
+	return err
+}
+
+// AuthPack parses the signed data of the PA-PK-AS-REQ and returns the AuthPack it holds along with the signed data so
+// that the client's signature and certificate can be verified.
+func (p *PAPKASReq) AuthPack() (AuthPack, *rfc4556.SignedData, error) {
+	var a AuthPack
+	sd, err := rfc4556.ParseSignedData(p.SignedAuthPack)
+	if err != nil {
+		return a, nil, krberror.Errorf(err, krberror.EncodingError, "error parsing PKINIT signed AuthPack")
+	}
+	if !sd.ContentType.Equal(rfc4556.OIDPKINITAuthData) {
+		return a, sd, krberror.NewErrorf(krberror.EncodingError, "PKINIT signed data content type %v is not AuthPack", sd.ContentType)
+	}
+	_, err = asn1.Unmarshal(sd.Content, &a)
+	if err != nil {
+		return a, sd, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PKINIT AuthPack")
+	}
+	return a, sd, nil
+}
+
+// NewPAPKASRep generates the PA-PK-AS-REP PAData of a KDC's Diffie-Hellman reply. The KDCDHKeyInfo carries the public
+// key of the KDC's key agreement and the nonce of the client's PKAuthenticator and is signed with the KDC's certificate key.
+func NewPAPKASRep(ka rfc4556.KeyAgreement, nonce int, certs []*x509.Certificate, signer crypto.Signer) (types.PAData, error) {
+	pk := ka.PublicKey()
+	kb, err := asn1.Marshal(KDCDHKeyInfo{
+		SubjectPublicKey: asn1.BitString{Bytes: pk, BitLength: len(pk) * 8},
+		Nonce:            nonce,
+	})
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling PKINIT KDCDHKeyInfo")
+	}
+	sd, err := rfc4556.NewSignedData(rfc4556.OIDPKINITDHKeyData, kb, certs, signer)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncryptingError, "error signing PKINIT KDCDHKeyInfo")
+	}
+	p := PAPKASRep{DHInfo: DHRepInfo{DHSignedData: sd}}
+	b, err := p.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return types.PAData{
+		PADataType:  patype.PA_PK_AS_REP,
+		PADataValue: b,
+	}, nil
+}
+
+// Unmarshal bytes b into the PAPKASRep struct.
+func (p *PAPKASRep) Unmarshal(b []byte) error {
+	var rv asn1.RawValue
+	_, err := asn1.Unmarshal(b, &rv)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-PK-AS-REP")
+	}
+	if rv.Class != asn1.ClassContextSpecific {
+		return krberror.NewErrorf(krberror.EncodingError, "PA-PK-AS-REP choice not valid")
+	}
+	switch rv.Tag {
+	case 0:
+		_, err = asn1.Unmarshal(rv.Bytes, &p.DHInfo)
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-PK-AS-REP DHRepInfo")
+		}
+	case 1:
+		p.EncKeyPack = rv.Bytes
+	default:
+		return krberror.NewErrorf(krberror.EncodingError, "PA-PK-AS-REP choice %d not valid", rv.Tag)
+	}
+	return nil
+}
+
+// Marshal the PAPKASRep struct.
+func (p *PAPKASRep) Marshal() ([]byte, error) {
+	if len(p.EncKeyPack) > 0 {
+		return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: p.EncKeyPack})
+	}
+	b, err := asn1.Marshal(p.DHInfo)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PK-AS-REP DHRepInfo")
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b})
+}
+
+// ReplyKey verifies the KDC's signed KDCDHKeyInfo and derives the AS_REP reply key, of the encryption type provided,
+// from the key agreement with the KDC. The KDC's certificate must chain to a root in the verify options and be for a KDC
+// of the realm, as checked by rfc4556.VerifyKDCCertificate with requirePrincipal. The nonce is that of the client's
+// PKAuthenticator.
+func (p *PAPKASRep) ReplyKey(ka rfc4556.KeyAgreement, nonce int, etypeID int32, realm string, requirePrincipal bool, opts x509.VerifyOptions) (types.EncryptionKey, error) {
+	if len(p.EncKeyPack) > 0 {
+		return types.EncryptionKey{}, krberror.NewErrorf(krberror.KRBMsgError, "PKINIT public key encryption reply not supported, only Diffie-Hellman key agreement")
+	}
+	sd, err := rfc4556.ParseSignedData(p.DHInfo.DHSignedData)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error parsing PKINIT KDC signed data")
+	}
+	if !sd.ContentType.Equal(rfc4556.OIDPKINITDHKeyData) {
+		return types.EncryptionKey{}, krberror.NewErrorf(krberror.EncodingError, "PKINIT KDC signed data content type %v is not KDCDHKeyInfo", sd.ContentType)
+	}
+	cert, err := sd.Verify(opts)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "KDC signature not valid")
+	}
+	err = rfc4556.VerifyKDCCertificate(cert, realm, requirePrincipal)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "KDC certificate not valid")
+	}
+	var ki KDCDHKeyInfo
+	_, err = asn1.Unmarshal(sd.Content, &ki)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PKINIT KDCDHKeyInfo")
+	}
+	if ki.Nonce != nonce {
+		return types.EncryptionKey{}, krberror.NewErrorf(krberror.KRBMsgError, "possible replay attack, nonce in KDCDHKeyInfo does not match that in request")
+	}
+	secret, err := ka.SharedSecret(ki.SubjectPublicKey.Bytes)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error in PKINIT key agreement")
+	}
+	et, err := kcrypto.GetEtype(etypeID)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error getting etype of AS_REP reply key")
+	}
+	// The client does not send a DH nonce so any server DH nonce is not used
+	return rfc4556.OctetString2Key(et, secret, nil, nil), nil
+}
+
+// NewPAPKINITKX generates the PA-PKINIT-KX PAData a KDC includes in the reply to an anonymous PKINIT request to prove it
+// knows the reply key as well as the session key of the ticket issued. RFC 8062 Section 7.
+func NewPAPKINITKX(replyKey, sessionKey types.EncryptionKey) (types.PAData, error) {
+	key, err := kcrypto.KRBFXCF2(replyKey, sessionKey, "PKINIT", "KEYEXCHANGE")
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncryptingError, "error generating PA-PKINIT-KX key")
+	}
+	ed, err := kcrypto.GetEncryptedData([]byte{}, key, keyusage.KEY_USAGE_PA_PKINIT_KX, 0)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncryptingError, "error encrypting PA-PKINIT-KX")
+	}
+	b, err := ed.Marshal()
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PKINIT-KX")
+	}
+	return types.PAData{
+		PADataType:  patype.PA_PKINIT_KX,
+		PADataValue: b,
+	}, nil
+}
+
+// VerifyPAPKINITKX checks the PA-PKINIT-KX PAData of the reply to an anonymous PKINIT request can be decrypted with the
+// key derived from the reply key and the session key of the ticket issued. RFC 8062 Section 7.
+func VerifyPAPKINITKX(pa types.PAData, replyKey, sessionKey types.EncryptionKey) error {
+	var ed types.EncryptedData
+	err := ed.Unmarshal(pa.PADataValue)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-PKINIT-KX")
+	}
+	key, err := kcrypto.KRBFXCF2(replyKey, sessionKey, "PKINIT", "KEYEXCHANGE")
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncryptingError, "error generating PA-PKINIT-KX key")
+	}
+	_, err = kcrypto.DecryptEncPart(ed, key, keyusage.KEY_USAGE_PA_PKINIT_KX)
+	if err != nil {
+		return krberror.Errorf(err, krberror.DecryptingError, "PA-PKINIT-KX not valid, the KDC may not know the session key")
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package messages
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	stdasn1 "encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	kcrypto "github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4556"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPKINITCertificate(t *testing.T, cn string, eku stdasn1.ObjectIdentifier, exts ...pkix.Extension) (*x509.Certificate, crypto.Signer) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:       big.NewInt(time.Now().UnixNano()),
+		Subject:            pkix.Name{CommonName: cn},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(time.Hour),
+		KeyUsage:           x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		UnknownExtKeyUsage: []stdasn1.ObjectIdentifier{eku},
+		ExtraExtensions:    exts,
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	return cert, key
+}
+
+func TestPKINIT_RoundTrip(t *testing.T) {
+	t.Parallel()
+	clientCert, clientKey := testPKINITCertificate(t, "testuser1", stdasn1.ObjectIdentifier(rfc4556.OIDPKINITKPClientAuth))
+	san, err := rfc4556.PrincipalNameExtension(rfc4556.KRB5PrincipalName{
+		Realm:         "TEST.GOKRB5",
+		PrincipalName: types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+	})
+	if err != nil {
+		t.Fatalf("error creating id-pkinit-san extension: %v", err)
+	}
+	kdcCert, kdcKey := testPKINITCertificate(t, "kdc", stdasn1.ObjectIdentifier(rfc4556.OIDPKINITKPKdc), san)
+	noSANCert, noSANKey := testPKINITCertificate(t, "kdc", stdasn1.ObjectIdentifier(rfc4556.OIDPKINITKPKdc))
+
+	for _, g := range []rfc4556.Group{rfc4556.MODP2048, rfc4556.P256} {
+		body := KDCReqBody{
+			KDCOptions: types.NewKrbFlags(),
+			CName:      types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"),
+			Realm:      "TEST.GOKRB5",
+			SName:      types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+			Till:       time.Now().UTC().Add(time.Hour).Truncate(time.Second),
+			Nonce:      12345,
+			EType:      []int32{etypeID.AES256_CTS_HMAC_SHA1_96},
+		}
+		cka, err := rfc4556.NewKeyAgreement(g)
+		if err != nil {
+			t.Fatalf("error creating key agreement: %v", err)
+		}
+		pa, err := NewPAPKASReq(body, cka, []*x509.Certificate{clientCert}, clientKey)
+		if err != nil {
+			t.Fatalf("error creating PA-PK-AS-REQ: %v", err)
+		}
+		assert.Equal(t, patype.PA_PK_AS_REQ, pa.PADataType, "PA data type not as expected")
+
+		// KDC side
+		var req PAPKASReq
+		err = req.Unmarshal(pa.PADataValue)
+		if err != nil {
+			t.Fatalf("error unmarshaling PA-PK-AS-REQ: %v", err)
+		}
+		a, sd, err := req.AuthPack()
+		if err != nil {
+			t.Fatalf("error getting AuthPack: %v", err)
+		}
+		roots := x509.NewCertPool()
+		roots.AddCert(clientCert)
+		signer, err := sd.Verify(x509.VerifyOptions{Roots: roots})
+		if err != nil {
+			t.Fatalf("error verifying AuthPack signature: %v", err)
+		}
+		assert.True(t, signer.Equal(clientCert), "AuthPack signer not as expected")
+		assert.Equal(t, body.Nonce, a.PKAuthenticator.Nonce, "nonce not as expected")
+		assert.Equal(t, 20, len(a.PKAuthenticator.PAChecksum), "paChecksum not a SHA1")
+		kka, peer, err := rfc4556.NewKeyAgreementFromPublicKeyInfo(a.ClientPublicValue)
+		if err != nil {
+			t.Fatalf("error creating KDC key agreement: %v", err)
+		}
+		kdcSecret, err := kka.SharedSecret(peer)
+		if err != nil {
+			t.Fatalf("error computing KDC shared secret: %v", err)
+		}
+		rpa, err := NewPAPKASRep(kka, a.PKAuthenticator.Nonce, []*x509.Certificate{kdcCert}, kdcKey)
+		if err != nil {
+			t.Fatalf("error creating PA-PK-AS-REP: %v", err)
+		}
+
+		// Client side
+		var rep PAPKASRep
+		err = rep.Unmarshal(rpa.PADataValue)
+		if err != nil {
+			t.Fatalf("error unmarshaling PA-PK-AS-REP: %v", err)
+		}
+		kdcRoots := x509.NewCertPool()
+		kdcRoots.AddCert(kdcCert)
+		opts := x509.VerifyOptions{Roots: kdcRoots}
+		key, err := rep.ReplyKey(cka, body.Nonce, etypeID.AES256_CTS_HMAC_SHA1_96, "TEST.GOKRB5", true, opts)
+		if err != nil {
+			t.Fatalf("error deriving reply key: %v", err)
+		}
+		et, _ := kcrypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+		assert.Equal(t, rfc4556.OctetString2Key(et, kdcSecret, nil, nil), key, "reply key not as expected")
+
+		_, err = rep.ReplyKey(cka, body.Nonce+1, etypeID.AES256_CTS_HMAC_SHA1_96, "TEST.GOKRB5", true, opts)
+		assert.Error(t, err, "nonce mismatch should error")
+		_, err = rep.ReplyKey(cka, body.Nonce, etypeID.AES256_CTS_HMAC_SHA1_96, "TEST.GOKRB5", true, x509.VerifyOptions{Roots: roots})
+		assert.Error(t, err, "untrusted KDC certificate should error")
+
+		// A KDC certificate without the id-pkinit-san is only accepted if the principal is not required.
+		rpa, err = NewPAPKASRep(kka, a.PKAuthenticator.Nonce, []*x509.Certificate{noSANCert}, noSANKey)
+		if err != nil {
+			t.Fatalf("error creating PA-PK-AS-REP: %v", err)
+		}
+		err = rep.Unmarshal(rpa.PADataValue)
+		if err != nil {
+			t.Fatalf("error unmarshaling PA-PK-AS-REP: %v", err)
+		}
+		kdcRoots.AddCert(noSANCert)
+		_, err = rep.ReplyKey(cka, body.Nonce, etypeID.AES256_CTS_HMAC_SHA1_96, "TEST.GOKRB5", true, opts)
+		assert.Error(t, err, "KDC certificate without id-pkinit-san should error")
+		_, err = rep.ReplyKey(cka, body.Nonce, etypeID.AES256_CTS_HMAC_SHA1_96, "TEST.GOKRB5", false, opts)
+		assert.NoError(t, err, "KDC certificate without id-pkinit-san should be accepted when the principal is not required")
+	}
+}
+
+func TestPKINIT_Anonymous(t *testing.T) {
+	t.Parallel()
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	a, err := NewASReqForAnonymousTGT("TEST.GOKRB5", c)
+	if err != nil {
+		t.Fatalf("error creating anonymous AS_REQ: %v", err)
+	}
+	assert.True(t, a.ReqBody.CName.IsAnonymous(), "client name should be anonymous")
+	assert.True(t, types.IsFlagSet(&a.ReqBody.KDCOptions, flags.RequestAnonymous), "request-anonymous KDC option should be set")
+
+	ka, _ := rfc4556.NewKeyAgreement(rfc4556.P256)
+	pa, err := NewAnonymousPAPKASReq(a.ReqBody, ka)
+	if err != nil {
+		t.Fatalf("error creating anonymous PA-PK-AS-REQ: %v", err)
+	}
+	var req PAPKASReq
+	err = req.Unmarshal(pa.PADataValue)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-PK-AS-REQ: %v", err)
+	}
+	ap, sd, err := req.AuthPack()
+	if err != nil {
+		t.Fatalf("error getting AuthPack: %v", err)
+	}
+	assert.False(t, sd.Signed(), "anonymous AuthPack should not be signed")
+	assert.Equal(t, a.ReqBody.Nonce, ap.PKAuthenticator.Nonce, "nonce not as expected")
+
+	et, _ := kcrypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	replyKey, _ := types.GenerateEncryptionKey(et)
+	sessionKey, _ := types.GenerateEncryptionKey(et)
+	kx, err := NewPAPKINITKX(replyKey, sessionKey)
+	if err != nil {
+		t.Fatalf("error creating PA-PKINIT-KX: %v", err)
+	}
+	assert.NoError(t, VerifyPAPKINITKX(kx, replyKey, sessionKey), "PA-PKINIT-KX should be valid")
+	otherKey, _ := types.GenerateEncryptionKey(et)
+	assert.Error(t, VerifyPAPKINITKX(kx, replyKey, otherKey), "PA-PKINIT-KX with a different session key should not be valid")
+}
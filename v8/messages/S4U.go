@@ -0,0 +1,287 @@
+package messages
+
+// Reference: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-sfu
+// Section: 2.2
+
+import (
+	"crypto/hmac"
+	"crypto/x509"
+	"encoding/binary"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4757"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// s4uAuthPackage is the authentication package named in the PA-FOR-USER.
+const s4uAuthPackage = "Kerberos"
+
+// PAForUser implements MS-SFU PA-FOR-USER: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-sfu/aceb70de-40f0-4409-87fa-df00ca145f5a
+type PAForUser struct {
+	UserName    types.PrincipalName `asn1:"explicit,tag:0"`
+	UserRealm   string              `asn1:"generalstring,explicit,tag:1"`
+	Cksum       types.Checksum      `asn1:"explicit,tag:2"`
+	AuthPackage string              `asn1:"generalstring,explicit,tag:3"`
+}
+
+// S4UUserID implements MS-SFU S4UUserID: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-sfu/cd9d5ca7-ce20-4693-872b-2f5dd41cbff6
+type S4UUserID struct {
+	Nonce              int                 `asn1:"explicit,tag:0"`
+	CName              types.PrincipalName `asn1:"explicit,optional,tag:1"`
+	CRealm             string              `asn1:"generalstring,explicit,tag:2"`
+	SubjectCertificate []byte              `asn1:"explicit,optional,tag:3"`
+	Options            asn1.BitString      `asn1:"explicit,optional,tag:4"`
+}
+
+// PAS4UX509User implements MS-SFU PA-S4U-X509-USER: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-sfu/cd9d5ca7-ce20-4693-872b-2f5dd41cbff6
+type PAS4UX509User struct {
+	UserID   S4UUserID      `asn1:"explicit,tag:0"`
+	Checksum types.Checksum `asn1:"explicit,tag:1"`
+}
+
+// PAPACOptions implements MS-KILE PA-PAC-OPTIONS: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-kile/99721ba8-61b6-4e35-8862-8fcd7e5f9a91
+type PAPACOptions struct {
+	Options asn1.BitString `asn1:"explicit,tag:0"`
+}
+
+// NewPAForUser generates a PA-FOR-USER identifying the user on whose behalf a ticket is requested.
+// The checksum is keyed with the session key of the TGT used for the TGS_REQ.
+func NewPAForUser(user types.PrincipalName, userRealm string, sessionKey types.EncryptionKey) (PAForUser, error) {
+	p := PAForUser{
+		UserName:    user,
+		UserRealm:   userRealm,
+		AuthPackage: s4uAuthPackage,
+	}
+	cb, err := rfc4757.Checksum(sessionKey.KeyValue, keyusage.KERB_NON_KERB_CKSUM_SALT, p.checksumData())
+	if err != nil {
+		return p, krberror.Errorf(err, krberror.ChksumError, "error generating PA-FOR-USER checksum")
+	}
+	p.Cksum = types.Checksum{
+		CksumType: chksumtype.KERB_CHECKSUM_HMAC_MD5,
+		Checksum:  cb,
+	}
+	return p, nil
+}
+
+// checksumData returns the data over which the PA-FOR-USER checksum is calculated: the little endian name type,
+// the name strings, the realm and the authentication package.
+func (p *PAForUser) checksumData() []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(p.UserName.NameType))
+	for _, s := range p.UserName.NameString {
+		b = append(b, s...)
+	}
+	b = append(b, p.UserRealm...)
+	b = append(b, p.AuthPackage...)
+	return b
+}
+
+// Verify the checksum of the PA-FOR-USER using the session key of the TGT used for the TGS_REQ.
+func (p *PAForUser) Verify(sessionKey types.EncryptionKey) (bool, error) {
+	if p.Cksum.CksumType != chksumtype.KERB_CHECKSUM_HMAC_MD5 {
+		return false, krberror.NewErrorf(krberror.ChksumError, "PA-FOR-USER checksum type %d not supported", p.Cksum.CksumType)
+	}
+	cb, err := rfc4757.Checksum(sessionKey.KeyValue, keyusage.KERB_NON_KERB_CKSUM_SALT, p.checksumData())
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.ChksumError, "error generating PA-FOR-USER checksum")
+	}
+	if !hmac.Equal(cb, p.Cksum.Checksum) {
+		return false, krberror.NewErrorf(krberror.ChksumError, "PA-FOR-USER checksum not valid")
+	}
+	return true, nil
+}
+
+// Unmarshal bytes b into the PAForUser struct.
+func (p *PAForUser) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, p)
+	return err
+}
+
+// Marshal the PAForUser struct.
+func (p *PAForUser) Marshal() ([]byte, error) {
+	return asn1.Marshal(*p)
+}
+
+// NewPAS4UX509User generates a PA-S4U-X509-USER identifying the user on whose behalf a ticket is requested by name,
+// certificate or both. The nonce must be that of the TGS_REQ body and the checksum is keyed with the TGT session key.
+// The KDC is asked to sign the PA-S4U-X509-USER of its reply with the reply key usage.
+func NewPAS4UX509User(nonce int, user types.PrincipalName, userRealm string, cert *x509.Certificate, sessionKey types.EncryptionKey) (PAS4UX509User, error) {
+	p := PAS4UX509User{
+		UserID: S4UUserID{
+			Nonce:   nonce,
+			CName:   user,
+			CRealm:  userRealm,
+			Options: types.NewKrbFlags(),
+		},
+	}
+	if cert != nil {
+		p.UserID.SubjectCertificate = cert.Raw
+	}
+	types.SetFlag(&p.UserID.Options, flags.S4UOptionUseReplyKeyUsage)
+	err := p.setChecksum(sessionKey, keyusage.PA_S4U_X509_USER_REQUEST)
+	return p, err
+}
+
+// NewPAS4UX509UserReply generates the PA-S4U-X509-USER of a KDC's reply to a S4U2self request, identifying the user of
+// the request. The checksum is keyed with the reply key using the reply key usage.
+func NewPAS4UX509UserReply(userID S4UUserID, replyKey types.EncryptionKey) (PAS4UX509User, error) {
+	p := PAS4UX509User{
+		UserID: userID,
+	}
+	p.UserID.Options = types.NewKrbFlags()
+	types.SetFlag(&p.UserID.Options, flags.S4UOptionUseReplyKeyUsage)
+	err := p.setChecksum(replyKey, keyusage.PA_S4U_X509_USER_REPLY)
+	return p, err
+}
+
+// setChecksum sets the checksum of the S4UUserID using the key and key usage provided.
+func (p *PAS4UX509User) setChecksum(key types.EncryptionKey, usage uint32) error {
+	b, err := asn1.Marshal(p.UserID)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error marshaling S4UUserID")
+	}
+	et, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return krberror.Errorf(err, krberror.ChksumError, "error getting etype for PA-S4U-X509-USER checksum")
+	}
+	cb, err := et.GetChecksumHash(key.KeyValue, b, usage)
+	if err != nil {
+		return krberror.Errorf(err, krberror.ChksumError, "error generating PA-S4U-X509-USER checksum")
+	}
+	p.Checksum = types.Checksum{
+		CksumType: et.GetHashID(),
+		Checksum:  cb,
+	}
+	return nil
+}
+
+// verifyChecksum verifies the checksum of the S4UUserID using the key and key usage provided.
+func (p *PAS4UX509User) verifyChecksum(key types.EncryptionKey, usage uint32) (bool, error) {
+	b, err := asn1.Marshal(p.UserID)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.EncodingError, "error marshaling S4UUserID")
+	}
+	et, err := crypto.GetChksumEtype(p.Checksum.CksumType)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.ChksumError, "error getting etype for PA-S4U-X509-USER checksum")
+	}
+	if !et.VerifyChecksum(key.KeyValue, b, p.Checksum.Checksum, usage) {
+		return false, krberror.NewErrorf(krberror.ChksumError, "PA-S4U-X509-USER checksum not valid")
+	}
+	return true, nil
+}
+
+// Verify the checksum of the PA-S4U-X509-USER using the TGT session key.
+func (p *PAS4UX509User) Verify(sessionKey types.EncryptionKey) (bool, error) {
+	return p.verifyChecksum(sessionKey, keyusage.PA_S4U_X509_USER_REQUEST)
+}
+
+// VerifyReply verifies the PA-S4U-X509-USER of a KDC's reply to the S4U2self request with the PA-S4U-X509-USER
+// provided, as MS-SFU section 3.1.5.1.2 requires. The checksum is verified using the reply key, with the reply key
+// usage if the KDC indicates it used it, and the reply must be for the nonce, realm and, if the request named one, user
+// of the request.
+func (p *PAS4UX509User) VerifyReply(req PAS4UX509User, replyKey types.EncryptionKey) (bool, error) {
+	usage := uint32(keyusage.PA_S4U_X509_USER_REQUEST)
+	if types.IsFlagSet(&p.UserID.Options, flags.S4UOptionUseReplyKeyUsage) {
+		usage = keyusage.PA_S4U_X509_USER_REPLY
+	}
+	if ok, err := p.verifyChecksum(replyKey, usage); !ok {
+		return false, err
+	}
+	if p.UserID.Nonce != req.UserID.Nonce {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "PA-S4U-X509-USER nonce does not match that of the request")
+	}
+	if p.UserID.CRealm != req.UserID.CRealm {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "PA-S4U-X509-USER realm %s does not match the requested realm %s", p.UserID.CRealm, req.UserID.CRealm)
+	}
+	if len(req.UserID.CName.NameString) > 0 && !p.UserID.CName.Equal(req.UserID.CName) {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "PA-S4U-X509-USER user %s does not match the requested user %s", p.UserID.CName.PrincipalNameString(), req.UserID.CName.PrincipalNameString())
+	}
+	return true, nil
+}
+
+// Unmarshal bytes b into the PAS4UX509User struct.
+func (p *PAS4UX509User) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, p)
+	return err
+}
+
+// Marshal the PAS4UX509User struct.
+func (p *PAS4UX509User) Marshal() ([]byte, error) {
+	return asn1.Marshal(*p)
+}
+
+// NewS4U2SelfTGSReq generates a new KRB_TGS_REQ for a service ticket to the service itself on behalf of a user
+// (S4U2self). The cname is that of the service, which is also the sname of the request. The user is identified by
+// name, by certificate or both. A PA-FOR-USER is only included when the user's name is provided.
+func NewS4U2SelfTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Config, tgt Ticket, sessionKey types.EncryptionKey, user types.PrincipalName, userRealm string, cert *x509.Certificate) (TGSReq, error) {
+	a, err := tgsReq(cname, cname, kdcRealm, false, c)
+	if err != nil {
+		return a, err
+	}
+	err = a.setPAData(tgt, sessionKey, nil)
+	if err != nil {
+		return a, err
+	}
+	if len(user.NameString) > 0 {
+		pfu, err := NewPAForUser(user, userRealm, sessionKey)
+		if err != nil {
+			return a, err
+		}
+		b, err := pfu.Marshal()
+		if err != nil {
+			return a, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-FOR-USER")
+		}
+		a.PAData = append(a.PAData, types.PAData{
+			PADataType:  patype.PA_FOR_USER,
+			PADataValue: b,
+		})
+	}
+	px, err := NewPAS4UX509User(a.ReqBody.Nonce, user, userRealm, cert, sessionKey)
+	if err != nil {
+		return a, err
+	}
+	b, err := px.Marshal()
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-S4U-X509-USER")
+	}
+	a.PAData = append(a.PAData, types.PAData{
+		PADataType:  patype.PA_FOR_X509_USER,
+		PADataValue: b,
+	})
+	return a, nil
+}
+
+// NewS4U2ProxyTGSReq generates a new KRB_TGS_REQ for a service ticket to sname on behalf of the user of the evidence
+// ticket (S4U2proxy). The evidence ticket is the forwardable service ticket to the service, cname, obtained from the user
+// or by S4U2self. The request indicates support for resource-based constrained delegation.
+func NewS4U2ProxyTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Config, tgt Ticket, sessionKey types.EncryptionKey, sname types.PrincipalName, evidence Ticket) (TGSReq, error) {
+	a, err := tgsReq(cname, sname, kdcRealm, false, c)
+	if err != nil {
+		return a, err
+	}
+	a.ReqBody.AdditionalTickets = []Ticket{evidence}
+	types.SetFlag(&a.ReqBody.KDCOptions, flags.CNameInAddlTkt)
+	err = a.setPAData(tgt, sessionKey, nil)
+	if err != nil {
+		return a, err
+	}
+	po := PAPACOptions{Options: types.NewKrbFlags()}
+	types.SetFlag(&po.Options, flags.PACOptionResourceBasedConstrainedDelegation)
+	b, err := asn1.Marshal(po)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PAC-OPTIONS")
+	}
+	a.PAData = append(a.PAData, types.PAData{
+		PADataType:  patype.PA_PAC_OPTIONS,
+		PADataValue: b,
+	})
+	return a, nil
+}
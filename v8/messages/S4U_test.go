@@ -0,0 +1,248 @@
+package messages
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testS4UTicket(t *testing.T) Ticket {
+	var tkt Ticket
+	b, err := hex.DecodeString(testdata.MarshaledKRB5ticket)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	err = tkt.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	return tkt
+}
+
+func TestPAForUser_Verify(t *testing.T) {
+	t.Parallel()
+	key := testArmorKey(t)
+	user := types.NewPrincipalName(nametype.KRB_NT_ENTERPRISE, "user@example.com")
+	p, err := NewPAForUser(user, testdata.TEST_REALM, key)
+	if err != nil {
+		t.Fatalf("error creating PA-FOR-USER: %v", err)
+	}
+	b, err := p.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling PA-FOR-USER: %v", err)
+	}
+	var u PAForUser
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-FOR-USER: %v", err)
+	}
+	assert.Equal(t, p, u, "PA-FOR-USER not as expected after round trip")
+	assert.Equal(t, "Kerberos", u.AuthPackage, "auth package not as expected")
+	ok, err := u.Verify(key)
+	assert.NoError(t, err)
+	assert.True(t, ok, "PA-FOR-USER checksum not valid")
+
+	u.UserName = types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "admin")
+	ok, err = u.Verify(key)
+	assert.Error(t, err, "PA-FOR-USER should not be valid for another user")
+	assert.False(t, ok)
+}
+
+func TestNewS4U2SelfTGSReq(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.LibDefaults.NoAddresses = true
+	key := testArmorKey(t)
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/gateway.example.com")
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	a, err := NewS4U2SelfTGSReq(cname, testdata.TEST_REALM, c, testS4UTicket(t), key, user, testdata.TEST_REALM, nil)
+	if err != nil {
+		t.Fatalf("error creating S4U2Self TGS_REQ: %v", err)
+	}
+	assert.Equal(t, cname, a.ReqBody.SName, "SName should be the service itself")
+	b, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling TGS_REQ: %v", err)
+	}
+	var r TGSReq
+	err = r.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling TGS_REQ: %v", err)
+	}
+	if !assert.Len(t, r.PAData, 3, "number of PAData not as expected") {
+		t.FailNow()
+	}
+	assert.Equal(t, patype.PA_TGS_REQ, r.PAData[0].PADataType, "first PAData should be the PA-TGS-REQ")
+	assert.Equal(t, patype.PA_FOR_USER, r.PAData[1].PADataType, "PA-FOR-USER not present")
+	assert.Equal(t, patype.PA_FOR_X509_USER, r.PAData[2].PADataType, "PA-S4U-X509-USER not present")
+
+	var pfu PAForUser
+	err = pfu.Unmarshal(r.PAData[1].PADataValue)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-FOR-USER: %v", err)
+	}
+	assert.Equal(t, user, pfu.UserName, "user name not as expected")
+	ok, err := pfu.Verify(key)
+	assert.NoError(t, err)
+	assert.True(t, ok, "PA-FOR-USER checksum not valid")
+
+	var px PAS4UX509User
+	err = px.Unmarshal(r.PAData[2].PADataValue)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-S4U-X509-USER: %v", err)
+	}
+	assert.Equal(t, r.ReqBody.Nonce, px.UserID.Nonce, "nonce should match that of the request body")
+	assert.Equal(t, user, px.UserID.CName, "user name not as expected")
+	assert.Equal(t, testdata.TEST_REALM, px.UserID.CRealm, "user realm not as expected")
+	ok, err = px.Verify(key)
+	assert.NoError(t, err)
+	assert.True(t, ok, "PA-S4U-X509-USER checksum not valid")
+	ok, _ = px.Verify(testArmorKey(t))
+	assert.False(t, ok, "PA-S4U-X509-USER should not be valid with another key")
+}
+
+func TestTGSReq_SetSubKey(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.LibDefaults.NoAddresses = true
+	key, subKey := testArmorKey(t), testArmorKey(t)
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/gateway.example.com")
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	a, err := NewS4U2SelfTGSReq(cname, testdata.TEST_REALM, c, testS4UTicket(t), key, user, testdata.TEST_REALM, nil)
+	if err != nil {
+		t.Fatalf("error creating S4U2Self TGS_REQ: %v", err)
+	}
+	pas := a.PAData
+	err = a.SetSubKey(testS4UTicket(t), key, subKey)
+	if err != nil {
+		t.Fatalf("error setting sub-session key: %v", err)
+	}
+	if !assert.Len(t, a.PAData, 3, "number of PAData not as expected") {
+		t.FailNow()
+	}
+	assert.Equal(t, patype.PA_TGS_REQ, a.PAData[0].PADataType, "first PAData should be the PA-TGS-REQ")
+	assert.Equal(t, pas[1:], a.PAData[1:], "PAData other than the PA-TGS-REQ should be kept")
+	var apReq APReq
+	err = apReq.Unmarshal(a.PAData[0].PADataValue)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-TGS-REQ: %v", err)
+	}
+	err = apReq.DecryptAuthenticator(key)
+	if err != nil {
+		t.Fatalf("error decrypting authenticator: %v", err)
+	}
+	assert.Equal(t, subKey, apReq.Authenticator.SubKey, "authenticator should carry the sub-session key")
+}
+
+func TestPAS4UX509User_VerifyReply(t *testing.T) {
+	t.Parallel()
+	key := testArmorKey(t)
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	req, err := NewPAS4UX509User(12345, user, testdata.TEST_REALM, nil, key)
+	if err != nil {
+		t.Fatalf("error creating PA-S4U-X509-USER: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&req.UserID.Options, flags.S4UOptionUseReplyKeyUsage), "request should ask for the reply key usage")
+	rep, err := NewPAS4UX509UserReply(req.UserID, key)
+	if err != nil {
+		t.Fatalf("error creating reply PA-S4U-X509-USER: %v", err)
+	}
+	b, err := rep.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling PA-S4U-X509-USER: %v", err)
+	}
+	var r PAS4UX509User
+	err = r.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-S4U-X509-USER: %v", err)
+	}
+	ok, err := r.VerifyReply(req, key)
+	assert.NoError(t, err)
+	assert.True(t, ok, "reply PA-S4U-X509-USER should be valid")
+	ok, _ = r.Verify(key)
+	assert.False(t, ok, "reply PA-S4U-X509-USER checksum should not use the request key usage")
+	ok, _ = r.VerifyReply(req, testArmorKey(t))
+	assert.False(t, ok, "reply PA-S4U-X509-USER should not be valid with another key")
+
+	// A KDC that does not indicate the reply key usage signs its reply with the request key usage.
+	old := req
+	old.UserID.Options = types.NewKrbFlags()
+	err = old.setChecksum(key, keyusage.PA_S4U_X509_USER_REQUEST)
+	if err != nil {
+		t.Fatalf("error setting checksum: %v", err)
+	}
+	ok, err = old.VerifyReply(req, key)
+	assert.NoError(t, err)
+	assert.True(t, ok, "reply PA-S4U-X509-USER with the request key usage should be valid")
+
+	other, err := NewPAS4UX509UserReply(S4UUserID{
+		Nonce:  req.UserID.Nonce,
+		CName:  types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "admin"),
+		CRealm: testdata.TEST_REALM,
+	}, key)
+	if err != nil {
+		t.Fatalf("error creating reply PA-S4U-X509-USER: %v", err)
+	}
+	ok, err = other.VerifyReply(req, key)
+	assert.Error(t, err, "reply PA-S4U-X509-USER for another user should not be valid")
+	assert.False(t, ok)
+
+	other, err = NewPAS4UX509UserReply(S4UUserID{
+		Nonce:  req.UserID.Nonce + 1,
+		CName:  user,
+		CRealm: testdata.TEST_REALM,
+	}, key)
+	if err != nil {
+		t.Fatalf("error creating reply PA-S4U-X509-USER: %v", err)
+	}
+	ok, err = other.VerifyReply(req, key)
+	assert.Error(t, err, "reply PA-S4U-X509-USER with another nonce should not be valid")
+	assert.False(t, ok)
+}
+
+func TestNewS4U2ProxyTGSReq(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.LibDefaults.NoAddresses = true
+	key := testArmorKey(t)
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/gateway.example.com")
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/backend.example.com")
+	evidence := testS4UTicket(t)
+	a, err := NewS4U2ProxyTGSReq(cname, testdata.TEST_REALM, c, testS4UTicket(t), key, sname, evidence)
+	if err != nil {
+		t.Fatalf("error creating S4U2Proxy TGS_REQ: %v", err)
+	}
+	b, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling TGS_REQ: %v", err)
+	}
+	var r TGSReq
+	err = r.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling TGS_REQ: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&r.ReqBody.KDCOptions, flags.CNameInAddlTkt), "cname-in-addl-tkt option not set")
+	if !assert.Len(t, r.ReqBody.AdditionalTickets, 1, "number of additional tickets not as expected") {
+		t.FailNow()
+	}
+	assert.Equal(t, evidence.EncPart.Cipher, r.ReqBody.AdditionalTickets[0].EncPart.Cipher, "evidence ticket not as expected")
+	if !assert.Len(t, r.PAData, 2, "number of PAData not as expected") {
+		t.FailNow()
+	}
+	assert.Equal(t, patype.PA_PAC_OPTIONS, r.PAData[1].PADataType, "PA-PAC-OPTIONS not present")
+	var po PAPACOptions
+	_, err = asn1.Unmarshal(r.PAData[1].PADataValue, &po)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-PAC-OPTIONS: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&po.Options, flags.PACOptionResourceBasedConstrainedDelegation), "resource-based constrained delegation option not set")
+}
@@ -1,17 +1,29 @@
 package service
 
 import (
+	"crypto/rand"
+	"math"
+	"math/big"
 	"time"
 
 	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/crypto"
 	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
 )
 
 // VerifyAPREQ verifies an AP_REQ sent to the service. Returns a boolean for if the AP_REQ is valid and the client's principal name and realm.
+//
+// Replays are detected with the replay cache of the Settings, which by default is shared by all Settings of the
+// process with the same keytab principal.
 func VerifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credentials, error) {
 	var creds *credentials.Credentials
-	ok, err := APReq.Verify(s.Keytab, s.MaxClockSkew(), s.ClientAddress(), s.KeytabPrincipal())
+	// Use the same keytab throughout even if the keytab source replaces it.
+	kt := s.currentKeytab()
+	ok, err := APReq.Verify(kt, s.MaxClockSkew(), s.ClientAddress(), s.KeytabPrincipal())
 	if err != nil || !ok {
 		return false, creds, err
 	}
@@ -22,8 +34,11 @@ func VerifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credent
 	}
 
 	// Check for replay
-	rc := GetReplayCache(s.MaxClockSkew())
-	if rc.IsReplay(APReq.Ticket.SName, APReq.Authenticator) {
+	replay, err := s.ReplayCache().CheckReplay(APReq.Ticket.SName, APReq.Authenticator)
+	if err != nil {
+		return false, creds, krberror.Errorf(err, krberror.KRBMsgError, "error checking the replay cache")
+	}
+	if replay {
 		return false, creds,
 			messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_REPEAT, "replay detected")
 	}
@@ -36,7 +51,7 @@ func VerifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credent
 
 	//PAC decoding
 	if !s.disablePACDecoding {
-		isPAC, pac, err := APReq.Ticket.GetPACType(s.Keytab, s.KeytabPrincipal(), s.Logger())
+		isPAC, pac, err := APReq.Ticket.GetPACType(kt, s.KeytabPrincipal(), s.Logger())
 		if isPAC && err != nil {
 			return false, creds, err
 		}
@@ -59,3 +74,41 @@ func VerifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credent
 	}
 	return true, creds, nil
 }
+
+// MutualRequired indicates if the client has requested mutual authentication in the AP_REQ.
+func MutualRequired(APReq *messages.APReq) bool {
+	return types.IsFlagSet(&APReq.APOptions, flags.APOptionMutualRequired)
+}
+
+// NewAPRep creates the AP_REP to return to the client for mutual authentication in response to an AP_REQ that has
+// been verified with VerifyAPREQ. A new subkey and sequence number are generated for the AP_REP and are available
+// from its DecryptedEncPart.
+func NewAPRep(APReq *messages.APReq) (messages.APRep, error) {
+	var a messages.APRep
+	key := APReq.Ticket.DecryptedEncPart.Key
+	keyType := key.KeyType
+	if len(APReq.Authenticator.SubKey.KeyValue) > 0 {
+		// The subkey is of the same encryption type as that of the client
+		keyType = APReq.Authenticator.SubKey.KeyType
+	}
+	et, err := crypto.GetEtype(keyType)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncryptingError, "error getting encryption type for AP_REP subkey")
+	}
+	subkey, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncryptingError, "error generating AP_REP subkey")
+	}
+	seq, err := rand.Int(rand.Reader, big.NewInt(math.MaxUint32))
+	if err != nil {
+		return a, err
+	}
+	a = messages.NewAPRep(messages.EncAPRepPart{
+		CTime:          APReq.Authenticator.CTime,
+		Cusec:          APReq.Authenticator.Cusec,
+		Subkey:         subkey,
+		SequenceNumber: seq.Int64() & 0x3fffffff,
+	})
+	err = a.EncryptEncPart(key)
+	return a, err
+}
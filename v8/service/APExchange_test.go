@@ -206,6 +206,61 @@ func TestVerifyAPREQ_LargeClockSkew(t *testing.T) {
 	}
 }
 
+// keytabSource is a keytab.Source whose keytab can be replaced.
+type keytabSource struct {
+	kt *keytab.Keytab
+}
+
+func (s *keytabSource) Keytab() *keytab.Keytab {
+	return s.kt
+}
+
+func TestVerifyAPREQ_KeytabSource(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	src := &keytabSource{kt: keytab.New()}
+	s := NewSettings(nil, ClientAddress(h), KeytabSource(src))
+
+	APReq, err := messages.NewAPReq(tkt, sessionKey, newTestAuthenticator(*cl.Credentials))
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	assert.False(t, ok, "validation of AP_REQ passed when the source's keytab does not have the key")
+
+	// The keytab of the source is used once it has been replaced.
+	src.kt = kt
+	APReq, err = messages.NewAPReq(tkt, sessionKey, newTestAuthenticator(*cl.Credentials))
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+	ok, _, err = VerifyAPREQ(&APReq, s)
+	assert.True(t, ok, "validation of AP_REQ with the source's keytab failed: %v", err)
+}
+
 func TestVerifyAPREQ_Replay(t *testing.T) {
 	t.Parallel()
 	cl := getClient()
@@ -400,6 +455,71 @@ func TestVerifyAPREQ_ExpiredTicket(t *testing.T) {
 	}
 }
 
+func TestNewAPRep(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	auth := newTestAuthenticator(*cl.Credentials)
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		auth,
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+	assert.False(t, MutualRequired(&APReq), "mutual authentication should not be required")
+	types.SetFlag(&APReq.APOptions, flags.APOptionMutualRequired)
+	assert.True(t, MutualRequired(&APReq), "mutual authentication should be required")
+
+	s := NewSettings(kt)
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+	APRep, err := NewAPRep(&APReq)
+	if err != nil {
+		t.Fatalf("Error creating AP_REP: %v", err)
+	}
+	b, err = APRep.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling AP_REP: %v", err)
+	}
+	var a messages.APRep
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling AP_REP: %v", err)
+	}
+	ok, err = a.Verify(sessionKey, auth)
+	if !ok || err != nil {
+		t.Fatalf("Verification of AP_REP failed when it should not have: %v", err)
+	}
+	assert.Equal(t, auth.SubKey.KeyType, a.DecryptedEncPart.Subkey.KeyType, "AP_REP subkey type not as expected")
+	assert.NotEqual(t, auth.SubKey.KeyValue, a.DecryptedEncPart.Subkey.KeyValue, "AP_REP subkey should be new")
+	assert.Equal(t, APRep.DecryptedEncPart.SequenceNumber, a.DecryptedEncPart.SequenceNumber, "AP_REP sequence number not as expected")
+}
+
 func newTestAuthenticator(creds credentials.Credentials) types.Authenticator {
 	auth, _ := types.NewAuthenticator(creds.Domain(), creds.CName())
 	auth.GenerateSeqNumberAndSubKey(18, 32)
@@ -52,6 +52,9 @@ var replayCache Cache
 var once sync.Once
 
 // GetReplayCache returns a pointer to the Cache singleton.
+//
+// The singleton is shared by all the services in the process. Services use their own replay cache, configured with the
+// ReplayCacheStore setting, rather than the singleton.
 func GetReplayCache(d time.Duration) *Cache {
 	// Create a singleton of the ReplayCache and start a background thread to regularly clean out old entries
 	once.Do(func() {
@@ -115,6 +118,11 @@ func (c *Cache) ClearOldEntries(d time.Duration) {
 	}
 }
 
+// CheckReplay implements the ReplayCache interface using IsReplay.
+func (c *Cache) CheckReplay(sname types.PrincipalName, a types.Authenticator) (bool, error) {
+	return c.IsReplay(sname, a), nil
+}
+
 // IsReplay tests if the Authenticator provided is a replay within the duration defined. If this is not a replay add the entry to the cache for tracking.
 func (c *Cache) IsReplay(sname types.PrincipalName, a types.Authenticator) bool {
 	ct := a.CTime.Add(time.Duration(a.Cusec) * time.Microsecond)
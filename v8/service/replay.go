@@ -0,0 +1,185 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// ReplayCache detects the replay of authenticators presented to a service, as required by RFC 4120 section 3.2.3.
+//
+// The replay cache of a service is configured with the ReplayCacheStore setting. By default the services of the process
+// with the same keytab principal share an in-memory replay cache, so replays are detected even when the service
+// Settings are created for each request. Instances of a service that share a replay cache, such as replicas behind a load balancer
+// using a FileReplayCache on shared storage or an implementation backed by a shared database, detect replays across
+// the instances. Implementations must be safe for concurrent use.
+type ReplayCache interface {
+	// CheckReplay reports whether the authenticator, presented to the service with the name provided, has been seen
+	// before. If it has not it is recorded so that a replay of it is detected. Authenticators only need to be recorded
+	// for the maximum clock skew after their client time, as older authenticators are rejected.
+	CheckReplay(sname types.PrincipalName, a types.Authenticator) (bool, error)
+}
+
+// replayTagSize is the size of the tag identifying an authenticator in a replay cache.
+const replayTagSize = 16
+
+// replayTag returns the tag identifying the authenticator presented to the service, which is derived from the service
+// name, the client's name and realm and the client time of the authenticator.
+func replayTag(sname types.PrincipalName, a types.Authenticator) [replayTagSize]byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%d\x00%d", sname.PrincipalNameString(), a.CName.PrincipalNameString(), a.CRealm,
+		a.CTime.Unix(), a.Cusec)
+	var tag [replayTagSize]byte
+	copy(tag[:], h.Sum(nil))
+	return tag
+}
+
+// MemoryReplayCache is a ReplayCache that holds the authenticators seen in memory. It is the default replay cache of a
+// service, shared by the services with the same keytab principal, and only detects replays within the process.
+type MemoryReplayCache struct {
+	window  time.Duration
+	mux     sync.Mutex
+	entries map[[replayTagSize]byte]time.Time
+	swept   time.Time
+}
+
+// NewMemoryReplayCache returns a new in-memory replay cache that records authenticators for the duration provided,
+// which should be the maximum clock skew of the services it is used by.
+func NewMemoryReplayCache(d time.Duration) *MemoryReplayCache {
+	return &MemoryReplayCache{
+		window:  d,
+		entries: make(map[[replayTagSize]byte]time.Time),
+		swept:   time.Now(),
+	}
+}
+
+// defaultReplayCaches holds the default in-memory replay caches of the process, by keytab principal and window.
+var defaultReplayCaches = struct {
+	mux    sync.Mutex
+	caches map[string]*MemoryReplayCache
+}{caches: make(map[string]*MemoryReplayCache)}
+
+// defaultReplayCache returns the default in-memory replay cache shared by the services with the keytab principal and
+// maximum clock skew provided, creating it if needed.
+func defaultReplayCache(principal string, d time.Duration) *MemoryReplayCache {
+	key := fmt.Sprintf("%s\x00%d", principal, d)
+	defaultReplayCaches.mux.Lock()
+	defer defaultReplayCaches.mux.Unlock()
+	c, ok := defaultReplayCaches.caches[key]
+	if !ok {
+		c = NewMemoryReplayCache(d)
+		defaultReplayCaches.caches[key] = c
+	}
+	return c
+}
+
+// CheckReplay reports whether the authenticator, presented to the service with the name provided, has been seen
+// before, recording it if not.
+func (c *MemoryReplayCache) CheckReplay(sname types.PrincipalName, a types.Authenticator) (bool, error) {
+	tag := replayTag(sname, a)
+	now := time.Now()
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if now.Sub(c.swept) > c.window {
+		for k, exp := range c.entries {
+			if now.After(exp) {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = now
+	}
+	if exp, ok := c.entries[tag]; ok && !now.After(exp) {
+		return true, nil
+	}
+	c.entries[tag] = a.CTime.Add(c.window)
+	return false, nil
+}
+
+// replayRecordSize is the size of a record in a file replay cache: the tag followed by the client time in seconds.
+const replayRecordSize = replayTagSize + 4
+
+// FileReplayCache is a ReplayCache that records the authenticators seen in a file, in the spirit of the MIT Kerberos
+// file replay cache. The file holds a fixed size record for each authenticator, of a tag derived from it and its client
+// time, and records older than the maximum clock skew are discarded when the file is compacted.
+//
+// The file is locked while it is checked and updated, where the platform supports POSIX advisory locks, so it can be
+// shared by services in different processes, or on different hosts with storage that supports locking.
+type FileReplayCache struct {
+	path   string
+	window time.Duration
+	mux    sync.Mutex
+}
+
+// NewFileReplayCache returns a replay cache that records authenticators, for the duration provided, in the file at the
+// path. The duration should be the maximum clock skew of the services it is used by. The file is created if it does not
+// exist.
+func NewFileReplayCache(path string, d time.Duration) (*FileReplayCache, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening replay cache file: %v", err)
+	}
+	f.Close()
+	return &FileReplayCache{
+		path:   path,
+		window: d,
+	}, nil
+}
+
+// CheckReplay reports whether the authenticator, presented to the service with the name provided, has been seen
+// before, recording it in the file if not.
+func (c *FileReplayCache) CheckReplay(sname types.PrincipalName, a types.Authenticator) (bool, error) {
+	tag := replayTag(sname, a)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	f, err := os.OpenFile(c.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return false, fmt.Errorf("error opening replay cache file: %v", err)
+	}
+	defer f.Close()
+	err = lockFile(f)
+	if err != nil {
+		return false, fmt.Errorf("error locking replay cache file: %v", err)
+	}
+	defer unlockFile(f)
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return false, fmt.Errorf("error reading replay cache file: %v", err)
+	}
+	// Ignore any partial record left by an interrupted write.
+	b = b[:len(b)-len(b)%replayRecordSize]
+	oldest := time.Now().Add(-c.window).Unix()
+	live := make([]byte, 0, len(b)+replayRecordSize)
+	for i := 0; i < len(b); i += replayRecordSize {
+		r := b[i : i+replayRecordSize]
+		if int64(binary.BigEndian.Uint32(r[replayTagSize:])) < oldest {
+			continue
+		}
+		if bytes.Equal(r[:replayTagSize], tag[:]) {
+			return true, nil
+		}
+		live = append(live, r...)
+	}
+	r := make([]byte, replayRecordSize)
+	copy(r, tag[:])
+	binary.BigEndian.PutUint32(r[replayTagSize:], uint32(a.CTime.Unix()))
+	if len(live) < len(b)/2 {
+		// Compact the file when most of its records have expired.
+		err = f.Truncate(0)
+		if err == nil {
+			_, err = f.WriteAt(append(live, r...), 0)
+		}
+	} else {
+		_, err = f.WriteAt(r, int64(len(b)))
+	}
+	if err != nil {
+		return false, fmt.Errorf("error writing replay cache file: %v", err)
+	}
+	return false, nil
+}
@@ -0,0 +1,29 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package service
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive POSIX advisory lock on the whole of the replay cache file, blocking until the lock is
+// obtained.
+func lockFile(f *os.File) error {
+	lk := syscall.Flock_t{
+		Type:   syscall.F_WRLCK,
+		Whence: io.SeekStart,
+	}
+	return syscall.FcntlFlock(f.Fd(), syscall.F_SETLKW, &lk)
+}
+
+// unlockFile releases the lock on the replay cache file.
+func unlockFile(f *os.File) error {
+	lk := syscall.Flock_t{
+		Type:   syscall.F_UNLCK,
+		Whence: io.SeekStart,
+	}
+	return syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lk)
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func replayTestAuthenticator(t *testing.T, ctime time.Time) types.Authenticator {
+	a, err := types.NewAuthenticator("TEST.GOKRB5", types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"))
+	if err != nil {
+		t.Fatalf("error creating authenticator: %v", err)
+	}
+	a.CTime = ctime.Truncate(time.Second)
+	a.Cusec = 1234
+	return a
+}
+
+func testReplayCache(t *testing.T, rc ReplayCache) {
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	a := replayTestAuthenticator(t, time.Now().UTC())
+	replay, err := rc.CheckReplay(sname, a)
+	assert.NoError(t, err, "error checking replay cache")
+	assert.False(t, replay, "first authenticator should not be a replay")
+	replay, err = rc.CheckReplay(sname, a)
+	assert.NoError(t, err, "error checking replay cache")
+	assert.True(t, replay, "repeated authenticator should be a replay")
+
+	other := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/other.test.gokrb5")
+	replay, err = rc.CheckReplay(other, a)
+	assert.NoError(t, err, "error checking replay cache")
+	assert.False(t, replay, "authenticator to another service should not be a replay")
+	a2 := a
+	a2.CRealm = "OTHER.GOKRB5"
+	replay, err = rc.CheckReplay(sname, a2)
+	assert.NoError(t, err, "error checking replay cache")
+	assert.False(t, replay, "authenticator from a client of another realm should not be a replay")
+	a3 := a
+	a3.Cusec++
+	replay, err = rc.CheckReplay(sname, a3)
+	assert.NoError(t, err, "error checking replay cache")
+	assert.False(t, replay, "authenticator with another client time should not be a replay")
+
+	// Authenticators older than the clock skew are no longer recorded.
+	old := replayTestAuthenticator(t, time.Now().UTC().Add(-2*time.Minute))
+	replay, err = rc.CheckReplay(sname, old)
+	assert.NoError(t, err, "error checking replay cache")
+	assert.False(t, replay, "first authenticator should not be a replay")
+	replay, err = rc.CheckReplay(sname, old)
+	assert.NoError(t, err, "error checking replay cache")
+	assert.False(t, replay, "authenticator older than the clock skew should not be recorded")
+}
+
+func TestMemoryReplayCache(t *testing.T) {
+	t.Parallel()
+	testReplayCache(t, NewMemoryReplayCache(time.Minute))
+}
+
+func TestFileReplayCache(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "gokrb5-rcache")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "HTTP_rcache")
+	rc, err := NewFileReplayCache(path, time.Minute)
+	if err != nil {
+		t.Fatalf("error creating file replay cache: %v", err)
+	}
+	testReplayCache(t, rc)
+
+	// Another instance using the same file detects the replay.
+	rc2, err := NewFileReplayCache(path, time.Minute)
+	if err != nil {
+		t.Fatalf("error creating file replay cache: %v", err)
+	}
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	a := replayTestAuthenticator(t, time.Now().UTC().Add(-time.Second))
+	replay, err := rc.CheckReplay(sname, a)
+	assert.NoError(t, err, "error checking replay cache")
+	assert.False(t, replay, "first authenticator should not be a replay")
+	replay, err = rc2.CheckReplay(sname, a)
+	assert.NoError(t, err, "error checking replay cache")
+	assert.True(t, replay, "replay should be detected by another instance sharing the file")
+
+	// Expired records are removed when the file is compacted.
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading replay cache file: %v", err)
+	}
+	for i := 0; i < len(b); i += replayRecordSize {
+		binary.BigEndian.PutUint32(b[i+replayTagSize:], uint32(time.Now().Add(-time.Hour).Unix()))
+	}
+	// Append a partial record, as left by an interrupted write.
+	err = ioutil.WriteFile(path, append(b, 1, 2, 3), 0600)
+	if err != nil {
+		t.Fatalf("error writing replay cache file: %v", err)
+	}
+	replay, err = rc.CheckReplay(sname, replayTestAuthenticator(t, time.Now().UTC()))
+	assert.NoError(t, err, "error checking replay cache")
+	assert.False(t, replay, "first authenticator should not be a replay")
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("error reading replay cache file: %v", err)
+	}
+	assert.Equal(t, int64(replayRecordSize), fi.Size(), "expired records should be removed from the file")
+}
+
+func TestVerifyAPREQ_ReplayCacheStore(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(tkt, sessionKey, newTestAuthenticator(*cl.Credentials))
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+
+	// Settings created for each request share the default replay cache.
+	assert.Same(t, NewSettings(kt).ReplayCache(), NewSettings(kt).ReplayCache(), "default replay cache not shared")
+	ok, _, err := VerifyAPREQ(&APReq, NewSettings(kt, ClientAddress(h)))
+	assert.True(t, ok, "validation of AP_REQ failed: %v", err)
+	ok, _, err = VerifyAPREQ(&APReq, NewSettings(kt, ClientAddress(h)))
+	assert.False(t, ok, "validation of AP_REQ replayed to new settings passed")
+	if assert.IsType(t, messages.KRBError{}, err, "error is not a KRBError") {
+		assert.Equal(t, errorcode.KRB_AP_ERR_REPEAT, err.(messages.KRBError).ErrorCode, "error code not as expected")
+	}
+	assert.NotSame(t, NewSettings(kt).ReplayCache(), NewSettings(kt, KeytabPrincipal("HTTP/other.test.gokrb5")).ReplayCache(),
+		"services with different keytab principals share the default replay cache")
+
+	// Replays are detected across services sharing a replay cache.
+	rc := NewMemoryReplayCache(time.Minute)
+	ok, _, err = VerifyAPREQ(&APReq, NewSettings(kt, ClientAddress(h), ReplayCacheStore(rc)))
+	assert.True(t, ok, "validation of AP_REQ failed: %v", err)
+	ok, _, err = VerifyAPREQ(&APReq, NewSettings(kt, ClientAddress(h), ReplayCacheStore(rc)))
+	assert.False(t, ok, "validation of replayed AP_REQ passed")
+	if assert.IsType(t, messages.KRBError{}, err, "error is not a KRBError") {
+		assert.Equal(t, errorcode.KRB_AP_ERR_REPEAT, err.(messages.KRBError).ErrorCode, "error code not as expected")
+	}
+}
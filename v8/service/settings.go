@@ -3,6 +3,7 @@ package service
 import (
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/jcmturner/gokrb5/v8/keytab"
@@ -12,6 +13,7 @@ import (
 // Settings defines service side configuration settings.
 type Settings struct {
 	Keytab             *keytab.Keytab
+	keytabSource       keytab.Source
 	ktprinc            *types.PrincipalName
 	sname              string
 	requireHostAddr    bool
@@ -20,9 +22,14 @@ type Settings struct {
 	maxClockSkew       time.Duration
 	logger             *log.Logger
 	sessionMgr         SessionMgr
+	replayCache        ReplayCache
+	replayCacheOnce    sync.Once
 }
 
 // NewSettings creates a new service Settings.
+//
+// Unless a replay cache is configured with the ReplayCacheStore setting, Settings with the same keytab principal share
+// a default in-memory replay cache within the process, so Settings may be created for each request.
 func NewSettings(kt *keytab.Keytab, settings ...func(*Settings)) *Settings {
 	s := new(Settings)
 	s.Keytab = kt
@@ -104,6 +111,29 @@ func (s *Settings) KeytabPrincipal() *types.PrincipalName {
 	return s.ktprinc
 }
 
+// KeytabSource used to configure the service to use the keytab provided by the source in place of the keytab it was
+// created with, so that the keytab can be replaced while the service is running, such as when its keys are rotated.
+//
+// s := NewSettings(nil, KeytabSource(src))
+func KeytabSource(src keytab.Source) func(*Settings) {
+	return func(s *Settings) {
+		s.keytabSource = src
+	}
+}
+
+// KeytabSource returns the source of the service's keytab if one is configured, otherwise nil.
+func (s *Settings) KeytabSource() keytab.Source {
+	return s.keytabSource
+}
+
+// currentKeytab returns the keytab of the service's keytab source, if one is configured, otherwise its keytab.
+func (s *Settings) currentKeytab() *keytab.Keytab {
+	if s.keytabSource != nil {
+		return s.keytabSource.Keytab()
+	}
+	return s.Keytab
+}
+
 // MaxClockSkew used to configure service side with the maximum acceptable clock skew
 // between the service and the issue time of kerberos tickets
 //
@@ -151,6 +181,31 @@ func (s *Settings) SessionManager() SessionMgr {
 	return s.sessionMgr
 }
 
+// ReplayCacheStore configures the replay cache used to detect the replay of authenticators to the service. A replay
+// cache shared by the instances of a service allows replays to be detected across them.
+//
+// s := NewSettings(kt, ReplayCacheStore(rc))
+func ReplayCacheStore(rc ReplayCache) func(*Settings) {
+	return func(s *Settings) {
+		s.replayCache = rc
+	}
+}
+
+// ReplayCache returns the replay cache of the service. If none is configured the in-memory replay cache shared by the
+// services of the process with the same keytab principal, or service name, and maximum clock skew is used.
+func (s *Settings) ReplayCache() ReplayCache {
+	s.replayCacheOnce.Do(func() {
+		if s.replayCache == nil {
+			principal := s.sname
+			if s.ktprinc != nil {
+				principal = s.ktprinc.PrincipalNameString()
+			}
+			s.replayCache = defaultReplayCache(principal, s.MaxClockSkew())
+		}
+	})
+	return s.replayCache
+}
+
 // SessionMgr must provide a ways to:
 //
 // - Create new sessions and in the process add a value to the session under the key provided.
@@ -2,6 +2,7 @@ package spnego
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -31,6 +32,7 @@ type Client struct {
 	*http.Client
 	krb5Client *client.Client
 	spn        string
+	options    []func(*SPNEGO)
 	reqs       []*http.Request
 }
 
@@ -52,7 +54,8 @@ type teeReadCloser struct {
 // Ensure reuse of the provided *http.Client is for the same user as a session cookie may have been added to
 // http.Client's cookie jar.
 // Incorrect reuse of the provided *http.Client could lead to access to the wrong user's session.
-func NewClient(krb5Cl *client.Client, httpCl *http.Client, spn string) *Client {
+// Options, such as Delegate, configure the SPNEGO mechanism used to authenticate.
+func NewClient(krb5Cl *client.Client, httpCl *http.Client, spn string, options ...func(*SPNEGO)) *Client {
 	if httpCl == nil {
 		httpCl = &http.Client{}
 	}
@@ -75,11 +78,20 @@ func NewClient(krb5Cl *client.Client, httpCl *http.Client, spn string) *Client {
 		Client:     httpCl,
 		krb5Client: krb5Cl,
 		spn:        spn,
+		options:    options,
 	}
 }
 
 // Do is the SPNEGO enabled HTTP client's equivalent of the http.Client's Do method.
+// Mutual authentication is required of the server, so if the response to the authenticated request does not hold
+// a valid AP_REP an error is returned.
 func (c *Client) Do(req *http.Request) (resp *http.Response, err error) {
+	return c.do(req, nil)
+}
+
+// do sends the request. If the request carries an SPNEGO authorization header, the SPNEGO mechanism that generated it
+// is passed so that the server's response can be verified for mutual authentication.
+func (c *Client) do(req *http.Request, s *SPNEGO) (resp *http.Response, err error) {
 	var body bytes.Buffer
 	if req.Body != nil {
 		// Use a tee reader to capture any body sent in case we have to replay it again
@@ -92,6 +104,12 @@ func (c *Client) Do(req *http.Request) (resp *http.Response, err error) {
 		if ue, ok := err.(*url.Error); ok {
 			if e, ok := ue.Err.(redirectErr); ok {
 				// Picked up a redirect
+				if s != nil && resp != nil {
+					// The redirect is only followed if it came from the authenticated server
+					if err := verifyMutualAuth(s, resp); err != nil {
+						return nil, err
+					}
+				}
 				e.reqTarget.Header.Del(HTTPHeaderAuthRequest)
 				c.reqs = append(c.reqs, e.reqTarget)
 				if len(c.reqs) >= 10 {
@@ -101,13 +119,21 @@ func (c *Client) Do(req *http.Request) (resp *http.Response, err error) {
 					// Refresh the body reader so the body can be sent again
 					e.reqTarget.Body = io.NopCloser(&body)
 				}
-				return c.Do(e.reqTarget)
+				return c.do(e.reqTarget, nil)
 			}
 		}
 		return resp, err
 	}
+	if s != nil && resp.StatusCode != http.StatusUnauthorized {
+		err = verifyMutualAuth(s, resp)
+		if err != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			return nil, err
+		}
+	}
 	if respUnauthorizedNegotiate(resp) {
-		err := SetSPNEGOHeader(c.krb5Client, req, c.spn)
+		s, err := setSPNEGOHeader(c.krb5Client, req, c.spn, c.options...)
 		if err != nil {
 			return resp, err
 		}
@@ -117,11 +143,44 @@ func (c *Client) Do(req *http.Request) (resp *http.Response, err error) {
 		}
 		io.Copy(io.Discard, resp.Body)
 		resp.Body.Close()
-		return c.Do(req)
+		return c.do(req, s)
 	}
 	return resp, err
 }
 
+// verifyMutualAuth verifies the SPNEGO token in the WWW-Authenticate header of the server's response to complete
+// mutual authentication.
+func verifyMutualAuth(s *SPNEGO, resp *http.Response) error {
+	h := strings.SplitN(resp.Header.Get(HTTPHeaderAuthResponse), " ", 2)
+	if len(h) != 2 || h[0] != HTTPHeaderAuthResponseValueKey {
+		if s.SecurityContext().Flags()&gssapi.ContextFlagMutual != 0 {
+			return errors.New("mutual authentication failed: server did not return a negotiation token")
+		}
+		return nil
+	}
+	b, err := base64.StdEncoding.DecodeString(h[1])
+	if err != nil {
+		return fmt.Errorf("mutual authentication failed: error in base64 decoding negotiation header: %v", err)
+	}
+	var ct gssapi.ContextToken
+	var st SPNEGOToken
+	err = st.Unmarshal(b)
+	ct = &st
+	if err != nil {
+		// Check if this is a raw KRB5 context token
+		var k5t KRB5Token
+		if k5t.Unmarshal(b) != nil {
+			return fmt.Errorf("mutual authentication failed: error in unmarshaling SPNEGO token: %v", err)
+		}
+		ct = &k5t
+	}
+	ok, status := s.InitSecContextResponse(ct)
+	if !ok {
+		return fmt.Errorf("mutual authentication failed: %v", status)
+	}
+	return nil
+}
+
 // Get is the SPNEGO enabled HTTP client's equivalent of the http.Client's Get method.
 func (c *Client) Get(url string) (resp *http.Response, err error) {
 	req, err := http.NewRequest("GET", url, nil)
@@ -194,31 +253,39 @@ func setRequestSPN(r *http.Request) (types.PrincipalName, error) {
 
 // SetSPNEGOHeader gets the service ticket and sets it as the SPNEGO authorization header on HTTP request object.
 // To auto generate the SPN from the request object pass a null string "".
-func SetSPNEGOHeader(cl *client.Client, r *http.Request, spn string) error {
+// Options, such as Delegate, configure the SPNEGO mechanism used to authenticate.
+func SetSPNEGOHeader(cl *client.Client, r *http.Request, spn string, options ...func(*SPNEGO)) error {
+	_, err := setSPNEGOHeader(cl, r, spn, options...)
+	return err
+}
+
+// setSPNEGOHeader sets the SPNEGO authorization header and returns the SPNEGO mechanism holding the security context
+// initiated.
+func setSPNEGOHeader(cl *client.Client, r *http.Request, spn string, options ...func(*SPNEGO)) (*SPNEGO, error) {
 	if spn == "" {
 		pn, err := setRequestSPN(r)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		spn = pn.PrincipalNameString()
 	}
 	cl.Log("using SPN %s", spn)
-	s := SPNEGOClient(cl, spn)
+	s := SPNEGOClient(cl, spn, options...)
 	err := s.AcquireCred()
 	if err != nil {
-		return fmt.Errorf("could not acquire client credential: %v", err)
+		return nil, fmt.Errorf("could not acquire client credential: %v", err)
 	}
 	st, err := s.InitSecContext()
 	if err != nil {
-		return fmt.Errorf("could not initialize context: %v", err)
+		return nil, fmt.Errorf("could not initialize context: %v", err)
 	}
 	nb, err := st.Marshal()
 	if err != nil {
-		return krberror.Errorf(err, krberror.EncodingError, "could not marshal SPNEGO")
+		return nil, krberror.Errorf(err, krberror.EncodingError, "could not marshal SPNEGO")
 	}
 	hs := "Negotiate " + base64.StdEncoding.EncodeToString(nb)
 	r.Header.Set(HTTPHeaderAuthRequest, hs)
-	return nil
+	return s, nil
 }
 
 // Service side functionality //
@@ -234,6 +301,8 @@ const (
 	sessionCredentials = "github.com/jcmturner/gokrb5/v8/sessionCredentials"
 	// ctxCredentials is the SPNEGO context key holding the credentials jcmturner/goidentity/Identity object.
 	ctxCredentials = "github.com/jcmturner/gokrb5/v8/ctxCredentials"
+	// ctxDelegatedCredential is the SPNEGO context key holding the KRB_CRED delegated by the client.
+	ctxDelegatedCredential = "github.com/jcmturner/gokrb5/v8/ctxDelegatedCredential"
 	// HTTPHeaderAuthRequest is the header that will hold authn/z information.
 	HTTPHeaderAuthRequest = "Authorization"
 	// HTTPHeaderAuthResponse is the header that will hold SPNEGO data from the server.
@@ -245,6 +314,12 @@ const (
 )
 
 // SPNEGOKRB5Authenticate is a Kerberos SPNEGO authentication HTTP handler wrapper.
+//
+// To pick up rotated keys without a restart, provide a keytab source with the service.KeytabSource setting, such as a
+// keytab.FileSource, in which case the keytab argument may be nil:
+//
+//	src, err := keytab.NewFileSource("/etc/krb5.keytab", time.Minute, l)
+//	h := spnego.SPNEGOKRB5Authenticate(inner, nil, service.KeytabSource(src), service.Logger(l))
 func SPNEGOKRB5Authenticate(inner http.Handler, kt *keytab.Keytab, settings ...func(*service.Settings)) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set up the SPNEGO GSS-API mechanism
@@ -293,8 +368,15 @@ func SPNEGOKRB5Authenticate(inner http.Handler, kt *keytab.Keytab, settings ...f
 			if err != nil {
 				return
 			}
-			spnegoResponseAcceptCompleted(spnego, w, "%s %s@%s - SPNEGO authentication succeeded", r.RemoteAddr, id.UserName(), id.Domain())
-			// Add the identity to the context and serve the inner/wrapped handler
+			err = spnegoResponseAcceptCompleted(spnego, w, "%s %s@%s - SPNEGO authentication succeeded", r.RemoteAddr, id.UserName(), id.Domain())
+			if err != nil {
+				spnegoInternalServerError(spnego, w, "%s - SPNEGO could not create response token: %v", r.RemoteAddr, err)
+				return
+			}
+			// Add any delegated credential and the identity to the context and serve the inner/wrapped handler
+			if cred, ok := DelegatedCredential(ctx); ok {
+				r = r.WithContext(context.WithValue(r.Context(), ctxDelegatedCredential, cred))
+			}
 			inner.ServeHTTP(w, goidentity.AddToHTTPRequestContext(id, r))
 			return
 		}
@@ -331,6 +413,7 @@ func getAuthorizationNegotiationHeaderAsSPNEGOToken(spnego *SPNEGO, r *http.Requ
 			return nil, err
 		}
 		// Wrap it into an SPNEGO context token
+		st.rawKRB5 = true
 		st.Init = true
 		st.NegTokenInit = NegTokenInit{
 			MechTypes:      []asn1.ObjectIdentifier{k5t.OID},
@@ -389,9 +472,22 @@ func spnegoResponseReject(s *SPNEGO, w http.ResponseWriter, format string, v ...
 	http.Error(w, UnauthorizedMsg, http.StatusUnauthorized)
 }
 
-func spnegoResponseAcceptCompleted(s *SPNEGO, w http.ResponseWriter, format string, v ...interface{}) {
+func spnegoResponseAcceptCompleted(s *SPNEGO, w http.ResponseWriter, format string, v ...interface{}) error {
+	rt, err := s.AcceptSecContextResponse()
+	if err != nil {
+		return err
+	}
+	h := spnegoNegTokenRespKRBAcceptCompleted
+	if rt != nil {
+		b, err := rt.Marshal()
+		if err != nil {
+			return err
+		}
+		h = HTTPHeaderAuthResponseValueKey + " " + base64.StdEncoding.EncodeToString(b)
+	}
 	s.Log(format, v...)
-	w.Header().Set(HTTPHeaderAuthResponse, spnegoNegTokenRespKRBAcceptCompleted)
+	w.Header().Set(HTTPHeaderAuthResponse, h)
+	return nil
 }
 
 func spnegoInternalServerError(s *SPNEGO, w http.ResponseWriter, format string, v ...interface{}) {
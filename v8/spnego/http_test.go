@@ -135,6 +135,28 @@ func TestService_SPNEGOKRB_NoAuthHeader(t *testing.T) {
 	assert.Equal(t, "Negotiate", httpResp.Header.Get("WWW-Authenticate"), "Negotiation header not set by server.")
 }
 
+func TestService_SPNEGOKRB_MutualAuth(t *testing.T) {
+	t.Parallel()
+	s := httpServerWithoutSessionManager()
+	defer s.Close()
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	ini, b := testInitiator(t, kt)
+	r, _ := http.NewRequest("GET", s.URL, nil)
+	r.Header.Set(HTTPHeaderAuthRequest, "Negotiate "+base64.StdEncoding.EncodeToString(b))
+	httpResp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("Request error: %v\n", err)
+	}
+	assert.Equal(t, http.StatusOK, httpResp.StatusCode, "Status code in response to client SPNEGO request not as expected")
+	assert.NoError(t, verifyMutualAuth(ini, httpResp), "mutual authentication of the server failed")
+
+	// The response to another initiator does not authenticate the server to this one
+	other, _ := testInitiator(t, kt)
+	assert.Error(t, verifyMutualAuth(other, httpResp), "mutual authentication should fail for another initiator")
+}
+
 func TestService_SPNEGOKRB_ValidUser(t *testing.T) {
 	test.Integration(t)
 
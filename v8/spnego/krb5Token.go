@@ -10,7 +10,9 @@ import (
 	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/jcmturner/gokrb5/v8/asn1tools"
 	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
 	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/crypto"
 	"github.com/jcmturner/gokrb5/v8/gssapi"
 	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
@@ -29,13 +31,16 @@ const (
 
 // KRB5Token context token implementation for GSSAPI.
 type KRB5Token struct {
-	OID      asn1.ObjectIdentifier
-	tokID    []byte
-	APReq    messages.APReq
-	APRep    messages.APRep
-	KRBError messages.KRBError
-	settings *service.Settings
-	context  context.Context
+	OID        asn1.ObjectIdentifier
+	tokID      []byte
+	APReq      messages.APReq
+	APRep      messages.APRep
+	KRBError   messages.KRBError
+	settings   *service.Settings
+	context    context.Context
+	secCtx     *gssapi.SecurityContext
+	sessionKey types.EncryptionKey
+	response   *KRB5Token
 }
 
 // Marshal a KRB5Token into a slice of bytes.
@@ -52,7 +57,10 @@ func (m *KRB5Token) Marshal() ([]byte, error) {
 			return []byte{}, fmt.Errorf("error marshalling AP_REQ for MechToken: %v", err)
 		}
 	case TOK_ID_KRB_AP_REP:
-		return []byte{}, errors.New("marshal of AP_REP GSSAPI MechToken not supported by gokrb5")
+		tb, err = m.APRep.Marshal()
+		if err != nil {
+			return []byte{}, fmt.Errorf("error marshalling AP_REP for MechToken: %v", err)
+		}
 	case TOK_ID_KRB_ERROR:
 		return []byte{}, errors.New("marshal of KRB_ERROR GSSAPI MechToken not supported by gokrb5")
 	}
@@ -117,11 +125,28 @@ func (m *KRB5Token) Verify() (bool, gssapi.Status) {
 		}
 		m.context = context.Background()
 		m.context = context.WithValue(m.context, ctxCredentials, creds)
+		if authenticatorChksumFlags(m.APReq.Authenticator.Cksum)&gssapi.ContextFlagDeleg != 0 {
+			cred, err := delegatedCredential(&m.APReq)
+			if err != nil {
+				return false, gssapi.Status{Code: gssapi.StatusDefectiveCredential, Message: err.Error()}
+			}
+			m.context = context.WithValue(m.context, ctxDelegatedCredential, cred)
+		}
+		m.secCtx = newAcceptorSecurityContext(&m.APReq)
+		if service.MutualRequired(&m.APReq) || authenticatorChksumFlags(m.APReq.Authenticator.Cksum)&gssapi.ContextFlagMutual != 0 {
+			APRep, err := service.NewAPRep(&m.APReq)
+			if err != nil {
+				return false, gssapi.Status{Code: gssapi.StatusFailure, Message: err.Error()}
+			}
+			m.secCtx.SetAcceptorSubkey(&APRep.DecryptedEncPart.Subkey, uint64(APRep.DecryptedEncPart.SequenceNumber))
+			rt := NewKRB5TokenAPREP(APRep)
+			m.response = &rt
+		}
 		return true, gssapi.Status{Code: gssapi.StatusComplete}
 	case TOK_ID_KRB_AP_REP:
 		// Client side
-		// TODO how to verify the AP_REP - not yet implemented
-		return false, gssapi.Status{Code: gssapi.StatusFailure, Message: "verifying an AP_REP is not currently supported by gokrb5"}
+		// The AP_REP can only be verified against the AP_REQ sent so VerifyAPRep of the initiator's token must be used
+		return false, gssapi.Status{Code: gssapi.StatusFailure, Message: "an AP_REP must be verified with the VerifyAPRep method of the initiator's KRB5 token"}
 	case TOK_ID_KRB_ERROR:
 		if m.KRBError.MsgType != msgtype.KRB_ERROR {
 			return false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "KRB5_Error token not valid"}
@@ -160,6 +185,37 @@ func (m *KRB5Token) Context() context.Context {
 	return m.context
 }
 
+// SecurityContext returns the GSS-API security context established by the KRB5 token.
+// On the initiator's side this is available once the token is created and on the acceptor's side once it is verified.
+func (m *KRB5Token) SecurityContext() *gssapi.SecurityContext {
+	return m.secCtx
+}
+
+// ResponseToken returns the KRB5 token holding the AP_REP to return to the initiator for mutual authentication.
+// It is available once a KRB5 token holding an AP_REQ requesting mutual authentication has been verified, otherwise
+// nil is returned.
+func (m *KRB5Token) ResponseToken() *KRB5Token {
+	return m.response
+}
+
+// VerifyAPRep verifies the AP_REP sent by the service in response to the AP_REQ within this KRB5 token, completing
+// mutual authentication. The security context adopts the subkey and sequence number asserted by the service.
+func (m *KRB5Token) VerifyAPRep(APRep *messages.APRep) error {
+	if !m.IsAPReq() || m.secCtx == nil {
+		return errors.New("KRB5 token does not hold an AP_REQ created by this initiator")
+	}
+	ok, err := APRep.Verify(m.sessionKey, m.APReq.Authenticator)
+	if err != nil || !ok {
+		return krberror.Errorf(err, krberror.KRBMsgError, "mutual authentication failed")
+	}
+	var subkey *types.EncryptionKey
+	if len(APRep.DecryptedEncPart.Subkey.KeyValue) > 0 {
+		subkey = &APRep.DecryptedEncPart.Subkey
+	}
+	m.secCtx.SetAcceptorSubkey(subkey, uint64(APRep.DecryptedEncPart.SequenceNumber))
+	return nil
+}
+
 // NewKRB5TokenAPREQ creates a new KRB5 token with AP_REQ
 func NewKRB5TokenAPREQ(cl *client.Client, tkt messages.Ticket, sessionKey types.EncryptionKey, GSSAPIFlags []int, APOptions []int) (KRB5Token, error) {
 	// TODO consider providing the SPN rather than the specific tkt and key and get these from the krb client.
@@ -172,6 +228,25 @@ func NewKRB5TokenAPREQ(cl *client.Client, tkt messages.Ticket, sessionKey types.
 	if err != nil {
 		return m, err
 	}
+	for _, f := range GSSAPIFlags {
+		if f == gssapi.ContextFlagDeleg {
+			cb, err := forwardedTGTCred(cl, sessionKey)
+			if err != nil {
+				return m, krberror.Errorf(err, krberror.KRBMsgError, "error getting credential to delegate")
+			}
+			auth.Cksum.Checksum = appendAuthenticatorChksumDeleg(auth.Cksum.Checksum, cb)
+			break
+		}
+	}
+	// RFC 4121 Section 2: the initiator's subkey protects the per-message tokens of the security context
+	et, err := crypto.GetEtype(sessionKey.KeyType)
+	if err != nil {
+		return m, krberror.Errorf(err, krberror.EncryptingError, "error getting encryption type of session key")
+	}
+	auth.SubKey, err = types.GenerateEncryptionKey(et)
+	if err != nil {
+		return m, krberror.Errorf(err, krberror.EncryptingError, "error generating authenticator subkey")
+	}
 	APReq, err := messages.NewAPReq(
 		tkt,
 		sessionKey,
@@ -183,10 +258,27 @@ func NewKRB5TokenAPREQ(cl *client.Client, tkt messages.Ticket, sessionKey types.
 	for _, o := range APOptions {
 		types.SetFlag(&APReq.APOptions, o)
 	}
+	APReq.Authenticator = auth
 	m.APReq = APReq
+	m.sessionKey = sessionKey
+	var flags int
+	for _, f := range GSSAPIFlags {
+		flags |= f
+	}
+	m.secCtx = gssapi.NewInitiatorSecurityContext(sessionKey, &auth.SubKey, uint64(auth.SeqNumber), flags)
 	return m, nil
 }
 
+// NewKRB5TokenAPREP creates a new KRB5 token with AP_REP
+func NewKRB5TokenAPREP(APRep messages.APRep) KRB5Token {
+	tb, _ := hex.DecodeString(TOK_ID_KRB_AP_REP)
+	return KRB5Token{
+		OID:   gssapi.OIDKRB5.OID(),
+		tokID: tb,
+		APRep: APRep,
+	}
+}
+
 // krb5TokenAuthenticator creates a new kerberos authenticator for kerberos MechToken
 func krb5TokenAuthenticator(creds *credentials.Credentials, flags []int) (types.Authenticator, error) {
 	//RFC 4121 Section 4.1.1
@@ -206,13 +298,102 @@ func newAuthenticatorChksum(flags []int) []byte {
 	a := make([]byte, 24)
 	binary.LittleEndian.PutUint32(a[:4], 16)
 	for _, i := range flags {
-		if i == gssapi.ContextFlagDeleg {
-			x := make([]byte, 28-len(a))
-			a = append(a, x...)
-		}
 		f := binary.LittleEndian.Uint32(a[20:24])
 		f |= uint32(i)
 		binary.LittleEndian.PutUint32(a[20:24], f)
 	}
 	return a
 }
+
+// appendAuthenticatorChksumDeleg appends the delegation option carrying the marshaled KRB_CRED to the authenticator
+// checksum of a KRB5 token.
+func appendAuthenticatorChksumDeleg(cksum, cred []byte) []byte {
+	//RFC 4121 Section 4.1.1: DlgOpt (1), Dlgth and Deleg
+	b := make([]byte, 4, 4+len(cred))
+	binary.LittleEndian.PutUint16(b[0:2], 1)
+	binary.LittleEndian.PutUint16(b[2:4], uint16(len(cred)))
+	return append(append(cksum, b...), cred...)
+}
+
+// forwardedTGTCred gets a forwarded TGT for the client and returns it within a marshaled KRB_CRED encrypted with the
+// session key of the service ticket.
+func forwardedTGTCred(cl *client.Client, sessionKey types.EncryptionKey) ([]byte, error) {
+	tkt, dep, err := cl.GetForwardedTGT()
+	if err != nil {
+		return nil, err
+	}
+	info := messages.NewKrbCredInfo(cl.Credentials.CName(), cl.Credentials.Domain(), dep)
+	cred, err := messages.NewKRBCred([]messages.Ticket{tkt}, []messages.KrbCredInfo{info}, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cred.Marshal()
+}
+
+// delegatedCredential extracts the KRB_CRED delegated by the initiator from the authenticator checksum of a verified
+// AP_REQ. The KRB_CRED is decrypted with the authenticator's subkey or the session key of the ticket.
+func delegatedCredential(APReq *messages.APReq) (*messages.KRBCred, error) {
+	cksum := APReq.Authenticator.Cksum.Checksum
+	if len(cksum) < 28 || binary.LittleEndian.Uint16(cksum[24:26]) != 1 {
+		return nil, errors.New("delegation flag set in authenticator checksum but no credential is present")
+	}
+	l := int(binary.LittleEndian.Uint16(cksum[26:28]))
+	if len(cksum) < 28+l {
+		return nil, errors.New("delegated credential length exceeds the authenticator checksum")
+	}
+	cred := new(messages.KRBCred)
+	err := cred.Unmarshal(cksum[28 : 28+l])
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling delegated credential: %v", err)
+	}
+	keys := []types.EncryptionKey{APReq.Ticket.DecryptedEncPart.Key}
+	if len(APReq.Authenticator.SubKey.KeyValue) > 0 {
+		keys = append([]types.EncryptionKey{APReq.Authenticator.SubKey}, keys...)
+	}
+	for _, k := range keys {
+		if err = cred.DecryptEncPart(k); err == nil {
+			return cred, nil
+		}
+	}
+	return nil, fmt.Errorf("error decrypting delegated credential: %v", err)
+}
+
+// DelegatedCredential returns the KRB_CRED delegated by the client from the context of a verified KRB5 token or
+// SPNEGO token, or of the request passed to the inner handler by SPNEGOKRB5Authenticate.
+// The boolean indicates if the client delegated a credential.
+func DelegatedCredential(ctx context.Context) (*messages.KRBCred, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	cred, ok := ctx.Value(ctxDelegatedCredential).(*messages.KRBCred)
+	return cred, ok
+}
+
+// DelegatedClient creates a client from the credential delegated by the client in the context, so that the service can
+// act onward as the authenticated user. See DelegatedCredential.
+func DelegatedClient(ctx context.Context, krb5conf *config.Config, settings ...func(*client.Settings)) (*client.Client, error) {
+	cred, ok := DelegatedCredential(ctx)
+	if !ok {
+		return nil, errors.New("no delegated credential in the context")
+	}
+	return client.NewFromKRBCred(cred, krb5conf, settings...)
+}
+
+// newAcceptorSecurityContext creates the acceptor's security context from a verified AP_REQ.
+func newAcceptorSecurityContext(APReq *messages.APReq) *gssapi.SecurityContext {
+	var subkey *types.EncryptionKey
+	if len(APReq.Authenticator.SubKey.KeyValue) > 0 {
+		subkey = &APReq.Authenticator.SubKey
+	}
+	return gssapi.NewAcceptorSecurityContext(APReq.Ticket.DecryptedEncPart.Key, subkey,
+		uint64(APReq.Authenticator.SeqNumber), authenticatorChksumFlags(APReq.Authenticator.Cksum))
+}
+
+// authenticatorChksumFlags returns the GSS-API context flags within the authenticator checksum of a KRB5 token.
+func authenticatorChksumFlags(cksum types.Checksum) int {
+	//RFC 4121 Section 4.1.1
+	if cksum.CksumType != chksumtype.GSSAPI || len(cksum.Checksum) < 24 {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(cksum.Checksum[20:24]))
+}
@@ -128,6 +128,7 @@ func TestNewAPREQKRB5Token_and_Marshal(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error creating KRB5Token: %v", err)
 	}
+	assert.Equal(t, int32(18), mt.APReq.Authenticator.SubKey.KeyType, "authenticator subkey not of the expected type")
 	mb, err := mt.Marshal()
 	if err != nil {
 		t.Fatalf("Error unmarshalling KRB5Token: %v", err)
@@ -143,4 +144,9 @@ func TestNewAPREQKRB5Token_and_Marshal(t *testing.T) {
 	assert.Equal(t, testdata.TEST_REALM, mt.APReq.Ticket.Realm, "Realm in ticket within the AP_REQ of the KRB5Token not as expected.")
 	assert.Equal(t, testdata.TEST_PRINCIPALNAME_NAMESTRING, mt.APReq.Ticket.SName.NameString, "SName in ticket within the AP_REQ of the KRB5Token not as expected.")
 	assert.Equal(t, int32(18), mt.APReq.EncryptedAuthenticator.EType, "Authenticator within AP_REQ does not have the etype expected.")
+	sc := mt.SecurityContext()
+	if assert.NotNil(t, sc, "security context not established") {
+		assert.True(t, sc.Initiator(), "security context should be the initiator's")
+		assert.Equal(t, gssapi.ContextFlagInteg|gssapi.ContextFlagConf, sc.Flags(), "security context flags not as expected")
+	}
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/jcmturner/gokrb5/v8/client"
 	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
 	"github.com/jcmturner/gokrb5/v8/messages"
 	"github.com/jcmturner/gokrb5/v8/service"
 	"github.com/jcmturner/gokrb5/v8/types"
@@ -153,6 +154,14 @@ func (n *NegTokenInit) Context() context.Context {
 	return nil
 }
 
+// SecurityContext returns the GSS-API security context established by the KRB5 mechanism token.
+func (n *NegTokenInit) SecurityContext() *gssapi.SecurityContext {
+	if mt, ok := n.mechToken.(*KRB5Token); ok {
+		return mt.SecurityContext()
+	}
+	return nil
+}
+
 // Marshal a Resp/Targ negotiation token
 func (n *NegTokenResp) Marshal() ([]byte, error) {
 	m := marshalNegTokenResp{
@@ -242,6 +251,14 @@ func (n *NegTokenResp) Context() context.Context {
 	return nil
 }
 
+// SecurityContext returns the GSS-API security context established by the KRB5 mechanism token.
+func (n *NegTokenResp) SecurityContext() *gssapi.SecurityContext {
+	if mt, ok := n.mechToken.(*KRB5Token); ok {
+		return mt.SecurityContext()
+	}
+	return nil
+}
+
 // UnmarshalNegToken umarshals and returns either a NegTokenInit or a NegTokenResp.
 //
 // The boolean indicates if the response is a NegTokenInit.
@@ -287,7 +304,16 @@ func UnmarshalNegToken(b []byte) (bool, interface{}, error) {
 
 // NewNegTokenInitKRB5 creates new Init negotiation token for Kerberos 5
 func NewNegTokenInitKRB5(cl *client.Client, tkt messages.Ticket, sessionKey types.EncryptionKey) (NegTokenInit, error) {
-	mt, err := NewKRB5TokenAPREQ(cl, tkt, sessionKey, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}, []int{})
+	return newNegTokenInitKRB5(cl, tkt, sessionKey, false)
+}
+
+// newNegTokenInitKRB5 creates new Init negotiation token for Kerberos 5, delegating the client's credentials if requested.
+func newNegTokenInitKRB5(cl *client.Client, tkt messages.Ticket, sessionKey types.EncryptionKey, delegate bool) (NegTokenInit, error) {
+	gssFlags := []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf, gssapi.ContextFlagReplay, gssapi.ContextFlagSequence, gssapi.ContextFlagMutual}
+	if delegate {
+		gssFlags = append(gssFlags, gssapi.ContextFlagDeleg)
+	}
+	mt, err := NewKRB5TokenAPREQ(cl, tkt, sessionKey, gssFlags, []int{flags.APOptionMutualRequired})
 	if err != nil {
 		return NegTokenInit{}, fmt.Errorf("error getting KRB5 token; %v", err)
 	}
@@ -298,5 +324,6 @@ func NewNegTokenInitKRB5(cl *client.Client, tkt messages.Ticket, sessionKey type
 	return NegTokenInit{
 		MechTypes:      []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()},
 		MechTokenBytes: mtb,
+		mechToken:      &mt,
 	}, nil
 }
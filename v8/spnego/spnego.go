@@ -19,18 +19,38 @@ type SPNEGO struct {
 	serviceSettings *service.Settings
 	client          *client.Client
 	spn             string
+	krb5Token       *KRB5Token
+	secCtx          *gssapi.SecurityContext
+	mechType        asn1.ObjectIdentifier
+	rawKRB5         bool
+	delegate        bool
 }
 
 // SPNEGOClient configures the SPNEGO mechanism suitable for client side use.
-func SPNEGOClient(cl *client.Client, spn string) *SPNEGO {
+func SPNEGOClient(cl *client.Client, spn string, options ...func(*SPNEGO)) *SPNEGO {
 	s := new(SPNEGO)
 	s.client = cl
 	s.spn = spn
 	s.serviceSettings = service.NewSettings(nil, service.SName(spn))
+	for _, o := range options {
+		o(s)
+	}
 	return s
 }
 
-// SPNEGOService configures the SPNEGO mechanism suitable for service side use.
+// Delegate configures the client side SPNEGO mechanism to delegate the client's credentials to the service
+// (GSS_C_DELEG_FLAG). A forwarded TGT is sent to the service within a KRB_CRED in the KRB5 token, so the client's TGT
+// must be forwardable.
+//
+// s := SPNEGOClient(cl, spn, Delegate(true))
+func Delegate(b bool) func(*SPNEGO) {
+	return func(s *SPNEGO) {
+		s.delegate = b
+	}
+}
+
+// SPNEGOService configures the SPNEGO mechanism suitable for service side use. Unless the service.ReplayCacheStore
+// setting is provided, the default replay cache shared by services with the same keytab principal is used.
 func SPNEGOService(kt *keytab.Keytab, options ...func(*service.Settings)) *SPNEGO {
 	s := new(SPNEGO)
 	s.serviceSettings = service.NewSettings(kt, options...)
@@ -53,10 +73,12 @@ func (s *SPNEGO) InitSecContext() (gssapi.ContextToken, error) {
 	if err != nil {
 		return &SPNEGOToken{}, err
 	}
-	negTokenInit, err := NewNegTokenInitKRB5(s.client, tkt, key)
+	negTokenInit, err := newNegTokenInitKRB5(s.client, tkt, key, s.delegate)
 	if err != nil {
 		return &SPNEGOToken{}, fmt.Errorf("could not create NegTokenInit: %v", err)
 	}
+	s.krb5Token, _ = negTokenInit.mechToken.(*KRB5Token)
+	s.secCtx = negTokenInit.SecurityContext()
 	return &SPNEGOToken{
 		Init:         true,
 		NegTokenInit: negTokenInit,
@@ -64,6 +86,56 @@ func (s *SPNEGO) InitSecContext() (gssapi.ContextToken, error) {
 	}, nil
 }
 
+// InitSecContextResponse is the GSS-API method for the client to process the context token returned by the service in
+// response to that generated by InitSecContext. The context token may be an SPNEGO token or a raw KRB5 token.
+// If the token holds an AP_REP it is verified to complete mutual authentication and the security context adopts the
+// subkey asserted by the service. If mutual authentication was requested the token must hold a valid AP_REP.
+func (s *SPNEGO) InitSecContextResponse(ct gssapi.ContextToken) (bool, gssapi.Status) {
+	if s.krb5Token == nil {
+		return false, gssapi.Status{Code: gssapi.StatusNoContext, Message: "InitSecContext has not been called"}
+	}
+	mutual := s.secCtx.Flags()&gssapi.ContextFlagMutual != 0
+	var mt *KRB5Token
+	switch t := ct.(type) {
+	case *SPNEGOToken:
+		if !t.Resp {
+			return false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "SPNEGO token returned by the service is not a NegTokenResp"}
+		}
+		if t.NegTokenResp.State() == NegStateReject {
+			return false, gssapi.Status{Code: gssapi.StatusUnauthorized, Message: "service rejected the SPNEGO negotiation"}
+		}
+		if len(t.NegTokenResp.ResponseToken) < 1 {
+			if mutual {
+				return false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "service did not return an AP_REP for mutual authentication"}
+			}
+			if t.NegTokenResp.State() == NegStateAcceptCompleted {
+				return true, gssapi.Status{Code: gssapi.StatusComplete}
+			}
+			return false, gssapi.Status{Code: gssapi.StatusContinueNeeded}
+		}
+		mt = new(KRB5Token)
+		err := mt.Unmarshal(t.NegTokenResp.ResponseToken)
+		if err != nil {
+			return false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: err.Error()}
+		}
+	case *KRB5Token:
+		mt = t
+	default:
+		return false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "context token provided was not an SPNEGO or KRB5 token"}
+	}
+	if mt.IsKRBError() {
+		return false, gssapi.Status{Code: gssapi.StatusFailure, Message: mt.KRBError.Error()}
+	}
+	if !mt.IsAPRep() {
+		return false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "KRB5 token returned by the service does not hold an AP_REP"}
+	}
+	err := s.krb5Token.VerifyAPRep(&mt.APRep)
+	if err != nil {
+		return false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: err.Error()}
+	}
+	return true, gssapi.Status{Code: gssapi.StatusComplete}
+}
+
 // AcceptSecContext is the GSS-API method for the service to verify the context token provided by the client and
 // establish a context.
 func (s *SPNEGO) AcceptSecContext(ct gssapi.ContextToken) (bool, context.Context, gssapi.Status) {
@@ -86,9 +158,87 @@ func (s *SPNEGO) AcceptSecContext(ct gssapi.ContextToken) (bool, context.Context
 	// Flags in the NegInit must be used 	t.NegTokenInit.ReqFlags
 	ok, status := t.Verify()
 	ctx = t.Context()
+	if ok {
+		s.secCtx = t.SecurityContext()
+		s.krb5Token = t.krb5Token()
+		s.mechType = oid
+		s.rawKRB5 = t.rawKRB5
+	}
 	return ok, ctx, status
 }
 
+// AcceptSecContextResponse returns the context token for the service to return to the client once AcceptSecContext
+// has established a context.
+// This is a NegTokenResp with the accept-completed state. If the client requested mutual authentication the KRB5
+// token holding the AP_REP is its response token. If the client sent a raw KRB5 token rather than an SPNEGO token
+// the KRB5 token holding the AP_REP is returned, or nil if mutual authentication was not requested.
+func (s *SPNEGO) AcceptSecContextResponse() (gssapi.ContextToken, error) {
+	if s.krb5Token == nil || !s.krb5Token.IsAPReq() || s.secCtx == nil {
+		return nil, gssapi.Status{Code: gssapi.StatusNoContext, Message: "AcceptSecContext has not established a context"}
+	}
+	rt := s.krb5Token.ResponseToken()
+	if s.rawKRB5 {
+		if rt == nil {
+			return nil, nil
+		}
+		return rt, nil
+	}
+	nt := NegTokenResp{
+		NegState:      asn1.Enumerated(NegStateAcceptCompleted),
+		SupportedMech: s.mechType,
+	}
+	if rt != nil {
+		b, err := rt.Marshal()
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal KRB5 response token: %v", err)
+		}
+		nt.ResponseToken = b
+	}
+	return &SPNEGOToken{
+		Resp:         true,
+		NegTokenResp: nt,
+		settings:     s.serviceSettings,
+	}, nil
+}
+
+// SecurityContext returns the GSS-API security context established by InitSecContext or AcceptSecContext.
+// It is nil until a context has been established.
+func (s *SPNEGO) SecurityContext() *gssapi.SecurityContext {
+	return s.secCtx
+}
+
+// GetMIC is the GSS-API method to generate a MIC token for the message using the established security context.
+func (s *SPNEGO) GetMIC(msg []byte) ([]byte, error) {
+	if s.secCtx == nil {
+		return nil, gssapi.Status{Code: gssapi.StatusNoContext}
+	}
+	return s.secCtx.GetMIC(msg)
+}
+
+// VerifyMIC is the GSS-API method to verify a MIC token for the message using the established security context.
+func (s *SPNEGO) VerifyMIC(msg, token []byte) (bool, error) {
+	if s.secCtx == nil {
+		return false, gssapi.Status{Code: gssapi.StatusNoContext}
+	}
+	return s.secCtx.VerifyMIC(msg, token)
+}
+
+// Wrap is the GSS-API method to generate a wrap token for the message using the established security context.
+func (s *SPNEGO) Wrap(msg []byte, confReq bool) ([]byte, error) {
+	if s.secCtx == nil {
+		return nil, gssapi.Status{Code: gssapi.StatusNoContext}
+	}
+	return s.secCtx.Wrap(msg, confReq)
+}
+
+// Unwrap is the GSS-API method to get the message from a wrap token using the established security context.
+func (s *SPNEGO) Unwrap(token []byte) ([]byte, bool, error) {
+	if s.secCtx == nil {
+		return nil, false, gssapi.Status{Code: gssapi.StatusNoContext}
+	}
+	return s.secCtx.Unwrap(token)
+}
+
 // Log will write to the service's logger if it is configured.
 func (s *SPNEGO) Log(format string, v ...interface{}) {
 	if s.serviceSettings.Logger() != nil {
@@ -104,6 +254,7 @@ type SPNEGOToken struct {
 	NegTokenResp NegTokenResp
 	settings     *service.Settings
 	context      context.Context
+	rawKRB5      bool // the token was received as a raw KRB5 token and wrapped into an SPNEGO token
 }
 
 // Marshal SPNEGO context token
@@ -201,3 +352,24 @@ func (s *SPNEGOToken) Verify() (bool, gssapi.Status) {
 func (s *SPNEGOToken) Context() context.Context {
 	return s.context
 }
+
+// krb5Token returns the KRB5 mechanism token within the SPNEGO token once it has been verified.
+func (s *SPNEGOToken) krb5Token() *KRB5Token {
+	var mt gssapi.ContextToken
+	if s.Init {
+		mt = s.NegTokenInit.mechToken
+	} else {
+		mt = s.NegTokenResp.mechToken
+	}
+	k, _ := mt.(*KRB5Token)
+	return k
+}
+
+// SecurityContext returns the GSS-API security context established by the SPNEGO token.
+// On the acceptor's side this is available once the token is verified.
+func (s *SPNEGOToken) SecurityContext() *gssapi.SecurityContext {
+	if s.Init {
+		return s.NegTokenInit.SecurityContext()
+	}
+	return s.NegTokenResp.SecurityContext()
+}
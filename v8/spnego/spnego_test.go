@@ -3,8 +3,25 @@ package spnego
 import (
 	"encoding/hex"
 	"testing"
+	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -104,3 +121,264 @@ func TestMarshal_SPNEGO_RespTarg(t *testing.T) {
 	}
 	assert.Equal(t, b, mb, "Marshaled bytes not as expected")
 }
+
+func TestSPNEGO_InitSecContextResponse(t *testing.T) {
+	t.Parallel()
+	creds := credentials.New("testuser1", testdata.TEST_REALM)
+	creds.SetCName(types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"testuser1"}})
+	cl := client.Client{
+		Credentials: creds,
+	}
+	var tkt messages.Ticket
+	b, err := hex.DecodeString(testdata.MarshaledKRB5ticket)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	err = tkt.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	et, _ := crypto.GetEtype(18)
+	key, _ := types.GenerateEncryptionKey(et)
+	mt, err := NewKRB5TokenAPREQ(&cl, tkt, key, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagMutual}, []int{flags.APOptionMutualRequired})
+	if err != nil {
+		t.Fatalf("Error creating KRB5Token: %v", err)
+	}
+	s := &SPNEGO{krb5Token: &mt, secCtx: mt.SecurityContext()}
+
+	// A bare accept-completed response does not complete mutual authentication
+	b, _ = hex.DecodeString(testGSSAPIResp)
+	var st SPNEGOToken
+	err = st.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling SPNEGO with NegTokenResp: %v", err)
+	}
+	ok, status := s.InitSecContextResponse(&st)
+	assert.False(t, ok, "mutual authentication should fail without an AP_REP")
+	assert.Equal(t, gssapi.StatusDefectiveToken, status.Code)
+
+	auth := mt.APReq.Authenticator
+	subkey, _ := types.GenerateEncryptionKey(et)
+	encPart := messages.EncAPRepPart{
+		CTime:          auth.CTime.Truncate(time.Second),
+		Cusec:          auth.Cusec,
+		Subkey:         subkey,
+		SequenceNumber: 1000,
+	}
+	eb, _ := asn1.Marshal(encPart)
+	eb = asn1tools.AddASNAppTag(eb, asnAppTag.EncAPRepPart)
+	ed, err := crypto.GetEncryptedData(eb, key, keyusage.AP_REP_ENCPART, 1)
+	if err != nil {
+		t.Fatalf("error encrypting EncAPRepPart: %v", err)
+	}
+	rep := &KRB5Token{
+		OID:   gssapi.OIDKRB5.OID(),
+		tokID: []byte{2, 0},
+		APRep: messages.APRep{PVNO: iana.PVNO, MsgType: msgtype.KRB_AP_REP, EncPart: ed},
+	}
+	ok, status = s.InitSecContextResponse(rep)
+	assert.True(t, ok, "mutual authentication should succeed: %v", status)
+	assert.Equal(t, gssapi.StatusComplete, status.Code)
+
+	// The security context now uses the acceptor's subkey and sequence number
+	acc := gssapi.NewAcceptorSecurityContext(key, &auth.SubKey, uint64(auth.SeqNumber), gssapi.ContextFlagInteg)
+	acc.SetAcceptorSubkey(&subkey, 1000)
+	wb, err := acc.Wrap([]byte("hello"), true)
+	if err != nil {
+		t.Fatalf("error wrapping: %v", err)
+	}
+	m, _, err := s.Unwrap(wb)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), m, "message not as expected")
+
+	rep.APRep.EncPart.Cipher[0] ^= 0xff
+	ok, _ = s.InitSecContextResponse(rep)
+	assert.False(t, ok, "mutual authentication should fail with a modified AP_REP")
+}
+
+// testInitiator returns an initiator's SPNEGO mechanism and the marshaled NegTokenInit it has generated for a ticket
+// to the HTTP/host.test.gokrb5 service issued without a KDC.
+func testInitiator(t *testing.T, kt *keytab.Keytab) (*SPNEGO, []byte) {
+	creds := credentials.New("testuser1", "TEST.GOKRB5")
+	cl := client.Client{
+		Credentials: creds,
+	}
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(creds.CName(), creds.Domain(),
+		types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5"), "TEST.GOKRB5",
+		types.NewKrbFlags(), kt, 18, 1, st, st, st.Add(time.Hour), st.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	nti, err := NewNegTokenInitKRB5(&cl, tkt, sessionKey)
+	if err != nil {
+		t.Fatalf("Error creating NegTokenInit: %v", err)
+	}
+	ini := &SPNEGO{krb5Token: nti.mechToken.(*KRB5Token), secCtx: nti.SecurityContext()}
+	b, err := (&SPNEGOToken{Init: true, NegTokenInit: nti}).Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling SPNEGO token: %v", err)
+	}
+	return ini, b
+}
+
+func TestSPNEGO_MutualAuthentication(t *testing.T) {
+	t.Parallel()
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	ini, b := testInitiator(t, kt)
+
+	// Acceptor
+	acc := SPNEGOService(kt)
+	var at SPNEGOToken
+	err := at.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling SPNEGO token: %v", err)
+	}
+	ok, _, status := acc.AcceptSecContext(&at)
+	if !ok {
+		t.Fatalf("SPNEGO token not accepted: %v", status)
+	}
+	rt, err := acc.AcceptSecContextResponse()
+	if err != nil {
+		t.Fatalf("Error getting response token: %v", err)
+	}
+	b, err = rt.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling response token: %v", err)
+	}
+
+	// Initiator completes mutual authentication
+	var rst SPNEGOToken
+	err = rst.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling response token: %v", err)
+	}
+	assert.Equal(t, NegStateAcceptCompleted, rst.NegTokenResp.State(), "negotiation state not as expected")
+	ok, status = ini.InitSecContextResponse(&rst)
+	if !ok {
+		t.Fatalf("mutual authentication failed: %v", status)
+	}
+
+	for _, m := range [][]byte{[]byte("first"), []byte("second")} {
+		wb, err := ini.Wrap(m, true)
+		if err != nil {
+			t.Fatalf("error wrapping: %v", err)
+		}
+		um, sealed, err := acc.Unwrap(wb)
+		assert.NoError(t, err)
+		assert.True(t, sealed, "message should be sealed")
+		assert.Equal(t, m, um, "message not as expected")
+		mic, err := acc.GetMIC(m)
+		if err != nil {
+			t.Fatalf("error getting MIC: %v", err)
+		}
+		ok, err = ini.VerifyMIC(m, mic)
+		assert.NoError(t, err)
+		assert.True(t, ok, "MIC not valid")
+	}
+}
+
+func TestSPNEGO_DelegatedCredential(t *testing.T) {
+	t.Parallel()
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	creds := credentials.New("testuser1", "TEST.GOKRB5")
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(creds.CName(), creds.Domain(),
+		types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5"), "TEST.GOKRB5",
+		types.NewKrbFlags(), kt, 18, 1, st, st, st.Add(time.Hour), st.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+
+	// Forwarded TGT delegated by the initiator. The ticket is opaque to the service.
+	tgtName := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5")
+	tgt := messages.Ticket{
+		TktVNO:  iana.PVNO,
+		Realm:   "TEST.GOKRB5",
+		SName:   tgtName,
+		EncPart: types.EncryptedData{EType: 18, KVNO: 1, Cipher: []byte("forwarded TGT")},
+	}
+	et, _ := crypto.GetEtype(18)
+	tgtKey, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		t.Fatalf("Error generating TGT session key: %v", err)
+	}
+	tgtFlags := types.NewKrbFlags()
+	types.SetFlag(&tgtFlags, flags.Forwardable)
+	types.SetFlag(&tgtFlags, flags.Forwarded)
+	info := messages.NewKrbCredInfo(creds.CName(), creds.Domain(), messages.EncKDCRepPart{
+		Key:       tgtKey,
+		Flags:     tgtFlags,
+		AuthTime:  st,
+		StartTime: st,
+		EndTime:   st.Add(time.Hour),
+		RenewTill: st.Add(time.Hour),
+		SRealm:    "TEST.GOKRB5",
+		SName:     tgtName,
+	})
+	cred, err := messages.NewKRBCred([]messages.Ticket{tgt}, []messages.KrbCredInfo{info}, sessionKey)
+	if err != nil {
+		t.Fatalf("Error creating KRB_CRED: %v", err)
+	}
+	cb, err := cred.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling KRB_CRED: %v", err)
+	}
+	auth, err := krb5TokenAuthenticator(creds, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf, gssapi.ContextFlagDeleg})
+	if err != nil {
+		t.Fatalf("Error creating authenticator: %v", err)
+	}
+	auth.Cksum.Checksum = appendAuthenticatorChksumDeleg(auth.Cksum.Checksum, cb)
+	APReq, err := messages.NewAPReq(tkt, sessionKey, auth)
+	if err != nil {
+		t.Fatalf("Error creating AP_REQ: %v", err)
+	}
+	tb, _ := hex.DecodeString(TOK_ID_KRB_AP_REQ)
+	mt := KRB5Token{OID: gssapi.OIDKRB5.OID(), tokID: tb, APReq: APReq}
+	mtb, err := mt.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling KRB5 token: %v", err)
+	}
+	st2 := SPNEGOToken{
+		Init: true,
+		NegTokenInit: NegTokenInit{
+			MechTypes:      []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()},
+			MechTokenBytes: mtb,
+		},
+	}
+	b, err = st2.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling SPNEGO token: %v", err)
+	}
+
+	acc := SPNEGOService(kt)
+	var at SPNEGOToken
+	err = at.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling SPNEGO token: %v", err)
+	}
+	ok, ctx, status := acc.AcceptSecContext(&at)
+	if !ok {
+		t.Fatalf("SPNEGO token not accepted: %v", status)
+	}
+	dc, ok := DelegatedCredential(ctx)
+	if !assert.True(t, ok, "delegated credential not in the context") {
+		t.FailNow()
+	}
+	if !assert.Len(t, dc.DecryptedEncPart.TicketInfo, 1, "number of ticket info not as expected") {
+		t.FailNow()
+	}
+	assert.Equal(t, tgtKey, dc.DecryptedEncPart.TicketInfo[0].Key, "TGT session key not as expected")
+	assert.Equal(t, creds.CName(), dc.DecryptedEncPart.TicketInfo[0].PName, "client name not as expected")
+
+	cl, err := DelegatedClient(ctx, config.New())
+	if err != nil {
+		t.Fatalf("Error creating client from delegated credential: %v", err)
+	}
+	assert.Equal(t, "testuser1", cl.Credentials.UserName(), "delegated client user not as expected")
+	assert.Equal(t, "TEST.GOKRB5", cl.Credentials.Domain(), "delegated client realm not as expected")
+}
@@ -0,0 +1,358 @@
+package kdc
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4556"
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// asExchange processes an AS_REQ and returns the marshaled AS_REP.
+func (k *KDC) asExchange(req messages.ASReq) ([]byte, error) {
+	if !k.settings.FAST() || !req.PAData.Contains(patype.PA_FX_FAST) {
+		return k.asReply(req, req.ReqBody, req.PAData, nil)
+	}
+	fast, err := k.asArmor(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := k.asReply(req, fast.req.ReqBody, fast.req.PAData, fast)
+	if kerr, ok := err.(messages.KRBError); ok {
+		return nil, k.fastError(kerr, fast)
+	}
+	return b, err
+}
+
+// asReply returns the marshaled AS_REP to the AS_REQ for the request body and pre-authentication data provided, which
+// are those within the FAST request if the AS_REQ is armored.
+func (k *KDC) asReply(req messages.ASReq, body messages.KDCReqBody, padata types.PADataSequence, fast *fastArmor) ([]byte, error) {
+	if body.Realm != k.realm {
+		return nil, k.krbError(errorcode.KDC_ERR_WRONG_REALM, "realm %s is not served by this KDC", body.Realm)
+	}
+	anonymous := types.IsFlagSet(&body.KDCOptions, flags.RequestAnonymous)
+	if anonymous {
+		if !body.CName.IsAnonymous() {
+			return nil, k.krbError(errorcode.KDC_ERR_BADOPTION, "request-anonymous option set for a client that is not anonymous")
+		}
+		if !k.settings.Anonymous() {
+			return nil, k.krbError(errorcode.KDC_ERR_POLICY, "anonymous tickets are not issued by this KDC")
+		}
+	} else if !k.hasPrincipal(body.CName, k.realm) {
+		return nil, k.krbError(errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN, "client %s not found in realm %s", body.CName.PrincipalNameString(), k.realm)
+	}
+	if !k.hasPrincipal(body.SName, k.realm) {
+		return nil, k.krbError(errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, "service %s not found in realm %s", body.SName.PrincipalNameString(), k.realm)
+	}
+	sessionEType, ok := k.sessionEType(body.EType)
+	if !ok {
+		return nil, k.krbError(errorcode.KDC_ERR_ETYPE_NOSUPP, "none of the requested encryption types %v are supported", body.EType)
+	}
+
+	var replyKey types.EncryptionKey
+	var kvno int
+	var pas types.PADataSequence
+	var preAuthent bool
+	switch {
+	case padata.Contains(patype.PA_PK_AS_REQ) && k.settings.PKINIT():
+		var err error
+		var pa types.PAData
+		replyKey, pa, err = k.pkinitPreAuth(body, padata, sessionEType, anonymous)
+		if err != nil {
+			return nil, err
+		}
+		pas = append(pas, pa)
+		preAuthent = true
+	case anonymous:
+		return nil, k.preAuthRequired(body, "anonymous tickets require PKINIT")
+	default:
+		var err error
+		replyKey, kvno, err = k.principalKey(body.CName, k.realm, body.EType)
+		if err != nil {
+			return nil, k.krbError(errorcode.KDC_ERR_ETYPE_NOSUPP, "client has no key of the requested encryption types: %v", err)
+		}
+		switch {
+		case fast != nil && padata.Contains(patype.PA_ENCRYPTED_CHALLENGE):
+			// The reply key of encrypted challenge pre-authentication is the armor key
+			clientKey, err := k.verifyEncryptedChallenge(body, padata, fast)
+			if err != nil {
+				return nil, err
+			}
+			pa, err := kdcEncryptedChallenge(fast.key, clientKey)
+			if err != nil {
+				return nil, err
+			}
+			pas = append(pas, pa)
+			replyKey, kvno = fast.key, 0
+			preAuthent = true
+		case padata.Contains(patype.PA_ENC_TIMESTAMP):
+			replyKey, kvno, err = k.verifyEncTimestamp(body, padata)
+			if err != nil {
+				return nil, err
+			}
+			preAuthent = true
+		case k.settings.RequirePreAuth():
+			return nil, k.preAuthRequired(body, "pre-authentication required")
+		}
+		pa, err := eTypeInfo2PAData(replyKey.KeyType, body.CName, k.realm)
+		if err != nil {
+			return nil, err
+		}
+		pas = append(pas, pa)
+	}
+
+	cname, crealm := body.CName, k.realm
+	if anonymous {
+		crealm = types.AnonymousRealm
+	}
+	f := types.NewKrbFlags()
+	types.SetFlag(&f, flags.Initial)
+	if preAuthent {
+		types.SetFlag(&f, flags.PreAuthent)
+	}
+	if anonymous {
+		types.SetFlag(&f, flags.Anonymous)
+	}
+	for _, o := range []int{flags.Forwardable, flags.Proxiable} {
+		if types.IsFlagSet(&body.KDCOptions, o) {
+			types.SetFlag(&f, o)
+		}
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	endTime, renewTill := k.ticketTimes(body, now, now.Add(k.settings.MaxTicketLifetime()), now.Add(k.settings.MaxRenewLifetime()))
+	if !renewTill.IsZero() {
+		types.SetFlag(&f, flags.Renewable)
+	}
+	tkt, sessionKey, err := k.newTicket(messages.EncTicketPart{
+		Flags:     f,
+		CRealm:    crealm,
+		CName:     cname,
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   endTime,
+		RenewTill: renewTill,
+		CAddr:     body.Addresses,
+	}, body.SName, k.realm, sessionEType)
+	if err != nil {
+		return nil, err
+	}
+	var strengthenKey types.EncryptionKey
+	if fast != nil {
+		strengthenKey, replyKey, err = strengthenReplyKey(replyKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if anonymous {
+		pa, err := messages.NewPAPKINITKX(replyKey, sessionKey)
+		if err != nil {
+			return nil, err
+		}
+		pas = append(pas, pa)
+	}
+	// The enc-pa-rep flag is only set in the reply so the ticket's flags are not changed
+	repFlags := asn1.BitString{Bytes: append([]byte{}, f.Bytes...), BitLength: f.BitLength}
+	var encPAs types.PADataSequence
+	if k.settings.FAST() && req.PAData.Contains(patype.PA_REQ_ENC_PA_REP) {
+		types.SetFlag(&repFlags, flags.EncPARep)
+		encPAs, err = encPAData(req, replyKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	encPart, err := encKDCRepPart(messages.EncKDCRepPart{
+		Key:       sessionKey,
+		LastReqs:  []messages.LastReq{},
+		Nonce:     body.Nonce,
+		Flags:     repFlags,
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   endTime,
+		RenewTill: renewTill,
+		SRealm:    k.realm,
+		SName:     body.SName,
+		CAddr:     body.Addresses,
+		EncPAData: encPAs,
+	}, asnAppTag.EncASRepPart, replyKey, keyusage.AS_REP_ENCPART, kvno)
+	if err != nil {
+		return nil, err
+	}
+	if fast != nil {
+		// The PAData of an armored reply is within the FAST response
+		pa, err := k.fastReply(fast, pas, strengthenKey, tkt, crealm, cname)
+		if err != nil {
+			return nil, err
+		}
+		pas = types.PADataSequence{pa}
+	}
+	rep := messages.ASRep{
+		KDCRepFields: messages.KDCRepFields{
+			PVNO:    iana.PVNO,
+			MsgType: msgtype.KRB_AS_REP,
+			PAData:  pas,
+			CRealm:  crealm,
+			CName:   cname,
+			Ticket:  tkt,
+			EncPart: encPart,
+		},
+	}
+	k.log("AS exchange: issued %s@%s a ticket for %s", cname.PrincipalNameString(), crealm, body.SName.PrincipalNameString())
+	return rep.Marshal()
+}
+
+// verifyEncTimestamp checks the PA-ENC-TIMESTAMP of the AS_REQ is encrypted with the client's key and within the
+// allowed clock skew. The client's key is returned.
+func (k *KDC) verifyEncTimestamp(body messages.KDCReqBody, padata types.PADataSequence) (types.EncryptionKey, int, error) {
+	var ed types.EncryptedData
+	for _, pa := range padata {
+		if pa.PADataType == patype.PA_ENC_TIMESTAMP {
+			err := ed.Unmarshal(pa.PADataValue)
+			if err != nil {
+				return types.EncryptionKey{}, 0, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "could not unmarshal PA-ENC-TIMESTAMP: %v", err)
+			}
+			break
+		}
+	}
+	key, kvno, err := k.principalKey(body.CName, k.realm, []int32{ed.EType})
+	if err != nil {
+		return key, kvno, k.krbError(errorcode.KDC_ERR_ETYPE_NOSUPP, "client has no key of the PA-ENC-TIMESTAMP encryption type: %v", err)
+	}
+	b, err := crypto.DecryptEncPart(ed, key, keyusage.AS_REQ_PA_ENC_TIMESTAMP)
+	if err != nil {
+		return key, kvno, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "could not decrypt PA-ENC-TIMESTAMP")
+	}
+	var ts types.PAEncTSEnc
+	err = ts.Unmarshal(b)
+	if err != nil {
+		return key, kvno, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "could not unmarshal PA-ENC-TS-ENC: %v", err)
+	}
+	if !k.withinSkew(ts.PATimestamp) {
+		return key, kvno, k.krbError(errorcode.KRB_AP_ERR_SKEW, "pre-authentication timestamp is outside the allowed clock skew")
+	}
+	return key, kvno, nil
+}
+
+// preAuthRequired returns a KDC_ERR_PREAUTH_REQUIRED error with the pre-authentication methods supported.
+func (k *KDC) preAuthRequired(body messages.KDCReqBody, etext string) error {
+	kerr := k.krbError(errorcode.KDC_ERR_PREAUTH_REQUIRED, etext)
+	var pas types.PADataSequence
+	if !body.CName.IsAnonymous() {
+		pas = append(pas, types.PAData{PADataType: patype.PA_ENC_TIMESTAMP})
+		key, _, err := k.principalKey(body.CName, k.realm, body.EType)
+		if err == nil {
+			pa, err := eTypeInfo2PAData(key.KeyType, body.CName, k.realm)
+			if err != nil {
+				return err
+			}
+			pas = append(pas, pa)
+		}
+	}
+	if k.settings.PKINIT() {
+		pas = append(pas, types.PAData{PADataType: patype.PA_PK_AS_REQ})
+	}
+	if k.settings.FAST() {
+		pas = append(pas, types.PAData{PADataType: patype.PA_FX_FAST})
+	}
+	b, err := asn1.Marshal(pas)
+	if err != nil {
+		return err
+	}
+	kerr.EData = b
+	return kerr
+}
+
+// pkinitPreAuth verifies the PA-PK-AS-REQ of the AS_REQ body and returns the reply key agreed with the client and the
+// PA-PK-AS-REP for the reply. The AuthPack of an anonymous request is not signed, otherwise it must be signed with a
+// certificate trusted for the client.
+func (k *KDC) pkinitPreAuth(body messages.KDCReqBody, padata types.PADataSequence, etypeID int32, anonymous bool) (types.EncryptionKey, types.PAData, error) {
+	var pkReq messages.PAPKASReq
+	for _, pa := range padata {
+		if pa.PADataType == patype.PA_PK_AS_REQ {
+			err := pkReq.Unmarshal(pa.PADataValue)
+			if err != nil {
+				return types.EncryptionKey{}, types.PAData{}, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "could not unmarshal PA-PK-AS-REQ: %v", err)
+			}
+			break
+		}
+	}
+	authPack, sd, err := pkReq.AuthPack()
+	if err != nil {
+		return types.EncryptionKey{}, types.PAData{}, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "%v", err)
+	}
+	if !anonymous {
+		cert, err := sd.Verify(x509.VerifyOptions{Roots: k.settings.pkinitClientRoots})
+		if err != nil {
+			return types.EncryptionKey{}, types.PAData{}, k.krbError(errorcode.KDC_ERROR_CLIENT_NOT_TRUSTED, "%v", err)
+		}
+		if !k.certificateMatches(cert, body.CName) {
+			return types.EncryptionKey{}, types.PAData{}, k.krbError(errorcode.KDC_ERR_CLIENT_NAME_MISMATCH, "certificate is not for client %s", body.CName.PrincipalNameString())
+		}
+	}
+	bb, err := body.Marshal()
+	if err != nil {
+		return types.EncryptionKey{}, types.PAData{}, err
+	}
+	sum := sha1.Sum(bb)
+	if !bytes.Equal(sum[:], authPack.PKAuthenticator.PAChecksum) {
+		return types.EncryptionKey{}, types.PAData{}, k.krbError(errorcode.KRB_AP_ERR_MODIFIED, "PKINIT checksum of the request body is not valid")
+	}
+	if authPack.PKAuthenticator.Nonce != body.Nonce {
+		return types.EncryptionKey{}, types.PAData{}, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "PKINIT nonce does not match the request")
+	}
+	if !k.withinSkew(authPack.PKAuthenticator.CTime) {
+		return types.EncryptionKey{}, types.PAData{}, k.krbError(errorcode.KRB_AP_ERR_SKEW, "PKINIT authenticator time is outside the allowed clock skew")
+	}
+	ka, peer, err := rfc4556.NewKeyAgreementFromPublicKeyInfo(authPack.ClientPublicValue)
+	if err != nil {
+		return types.EncryptionKey{}, types.PAData{}, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "%v", err)
+	}
+	secret, err := ka.SharedSecret(peer)
+	if err != nil {
+		return types.EncryptionKey{}, types.PAData{}, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "%v", err)
+	}
+	pa, err := messages.NewPAPKASRep(ka, authPack.PKAuthenticator.Nonce, k.settings.pkinitCerts, k.settings.pkinitSigner)
+	if err != nil {
+		return types.EncryptionKey{}, types.PAData{}, err
+	}
+	et, err := crypto.GetEtype(etypeID)
+	if err != nil {
+		return types.EncryptionKey{}, types.PAData{}, err
+	}
+	return rfc4556.OctetString2Key(et, secret, nil, nil), pa, nil
+}
+
+// certificateMatches indicates if the client certificate is for the client principal, either with an id-pkinit-san
+// of the principal or a common name that is the principal's name.
+func (k *KDC) certificateMatches(cert *x509.Certificate, cname types.PrincipalName) bool {
+	names, err := rfc4556.PrincipalNames(cert)
+	if err == nil && len(names) > 0 {
+		for _, n := range names {
+			if n.Realm == k.realm && n.PrincipalName.Equal(cname) {
+				return true
+			}
+		}
+		return false
+	}
+	return cert.Subject.CommonName == cname.PrincipalNameString()
+}
+
+// eTypeInfo2PAData returns the PA-ETYPE-INFO2 for the client's key of the encryption type.
+func eTypeInfo2PAData(etypeID int32, cname types.PrincipalName, realm string) (types.PAData, error) {
+	b, err := asn1.Marshal(types.ETypeInfo2{{EType: etypeID, Salt: cname.GetSalt(realm)}})
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return types.PAData{PADataType: patype.PA_ETYPE_INFO2, PADataValue: b}, nil
+}
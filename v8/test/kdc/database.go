@@ -0,0 +1,161 @@
+package kdc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// AddPrincipal adds a principal, such as "testuser1" or "HTTP/host.test.gokrb5", to the KDC's realm with keys derived
+// from the password for each of the KDC's encryption types. If the principal already exists its password is changed
+// and its key version number incremented.
+func (k *KDC) AddPrincipal(name, password string) error {
+	pn, _ := types.ParseSPNString(name)
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	return k.setPassword(pn, k.realm, password)
+}
+
+// AddKeytab adds the keys of the principals in the keytab to the KDC's database.
+func (k *KDC) AddKeytab(kt *keytab.Keytab) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	k.db.Entries = append(k.db.Entries, kt.Entries...)
+}
+
+// Keytab returns a keytab holding the current keys of the principals of the KDC's realm named, for use by the
+// principals' clients or services.
+func (k *KDC) Keytab(names ...string) (*keytab.Keytab, error) {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	kt := keytab.New()
+	for _, name := range names {
+		pn, _ := types.ParseSPNString(name)
+		kvno := k.kvno(pn, k.realm)
+		if kvno == 0 {
+			return nil, fmt.Errorf("principal %s not found in realm %s", name, k.realm)
+		}
+		for _, e := range k.db.Entries {
+			if e.KVNO == uint32(kvno) && entryMatches(e.Principal.Realm, e.Principal.Components, pn, k.realm) {
+				kt.Entries = append(kt.Entries, e)
+			}
+		}
+	}
+	return kt, nil
+}
+
+// Trust establishes a two-way cross-realm trust between the KDC and the other KDC provided by adding shared cross-realm
+// krbtgt keys to both. Each KDC refers clients requesting a service of a host within the other's realm to it.
+func (k *KDC) Trust(other *KDC) error {
+	if other.realm == k.realm {
+		return fmt.Errorf("cannot establish a trust between KDCs of the same realm %s", k.realm)
+	}
+	for _, r := range [][2]*KDC{{k, other}, {other, k}} {
+		pn := types.NewPrincipalName(krbtgtNameType, "krbtgt/"+r[1].realm)
+		password, err := randomPassword()
+		if err != nil {
+			return err
+		}
+		for _, d := range r {
+			d.mux.Lock()
+			err = d.setPassword(pn, r[0].realm, password)
+			d.mux.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	k.mux.Lock()
+	k.trusts[other.realm] = other
+	k.mux.Unlock()
+	other.mux.Lock()
+	other.trusts[k.realm] = k
+	other.mux.Unlock()
+	return nil
+}
+
+// setPassword replaces any keys of the principal with those derived from the password with the next key version
+// number. The caller must hold the write lock.
+func (k *KDC) setPassword(pn types.PrincipalName, realm, password string) error {
+	kvno := k.kvno(pn, realm) + 1
+	entries := k.db.Entries[:0]
+	for _, e := range k.db.Entries {
+		if !entryMatches(e.Principal.Realm, e.Principal.Components, pn, realm) {
+			entries = append(entries, e)
+		}
+	}
+	k.db.Entries = entries
+	ts := time.Now().UTC()
+	for _, et := range k.settings.EncTypes() {
+		err := k.db.AddEntry(pn.PrincipalNameString(), realm, password, ts, uint8(kvno), et)
+		if err != nil {
+			return fmt.Errorf("error generating key for %s@%s: %v", pn.PrincipalNameString(), realm, err)
+		}
+	}
+	return nil
+}
+
+// kvno returns the latest key version number of the principal, or zero if the principal is not in the database.
+// The caller must hold the lock.
+func (k *KDC) kvno(pn types.PrincipalName, realm string) int {
+	var kvno int
+	for _, e := range k.db.Entries {
+		if entryMatches(e.Principal.Realm, e.Principal.Components, pn, realm) && int(e.KVNO) > kvno {
+			kvno = int(e.KVNO)
+		}
+	}
+	return kvno
+}
+
+// hasPrincipal indicates if the principal is in the KDC's database.
+func (k *KDC) hasPrincipal(pn types.PrincipalName, realm string) bool {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	return k.kvno(pn, realm) > 0
+}
+
+// principalKey returns the principal's latest key of the first of the encryption types it has a key for.
+func (k *KDC) principalKey(pn types.PrincipalName, realm string, etypes []int32) (types.EncryptionKey, int, error) {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	for _, et := range etypes {
+		key, kvno, err := k.db.GetEncryptionKey(pn, realm, 0, et)
+		if err == nil {
+			return key, kvno, nil
+		}
+	}
+	return types.EncryptionKey{}, 0, fmt.Errorf("no key for %s@%s of encryption types %v", pn.PrincipalNameString(), realm, etypes)
+}
+
+// principalKeyVersion returns the principal's key of the key version number and encryption type specified.
+func (k *KDC) principalKeyVersion(pn types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, error) {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	key, _, err := k.db.GetEncryptionKey(pn, realm, kvno, etype)
+	return key, err
+}
+
+func entryMatches(realm string, components []string, pn types.PrincipalName, r string) bool {
+	if realm != r || len(components) != len(pn.NameString) {
+		return false
+	}
+	for i, n := range components {
+		if pn.NameString[i] != n {
+			return false
+		}
+	}
+	return true
+}
+
+func randomPassword() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("error generating random password: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,269 @@
+package kdc
+
+// Reference: https://tools.ietf.org/html/rfc6113
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// fastCookie is the value of the PA-FX-COOKIE the KDC sends with FAST errors. As the KDC holds no state between the
+// requests of a client the cookie is fixed, however clients must return it with their encrypted challenge.
+var fastCookie = []byte("gokrb5 test KDC")
+
+// fastArmor holds the armor key and the decrypted inner request of a FAST armored request.
+type fastArmor struct {
+	key types.EncryptionKey
+	req messages.KrbFastReq
+}
+
+// asArmor verifies the PA-FX-FAST of an AS_REQ, which must be armored with an AP_REQ for a TGT of the KDC's realm, and
+// returns its armor key and inner request.
+func (k *KDC) asArmor(req messages.ASReq) (*fastArmor, error) {
+	a, err := fastArmoredReq(req.PAData)
+	if err != nil {
+		return nil, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "%v", err)
+	}
+	if a.Armor.ArmorType != messages.FXFastArmorAPRequest {
+		return nil, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "FAST armor type %d is not supported", a.Armor.ArmorType)
+	}
+	var apReq messages.APReq
+	err = apReq.Unmarshal(a.Armor.ArmorValue)
+	if err != nil {
+		return nil, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "could not unmarshal FAST armor AP_REQ: %v", err)
+	}
+	if !k.isTGT(apReq.Ticket) {
+		return nil, k.krbError(errorcode.KRB_AP_ERR_NOT_US, "FAST armor ticket is not a TGT for realm %s", k.realm)
+	}
+	err = k.verifyAPReq(&apReq, keyusage.AP_REQ_AUTHENTICATOR)
+	if err != nil {
+		return nil, err
+	}
+	bb, err := req.ReqBody.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return k.fastArmor(a, apReq, bb)
+}
+
+// tgsArmor verifies the PA-FX-FAST of a TGS_REQ, which is armored with the subkey of the authenticator of its verified
+// PA-TGS-REQ, and returns its armor key and inner request.
+func (k *KDC) tgsArmor(req messages.TGSReq, apReq messages.APReq, apb []byte) (*fastArmor, error) {
+	a, err := fastArmoredReq(req.PAData)
+	if err != nil {
+		return nil, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "%v", err)
+	}
+	if a.Armor.ArmorType != 0 {
+		return nil, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "TGS_REQ FAST armor must be implicit")
+	}
+	return k.fastArmor(a, apReq, apb)
+}
+
+// fastArmor derives the armor key from the AP_REQ, which must have an authenticator subkey, verifies the request
+// checksum over the data provided and decrypts the inner request.
+func (k *KDC) fastArmor(a messages.KrbFastArmoredReq, apReq messages.APReq, chksumData []byte) (*fastArmor, error) {
+	if len(apReq.Authenticator.SubKey.KeyValue) < 1 {
+		return nil, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "FAST armor authenticator has no subkey")
+	}
+	key, err := crypto.KRBFXCF2(apReq.Authenticator.SubKey, apReq.Ticket.DecryptedEncPart.Key, "subkeyarmor", "ticketarmor")
+	if err != nil {
+		return nil, err
+	}
+	if !a.VerifyChecksum(key, chksumData) {
+		return nil, k.krbError(errorcode.KRB_AP_ERR_MODIFIED, "FAST request checksum is not valid")
+	}
+	err = a.DecryptEncPart(key)
+	if err != nil {
+		return nil, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "%v", err)
+	}
+	return &fastArmor{key: key, req: a.DecryptedEncPart}, nil
+}
+
+// fastArmoredReq returns the KrbFastArmoredReq of the PA-FX-FAST within the PAData.
+func fastArmoredReq(pas types.PADataSequence) (messages.KrbFastArmoredReq, error) {
+	var a messages.KrbFastArmoredReq
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_FX_FAST {
+			return a, a.Unmarshal(pa.PADataValue)
+		}
+	}
+	return a, nil
+}
+
+// verifyEncryptedChallenge checks the client's PA-ENCRYPTED-CHALLENGE of a FAST armored AS_REQ is encrypted with the
+// key derived from the armor key and the client's key, and within the allowed clock skew. The client's key is returned.
+func (k *KDC) verifyEncryptedChallenge(body messages.KDCReqBody, padata types.PADataSequence, fast *fastArmor) (types.EncryptionKey, error) {
+	var ed types.EncryptedData
+	var cookie []byte
+	for _, pa := range padata {
+		switch pa.PADataType {
+		case patype.PA_ENCRYPTED_CHALLENGE:
+			err := ed.Unmarshal(pa.PADataValue)
+			if err != nil {
+				return types.EncryptionKey{}, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "could not unmarshal PA-ENCRYPTED-CHALLENGE: %v", err)
+			}
+		case patype.PA_FX_COOKIE:
+			cookie = pa.PADataValue
+		}
+	}
+	if !bytes.Equal(cookie, fastCookie) {
+		return types.EncryptionKey{}, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "encrypted challenge without the KDC's FAST cookie")
+	}
+	key, _, err := k.principalKey(body.CName, k.realm, []int32{ed.EType})
+	if err != nil {
+		return key, k.krbError(errorcode.KDC_ERR_ETYPE_NOSUPP, "client has no key of the PA-ENCRYPTED-CHALLENGE encryption type: %v", err)
+	}
+	challengeKey, err := crypto.KRBFXCF2(fast.key, key, "clientchallengearmor", "challengelongterm")
+	if err != nil {
+		return key, err
+	}
+	b, err := crypto.DecryptEncPart(ed, challengeKey, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT)
+	if err != nil {
+		return key, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "could not decrypt PA-ENCRYPTED-CHALLENGE")
+	}
+	var ts types.PAEncTSEnc
+	err = ts.Unmarshal(b)
+	if err != nil {
+		return key, k.krbError(errorcode.KDC_ERR_PREAUTH_FAILED, "could not unmarshal PA-ENC-TS-ENC: %v", err)
+	}
+	if !k.withinSkew(ts.PATimestamp) {
+		return key, k.krbError(errorcode.KRB_AP_ERR_SKEW, "encrypted challenge timestamp is outside the allowed clock skew")
+	}
+	return key, nil
+}
+
+// kdcEncryptedChallenge returns the KDC's PA-ENCRYPTED-CHALLENGE, which authenticates the KDC to the client, encrypted
+// with the key derived from the armor key and the client's key.
+func kdcEncryptedChallenge(armorKey, clientKey types.EncryptionKey) (types.PAData, error) {
+	challengeKey, err := crypto.KRBFXCF2(armorKey, clientKey, "kdcchallengearmor", "challengelongterm")
+	if err != nil {
+		return types.PAData{}, err
+	}
+	b, err := types.GetPAEncTSEncAsnMarshalled()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	ed, err := crypto.GetEncryptedData(b, challengeKey, keyusage.KEY_USAGE_ENC_CHALLENGE_KDC, 0)
+	if err != nil {
+		return types.PAData{}, err
+	}
+	b, err = ed.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return types.PAData{PADataType: patype.PA_ENCRYPTED_CHALLENGE, PADataValue: b}, nil
+}
+
+// strengthenReplyKey generates a strengthen key and returns it with the reply key strengthened with it.
+func strengthenReplyKey(replyKey types.EncryptionKey) (types.EncryptionKey, types.EncryptionKey, error) {
+	et, err := crypto.GetEtype(replyKey.KeyType)
+	if err != nil {
+		return types.EncryptionKey{}, replyKey, err
+	}
+	strengthenKey, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		return strengthenKey, replyKey, err
+	}
+	replyKey, err = crypto.KRBFXCF2(strengthenKey, replyKey, "strengthenkey", "replykey")
+	return strengthenKey, replyKey, err
+}
+
+// fastReply returns the PA-FX-FAST of the reply to a FAST armored request, with the PAData and strengthen key provided
+// and the finished checksum of the ticket issued.
+func (k *KDC) fastReply(fast *fastArmor, pas types.PADataSequence, strengthenKey types.EncryptionKey, tkt messages.Ticket, crealm string, cname types.PrincipalName) (types.PAData, error) {
+	b, err := tkt.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	et, err := crypto.GetEtype(fast.key.KeyType)
+	if err != nil {
+		return types.PAData{}, err
+	}
+	cb, err := et.GetChecksumHash(fast.key.KeyValue, b, keyusage.KEY_USAGE_FAST_FINISHED)
+	if err != nil {
+		return types.PAData{}, err
+	}
+	now := time.Now().UTC()
+	a, err := messages.NewKrbFastArmoredRep(fast.key, messages.KrbFastResponse{
+		PAData:        pas,
+		StrengthenKey: strengthenKey,
+		Finished: messages.KrbFastFinished{
+			Timestamp:      now.Truncate(time.Second),
+			Usec:           now.Nanosecond() / int(time.Microsecond),
+			CRealm:         crealm,
+			CName:          cname,
+			TicketChecksum: types.Checksum{CksumType: et.GetHashID(), Checksum: cb},
+		},
+		Nonce: fast.req.ReqBody.Nonce,
+	})
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return a.PAData()
+}
+
+// fastError returns the error for a FAST armored request, which carries the error in the PA-FX-ERROR of the armored
+// reply within its e-data, together with the KDC's cookie and the PAData of the error.
+func (k *KDC) fastError(kerr messages.KRBError, fast *fastArmor) error {
+	var pas types.PADataSequence
+	if len(kerr.EData) > 0 && pas.Unmarshal(kerr.EData) != nil {
+		pas = nil
+	}
+	if kerr.ErrorCode == errorcode.KDC_ERR_PREAUTH_REQUIRED {
+		pas = append(pas, types.PAData{PADataType: patype.PA_ENCRYPTED_CHALLENGE})
+	}
+	pas = append(pas, types.PAData{PADataType: patype.PA_FX_COOKIE, PADataValue: fastCookie})
+	inner := kerr
+	inner.EData = nil
+	b, err := inner.Marshal()
+	if err != nil {
+		return err
+	}
+	pas = append(pas, types.PAData{PADataType: patype.PA_FX_ERROR, PADataValue: b})
+	a, err := messages.NewKrbFastArmoredRep(fast.key, messages.KrbFastResponse{PAData: pas, Nonce: fast.req.ReqBody.Nonce})
+	if err != nil {
+		return err
+	}
+	pa, err := a.PAData()
+	if err != nil {
+		return err
+	}
+	kerr.EData, err = asn1.Marshal(types.PADataSequence{pa})
+	if err != nil {
+		return err
+	}
+	return kerr
+}
+
+// encPAData returns the encrypted PAData of an AS_REP in reply to an AS_REQ that has PA-REQ-ENC-PA-REP, which
+// advertises FAST support and holds the checksum of the AS_REQ as it was sent, as defined in RFC 6806.
+func encPAData(req messages.ASReq, replyKey types.EncryptionKey) (types.PADataSequence, error) {
+	b, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	et, err := crypto.GetEtype(replyKey.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	cb, err := et.GetChecksumHash(replyKey.KeyValue, b, keyusage.KEY_USAGE_AS_REQ)
+	if err != nil {
+		return nil, err
+	}
+	pb, err := asn1.Marshal(types.PAReqEncPARep{ChksumType: et.GetHashID(), Chksum: cb})
+	if err != nil {
+		return nil, err
+	}
+	return types.PADataSequence{
+		{PADataType: patype.PA_REQ_ENC_PA_REP, PADataValue: pb},
+		{PADataType: patype.PA_FX_FAST},
+	}, nil
+}
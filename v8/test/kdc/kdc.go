@@ -0,0 +1,170 @@
+// Package kdc provides a Kerberos KDC that runs in-process for testing.
+//
+// The KDC supports the AS exchange, with encrypted timestamp pre-authentication, PKINIT and anonymous PKINIT, the TGS
+// exchange, including ticket renewal and server referrals to realms it has a cross-realm trust with, FAST armoring of
+// both exchanges with encrypted challenge pre-authentication, and password changes with the kpasswd protocol defined in
+// RFC 3244. Principals are added with a password or from a keytab and held in memory. S4U and user-to-user exchanges
+// are not supported.
+//
+// It allows applications and libraries using Kerberos to exercise real protocol exchanges without any external
+// services:
+//
+//	k, err := kdc.New("TEST.GOKRB5")
+//	k.AddPrincipal("testuser1", "passwordvalue")
+//	err = k.Start()
+//	defer k.Close()
+//	cfg, err := k.Config()
+//	cl := client.NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", cfg)
+package kdc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+const (
+	krbtgtNameType = nametype.KRB_NT_SRV_INST
+	// kpasswdService is the principal password change tickets are issued for.
+	kpasswdService = "kadmin/changepw"
+)
+
+// KDC is an in-process Kerberos KDC for a single realm.
+type KDC struct {
+	realm     string
+	settings  *Settings
+	mux       sync.RWMutex
+	db        *keytab.Keytab
+	trusts    map[string]*KDC
+	listeners []io.Closer
+	wg        sync.WaitGroup
+	addr      string
+	kpAddr    string
+}
+
+// New creates a KDC for the realm. The realm's krbtgt and kadmin/changepw principals are created with random
+// passwords unless they are in a keytab configured with the Keytab setting.
+func New(realm string, settings ...func(*Settings)) (*KDC, error) {
+	k := &KDC{
+		realm:    realm,
+		settings: NewSettings(settings...),
+		db:       keytab.New(),
+		trusts:   make(map[string]*KDC),
+	}
+	if len(k.settings.EncTypes()) < 1 {
+		return nil, fmt.Errorf("KDC for %s has no encryption types configured", realm)
+	}
+	if k.settings.keytab != nil {
+		k.AddKeytab(k.settings.keytab)
+	}
+	for _, name := range []string{"krbtgt/" + realm, kpasswdService} {
+		pn := types.NewPrincipalName(krbtgtNameType, name)
+		if k.hasPrincipal(pn, realm) {
+			continue
+		}
+		password, err := randomPassword()
+		if err != nil {
+			return nil, err
+		}
+		k.mux.Lock()
+		err = k.setPassword(pn, realm, password)
+		k.mux.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Realm returns the name of the KDC's realm.
+func (k *KDC) Realm() string {
+	return k.realm
+}
+
+// Handle processes the AS_REQ or TGS_REQ message provided and returns the reply. A KRB_ERROR is returned if the
+// request fails.
+func (k *KDC) Handle(b []byte) []byte {
+	var rb []byte
+	var err error
+	var asReq messages.ASReq
+	var tgsReq messages.TGSReq
+	if e := asReq.Unmarshal(b); e == nil {
+		rb, err = k.asExchange(asReq)
+	} else if e := tgsReq.Unmarshal(b); e == nil {
+		rb, err = k.tgsExchange(tgsReq)
+	} else {
+		err = k.krbError(errorcode.KRB_AP_ERR_MSG_TYPE, "message is not an AS_REQ or TGS_REQ")
+	}
+	if err != nil {
+		k.log("request failed: %v", err)
+		kerr, ok := err.(messages.KRBError)
+		if !ok {
+			kerr = k.krbError(errorcode.KRB_ERR_GENERIC, "%v", err)
+		}
+		rb, err = kerr.Marshal()
+		if err != nil {
+			k.log("error marshaling KRB_ERROR: %v", err)
+			return nil
+		}
+	}
+	return rb
+}
+
+// KRB5Conf returns a krb5.conf configuration for clients of the KDC, which must have been started. The realms of KDCs
+// trusted with Trust are included so that referrals to them can be followed, however the domains of their realms are
+// not mapped so that the referrals are exercised.
+func (k *KDC) KRB5Conf() string {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	var s strings.Builder
+	fmt.Fprintf(&s, "[libdefaults]\n  default_realm = %s\n  dns_lookup_kdc = false\n  dns_lookup_realm = false\n\n", k.realm)
+	fmt.Fprintf(&s, "[realms]\n  %s = {\n    kdc = %s\n    kpasswd_server = %s\n  }\n", k.realm, k.addr, k.kpAddr)
+	for _, t := range k.trusts {
+		fmt.Fprintf(&s, "  %s = {\n    kdc = %s\n    kpasswd_server = %s\n  }\n", t.realm, t.Addr(), t.KPasswdAddr())
+	}
+	d := strings.ToLower(k.realm)
+	fmt.Fprintf(&s, "\n[domain_realm]\n  .%s = %s\n  %s = %s\n", d, k.realm, d, k.realm)
+	return s.String()
+}
+
+// Config returns the client configuration for the KDC, which must have been started.
+func (k *KDC) Config() (*config.Config, error) {
+	return config.NewFromString(k.KRB5Conf())
+}
+
+// referralRealm returns the realm of a trusted KDC the host of the service principal is within, if there is one.
+func (k *KDC) referralRealm(sname types.PrincipalName) (string, bool) {
+	if len(sname.NameString) < 2 {
+		return "", false
+	}
+	host := strings.ToLower(strings.TrimSuffix(sname.NameString[len(sname.NameString)-1], "."))
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	for realm := range k.trusts {
+		d := strings.ToLower(realm)
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return realm, true
+		}
+	}
+	return "", false
+}
+
+// krbError returns a KRB_ERROR from the KDC.
+func (k *KDC) krbError(code int32, format string, v ...interface{}) messages.KRBError {
+	return messages.NewKRBError(types.NewPrincipalName(krbtgtNameType, "krbtgt/"+k.realm), k.realm, code, fmt.Sprintf(format, v...))
+}
+
+// log will write to the KDC's logger if it is configured.
+func (k *KDC) log(format string, v ...interface{}) {
+	if k.settings.Logger() != nil {
+		k.settings.Logger().Output(2, fmt.Sprintf(format, v...))
+	}
+}
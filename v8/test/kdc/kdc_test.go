@@ -0,0 +1,363 @@
+package kdc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	stdasn1 "encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4556"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRealm    = "TEST.GOKRB5"
+	testUser     = "testuser1"
+	testPassword = "passwordvalue"
+	testSPN      = "HTTP/host.test.gokrb5"
+)
+
+func testKDC(t *testing.T, realm string, settings ...func(*Settings)) *KDC {
+	k, err := New(realm, settings...)
+	if err != nil {
+		t.Fatalf("error creating KDC: %v", err)
+	}
+	err = k.AddPrincipal(testUser, testPassword)
+	if err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	err = k.AddPrincipal(testSPN, "servicepassword")
+	if err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	err = k.Start()
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	t.Cleanup(func() { k.Close() })
+	return k
+}
+
+func testCertificate(t *testing.T, cn string, eku stdasn1.ObjectIdentifier, exts ...pkix.Extension) (*x509.Certificate, crypto.Signer) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:       big.NewInt(time.Now().UnixNano()),
+		Subject:            pkix.Name{CommonName: cn},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(time.Hour),
+		KeyUsage:           x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		UnknownExtKeyUsage: []stdasn1.ObjectIdentifier{eku},
+		ExtraExtensions:    exts,
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	return cert, key
+}
+
+func TestKDC_Login(t *testing.T) {
+	t.Parallel()
+	for _, preAuth := range []bool{false, true} {
+		k := testKDC(t, testRealm, RequirePreAuth(preAuth))
+		cfg, err := k.Config()
+		if err != nil {
+			t.Fatalf("error loading KDC config: %v", err)
+		}
+		cl := client.NewWithPassword(testUser, testRealm, testPassword, cfg)
+		err = cl.Login()
+		if err != nil {
+			t.Fatalf("error logging in with pre-auth required %t: %v", preAuth, err)
+		}
+		cl.Destroy()
+
+		cl = client.NewWithPassword(testUser, testRealm, "wrongpassword", cfg, client.DisablePAFXFAST(true))
+		err = cl.Login()
+		assert.Error(t, err, "login with the wrong password should fail with pre-auth required %t", preAuth)
+
+		cl = client.NewWithPassword("unknownuser", testRealm, testPassword, cfg, client.DisablePAFXFAST(true))
+		err = cl.Login()
+		assert.Error(t, err, "login of an unknown principal should fail")
+	}
+}
+
+func TestKDC_ServiceTicket(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t, testRealm, RequirePreAuth(true))
+	cfg, err := k.Config()
+	if err != nil {
+		t.Fatalf("error loading KDC config: %v", err)
+	}
+	ckt, err := k.Keytab(testUser)
+	if err != nil {
+		t.Fatalf("error getting client keytab: %v", err)
+	}
+	cl := client.NewWithKeytab(testUser, testRealm, ckt, cfg, client.DisablePAFXFAST(true))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in with keytab: %v", err)
+	}
+	defer cl.Destroy()
+	tkt, key, err := cl.GetServiceTicket(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	skt, err := k.Keytab(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	err = tkt.DecryptEncPart(skt, &tkt.SName)
+	if err != nil {
+		t.Fatalf("service could not decrypt ticket: %v", err)
+	}
+	assert.Equal(t, testUser, tkt.DecryptedEncPart.CName.PrincipalNameString(), "client name in ticket not as expected")
+	assert.Equal(t, key, tkt.DecryptedEncPart.Key, "session key in ticket not as expected")
+	assert.True(t, types.IsFlagSet(&tkt.DecryptedEncPart.Flags, flags.PreAuthent), "pre-authent flag should be set")
+
+	_, _, err = cl.GetServiceTicket("HTTP/unknown.test.gokrb5")
+	assert.Error(t, err, "ticket for an unknown service should not be issued")
+}
+
+func TestKDC_Referral(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t, testRealm)
+	other := testKDC(t, "OTHER.GOKRB5")
+	err := other.AddPrincipal("HTTP/host.other.gokrb5", "otherpassword")
+	if err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	err = k.Trust(other)
+	if err != nil {
+		t.Fatalf("error establishing trust: %v", err)
+	}
+	cfg, err := k.Config()
+	if err != nil {
+		t.Fatalf("error loading KDC config: %v", err)
+	}
+	cl := client.NewWithPassword(testUser, testRealm, testPassword, cfg, client.DisablePAFXFAST(true))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	defer cl.Destroy()
+	tkt, _, err := cl.GetServiceTicket("HTTP/host.other.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket by referral: %v", err)
+	}
+	assert.Equal(t, "OTHER.GOKRB5", tkt.Realm, "ticket should be issued by the referred realm")
+	skt, err := other.Keytab("HTTP/host.other.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	err = tkt.DecryptEncPart(skt, &tkt.SName)
+	if err != nil {
+		t.Fatalf("service could not decrypt ticket: %v", err)
+	}
+	assert.Equal(t, testRealm, tkt.DecryptedEncPart.CRealm, "client realm in ticket not as expected")
+}
+
+func TestKDC_ChangePasswd(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t, testRealm, RequirePreAuth(true))
+	cfg, err := k.Config()
+	if err != nil {
+		t.Fatalf("error loading KDC config: %v", err)
+	}
+	cl := client.NewWithPassword(testUser, testRealm, testPassword, cfg, client.DisablePAFXFAST(true))
+	ok, err := cl.ChangePasswd("newpasswordvalue")
+	if err != nil || !ok {
+		t.Fatalf("error changing password: %v", err)
+	}
+	kt, err := k.Keytab(testUser)
+	if err != nil {
+		t.Fatalf("error getting client keytab: %v", err)
+	}
+	assert.Equal(t, uint32(2), kt.Entries[0].KVNO, "key version number should be incremented")
+
+	cl = client.NewWithPassword(testUser, testRealm, "newpasswordvalue", cfg, client.DisablePAFXFAST(true))
+	err = cl.Login()
+	assert.NoError(t, err, "login with the new password should succeed")
+	cl = client.NewWithPassword(testUser, testRealm, testPassword, cfg, client.DisablePAFXFAST(true))
+	err = cl.Login()
+	assert.Error(t, err, "login with the old password should fail")
+}
+
+func TestKDC_PKINIT(t *testing.T) {
+	t.Parallel()
+	clientCert, clientKey := testCertificate(t, testUser, stdasn1.ObjectIdentifier(rfc4556.OIDPKINITKPClientAuth))
+	san, err := rfc4556.PrincipalNameExtension(rfc4556.KRB5PrincipalName{
+		Realm:         testRealm,
+		PrincipalName: types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+testRealm),
+	})
+	if err != nil {
+		t.Fatalf("error creating id-pkinit-san extension: %v", err)
+	}
+	kdcCert, kdcKey := testCertificate(t, "kdc", stdasn1.ObjectIdentifier(rfc4556.OIDPKINITKPKdc), san)
+	clientRoots := x509.NewCertPool()
+	clientRoots.AddCert(clientCert)
+	kdcRoots := x509.NewCertPool()
+	kdcRoots.AddCert(kdcCert)
+	k := testKDC(t, testRealm, RequirePreAuth(true), PKINIT([]*x509.Certificate{kdcCert}, kdcKey, clientRoots), Anonymous(true))
+	cfg, err := k.Config()
+	if err != nil {
+		t.Fatalf("error loading KDC config: %v", err)
+	}
+
+	for _, g := range []rfc4556.Group{rfc4556.MODP2048, rfc4556.P256} {
+		cl := client.NewWithCertificate(testUser, testRealm, []*x509.Certificate{clientCert}, clientKey, cfg,
+			client.DisablePAFXFAST(true), client.PKINITTrustPool(kdcRoots), client.PKINITKeyAgreement(g))
+		err = cl.Login()
+		if err != nil {
+			t.Fatalf("error logging in with PKINIT: %v", err)
+		}
+		_, _, err = cl.GetServiceTicket(testSPN)
+		assert.NoError(t, err, "error getting service ticket with PKINIT TGT")
+		cl.Destroy()
+	}
+
+	cl := client.NewAnonymous(testRealm, cfg, client.DisablePAFXFAST(true), client.PKINITTrustPool(kdcRoots))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in anonymously: %v", err)
+	}
+	defer cl.Destroy()
+	tkt, _, err := cl.GetServiceTicket(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service ticket with anonymous TGT: %v", err)
+	}
+	skt, err := k.Keytab(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	err = tkt.DecryptEncPart(skt, &tkt.SName)
+	if err != nil {
+		t.Fatalf("service could not decrypt ticket: %v", err)
+	}
+	assert.True(t, tkt.DecryptedEncPart.CName.IsAnonymous(), "ticket should be for the anonymous principal")
+	assert.True(t, types.IsFlagSet(&tkt.DecryptedEncPart.Flags, flags.Anonymous), "anonymous flag should be set")
+
+	otherCert, otherKey := testCertificate(t, "otheruser", stdasn1.ObjectIdentifier(rfc4556.OIDPKINITKPClientAuth))
+	cl = client.NewWithCertificate(testUser, testRealm, []*x509.Certificate{otherCert}, otherKey, cfg,
+		client.DisablePAFXFAST(true), client.PKINITTrustPool(kdcRoots))
+	err = cl.Login()
+	assert.Error(t, err, "login with an untrusted certificate should fail")
+
+	// Without a trust pool the KDC's certificate must chain to the pkinit_anchors of the configuration.
+	cl = client.NewAnonymous(testRealm, cfg, client.DisablePAFXFAST(true))
+	err = cl.Login()
+	assert.Error(t, err, "login without a trust pool or pkinit_anchors should fail")
+	anchors := filepath.Join(t.TempDir(), "kdc.pem")
+	err = ioutil.WriteFile(anchors, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: kdcCert.Raw}), 0600)
+	if err != nil {
+		t.Fatalf("error writing pkinit_anchors file: %v", err)
+	}
+	cfg.LibDefaults.PKINITAnchors = []string{"FILE:" + anchors}
+	cl = client.NewAnonymous(testRealm, cfg, client.DisablePAFXFAST(true))
+	err = cl.Login()
+	assert.NoError(t, err, "login with the KDC's certificate in the pkinit_anchors should succeed")
+	cl.Destroy()
+}
+
+func TestKDC_PKINIT_KDCPrincipal(t *testing.T) {
+	t.Parallel()
+	kdcCert, kdcKey := testCertificate(t, "kdc", stdasn1.ObjectIdentifier(rfc4556.OIDPKINITKPKdc))
+	kdcRoots := x509.NewCertPool()
+	kdcRoots.AddCert(kdcCert)
+	k := testKDC(t, testRealm, RequirePreAuth(true), PKINIT([]*x509.Certificate{kdcCert}, kdcKey, nil), Anonymous(true))
+	cfg, err := k.Config()
+	if err != nil {
+		t.Fatalf("error loading KDC config: %v", err)
+	}
+	cl := client.NewAnonymous(testRealm, cfg, client.DisablePAFXFAST(true), client.PKINITTrustPool(kdcRoots))
+	err = cl.Login()
+	assert.Error(t, err, "login with a KDC certificate without the id-pkinit-san should fail")
+
+	cl = client.NewAnonymous(testRealm, cfg, client.DisablePAFXFAST(true), client.PKINITTrustPool(kdcRoots),
+		client.PKINITRequireKDCPrincipal(false))
+	err = cl.Login()
+	assert.NoError(t, err, "login with a KDC certificate without the id-pkinit-san should succeed when not required")
+	cl.Destroy()
+}
+
+func TestKDC_FAST(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t, testRealm, RequirePreAuth(true), FAST(true))
+	err := k.AddPrincipal("host/armor.test.gokrb5", "armorpassword")
+	if err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	akt, err := k.Keytab("host/armor.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting armor keytab: %v", err)
+	}
+	cfg, err := k.Config()
+	if err != nil {
+		t.Fatalf("error loading KDC config: %v", err)
+	}
+	acl := client.NewWithKeytab("host/armor.test.gokrb5", testRealm, akt, cfg)
+	defer acl.Destroy()
+	cl := client.NewWithPassword(testUser, testRealm, testPassword, cfg, client.FASTArmor(acl), client.RequireFAST(true))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in with FAST: %v", err)
+	}
+	defer cl.Destroy()
+	tkt, _, err := cl.GetServiceTicket(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service ticket with FAST: %v", err)
+	}
+	skt, err := k.Keytab(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	err = tkt.DecryptEncPart(skt, &tkt.SName)
+	if err != nil {
+		t.Fatalf("service could not decrypt ticket: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&tkt.DecryptedEncPart.Flags, flags.PreAuthent), "pre-authent flag should be set")
+
+	cl = client.NewWithPassword(testUser, testRealm, "wrongpassword", cfg, client.FASTArmor(acl))
+	err = cl.Login()
+	assert.Error(t, err, "login with the wrong password should fail with FAST")
+
+	// A KDC that does not support FAST ignores the armor so its reply is not armored
+	k = testKDC(t, testRealm, RequirePreAuth(true))
+	cfg, err = k.Config()
+	if err != nil {
+		t.Fatalf("error loading KDC config: %v", err)
+	}
+	acl = client.NewWithPassword(testUser, testRealm, testPassword, cfg)
+	defer acl.Destroy()
+	cl = client.NewWithPassword(testUser, testRealm, testPassword, cfg, client.FASTArmor(acl))
+	err = cl.Login()
+	assert.Error(t, err, "login with FAST armor should fail with a KDC that does not support FAST")
+}
+
+func TestKDC_Handle(t *testing.T) {
+	t.Parallel()
+	k, err := New(testRealm)
+	if err != nil {
+		t.Fatalf("error creating KDC: %v", err)
+	}
+	var kerr messages.KRBError
+	err = kerr.Unmarshal(k.Handle([]byte{0x30, 0x00}))
+	assert.NoError(t, err, "reply to a malformed request should be a KRB_ERROR")
+}
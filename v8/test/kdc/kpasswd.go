@@ -0,0 +1,181 @@
+package kdc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/kadmin"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Reference: https://tools.ietf.org/html/rfc3244
+
+// Kpasswd result codes.
+const (
+	kpasswdSuccess           = 0
+	kpasswdMalformed         = 1
+	kpasswdHardError         = 2
+	kpasswdAuthError         = 3
+	kpasswdSoftError         = 4
+	kpasswdAccessDenied      = 5
+	kpasswdInitialFlagNeeded = 7
+)
+
+// kpasswdVersion is the protocol version number of a set password request. The reply always has version 1.
+const kpasswdVersion = 0xff80
+
+// HandleKPasswd processes the kpasswd change password request provided and returns the reply.
+func (k *KDC) HandleKPasswd(b []byte) []byte {
+	rb, err := k.kpasswd(b)
+	if err != nil {
+		k.log("kpasswd request failed: %v", err)
+	}
+	return rb
+}
+
+// kpasswd processes a change password request. The reply is always returned, carrying the result code of any error.
+func (k *KDC) kpasswd(b []byte) ([]byte, error) {
+	if len(b) < 6 {
+		return k.kpasswdError(kpasswdMalformed, "request is too short")
+	}
+	l := int(binary.BigEndian.Uint16(b[0:2]))
+	v := binary.BigEndian.Uint16(b[2:4])
+	al := int(binary.BigEndian.Uint16(b[4:6]))
+	if l != len(b) || 6+al > l {
+		return k.kpasswdError(kpasswdMalformed, "request length is not valid")
+	}
+	if v != 1 && v != kpasswdVersion {
+		return k.kpasswdError(kpasswdMalformed, fmt.Sprintf("protocol version %x is not supported", v))
+	}
+	var apReq messages.APReq
+	err := apReq.Unmarshal(b[6 : 6+al])
+	if err != nil {
+		return k.kpasswdError(kpasswdMalformed, "could not unmarshal AP_REQ")
+	}
+	if !apReq.Ticket.SName.Equal(types.NewPrincipalName(apReq.Ticket.SName.NameType, kpasswdService)) || apReq.Ticket.Realm != k.realm {
+		return k.kpasswdError(kpasswdAuthError, "ticket is not for "+kpasswdService)
+	}
+	if err := k.verifyAPReq(&apReq, keyusage.AP_REQ_AUTHENTICATOR); err != nil {
+		return k.kpasswdError(kpasswdAuthError, err.Error())
+	}
+	tkt := apReq.Ticket.DecryptedEncPart
+	if !types.IsFlagSet(&tkt.Flags, flags.Initial) {
+		return k.kpasswdError(kpasswdInitialFlagNeeded, "ticket was not issued by an AS exchange")
+	}
+	auth := apReq.Authenticator
+	if len(auth.SubKey.KeyValue) < 1 {
+		return k.kpasswdError(kpasswdAuthError, "authenticator does not have a subkey")
+	}
+
+	var priv messages.KRBPriv
+	err = priv.Unmarshal(b[6+al:])
+	if err != nil {
+		return k.kpasswdReply(apReq, kpasswdMalformed, "could not unmarshal KRB_PRIV")
+	}
+	err = priv.DecryptEncPart(auth.SubKey)
+	if err != nil {
+		return k.kpasswdReply(apReq, kpasswdAuthError, "could not decrypt KRB_PRIV")
+	}
+	var data kadmin.ChangePasswdData
+	if v == 1 {
+		data.NewPasswd = priv.DecryptedEncPart.UserData
+	} else {
+		_, err = asn1.Unmarshal(priv.DecryptedEncPart.UserData, &data)
+		if err != nil {
+			return k.kpasswdReply(apReq, kpasswdMalformed, "could not unmarshal ChangePasswdData")
+		}
+	}
+	if (len(data.TargName.NameString) > 0 && !data.TargName.Equal(tkt.CName)) || (data.TargRealm != "" && data.TargRealm != tkt.CRealm) {
+		return k.kpasswdReply(apReq, kpasswdAccessDenied, "only the client's own password can be changed")
+	}
+	if len(data.NewPasswd) < 1 {
+		return k.kpasswdReply(apReq, kpasswdSoftError, "password is empty")
+	}
+	if tkt.CRealm != k.realm || tkt.CName.IsAnonymous() {
+		return k.kpasswdReply(apReq, kpasswdAccessDenied, "client is not a principal of the realm")
+	}
+	k.mux.Lock()
+	err = k.setPassword(tkt.CName, k.realm, string(data.NewPasswd))
+	k.mux.Unlock()
+	if err != nil {
+		return k.kpasswdReply(apReq, kpasswdHardError, err.Error())
+	}
+	k.log("kpasswd: changed password of %s@%s", tkt.CName.PrincipalNameString(), k.realm)
+	rb, _ := k.kpasswdReply(apReq, kpasswdSuccess, "password changed")
+	return rb, nil
+}
+
+// kpasswdReply returns a reply to the authenticated request with the result code and string encrypted in a KRB_PRIV.
+// The result string is also returned as an error unless the result code is success.
+func (k *KDC) kpasswdReply(apReq messages.APReq, code uint16, result string) ([]byte, error) {
+	var rerr error
+	if code != kpasswdSuccess {
+		rerr = errors.New(result)
+	}
+	auth := apReq.Authenticator
+	apRep := messages.NewAPRep(messages.EncAPRepPart{
+		CTime:          auth.CTime,
+		Cusec:          auth.Cusec,
+		SequenceNumber: auth.SeqNumber,
+	})
+	err := apRep.EncryptEncPart(apReq.Ticket.DecryptedEncPart.Key)
+	if err != nil {
+		return k.kpasswdError(kpasswdHardError, err.Error())
+	}
+	ab, err := apRep.Marshal()
+	if err != nil {
+		return k.kpasswdError(kpasswdHardError, err.Error())
+	}
+	priv := messages.NewKRBPriv(messages.EncKrbPrivPart{
+		UserData:       kpasswdResult(code, result),
+		Timestamp:      auth.CTime,
+		Usec:           auth.Cusec,
+		SequenceNumber: auth.SeqNumber,
+	})
+	err = priv.EncryptEncPart(auth.SubKey)
+	if err != nil {
+		return k.kpasswdError(kpasswdHardError, err.Error())
+	}
+	pb, err := priv.Marshal()
+	if err != nil {
+		return k.kpasswdError(kpasswdHardError, err.Error())
+	}
+	return kpasswdMessage(ab, pb), rerr
+}
+
+// kpasswdError returns a reply, to a request that could not be authenticated, holding a KRB_ERROR with the result code
+// and string in its e-data. The result string is also returned as an error.
+func (k *KDC) kpasswdError(code uint16, result string) ([]byte, error) {
+	kerr := k.krbError(errorcode.KRB_ERR_GENERIC, "%s", result)
+	kerr.SName = types.NewPrincipalName(krbtgtNameType, kpasswdService)
+	kerr.EData = kpasswdResult(code, result)
+	eb, err := kerr.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return kpasswdMessage(nil, eb), errors.New(result)
+}
+
+// kpasswdMessage returns the reply message with the AP_REP, which is empty for an error, followed by the KRB_PRIV or
+// KRB_ERROR.
+func kpasswdMessage(apRep, msg []byte) []byte {
+	b := make([]byte, 6, 6+len(apRep)+len(msg))
+	binary.BigEndian.PutUint16(b[0:2], uint16(6+len(apRep)+len(msg)))
+	binary.BigEndian.PutUint16(b[2:4], 1)
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(apRep)))
+	b = append(b, apRep...)
+	return append(b, msg...)
+}
+
+// kpasswdResult returns the result code followed by the result string.
+func kpasswdResult(code uint16, result string) []byte {
+	b := make([]byte, 2, 2+len(result))
+	binary.BigEndian.PutUint16(b, code)
+	return append(b, result...)
+}
@@ -0,0 +1,187 @@
+package kdc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+)
+
+const (
+	// maxUDPReply is the largest reply sent over UDP, which is the size of the client's UDP read buffer.
+	// Larger replies are replaced with a KRB_ERR_RESPONSE_TOO_BIG error so the client retries over TCP.
+	maxUDPReply = 4096
+	// maxTCPMessage is the largest request accepted over TCP.
+	maxTCPMessage = 1 << 20
+	// connTimeout is the deadline for a TCP connection to send its request and receive the reply.
+	connTimeout = 10 * time.Second
+)
+
+// Start the KDC listening for KDC requests on TCP and UDP on the same port of the loopback interface, and for kpasswd
+// requests on another port.
+func (k *KDC) Start() error {
+	if k.Addr() != "" {
+		return fmt.Errorf("KDC for %s is already started", k.realm)
+	}
+	addr, err := k.listen(k.Handle)
+	if err != nil {
+		k.Close()
+		return fmt.Errorf("KDC for %s could not listen: %v", k.realm, err)
+	}
+	kpAddr, err := k.listen(k.HandleKPasswd)
+	if err != nil {
+		k.Close()
+		return fmt.Errorf("KDC for %s could not listen for kpasswd: %v", k.realm, err)
+	}
+	k.mux.Lock()
+	k.addr, k.kpAddr = addr, kpAddr
+	k.mux.Unlock()
+	k.log("KDC for %s listening on %s, kpasswd on %s", k.realm, addr, kpAddr)
+	return nil
+}
+
+// Close stops the KDC listening and waits for requests being processed to complete.
+func (k *KDC) Close() error {
+	var err error
+	for _, l := range k.listeners {
+		if e := l.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	k.wg.Wait()
+	k.listeners = nil
+	k.mux.Lock()
+	k.addr, k.kpAddr = "", ""
+	k.mux.Unlock()
+	return err
+}
+
+// Addr returns the host:port address the KDC is listening on for KDC requests.
+func (k *KDC) Addr() string {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	return k.addr
+}
+
+// KPasswdAddr returns the host:port address the KDC is listening on for kpasswd requests.
+func (k *KDC) KPasswdAddr() string {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	return k.kpAddr
+}
+
+// listen on TCP and on UDP on the same loopback port, retrying with another port if the UDP port is in use.
+func (k *KDC) listen(handler func([]byte) []byte) (string, error) {
+	var err error
+	for i := 0; i < 10; i++ {
+		var tl net.Listener
+		tl, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return "", err
+		}
+		var ul net.PacketConn
+		ul, err = net.ListenPacket("udp", tl.Addr().String())
+		if err != nil {
+			tl.Close()
+			continue
+		}
+		k.listeners = append(k.listeners, tl, ul)
+		k.wg.Add(2)
+		go k.serveTCP(tl, handler)
+		go k.serveUDP(ul, handler)
+		return tl.Addr().String(), nil
+	}
+	return "", err
+}
+
+// serveTCP accepts connections and replies to the requests on them until the listener is closed.
+func (k *KDC) serveTCP(l net.Listener, handler func([]byte) []byte) {
+	defer k.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				k.log("error accepting TCP connection: %v", err)
+			}
+			return
+		}
+		k.wg.Add(1)
+		go func(conn net.Conn) {
+			defer k.wg.Done()
+			defer conn.Close()
+			err := handleTCP(conn, handler)
+			if err != nil && !errors.Is(err, io.EOF) {
+				k.log("error handling TCP connection from %s: %v", conn.RemoteAddr(), err)
+			}
+		}(conn)
+	}
+}
+
+// handleTCP replies to the requests on the connection. RFC 4120 7.2.2 specifies the first 4 bytes of each message
+// indicate its length in big endian order.
+func handleTCP(conn net.Conn, handler func([]byte) []byte) error {
+	for {
+		err := conn.SetDeadline(time.Now().Add(connTimeout))
+		if err != nil {
+			return err
+		}
+		hb := make([]byte, 4)
+		_, err = io.ReadFull(conn, hb)
+		if err != nil {
+			return err
+		}
+		s := binary.BigEndian.Uint32(hb)
+		if s > maxTCPMessage {
+			return fmt.Errorf("request of %d bytes is too large", s)
+		}
+		b := make([]byte, s)
+		_, err = io.ReadFull(conn, b)
+		if err != nil {
+			return err
+		}
+		rb := handler(b)
+		if rb == nil {
+			return errors.New("no reply to request")
+		}
+		binary.BigEndian.PutUint32(hb, uint32(len(rb)))
+		_, err = conn.Write(append(hb, rb...))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// serveUDP replies to requests until the connection is closed.
+func (k *KDC) serveUDP(conn net.PacketConn, handler func([]byte) []byte) {
+	defer k.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				k.log("error reading UDP request: %v", err)
+			}
+			return
+		}
+		rb := handler(buf[:n])
+		if rb == nil {
+			continue
+		}
+		if len(rb) > maxUDPReply {
+			kerr := k.krbError(errorcode.KRB_ERR_RESPONSE_TOO_BIG, "reply of %d bytes is too large for UDP", len(rb))
+			rb, err = kerr.Marshal()
+			if err != nil {
+				k.log("error marshaling KRB_ERROR: %v", err)
+				continue
+			}
+		}
+		_, err = conn.WriteTo(rb, addr)
+		if err != nil {
+			k.log("error sending UDP reply to %s: %v", addr, err)
+		}
+	}
+}
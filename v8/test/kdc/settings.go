@@ -0,0 +1,194 @@
+package kdc
+
+import (
+	"crypto"
+	"crypto/x509"
+	"log"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+)
+
+// Settings holds optional KDC settings.
+type Settings struct {
+	keytab            *keytab.Keytab
+	requirePreAuth    bool
+	encTypes          []int32
+	maxTicketLifetime time.Duration
+	maxRenewLifetime  time.Duration
+	clockskew         time.Duration
+	pkinitCerts       []*x509.Certificate
+	pkinitSigner      crypto.Signer
+	pkinitClientRoots *x509.CertPool
+	anonymous         bool
+	fast              bool
+	logger            *log.Logger
+}
+
+// NewSettings creates a new KDC settings struct with the defaults applied.
+func NewSettings(settings ...func(*Settings)) *Settings {
+	s := &Settings{
+		encTypes: []int32{
+			etypeID.AES256_CTS_HMAC_SHA1_96,
+			etypeID.AES128_CTS_HMAC_SHA1_96,
+			etypeID.AES256_CTS_HMAC_SHA384_192,
+			etypeID.AES128_CTS_HMAC_SHA256_128,
+			etypeID.RC4_HMAC,
+		},
+		maxTicketLifetime: 10 * time.Hour,
+		maxRenewLifetime:  7 * 24 * time.Hour,
+		clockskew:         5 * time.Minute,
+	}
+	for _, set := range settings {
+		set(s)
+	}
+	return s
+}
+
+// Keytab used to configure the KDC with the keys of principals in the keytab provided, in addition to those added
+// with AddPrincipal. The keytab's entries are copied so the keytab provided is not modified by the KDC.
+//
+// k, err := kdc.New("TEST.GOKRB5", kdc.Keytab(kt))
+func Keytab(kt *keytab.Keytab) func(*Settings) {
+	return func(s *Settings) {
+		s.keytab = kt
+	}
+}
+
+// RequirePreAuth used to configure the KDC to require clients to pre-authenticate AS exchanges.
+//
+// k, err := kdc.New("TEST.GOKRB5", kdc.RequirePreAuth(true))
+func RequirePreAuth(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.requirePreAuth = b
+	}
+}
+
+// RequirePreAuth indicates if the KDC requires clients to pre-authenticate AS exchanges.
+func (s *Settings) RequirePreAuth() bool {
+	return s.requirePreAuth
+}
+
+// EncTypes used to configure the encryption types, in order of preference, of the keys the KDC generates for
+// principals added with a password. The default is the AES and RC4 encryption types.
+//
+// k, err := kdc.New("TEST.GOKRB5", kdc.EncTypes(etypeID.AES256_CTS_HMAC_SHA1_96))
+func EncTypes(ids ...int32) func(*Settings) {
+	return func(s *Settings) {
+		s.encTypes = ids
+	}
+}
+
+// EncTypes returns the encryption types, in order of preference, supported by the KDC.
+func (s *Settings) EncTypes() []int32 {
+	return s.encTypes
+}
+
+// MaxTicketLifetime used to configure the maximum lifetime of tickets issued by the KDC. The default is 10 hours.
+//
+// k, err := kdc.New("TEST.GOKRB5", kdc.MaxTicketLifetime(time.Minute))
+func MaxTicketLifetime(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.maxTicketLifetime = d
+	}
+}
+
+// MaxTicketLifetime returns the maximum lifetime of tickets issued by the KDC.
+func (s *Settings) MaxTicketLifetime() time.Duration {
+	return s.maxTicketLifetime
+}
+
+// MaxRenewLifetime used to configure the maximum time renewable tickets issued by the KDC can be renewed for.
+// The default is 7 days.
+//
+// k, err := kdc.New("TEST.GOKRB5", kdc.MaxRenewLifetime(time.Hour))
+func MaxRenewLifetime(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.maxRenewLifetime = d
+	}
+}
+
+// MaxRenewLifetime returns the maximum time renewable tickets issued by the KDC can be renewed for.
+func (s *Settings) MaxRenewLifetime() time.Duration {
+	return s.maxRenewLifetime
+}
+
+// Clockskew used to configure the maximum clock skew the KDC allows between itself and its clients.
+// The default is 5 minutes.
+//
+// k, err := kdc.New("TEST.GOKRB5", kdc.Clockskew(time.Minute))
+func Clockskew(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.clockskew = d
+	}
+}
+
+// Clockskew returns the maximum clock skew the KDC allows between itself and its clients.
+func (s *Settings) Clockskew() time.Duration {
+	return s.clockskew
+}
+
+// PKINIT used to configure the KDC to support PKINIT, as defined in RFC 4556. The KDC signs its replies with the
+// signer of its certificate, which is the first of the certificates provided. Client certificates must chain to the
+// roots provided and either have an id-pkinit-san for the client principal or a common name that is the client's
+// principal name.
+//
+// k, err := kdc.New("TEST.GOKRB5", kdc.PKINIT([]*x509.Certificate{kdcCert}, kdcKey, roots))
+func PKINIT(certs []*x509.Certificate, signer crypto.Signer, clientRoots *x509.CertPool) func(*Settings) {
+	return func(s *Settings) {
+		s.pkinitCerts = certs
+		s.pkinitSigner = signer
+		s.pkinitClientRoots = clientRoots
+	}
+}
+
+// PKINIT indicates if the KDC supports PKINIT.
+func (s *Settings) PKINIT() bool {
+	return len(s.pkinitCerts) > 0 && s.pkinitSigner != nil
+}
+
+// Anonymous used to configure the KDC to issue anonymous tickets to clients using anonymous PKINIT, as defined in
+// RFC 8062. PKINIT must also be configured.
+//
+// k, err := kdc.New("TEST.GOKRB5", kdc.PKINIT(certs, key, nil), kdc.Anonymous(true))
+func Anonymous(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.anonymous = b
+	}
+}
+
+// Anonymous indicates if the KDC issues anonymous tickets.
+func (s *Settings) Anonymous() bool {
+	return s.anonymous && s.PKINIT()
+}
+
+// FAST used to configure the KDC to support FAST, as defined in RFC 6113. Armored AS_REQs must be armored with a TGT
+// issued by the KDC and may use encrypted challenge pre-authentication. The KDC advertises FAST in the replies to
+// clients that request FAST negotiation, as defined in RFC 6806.
+//
+// k, err := kdc.New("TEST.GOKRB5", kdc.FAST(true))
+func FAST(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.fast = b
+	}
+}
+
+// FAST indicates if the KDC supports FAST.
+func (s *Settings) FAST() bool {
+	return s.fast
+}
+
+// Logger used to configure the KDC with a logger.
+//
+// k, err := kdc.New("TEST.GOKRB5", kdc.Logger(l))
+func Logger(l *log.Logger) func(*Settings) {
+	return func(s *Settings) {
+		s.logger = l
+	}
+}
+
+// Logger returns the KDC's logger instance.
+func (s *Settings) Logger() *log.Logger {
+	return s.logger
+}
@@ -0,0 +1,257 @@
+package kdc
+
+import (
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// tgsExchange processes a TGS_REQ and returns the marshaled TGS_REP.
+func (k *KDC) tgsExchange(req messages.TGSReq) ([]byte, error) {
+	apReq, apb, err := k.tgsAPReq(req)
+	if err != nil {
+		return nil, err
+	}
+	if !k.settings.FAST() || !req.PAData.Contains(patype.PA_FX_FAST) {
+		return k.tgsReply(req.ReqBody, apReq, nil)
+	}
+	fast, err := k.tgsArmor(req, apReq, apb)
+	if err != nil {
+		return nil, err
+	}
+	b, err := k.tgsReply(fast.req.ReqBody, apReq, fast)
+	if kerr, ok := err.(messages.KRBError); ok {
+		return nil, k.fastError(kerr, fast)
+	}
+	return b, err
+}
+
+// tgsAPReq returns the verified AP_REQ of the PA-TGS-REQ of the TGS_REQ, which must be for a TGT of the KDC's realm and
+// have a valid checksum of the TGS_REQ body, and its marshaled bytes.
+func (k *KDC) tgsAPReq(req messages.TGSReq) (messages.APReq, []byte, error) {
+	var apReq messages.APReq
+	var apb []byte
+	for _, pa := range req.PAData {
+		if pa.PADataType == patype.PA_TGS_REQ {
+			err := apReq.Unmarshal(pa.PADataValue)
+			if err != nil {
+				return apReq, nil, k.krbError(errorcode.KRB_AP_ERR_MSG_TYPE, "could not unmarshal PA-TGS-REQ: %v", err)
+			}
+			apb = pa.PADataValue
+			break
+		}
+	}
+	if apb == nil {
+		return apReq, nil, k.krbError(errorcode.KDC_ERR_PADATA_TYPE_NOSUPP, "TGS_REQ does not contain a PA-TGS-REQ")
+	}
+	tgt := &apReq.Ticket
+	if !k.isTGT(*tgt) {
+		return apReq, nil, k.krbError(errorcode.KRB_AP_ERR_NOT_US, "ticket for %s@%s is not a TGT for realm %s", tgt.SName.PrincipalNameString(), tgt.Realm, k.realm)
+	}
+	err := k.verifyAPReq(&apReq, keyusage.TGS_REQ_PA_TGS_REQ_AP_REQ_AUTHENTICATOR)
+	if err != nil {
+		return apReq, nil, err
+	}
+	auth := apReq.Authenticator
+	bb, err := req.ReqBody.Marshal()
+	if err != nil {
+		return apReq, nil, err
+	}
+	cksumEType, err := crypto.GetChksumEtype(auth.Cksum.CksumType)
+	if err != nil {
+		return apReq, nil, k.krbError(errorcode.KDC_ERR_SUMTYPE_NOSUPP, "%v", err)
+	}
+	if !cksumEType.VerifyChecksum(tgt.DecryptedEncPart.Key.KeyValue, bb, auth.Cksum.Checksum, keyusage.TGS_REQ_PA_TGS_REQ_AP_REQ_AUTHENTICATOR_CHKSUM) {
+		return apReq, nil, k.krbError(errorcode.KRB_AP_ERR_MODIFIED, "checksum of the TGS_REQ body is not valid")
+	}
+	return apReq, apb, nil
+}
+
+// tgsReply returns the marshaled TGS_REP for the request body, which is that within the FAST request if the TGS_REQ is
+// armored, and the verified AP_REQ of the TGS_REQ.
+func (k *KDC) tgsReply(body messages.KDCReqBody, apReq messages.APReq, fast *fastArmor) ([]byte, error) {
+	tgt := &apReq.Ticket
+	tgtPart := tgt.DecryptedEncPart
+	auth := apReq.Authenticator
+	sessionEType, ok := k.sessionEType(body.EType)
+	if !ok {
+		return nil, k.krbError(errorcode.KDC_ERR_ETYPE_NOSUPP, "none of the requested encryption types %v are supported", body.EType)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	sname := body.SName
+	etp := messages.EncTicketPart{
+		Flags:     types.NewKrbFlags(),
+		CRealm:    tgtPart.CRealm,
+		CName:     tgtPart.CName,
+		AuthTime:  tgtPart.AuthTime,
+		StartTime: now,
+		CAddr:     tgtPart.CAddr,
+	}
+	if len(body.Addresses) > 0 {
+		etp.CAddr = body.Addresses
+	}
+	if types.IsFlagSet(&body.KDCOptions, flags.Renew) {
+		if !types.IsFlagSet(&tgtPart.Flags, flags.Renewable) || now.After(tgtPart.RenewTill) {
+			return nil, k.krbError(errorcode.KDC_ERR_BADOPTION, "ticket is not renewable")
+		}
+		sname = tgt.SName
+		etp.Flags = tgtPart.Flags
+		etp.EndTime = now.Add(k.settings.MaxTicketLifetime())
+		if etp.EndTime.After(tgtPart.RenewTill) {
+			etp.EndTime = tgtPart.RenewTill
+		}
+		etp.RenewTill = tgtPart.RenewTill
+	} else {
+		if !k.hasPrincipal(sname, k.realm) {
+			realm, ok := k.referralRealm(sname)
+			if !ok {
+				return nil, k.krbError(errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, "service %s not found in realm %s", sname.PrincipalNameString(), k.realm)
+			}
+			// Server referral https://tools.ietf.org/html/rfc6806.html#section-8
+			sname = types.NewPrincipalName(krbtgtNameType, "krbtgt/"+realm)
+		}
+		k.tgsFlags(body, tgtPart, &etp.Flags)
+		maxRenew := time.Time{}
+		if types.IsFlagSet(&tgtPart.Flags, flags.Renewable) {
+			maxRenew = tgtPart.RenewTill
+		}
+		etp.EndTime, etp.RenewTill = k.ticketTimes(body, now, minTime(now.Add(k.settings.MaxTicketLifetime()), tgtPart.EndTime), maxRenew)
+		if !etp.RenewTill.IsZero() {
+			types.SetFlag(&etp.Flags, flags.Renewable)
+		}
+	}
+	tkt, sessionKey, err := k.newTicket(etp, sname, k.realm, sessionEType)
+	if err != nil {
+		return nil, err
+	}
+	replyKey, usage := tgtPart.Key, uint32(keyusage.TGS_REP_ENCPART_SESSION_KEY)
+	if len(auth.SubKey.KeyValue) > 0 {
+		replyKey, usage = auth.SubKey, keyusage.TGS_REP_ENCPART_AUTHENTICATOR_SUB_KEY
+	}
+	var strengthenKey types.EncryptionKey
+	if fast != nil {
+		strengthenKey, replyKey, err = strengthenReplyKey(replyKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	encPart, err := encKDCRepPart(messages.EncKDCRepPart{
+		Key:       sessionKey,
+		LastReqs:  []messages.LastReq{},
+		Nonce:     body.Nonce,
+		Flags:     etp.Flags,
+		AuthTime:  etp.AuthTime,
+		StartTime: etp.StartTime,
+		EndTime:   etp.EndTime,
+		RenewTill: etp.RenewTill,
+		SRealm:    k.realm,
+		SName:     sname,
+		CAddr:     etp.CAddr,
+	}, asnAppTag.EncTGSRepPart, replyKey, usage, 0)
+	if err != nil {
+		return nil, err
+	}
+	var pas types.PADataSequence
+	if fast != nil {
+		pa, err := k.fastReply(fast, nil, strengthenKey, tkt, tgtPart.CRealm, tgtPart.CName)
+		if err != nil {
+			return nil, err
+		}
+		pas = append(pas, pa)
+	}
+	rep := messages.TGSRep{
+		KDCRepFields: messages.KDCRepFields{
+			PVNO:    iana.PVNO,
+			MsgType: msgtype.KRB_TGS_REP,
+			PAData:  pas,
+			CRealm:  tgtPart.CRealm,
+			CName:   tgtPart.CName,
+			Ticket:  tkt,
+			EncPart: encPart,
+		},
+	}
+	k.log("TGS exchange: issued %s@%s a ticket for %s", tgtPart.CName.PrincipalNameString(), tgtPart.CRealm, sname.PrincipalNameString())
+	return rep.Marshal()
+}
+
+// tgsFlags sets the flags of a ticket issued in a TGS exchange from the options requested and the flags of the TGT.
+func (k *KDC) tgsFlags(body messages.KDCReqBody, tgtPart messages.EncTicketPart, f *asn1.BitString) {
+	for _, fl := range []int{flags.PreAuthent, flags.Anonymous} {
+		if types.IsFlagSet(&tgtPart.Flags, fl) {
+			types.SetFlag(f, fl)
+		}
+	}
+	if types.IsFlagSet(&tgtPart.Flags, flags.Forwarded) {
+		types.SetFlag(f, flags.Forwarded)
+	}
+	if types.IsFlagSet(&tgtPart.Flags, flags.Forwardable) {
+		if types.IsFlagSet(&body.KDCOptions, flags.Forwardable) {
+			types.SetFlag(f, flags.Forwardable)
+		}
+		if types.IsFlagSet(&body.KDCOptions, flags.Forwarded) {
+			types.SetFlag(f, flags.Forwarded)
+		}
+	}
+	if types.IsFlagSet(&tgtPart.Flags, flags.Proxiable) && types.IsFlagSet(&body.KDCOptions, flags.Proxiable) {
+		types.SetFlag(f, flags.Proxiable)
+	}
+}
+
+// verifyAPReq decrypts the ticket of the AP_REQ with the service's key and its authenticator with the ticket's session
+// key and the key usage provided, and checks that they match and are current.
+func (k *KDC) verifyAPReq(apReq *messages.APReq, usage uint32) error {
+	tkt := &apReq.Ticket
+	key, err := k.principalKeyVersion(tkt.SName, tkt.Realm, tkt.EncPart.KVNO, tkt.EncPart.EType)
+	if err != nil {
+		return k.krbError(errorcode.KRB_AP_ERR_NOKEY, "%v", err)
+	}
+	err = tkt.Decrypt(key)
+	if err != nil {
+		return k.krbError(errorcode.KRB_AP_ERR_BAD_INTEGRITY, "could not decrypt ticket: %v", err)
+	}
+	b, err := crypto.DecryptEncPart(apReq.EncryptedAuthenticator, tkt.DecryptedEncPart.Key, usage)
+	if err != nil {
+		return k.krbError(errorcode.KRB_AP_ERR_BAD_INTEGRITY, "could not decrypt authenticator: %v", err)
+	}
+	err = apReq.Authenticator.Unmarshal(b)
+	if err != nil {
+		return k.krbError(errorcode.KRB_AP_ERR_BAD_INTEGRITY, "could not unmarshal authenticator: %v", err)
+	}
+	if !apReq.Authenticator.CName.Equal(tkt.DecryptedEncPart.CName) {
+		return k.krbError(errorcode.KRB_AP_ERR_BADMATCH, "authenticator client %s does not match ticket client %s", apReq.Authenticator.CName.PrincipalNameString(), tkt.DecryptedEncPart.CName.PrincipalNameString())
+	}
+	if !k.withinSkew(apReq.Authenticator.CTime) {
+		return k.krbError(errorcode.KRB_AP_ERR_SKEW, "authenticator time is outside the allowed clock skew")
+	}
+	now := time.Now().UTC()
+	if tkt.DecryptedEncPart.StartTime.Sub(now) > k.settings.Clockskew() {
+		return k.krbError(errorcode.KRB_AP_ERR_TKT_NYV, "ticket is not yet valid")
+	}
+	if now.Sub(tkt.DecryptedEncPart.EndTime) > k.settings.Clockskew() {
+		return k.krbError(errorcode.KRB_AP_ERR_TKT_EXPIRED, "ticket has expired")
+	}
+	return nil
+}
+
+// isTGT indicates if the ticket is a TGT for the KDC's realm.
+func (k *KDC) isTGT(tkt messages.Ticket) bool {
+	return len(tkt.SName.NameString) == 2 && tkt.SName.NameString[0] == "krbtgt" && tkt.SName.NameString[1] == k.realm
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
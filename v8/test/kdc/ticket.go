@@ -0,0 +1,104 @@
+package kdc
+
+import (
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// newTicket generates a session key of the encryption type and returns a ticket for the service with the encrypted
+// part provided, encrypted with the service's key.
+func (k *KDC) newTicket(etp messages.EncTicketPart, sname types.PrincipalName, srealm string, etypeID int32) (messages.Ticket, types.EncryptionKey, error) {
+	et, err := crypto.GetEtype(etypeID)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	etp.Key, err = types.GenerateEncryptionKey(et)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	skey, kvno, err := k.principalKey(sname, srealm, k.settings.EncTypes())
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, k.krbError(errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, "%v", err)
+	}
+	b, err := asn1.Marshal(etp)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncTicketPart)
+	ed, err := crypto.GetEncryptedData(b, skey, keyusage.KDC_REP_TICKET, kvno)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	return messages.Ticket{
+		TktVNO:  iana.PVNO,
+		Realm:   srealm,
+		SName:   sname,
+		EncPart: ed,
+	}, etp.Key, nil
+}
+
+// encKDCRepPart marshals the encrypted part of a KDC reply with the application tag provided and encrypts it with the
+// reply key.
+func encKDCRepPart(part messages.EncKDCRepPart, tag int, key types.EncryptionKey, usage uint32, kvno int) (types.EncryptedData, error) {
+	b, err := asn1.Marshal(part)
+	if err != nil {
+		return types.EncryptedData{}, err
+	}
+	b = asn1tools.AddASNAppTag(b, tag)
+	return crypto.GetEncryptedData(b, key, usage, kvno)
+}
+
+// sessionEType returns the first of the requested encryption types supported by the KDC.
+func (k *KDC) sessionEType(requested []int32) (int32, bool) {
+	for _, r := range requested {
+		for _, et := range k.settings.EncTypes() {
+			if r == et {
+				return et, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// ticketTimes returns the end time and renew till time of a ticket for the request, limited by the maximums provided.
+// The renew till time is zero if the ticket is not renewable.
+func (k *KDC) ticketTimes(body messages.KDCReqBody, now, maxEnd, maxRenew time.Time) (endTime, renewTill time.Time) {
+	endTime = maxEnd
+	if !body.Till.IsZero() && body.Till.After(now) && body.Till.Before(maxEnd) {
+		endTime = body.Till.UTC()
+	}
+	renewable := types.IsFlagSet(&body.KDCOptions, flags.Renewable)
+	if types.IsFlagSet(&body.KDCOptions, flags.RenewableOK) && !body.Till.IsZero() && body.Till.After(maxEnd) {
+		renewable = true
+	}
+	if !renewable || !maxRenew.After(now) {
+		return endTime, time.Time{}
+	}
+	renewTill = maxRenew
+	if !body.RTime.IsZero() && body.RTime.After(now) && body.RTime.Before(maxRenew) {
+		renewTill = body.RTime.UTC()
+	}
+	if renewTill.Before(endTime) {
+		renewTill = endTime
+	}
+	return endTime, renewTill
+}
+
+// withinSkew indicates if the time is within the allowed clock skew of the KDC's time.
+func (k *KDC) withinSkew(t time.Time) bool {
+	d := time.Since(t)
+	if d < 0 {
+		d = -d
+	}
+	return d <= k.settings.Clockskew()
+}
@@ -30,7 +30,12 @@ type Authenticator struct {
 }
 
 // NewAuthenticator creates a new Authenticator.
+// The realm of an Authenticator for the anonymous principal is always the anonymous realm.
 func NewAuthenticator(realm string, cname PrincipalName) (Authenticator, error) {
+	if cname.IsAnonymous() {
+		// Anonymous tickets are issued to the anonymous principal in the anonymous realm
+		realm = AnonymousRealm
+	}
 	seq, err := rand.Int(rand.Reader, big.NewInt(math.MaxUint32))
 	if err != nil {
 		return Authenticator{}, err
@@ -15,6 +15,22 @@ type PrincipalName struct {
 	NameString []string `asn1:"generalstring,explicit,tag:1"`
 }
 
+// AnonymousRealm is the realm of the anonymous principal when the client's realm is not disclosed. RFC 8062 Section 3.
+const AnonymousRealm = "WELLKNOWN:ANONYMOUS"
+
+// NewAnonymousPrincipalName creates the well-known anonymous PrincipalName, WELLKNOWN/ANONYMOUS. RFC 8062 Section 3.
+func NewAnonymousPrincipalName() PrincipalName {
+	return PrincipalName{
+		NameType:   nametype.KRB_NT_WELLKNOWN,
+		NameString: []string{"WELLKNOWN", "ANONYMOUS"},
+	}
+}
+
+// IsAnonymous tests if the PrincipalName is the well-known anonymous principal name.
+func (pn PrincipalName) IsAnonymous() bool {
+	return pn.Equal(NewAnonymousPrincipalName())
+}
+
 // NewPrincipalName creates a new PrincipalName from the name type int32 and name string provided.
 func NewPrincipalName(ntype int32, spn string) PrincipalName {
 	return PrincipalName{
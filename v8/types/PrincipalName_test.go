@@ -35,3 +35,17 @@ func TestParseSPNString(t *testing.T) {
 	assert.Equal(t, "www.example.com", pn.NameString[0], "second element of name string not as expected")
 
 }
+
+func TestPrincipalName_IsAnonymous(t *testing.T) {
+	t.Parallel()
+	pn := NewAnonymousPrincipalName()
+	assert.True(t, pn.IsAnonymous(), "anonymous principal name not identified")
+	assert.Equal(t, "WELLKNOWN/ANONYMOUS", pn.PrincipalNameString(), "anonymous principal name string not as expected")
+	assert.False(t, NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "ANONYMOUS").IsAnonymous(), "principal name should not be anonymous")
+
+	a, err := NewAuthenticator("TEST.GOKRB5", pn)
+	if err != nil {
+		t.Fatalf("error creating authenticator: %v", err)
+	}
+	assert.Equal(t, AnonymousRealm, a.CRealm, "authenticator realm of the anonymous principal not as expected")
+}